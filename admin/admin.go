@@ -0,0 +1,272 @@
+// Package admin provides an http.Handler for inspecting and operating a gache in production, mount it behind
+// http.StripPrefix and guard it with WithAuth. All responses are JSON except the snapshot download.
+//
+//	GET    /keys/{key}        entry of key with its expiration and metadata
+//	DELETE /keys/{key}        deletes key
+//	DELETE /keys?prefix=p     deletes the keys starting with p
+//	GET    /stats             length, counters and last sweep and save
+//	GET    /shards            distribution score and length of each shard
+//	GET    /snapshot          streams a snapshot written by Write
+//	POST   /snapshot          writes a snapshot to the WithSnapshotPath file
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ntsd/gache/v2"
+)
+
+type (
+	// Option configures New
+	Option func(*config)
+
+	config struct {
+		auth         func(*http.Request) error
+		snapshotPath string
+	}
+
+	handler[V any] struct {
+		cache gache.Gache[V]
+		config
+	}
+
+	entry[V any] struct {
+		Key        string     `json:"key"`
+		Value      V          `json:"value"`
+		ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+		TTL        string     `json:"ttl,omitempty"`
+		CreatedAt  *time.Time `json:"created_at,omitempty"`
+		LastAccess *time.Time `json:"last_access,omitempty"`
+		Hits       uint64     `json:"hits,omitempty"`
+	}
+
+	stats struct {
+		Len       int         `json:"len"`
+		Frozen    bool        `json:"frozen"`
+		Hits      uint64      `json:"hits"`
+		Misses    uint64      `json:"misses"`
+		Sets      uint64      `json:"sets"`
+		Deletes   uint64      `json:"deletes"`
+		Expired   uint64      `json:"expired"`
+		Evictions uint64      `json:"evictions"`
+		Rejected  uint64      `json:"rejections"`
+		Stale     uint64      `json:"stale"`
+		LastSweep *sweep      `json:"last_sweep,omitempty"`
+		LastSave  *saveStatus `json:"last_save,omitempty"`
+	}
+
+	sweep struct {
+		At       time.Time `json:"at"`
+		Duration string    `json:"duration"`
+		Removed  uint64    `json:"removed"`
+	}
+
+	saveStatus struct {
+		Path     string    `json:"path"`
+		At       time.Time `json:"at"`
+		Duration string    `json:"duration"`
+		Bytes    int64     `json:"bytes"`
+		Error    string    `json:"error,omitempty"`
+		Saves    uint64    `json:"saves"`
+		Failures uint64    `json:"failures"`
+	}
+
+	shards struct {
+		Score float64                `json:"score"`
+		Lens  []int                  `json:"lens"`
+		Sweep []gache.ShardSweepStat `json:"sweep,omitempty"`
+	}
+
+	snapshot struct {
+		Path     string `json:"path"`
+		Bytes    int64  `json:"bytes"`
+		Duration string `json:"duration"`
+	}
+)
+
+// WithAuth calls auth before every request, a returned error is replied with 401 Unauthorized and its message
+func WithAuth(auth func(*http.Request) error) Option {
+	return func(c *config) {
+		c.auth = auth
+	}
+}
+
+// WithSnapshotPath enables POST /snapshot writing the snapshot to path, it is replaced atomically
+func WithSnapshotPath(path string) Option {
+	return func(c *config) {
+		c.snapshotPath = path
+	}
+}
+
+// New returns the admin handler of g, values are encoded with encoding/json
+func New[V any](g gache.Gache[V], opts ...Option) http.Handler {
+	h := &handler[V]{cache: g}
+	for _, opt := range opts {
+		opt(&h.config)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /keys/{key}", h.get)
+	mux.HandleFunc("DELETE /keys/{key}", h.delete)
+	mux.HandleFunc("DELETE /keys", h.deletePrefix)
+	mux.HandleFunc("GET /stats", h.stats)
+	mux.HandleFunc("GET /shards", h.shards)
+	mux.HandleFunc("GET /snapshot", h.download)
+	if h.snapshotPath != "" {
+		mux.HandleFunc("POST /snapshot", h.save)
+	}
+	if h.auth == nil {
+		return mux
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := h.auth(r); err != nil {
+			reply(w, http.StatusUnauthorized, map[string]string{"error": err.Error()})
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+func (h *handler[V]) get(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+	e, ok := h.cache.GetEntry(key)
+	if !ok {
+		reply(w, http.StatusNotFound, map[string]string{"error": "key not found"})
+		return
+	}
+	res := entry[V]{Key: key, Value: e.Value, Hits: e.Hits}
+	if e.Expire > 0 {
+		at := time.Unix(0, e.Expire)
+		res.ExpiresAt, res.TTL = &at, time.Until(at).Round(time.Millisecond).String()
+	}
+	if !e.CreatedAt.IsZero() {
+		res.CreatedAt, res.LastAccess = &e.CreatedAt, &e.LastAccess
+	}
+	reply(w, http.StatusOK, res)
+}
+
+func (h *handler[V]) delete(w http.ResponseWriter, r *http.Request) {
+	if _, ok := h.cache.Delete(r.PathValue("key")); !ok {
+		reply(w, http.StatusNotFound, map[string]string{"error": "key not found"})
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// deletePrefix requires a non empty prefix so a missing query does not clear the cache
+func (h *handler[V]) deletePrefix(w http.ResponseWriter, r *http.Request) {
+	prefix := r.URL.Query().Get("prefix")
+	if prefix == "" {
+		reply(w, http.StatusBadRequest, map[string]string{"error": "prefix query parameter required"})
+		return
+	}
+	reply(w, http.StatusOK, map[string]uint64{"deleted": h.cache.DeleteByPrefix(r.Context(), prefix)})
+}
+
+func (h *handler[V]) stats(w http.ResponseWriter, _ *http.Request) {
+	s := h.cache.Stats()
+	res := stats{
+		Len:       h.cache.Len(),
+		Frozen:    h.cache.IsFrozen(),
+		Hits:      s.Hits,
+		Misses:    s.Misses,
+		Sets:      s.Sets,
+		Deletes:   s.Deletes,
+		Expired:   s.Expired,
+		Evictions: s.Evictions,
+		Rejected:  s.Rejections,
+		Stale:     s.Stale,
+	}
+	if at, d, removed := h.cache.LastSweep(); !at.IsZero() {
+		res.LastSweep = &sweep{At: at, Duration: d.String(), Removed: removed}
+	}
+	if last := h.cache.LastSave(); !last.At.IsZero() {
+		res.LastSave = &saveStatus{
+			Path:     last.Path,
+			At:       last.At,
+			Duration: last.Duration.String(),
+			Bytes:    last.Bytes,
+			Saves:    last.Saves,
+			Failures: last.Failures,
+		}
+		if last.Err != nil {
+			res.LastSave.Error = last.Err.Error()
+		}
+	}
+	reply(w, http.StatusOK, res)
+}
+
+func (h *handler[V]) shards(w http.ResponseWriter, _ *http.Request) {
+	reply(w, http.StatusOK, shards{
+		Score: h.cache.DistributionScore(),
+		Lens:  h.cache.ShardLens(),
+		Sweep: h.cache.LastSweepPerShard(),
+	})
+}
+
+// download streams the snapshot, an error after the first byte can only be reported by truncating the response
+func (h *handler[V]) download(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", `attachment; filename="gache.snapshot"`)
+	if err := h.cache.Write(r.Context(), w); err != nil {
+		panic(http.ErrAbortHandler)
+	}
+}
+
+func (h *handler[V]) save(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	n, err := saveFile(r.Context(), h.cache, h.snapshotPath)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			status = http.StatusServiceUnavailable
+		}
+		reply(w, status, map[string]string{"error": err.Error()})
+		return
+	}
+	reply(w, http.StatusOK, snapshot{Path: h.snapshotPath, Bytes: n, Duration: time.Since(start).String()})
+}
+
+// saveFile writes a snapshot to a temporary file next to path and renames it over path
+func saveFile[V any](ctx context.Context, g gache.Gache[V], path string) (n int64, err error) {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+	if err = g.Write(ctx, f); err != nil {
+		return 0, err
+	}
+	if err = f.Sync(); err != nil {
+		return 0, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if err = f.Close(); err != nil {
+		return 0, err
+	}
+	return info.Size(), os.Rename(f.Name(), path)
+}
+
+func reply(w http.ResponseWriter, status int, v any) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		status = http.StatusInternalServerError
+		b, _ = json.Marshal(map[string]string{"error": err.Error()})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(append(b, '\n'))
+}
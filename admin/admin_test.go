@@ -0,0 +1,135 @@
+package admin
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ntsd/gache/v2"
+)
+
+func do(t *testing.T, h http.Handler, method, target string, v any) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+	if v != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+			t.Fatalf("%s %s = %d %q: %v", method, target, rec.Code, rec.Body, err)
+		}
+	}
+	return rec
+}
+
+func TestHandler(t *testing.T) {
+	g := gache.New[map[string]int](gache.WithStats[map[string]int]())
+	g.SetWithExpire("user:1", map[string]int{"age": 30}, time.Hour)
+	g.SetWithExpire("user:2", map[string]int{"age": 40}, gache.NoTTL)
+	g.SetWithExpire("session:1", nil, gache.NoTTL)
+	h := New(g)
+
+	var e entry[map[string]int]
+	if rec := do(t, h, http.MethodGet, "/keys/user:1", &e); rec.Code != http.StatusOK || e.Value["age"] != 30 || e.ExpiresAt == nil {
+		t.Fatalf("GET /keys/user:1 = %d %+v", rec.Code, e)
+	}
+	if ttl, err := time.ParseDuration(e.TTL); err != nil || ttl <= 59*time.Minute {
+		t.Fatalf("TTL = %q, %v", e.TTL, err)
+	}
+	e = entry[map[string]int]{}
+	if do(t, h, http.MethodGet, "/keys/user:2", &e); e.ExpiresAt != nil || e.TTL != "" {
+		t.Fatalf("entry without expiration = %+v", e)
+	}
+	if rec := do(t, h, http.MethodGet, "/keys/missing", nil); rec.Code != http.StatusNotFound {
+		t.Fatalf("GET of missing key = %d", rec.Code)
+	}
+
+	if rec := do(t, h, http.MethodDelete, "/keys/session:1", nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("DELETE /keys/session:1 = %d", rec.Code)
+	}
+	if rec := do(t, h, http.MethodDelete, "/keys/session:1", nil); rec.Code != http.StatusNotFound {
+		t.Fatalf("DELETE of deleted key = %d", rec.Code)
+	}
+	if rec := do(t, h, http.MethodDelete, "/keys", nil); rec.Code != http.StatusBadRequest {
+		t.Fatalf("DELETE /keys without prefix = %d", rec.Code)
+	}
+	var deleted map[string]uint64
+	if do(t, h, http.MethodDelete, "/keys?prefix=user:", &deleted); deleted["deleted"] != 2 {
+		t.Fatalf("DELETE /keys?prefix=user: = %v", deleted)
+	}
+
+	var s stats
+	if do(t, h, http.MethodGet, "/stats", &s); s.Sets != 3 || s.Deletes != 3 || s.Len != 0 {
+		t.Fatalf("GET /stats = %+v", s)
+	}
+	var sh shards
+	if do(t, h, http.MethodGet, "/shards", &sh); len(sh.Lens) != len(g.ShardLens()) {
+		t.Fatalf("GET /shards = %+v", sh)
+	}
+
+	if rec := do(t, h, http.MethodPost, "/snapshot", nil); rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("POST /snapshot without path = %d", rec.Code)
+	}
+}
+
+func TestHandlerSnapshot(t *testing.T) {
+	g := gache.New[int]()
+	for i := range 100 {
+		g.Set(strconv.Itoa(i), i)
+	}
+	path := filepath.Join(t.TempDir(), "cache.snapshot")
+	h := New(g, WithSnapshotPath(path))
+
+	rec := do(t, h, http.MethodGet, "/snapshot", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /snapshot = %d", rec.Code)
+	}
+	downloaded := gache.New[int]()
+	if err := downloaded.Read(rec.Body); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := downloaded.Get("99"); !ok || v != 99 {
+		t.Fatalf("downloaded Get(99) = %v, %v", v, ok)
+	}
+
+	var res snapshot
+	if rec := do(t, h, http.MethodPost, "/snapshot", &res); rec.Code != http.StatusOK || res.Path != path || res.Bytes == 0 {
+		t.Fatalf("POST /snapshot = %d %+v", rec.Code, res)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil || int64(len(b)) != res.Bytes {
+		t.Fatalf("snapshot file of %d bytes, reported %d: %v", len(b), res.Bytes, err)
+	}
+	saved := gache.New[int]()
+	if err := saved.Read(bytes.NewReader(b)); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := saved.Get("42"); !ok || v != 42 {
+		t.Fatalf("saved Get(42) = %v, %v", v, ok)
+	}
+}
+
+func TestHandlerAuth(t *testing.T) {
+	h := New(gache.New[int](), WithAuth(func(r *http.Request) error {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			return errors.New("invalid token")
+		}
+		return nil
+	}))
+	rec := do(t, h, http.MethodGet, "/stats", nil)
+	if rec.Code != http.StatusUnauthorized || !strings.Contains(rec.Body.String(), "invalid token") {
+		t.Fatalf("GET /stats without token = %d %q", rec.Code, rec.Body)
+	}
+	rec = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/stats", nil)
+	req.Header.Set("Authorization", "Bearer token")
+	if h.ServeHTTP(rec, req); rec.Code != http.StatusOK {
+		t.Fatalf("GET /stats with token = %d", rec.Code)
+	}
+}
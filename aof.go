@@ -0,0 +1,420 @@
+package gache
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"hash/maphash"
+	"io"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/kpango/fastime"
+)
+
+// AOFSync is the policy syncing the append-only log of OpenAOF to disk
+type AOFSync uint8
+
+const (
+	// AOFSyncEverySecond syncs the log once a second, a crash of the machine loses at most a second of writes
+	AOFSyncEverySecond AOFSync = iota
+	// AOFSyncAlways syncs the log after every write
+	AOFSyncAlways
+	// AOFSyncNever leaves syncing to the operating system, writes still survive a crash of the process
+	AOFSyncNever
+)
+
+const (
+	// aofMagic starts every append-only log, it is followed by aofVersion and the codec name
+	aofMagic   = "GACHEAOF"
+	aofVersion = 1
+
+	// DefaultAOFCompaction is the interval the append-only log is compacted at unless WithAOFCompaction is set
+	DefaultAOFCompaction = time.Hour
+
+	aofStripes = 256
+)
+
+// ErrAOFOpen is returned by OpenAOF when a log is already open
+var ErrAOFOpen = errors.New("gache: append-only log already open")
+
+type (
+	// aof is an open append-only log, every frame is a uvarint length, a codec encoded aofRecord and its CRC-32
+	aof[V any] struct {
+		mu      sync.Mutex
+		f       *os.File
+		path    string
+		codec   Codec
+		seed    maphash.Seed
+		locks   [aofStripes]sync.Mutex
+		rewrite *bytes.Buffer
+		dirty   bool
+		cancel  context.CancelFunc
+		err     error
+	}
+
+	// aofRecord is a logged operation, an aofSet with an expiration in the past deletes the key on replay
+	aofRecord[V any] struct {
+		Op     aofOp  `json:"op"`
+		Key    string `json:"key"`
+		Value  V      `json:"value"`
+		Expire int64  `json:"expire"`
+	}
+
+	aofOp uint8
+)
+
+const (
+	aofSet aofOp = iota
+	aofDelete
+	aofClear
+)
+
+// OpenAOF replays the append-only log at path into the cache and appends every following write, deletion and Clear to it,
+// the log is created when path does not exist and a torn record at its end is truncated.
+// A damaged record elsewhere fails with ErrCorruptSnapshot and leaves the log untouched.
+// The log is synced by the WithAOFSync policy and rewritten from the live entries every WithAOFCompaction interval
+// until ctx is done or CloseAOF is called, OpenAOF should be called before the cache is used.
+func (g *gache[V]) OpenAOF(ctx context.Context, path string) error {
+	if g.aof.Load() != nil {
+		return ErrAOFOpen
+	}
+	a := &aof[V]{path: path, codec: g.snapshotCodec(), seed: maphash.MakeSeed()}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	if err := g.replay(f, a); err != nil {
+		f.Close()
+		return err
+	}
+	a.f = f
+	ctx, a.cancel = context.WithCancel(ctx)
+	if !g.aof.CompareAndSwap(nil, a) {
+		f.Close()
+		return ErrAOFOpen
+	}
+	g.log(ctx, slog.LevelDebug, "gache: append-only log opened", "path", path)
+	go g.runAOF(ctx, a)
+	return nil
+}
+
+// CompactAOF rewrites the append-only log from the live entries, writes during the rewrite are kept in order
+func (g *gache[V]) CompactAOF(ctx context.Context) (err error) {
+	a := g.aof.Load()
+	if a == nil {
+		return nil
+	}
+	start := time.Now()
+	a.mu.Lock()
+	if a.rewrite != nil {
+		a.mu.Unlock()
+		return nil
+	}
+	a.rewrite = new(bytes.Buffer)
+	a.mu.Unlock()
+	defer func() {
+		a.mu.Lock()
+		a.rewrite = nil
+		a.mu.Unlock()
+		if err != nil {
+			g.log(ctx, slog.LevelWarn, "gache: append-only log compaction failed", "path", a.path, "error", err)
+		}
+	}()
+
+	f, err := os.CreateTemp(filepath.Dir(a.path), "."+filepath.Base(a.path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+	w := bufio.NewWriter(f)
+	if err = a.header(w); err != nil {
+		return err
+	}
+	for _, shard := range g.shards {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+		for k, v := range shard.RangeIter() {
+			if !g.valid(v) {
+				continue
+			}
+			b, err := a.frame(aofRecord[V]{Op: aofSet, Key: k, Value: v.val, Expire: v.expire})
+			if err != nil {
+				return err
+			}
+			if _, err := w.Write(b); err != nil {
+				return err
+			}
+		}
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.f == nil {
+		return os.ErrClosed
+	}
+	if _, err = w.Write(a.rewrite.Bytes()); err != nil {
+		return err
+	}
+	if err = w.Flush(); err != nil {
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		return err
+	}
+	if err = os.Rename(f.Name(), a.path); err != nil {
+		return err
+	}
+	if d, err := os.Open(filepath.Dir(a.path)); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	a.f.Close()
+	a.f, a.dirty = f, false
+	g.log(ctx, slog.LevelDebug, "gache: append-only log compacted", "path", a.path, "duration", time.Since(start))
+	return nil
+}
+
+// CloseAOF syncs and closes the append-only log and returns the first error appending to it
+func (g *gache[V]) CloseAOF() error {
+	a := g.aof.Swap(nil)
+	if a == nil {
+		return nil
+	}
+	a.cancel()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	err := a.err
+	if a.f != nil {
+		err = errors.Join(err, a.f.Sync(), a.f.Close())
+		a.f = nil
+	}
+	return err
+}
+
+// runAOF syncs and compacts a until ctx is done
+func (g *gache[V]) runAOF(ctx context.Context, a *aof[V]) {
+	tick := time.NewTicker(time.Second)
+	defer tick.Stop()
+	interval := g.aofCompaction
+	if interval == 0 {
+		interval = DefaultAOFCompaction
+	}
+	compact := time.NewTicker(interval)
+	defer compact.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			if g.aof.Load() == a {
+				g.CloseAOF()
+			}
+			return
+		case <-tick.C:
+			if g.aofSync == AOFSyncEverySecond {
+				a.mu.Lock()
+				if a.dirty && a.f != nil {
+					a.f.Sync()
+					a.dirty = false
+				}
+				a.mu.Unlock()
+			}
+		case <-compact.C:
+			g.CompactAOF(ctx)
+		}
+	}
+}
+
+// replay applies the log in f to the cache and leaves f positioned at its end, an empty f gets the header
+func (g *gache[V]) replay(f *os.File, a *aof[V]) error {
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() == 0 {
+		return a.header(f)
+	}
+	r := &offsetReader{r: bufio.NewReader(f)}
+	head := make([]byte, len(aofMagic)+2)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return readErr(err)
+	}
+	if string(head[:len(aofMagic)]) != aofMagic {
+		return fmt.Errorf("%w: not an append-only log", ErrCorruptSnapshot)
+	}
+	if version := head[len(aofMagic)]; version != aofVersion {
+		return fmt.Errorf("%w: append-only log version %d", ErrUnsupportedSnapshot, version)
+	}
+	name := make([]byte, head[len(aofMagic)+1])
+	if _, err := io.ReadFull(r, name); err != nil {
+		return readErr(err)
+	}
+	if string(name) != a.codec.Name() {
+		return fmt.Errorf("%w: append-only log encoded by %q codec, reading with %q codec", ErrUnsupportedSnapshot, name, a.codec.Name())
+	}
+
+	var n uint64
+	for {
+		good := r.n
+		b, err := aofFrame(r)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+			// a damaged record is not a torn append, the records after it are kept for recovery
+			return fmt.Errorf("append-only log %s at offset %d: %w", a.path, good, corrupt(err))
+		}
+		if err != nil {
+			// a crash while appending leaves a partial record at the end
+			g.log(context.Background(), slog.LevelWarn, "gache: append-only log truncated", "path", a.path, "offset", good, "dropped", info.Size()-good, "error", err)
+			if err := f.Truncate(good); err != nil {
+				return err
+			}
+			break
+		}
+		var rec aofRecord[V]
+		if err := a.codec.Unmarshal(b, &rec); err != nil {
+			return corrupt(err)
+		}
+		switch rec.Op {
+		case aofSet:
+			if rec.Expire > 0 && rec.Expire < fastime.UnixNanoNow() {
+				g.Delete(rec.Key)
+			} else {
+				g.restore(rec.Key, rec.Value, rec.Expire)
+			}
+		case aofDelete:
+			g.Delete(rec.Key)
+		case aofClear:
+			g.Clear()
+		}
+		n++
+	}
+	if _, err := f.Seek(0, io.SeekEnd); err != nil {
+		return err
+	}
+	g.log(context.Background(), slog.LevelDebug, "gache: append-only log replayed", "path", a.path, "records", n)
+	return nil
+}
+
+// aofFrame reads a frame and verifies its checksum, io.EOF is only returned at a frame boundary
+func aofFrame(r *offsetReader) ([]byte, error) {
+	l, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	if l > maxSnapshotFrame {
+		return nil, fmt.Errorf("%w: record of %d bytes exceeds limit", ErrCorruptSnapshot, l)
+	}
+	b := make([]byte, l+4)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, readErr(err)
+	}
+	if crc32.ChecksumIEEE(b[:l]) != binary.BigEndian.Uint32(b[l:]) {
+		return nil, fmt.Errorf("%w: record checksum mismatch", ErrCorruptSnapshot)
+	}
+	return b[:l], nil
+}
+
+// header writes the log header
+func (a *aof[V]) header(w io.Writer) error {
+	name := a.codec.Name()
+	if len(name) > math.MaxUint8 {
+		return fmt.Errorf("gache: codec name %q is longer than %d bytes", name, math.MaxUint8)
+	}
+	_, err := w.Write(append(append([]byte(aofMagic), aofVersion, byte(len(name))), name...))
+	return err
+}
+
+// frame encodes rec as a log frame
+func (a *aof[V]) frame(rec aofRecord[V]) ([]byte, error) {
+	b, err := a.codec.Marshal(rec)
+	if err != nil {
+		return nil, err
+	}
+	frame := binary.AppendUvarint(make([]byte, 0, binary.MaxVarintLen64+len(b)+4), uint64(len(b)))
+	frame = append(frame, b...)
+	return binary.BigEndian.AppendUint32(frame, crc32.ChecksumIEEE(b)), nil
+}
+
+// lock serializes the writes of key with their log records, it is a no-op on a nil log
+func (a *aof[V]) lock(key string) {
+	if a != nil {
+		a.locks[maphash.String(a.seed, key)%aofStripes].Lock()
+	}
+}
+
+func (a *aof[V]) unlock(key string) {
+	if a != nil {
+		a.locks[maphash.String(a.seed, key)%aofStripes].Unlock()
+	}
+}
+
+// set logs the write of val to key
+func (a *aof[V]) set(g *gache[V], key string, val *value[V]) {
+	if a != nil {
+		a.append(g, aofRecord[V]{Op: aofSet, Key: key, Value: val.val, Expire: val.expire})
+	}
+}
+
+// delete logs the removal of key
+func (a *aof[V]) delete(g *gache[V], key string) {
+	if a != nil {
+		a.append(g, aofRecord[V]{Op: aofDelete, Key: key})
+	}
+}
+
+// append writes rec to the log and the buffer of a running compaction
+func (a *aof[V]) append(g *gache[V], rec aofRecord[V]) {
+	b, err := a.frame(rec)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err == nil && a.f != nil {
+		if _, err = a.f.Write(b); err == nil && g.aofSync == AOFSyncAlways {
+			err = a.f.Sync()
+		}
+		a.dirty = true
+		if a.rewrite != nil {
+			a.rewrite.Write(b)
+		}
+	}
+	if err != nil {
+		if a.err == nil {
+			a.err = err
+		}
+		g.log(context.Background(), slog.LevelWarn, "gache: append-only log write failed", "path", a.path, "key", rec.Key, "error", err)
+	}
+}
+
+// offsetReader counts the bytes read from r
+type offsetReader struct {
+	r *bufio.Reader
+	n int64
+}
+
+func (o *offsetReader) Read(b []byte) (int, error) {
+	n, err := o.r.Read(b)
+	o.n += int64(n)
+	return n, err
+}
+
+func (o *offsetReader) ReadByte() (byte, error) {
+	b, err := o.r.ReadByte()
+	if err == nil {
+		o.n++
+	}
+	return b, err
+}
@@ -0,0 +1,163 @@
+package gache
+
+import "container/list"
+
+const (
+	arcT1 = iota
+	arcT2
+	arcB1
+	arcB2
+)
+
+type (
+	// arc is the Adaptive Replacement Cache policy, T1 and T2 hold keys seen once and at least twice,
+	// B1 and B2 remember keys evicted from them and adapt the target size p of T1 on their hits
+	arc[V any] struct {
+		lists  [4]*list.List
+		items  map[string]*list.Element
+		p      int
+		c      int
+		lastB2 bool
+	}
+
+	arcEntry[V any] struct {
+		key  string
+		v    *value[V]
+		list int
+	}
+)
+
+// newARC returns ARC sized for c entries, resident keys are used as the size when c is 0
+func newARC[V any](c int) *arc[V] {
+	p := &arc[V]{
+		items: make(map[string]*list.Element),
+		c:     c,
+	}
+	for i := range p.lists {
+		p.lists[i] = list.New()
+	}
+	return p
+}
+
+func (p *arc[V]) set(key string, v *value[V]) {
+	p.lastB2 = false
+	e, ok := p.items[key]
+	if !ok {
+		p.push(arcT1, &arcEntry[V]{key: key, v: v})
+		p.trim()
+		return
+	}
+	en := e.Value.(*arcEntry[V])
+	switch en.list {
+	case arcB1:
+		p.p = min(p.size(), p.p+max(p.lists[arcB2].Len()/p.lists[arcB1].Len(), 1))
+	case arcB2:
+		p.p = max(0, p.p-max(p.lists[arcB1].Len()/p.lists[arcB2].Len(), 1))
+		p.lastB2 = true
+	}
+	en.v = v
+	p.move(e, arcT2)
+	p.trim()
+}
+
+func (p *arc[V]) access(key string) {
+	if e, ok := p.items[key]; ok {
+		if l := e.Value.(*arcEntry[V]).list; l == arcT1 || l == arcT2 {
+			p.move(e, arcT2)
+		}
+	}
+}
+
+func (p *arc[V]) remove(key string, v *value[V]) bool {
+	e, ok := p.items[key]
+	if !ok {
+		return false
+	}
+	en := e.Value.(*arcEntry[V])
+	if en.v != v || en.list > arcT2 {
+		return false
+	}
+	p.lists[en.list].Remove(e)
+	delete(p.items, key)
+	return true
+}
+
+func (p *arc[V]) evict(key string, v *value[V]) bool {
+	e, ok := p.items[key]
+	if !ok {
+		return false
+	}
+	en := e.Value.(*arcEntry[V])
+	if en.v != v || en.list > arcT2 {
+		return false
+	}
+	// keep the key as a ghost without its value
+	en.v = nil
+	p.move(e, en.list+arcB1)
+	p.trim()
+	return true
+}
+
+func (p *arc[V]) victim(skip string) (key string, v *value[V], ok bool) {
+	t1 := p.lists[arcT1].Len()
+	first, second := arcT2, arcT1
+	if t1 > 0 && (t1 > p.p || (p.lastB2 && t1 == p.p)) {
+		first, second = arcT1, arcT2
+	}
+	for _, l := range [2]int{first, second} {
+		for e := p.lists[l].Back(); e != nil; e = e.Prev() {
+			if en := e.Value.(*arcEntry[V]); en.key != skip {
+				return en.key, en.v, true
+			}
+		}
+	}
+	return key, nil, false
+}
+
+func (p *arc[V]) reset() {
+	for _, l := range p.lists {
+		l.Init()
+	}
+	clear(p.items)
+	p.p = 0
+	p.lastB2 = false
+}
+
+// size returns the target number of resident keys
+func (p *arc[V]) size() int {
+	if p.c > 0 {
+		return p.c
+	}
+	return max(p.lists[arcT1].Len()+p.lists[arcT2].Len(), 1)
+}
+
+// trim bounds the ghost lists so that T1+B1 and all four lists stay within c and 2c keys
+func (p *arc[V]) trim() {
+	c := p.size()
+	for p.lists[arcB1].Len() > 0 && p.lists[arcT1].Len()+p.lists[arcB1].Len() > c {
+		p.drop(p.lists[arcB1].Back())
+	}
+	for p.lists[arcB2].Len() > 0 && len(p.items) > 2*c {
+		p.drop(p.lists[arcB2].Back())
+	}
+	for p.lists[arcB1].Len() > 0 && len(p.items) > 2*c {
+		p.drop(p.lists[arcB1].Back())
+	}
+}
+
+func (p *arc[V]) push(l int, en *arcEntry[V]) {
+	en.list = l
+	p.items[en.key] = p.lists[l].PushFront(en)
+}
+
+func (p *arc[V]) move(e *list.Element, l int) {
+	en := e.Value.(*arcEntry[V])
+	p.lists[en.list].Remove(e)
+	p.push(l, en)
+}
+
+func (p *arc[V]) drop(e *list.Element) {
+	en := e.Value.(*arcEntry[V])
+	p.lists[en.list].Remove(e)
+	delete(p.items, en.key)
+}
@@ -0,0 +1,145 @@
+package gache
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// SaveStatus is the result of the last snapshot written by StartAutosave
+type SaveStatus struct {
+	Path     string
+	At       time.Time
+	Duration time.Duration
+	Bytes    int64
+	Err      error
+	Saves    uint64
+	Failures uint64
+}
+
+// StartAutosave writes a snapshot to path every interval and once more when ctx is done.
+// Snapshots are written to a temporary file in the same directory, synced and renamed over path,
+// the previous WithAutosaveGenerations - 1 snapshots are kept as path.1, path.2 and so on.
+func (g *gache[V]) StartAutosave(ctx context.Context, interval time.Duration, path string) Gache[V] {
+	g.autosave(ctx, interval, path, g.Write)
+	return g
+}
+
+// LastSave returns the status of the last snapshot written by StartAutosave, the zero value before the first save
+func (g *gache[V]) LastSave() SaveStatus {
+	if s := g.lastSave.Load(); s != nil {
+		return *s
+	}
+	return SaveStatus{}
+}
+
+// autosave runs the StartAutosave loop writing snapshots with write
+func (g *gache[V]) autosave(ctx context.Context, interval time.Duration, path string, write func(context.Context, io.Writer) error) {
+	go func() {
+		tick := time.NewTicker(interval)
+		defer tick.Stop()
+		g.log(ctx, slog.LevelDebug, "gache: autosave started", "path", path, "interval", interval)
+		for {
+			select {
+			case <-ctx.Done():
+				g.save(context.WithoutCancel(ctx), path, write)
+				g.log(context.Background(), slog.LevelDebug, "gache: autosave stopped", "path", path)
+				return
+			case <-tick.C:
+				g.save(ctx, path, write)
+			}
+		}
+	}()
+}
+
+// save writes a snapshot to path and records the result for LastSave
+func (g *gache[V]) save(ctx context.Context, path string, write func(context.Context, io.Writer) error) {
+	start := time.Now()
+	n, err := g.saveFile(ctx, path, write)
+	status := SaveStatus{Path: path, At: start, Duration: time.Since(start), Bytes: n, Err: err}
+	if last := g.lastSave.Load(); last != nil {
+		status.Saves, status.Failures = last.Saves, last.Failures
+	}
+	if err != nil {
+		status.Failures++
+		g.log(ctx, slog.LevelWarn, "gache: autosave failed", "path", path, "error", err)
+	} else {
+		status.Saves++
+		g.log(ctx, slog.LevelDebug, "gache: autosave written", "path", path, "bytes", n, "duration", status.Duration)
+	}
+	g.lastSave.Store(&status)
+}
+
+// saveFile atomically replaces path with a snapshot, path is left untouched when writing fails
+func (g *gache[V]) saveFile(ctx context.Context, path string, write func(context.Context, io.Writer) error) (n int64, err error) {
+	dir := filepath.Dir(path)
+	f, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+	cw := &countWriter{w: f}
+	if err = write(ctx, cw); err != nil {
+		return 0, err
+	}
+	if err = f.Sync(); err != nil {
+		return 0, err
+	}
+	if err = f.Close(); err != nil {
+		return 0, err
+	}
+	if err = rotate(path, g.generations); err != nil {
+		return 0, err
+	}
+	if err = os.Rename(f.Name(), path); err != nil {
+		return 0, err
+	}
+	// the rename is only durable once the directory entry is synced
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return cw.n, nil
+}
+
+// rotate shifts path.1 to path.2 and so on keeping generations - 1 old snapshots and links path as path.1,
+// path stays in place until the new snapshot is renamed over it
+func rotate(path string, generations int) error {
+	if generations <= 1 {
+		return nil
+	}
+	os.Remove(fmt.Sprintf("%s.%d", path, generations-1))
+	for i := generations - 2; i > 0; i-- {
+		if err := os.Rename(fmt.Sprintf("%s.%d", path, i), fmt.Sprintf("%s.%d", path, i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Link(path, path+".1"); err != nil && !os.IsNotExist(err) {
+		// file systems without hard links keep the previous snapshot by moving it
+		if err := os.Rename(path, path+".1"); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// countWriter counts the bytes written to w
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countWriter) Write(b []byte) (int, error) {
+	n, err := c.w.Write(b)
+	c.n += int64(n)
+	return n, err
+}
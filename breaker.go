@@ -0,0 +1,102 @@
+package gache
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/kpango/fastime"
+)
+
+// ErrCircuitOpen is returned by loads while the circuit breaker set by WithCircuitBreaker is open
+var ErrCircuitOpen = errors.New("gache: loader circuit open")
+
+type (
+	// retry is the loader retry policy set by WithLoaderRetry
+	retry struct {
+		attempts int
+		backoff  time.Duration
+		max      time.Duration
+	}
+
+	// breaker opens after threshold consecutive failed loads and lets a single probe through after cooldown
+	breaker struct {
+		mu        sync.Mutex
+		threshold int
+		cooldown  int64
+		failures  int
+		open      int64
+		probing   bool
+	}
+)
+
+// call runs f with the retry policy and the circuit breaker of the cache
+func (g *gache[V]) call(ctx context.Context, f func(context.Context) error) (err error) {
+	if b := g.breaker; b != nil {
+		allowed, probe := b.allow()
+		if !allowed {
+			return ErrCircuitOpen
+		}
+		ok := false
+		// a panicking loader counts as failed
+		defer func() { b.done(probe, ok) }()
+		err = g.withRetry(ctx, g.retry, f)
+		ok = err == nil || errors.Is(err, ErrNotFound)
+		return err
+	}
+	return g.withRetry(ctx, g.retry, f)
+}
+
+// withRetry calls f until it succeeds or reports ErrNotFound, ctx ends or the attempts of r run out,
+// waiting backoff doubled up to max between attempts. Every wait is jittered down to half its length so callers
+// failing together do not retry in lockstep. f is called once when r is nil.
+func (g *gache[V]) withRetry(ctx context.Context, r *retry, f func(context.Context) error) (err error) {
+	if r == nil {
+		return f(ctx)
+	}
+	wait := r.backoff
+	for i := 0; ; i++ {
+		if err = f(ctx); err == nil || errors.Is(err, ErrNotFound) || i >= r.attempts || ctx.Err() != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-g.after(wait/2 + rand.N(wait/2+1)):
+		}
+		wait = min(wait*2, r.max)
+	}
+}
+
+// allow reports whether a load may call the loader and whether it is the probe of an open circuit
+func (b *breaker) allow() (allowed, probe bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures < b.threshold {
+		return true, false
+	}
+	if b.probing || fastime.UnixNanoNow() < b.open+b.cooldown {
+		return false, false
+	}
+	b.probing = true
+	return true, true
+}
+
+// done records the result of an allowed load, only the probe ends probing
+func (b *breaker) done(probe, ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if probe {
+		b.probing = false
+	}
+	if ok {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.failures >= b.threshold {
+		b.open = fastime.UnixNanoNow()
+	}
+}
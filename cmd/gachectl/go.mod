@@ -0,0 +1,27 @@
+module github.com/ntsd/gache/v2/cmd/gachectl
+
+go 1.23.3
+
+require (
+	github.com/ntsd/gache/v2 v2.0.0
+	github.com/ntsd/gache/v2/codec/cbor v0.0.0
+	github.com/ntsd/gache/v2/codec/msgpack v0.0.0
+)
+
+require (
+	github.com/fxamacker/cbor/v2 v2.7.0 // indirect
+	github.com/klauspost/compress v1.17.11 // indirect
+	github.com/klauspost/cpuid/v2 v2.0.9 // indirect
+	github.com/kpango/fastime v1.1.9 // indirect
+	github.com/vmihailenco/msgpack/v5 v5.4.1 // indirect
+	github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
+	github.com/x448/float16 v0.8.4 // indirect
+	github.com/zeebo/xxh3 v1.0.2 // indirect
+	golang.org/x/sync v0.10.0 // indirect
+)
+
+replace (
+	github.com/ntsd/gache/v2 => ../../
+	github.com/ntsd/gache/v2/codec/cbor => ../../codec/cbor
+	github.com/ntsd/gache/v2/codec/msgpack => ../../codec/msgpack
+)
@@ -0,0 +1,60 @@
+// Command gachectl inspects and converts gache snapshot files and talks to the admin and RESP endpoints of a running cache.
+//
+//	gachectl info [flags] snapshot
+//	gachectl dump [flags] snapshot
+//	gachectl convert [flags] in out
+//	gachectl admin [flags] get key | delete key | invalidate prefix | stats | shards | snapshot file | save
+//	gachectl resp [flags] command [args...]
+//
+// Snapshot values are decoded as the Go type of -type, snapshots of other types can be inspected with -type any
+// when they were written by the json, msgpack or cbor codecs. A path of - reads stdin or writes stdout.
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+const usage = `usage: gachectl <command> [flags] [args]
+
+commands:
+  info      print the header and entry counts of a snapshot
+  dump      print the live entries of a snapshot
+  convert   re-encode a snapshot with another codec, compression or key, dropping expired entries
+  admin     call the HTTP endpoints of the admin package
+  resp      send a command to a server/resp endpoint
+
+run gachectl <command> -h for the flags of a command
+`
+
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "gachectl:", err)
+		os.Exit(1)
+	}
+}
+
+// errUsage reports invalid arguments, the usage has already been printed
+var errUsage = errors.New("invalid arguments")
+
+func run(args []string, stdin io.Reader, stdout io.Writer) error {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		return errUsage
+	}
+	switch args[0] {
+	case "info", "dump", "convert":
+		return snapshotCommand(args[0], args[1:], stdin, stdout)
+	case "admin":
+		return adminCommand(args[1:], stdout)
+	case "resp":
+		return respCommand(args[1:], stdout)
+	case "help", "-h", "--help":
+		fmt.Fprint(stdout, usage)
+		return nil
+	}
+	fmt.Fprint(os.Stderr, usage)
+	return fmt.Errorf("unknown command %q", args[0])
+}
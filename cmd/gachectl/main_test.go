@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ntsd/gache/v2"
+	"github.com/ntsd/gache/v2/admin"
+	"github.com/ntsd/gache/v2/server/resp"
+)
+
+func writeSnapshot(t *testing.T, g gache.Gache[string]) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "gache.snapshot")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := g.Write(context.Background(), f); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func gachectl(t *testing.T, args ...string) string {
+	t.Helper()
+	var out bytes.Buffer
+	if err := run(args, strings.NewReader(""), &out); err != nil {
+		t.Fatalf("gachectl %s: %v", strings.Join(args, " "), err)
+	}
+	return out.String()
+}
+
+func TestSnapshotCommands(t *testing.T) {
+	g := gache.New[string]()
+	g.SetDefaultExpire(gache.NoTTL)
+	g.Set("user:1", "alice")
+	g.Set("user:2", "bob")
+	g.SetWithExpire("session:1", "token", time.Hour)
+	path := writeSnapshot(t, g)
+
+	info := gachectl(t, "info", path)
+	for _, want := range []string{"codec\tgob\n", "compression\tnone\n", "entries\t3\n"} {
+		if !strings.Contains(info, want) {
+			t.Fatalf("info output %q lacks %q", info, want)
+		}
+	}
+	if got := gachectl(t, "info", "-prefix", "user:", path); !strings.Contains(got, "entries\t2\n") || !strings.Contains(got, "filtered\t1\n") {
+		t.Fatalf("info -prefix output %q", got)
+	}
+
+	if got := gachectl(t, "dump", "-keys", path); got != "session:1\nuser:1\nuser:2\n" {
+		t.Fatalf("dump -keys = %q", got)
+	}
+	dump := gachectl(t, "dump", "-prefix", "user:", path)
+	if dump != "user:1\t-\t\"alice\"\nuser:2\t-\t\"bob\"\n" {
+		t.Fatalf("dump -prefix = %q", dump)
+	}
+
+	// re-encode with json and gzip, the converted snapshot can then be dumped without knowing the value type
+	out := filepath.Join(t.TempDir(), "converted.snapshot")
+	gachectl(t, "convert", "-to-codec", "json", "-compress", "gzip", path, out)
+	if got := gachectl(t, "info", out); !strings.Contains(got, "codec\tjson\n") || !strings.Contains(got, "compression\tgzip\n") {
+		t.Fatalf("info of converted snapshot %q", got)
+	}
+	if got := gachectl(t, "dump", "-type", "any", "-prefix", "user:", out); got != dump {
+		t.Fatalf("dump of converted snapshot = %q, want %q", got, dump)
+	}
+	if got := gachectl(t, "dump", "-json", "-prefix", "session:", out); !strings.Contains(got, `"key":"session:1","value":"token","expires_at":`) {
+		t.Fatalf("dump -json = %q", got)
+	}
+
+	read := gache.New[string](gache.WithCodec[string](codecs["json"]))
+	f, err := os.Open(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := read.Read(f); err != nil {
+		t.Fatal(err)
+	}
+	if _, ttl, ok := read.GetWithTTL("session:1"); !ok || ttl <= 59*time.Minute || ttl > 61*time.Minute {
+		t.Fatalf("converted session:1 TTL = %v, %v", ttl, ok)
+	}
+
+	var stdout bytes.Buffer
+	if err := run([]string{"dump", "-codec", "msgpack", path}, nil, &stdout); err == nil {
+		t.Fatal("dump of a gob snapshot with the msgpack codec succeeded")
+	}
+	if err := run([]string{"dump", "-type", "complex", path}, nil, &stdout); err == nil {
+		t.Fatal("dump with an unknown value type succeeded")
+	}
+}
+
+func TestAdminCommand(t *testing.T) {
+	g := gache.New[string](gache.WithStats[string]())
+	g.SetDefaultExpire(gache.NoTTL)
+	g.Set("user:1", "alice")
+	g.Set("user:2", "bob")
+	g.Set("other", "x")
+	srv := httptest.NewServer(admin.New(g))
+	defer srv.Close()
+	addr := "-addr=" + srv.URL
+
+	if got := gachectl(t, "admin", addr, "get", "user:1"); !strings.Contains(got, `"value": "alice"`) {
+		t.Fatalf("admin get = %q", got)
+	}
+	if got := gachectl(t, "admin", addr, "stats"); !strings.Contains(got, `"sets": 3`) {
+		t.Fatalf("admin stats = %q", got)
+	}
+	if got := gachectl(t, "admin", addr, "shards"); !strings.Contains(got, `"lens": [`) {
+		t.Fatalf("admin shards = %q", got)
+	}
+
+	path := filepath.Join(t.TempDir(), "downloaded.snapshot")
+	gachectl(t, "admin", addr, "snapshot", path)
+	if got := gachectl(t, "dump", "-keys", path); got != "other\nuser:1\nuser:2\n" {
+		t.Fatalf("dump of downloaded snapshot = %q", got)
+	}
+
+	if got := gachectl(t, "admin", addr, "invalidate", "user:"); !strings.Contains(got, `"deleted": 2`) {
+		t.Fatalf("admin invalidate = %q", got)
+	}
+	gachectl(t, "admin", addr, "delete", "other")
+	var out bytes.Buffer
+	err := run([]string{"admin", addr, "get", "other"}, nil, &out)
+	if err == nil || !strings.Contains(err.Error(), "404") {
+		t.Fatalf("admin get of deleted key = %v", err)
+	}
+	if g.Len() != 0 {
+		t.Fatalf("Len after deletes = %d", g.Len())
+	}
+}
+
+func TestRespCommand(t *testing.T) {
+	g := gache.New[string]()
+	g.SetDefaultExpire(gache.NoTTL)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := resp.New(g, resp.WithPassword("secret"))
+	go srv.Serve(l)
+	defer srv.Close()
+	addr := "-addr=" + l.Addr().String()
+
+	var out bytes.Buffer
+	if err := run([]string{"resp", addr, "PING"}, nil, &out); err == nil || !strings.HasPrefix(out.String(), "(error) NOAUTH") {
+		t.Fatalf("PING without AUTH = %q, %v", out.String(), err)
+	}
+	if got := gachectl(t, "resp", addr, "-password=secret", "SET", "a", "1"); got != "OK\n" {
+		t.Fatalf("SET = %q", got)
+	}
+	if got := gachectl(t, "resp", addr, "-password=secret", "GET", "a"); got != "\"1\"\n" {
+		t.Fatalf("GET = %q", got)
+	}
+	if got := gachectl(t, "resp", addr, "-password=secret", "GET", "missing"); got != "(nil)\n" {
+		t.Fatalf("GET missing = %q", got)
+	}
+	if got := gachectl(t, "resp", addr, "-password=secret", "DEL", "a", "b"); got != "(integer) 1\n" {
+		t.Fatalf("DEL = %q", got)
+	}
+	gachectl(t, "resp", addr, "-password=secret", "SET", "b", "2")
+	if got := gachectl(t, "resp", addr, "-password=secret", "SCAN", "0"); got != "1) \"0\"\n2) 1) \"b\"\n" {
+		t.Fatalf("SCAN = %q", got)
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// adminCommand calls an endpoint of the admin package handler and prints its JSON reply indented
+func adminCommand(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("admin", flag.ContinueOnError)
+	addr := fs.String("addr", "http://localhost:8080", "base URL the admin handler is mounted at")
+	token := fs.String("token", "", "bearer token sent in the Authorization header")
+	timeout := fs.Duration("timeout", time.Minute, "request timeout")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: gachectl admin [flags] get key | delete key | invalidate prefix | stats | shards | snapshot file | save")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	var method, path, file string
+	switch cmd, n := fs.Arg(0), fs.NArg(); {
+	case cmd == "get" && n == 2:
+		method, path = http.MethodGet, "/keys/"+url.PathEscape(fs.Arg(1))
+	case cmd == "delete" && n == 2:
+		method, path = http.MethodDelete, "/keys/"+url.PathEscape(fs.Arg(1))
+	case cmd == "invalidate" && n == 2:
+		method, path = http.MethodDelete, "/keys?prefix="+url.QueryEscape(fs.Arg(1))
+	case (cmd == "stats" || cmd == "shards") && n == 1:
+		method, path = http.MethodGet, "/"+cmd
+	case cmd == "snapshot" && n == 2:
+		method, path, file = http.MethodGet, "/snapshot", fs.Arg(1)
+	case cmd == "save" && n == 1:
+		method, path = http.MethodPost, "/snapshot"
+	default:
+		fs.Usage()
+		return errUsage
+	}
+
+	req, err := http.NewRequest(method, strings.TrimSuffix(*addr, "/")+path, nil)
+	if err != nil {
+		return err
+	}
+	if *token != "" {
+		req.Header.Set("Authorization", "Bearer "+*token)
+	}
+	res, err := (&http.Client{Timeout: *timeout}).Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 300 {
+		b, _ := io.ReadAll(io.LimitReader(res.Body, 4<<10))
+		return fmt.Errorf("%s %s: %s %s", method, path, res.Status, bytes.TrimSpace(b))
+	}
+	if file != "" {
+		return download(res.Body, file, stdout)
+	}
+	if res.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	var v any
+	if err := json.NewDecoder(res.Body).Decode(&v); err != nil {
+		return err
+	}
+	enc := json.NewEncoder(stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// download writes r to file, or stdout for -, and reports the written size
+func download(r io.Reader, file string, stdout io.Writer) error {
+	if file == "-" {
+		_, err := io.Copy(stdout, r)
+		return err
+	}
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(f, r)
+	if err = errors.Join(err, f.Close()); err != nil {
+		os.Remove(file)
+		return err
+	}
+	_, err = fmt.Fprintf(stdout, "%d bytes written to %s\n", n, file)
+	return err
+}
+
+// respCommand sends one command to a server/resp endpoint and prints its reply like redis-cli
+func respCommand(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("resp", flag.ContinueOnError)
+	addr := fs.String("addr", "localhost:6379", "address of the RESP server")
+	password := fs.String("password", "", "password sent with AUTH before the command")
+	timeout := fs.Duration("timeout", 10*time.Second, "connection timeout")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: gachectl resp [flags] command [args...]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errUsage
+	}
+	conn, err := net.DialTimeout("tcp", *addr, *timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(*timeout))
+	w, r := bufio.NewWriter(conn), bufio.NewReader(conn)
+	if *password != "" {
+		writeCommand(w, "AUTH", *password)
+	}
+	writeCommand(w, fs.Args()...)
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if *password != "" {
+		var auth bytes.Buffer
+		if err := printReply(r, &auth, ""); err != nil {
+			return err
+		}
+		if s := auth.String(); strings.HasPrefix(s, "(error)") {
+			return errors.New(strings.TrimSpace(s))
+		}
+	}
+	// an error reply is printed and also fails the command so scripts can check the exit status
+	failed := false
+	if b, err := r.Peek(1); err == nil && b[0] == '-' {
+		failed = true
+	}
+	out := bufio.NewWriter(stdout)
+	if err := printReply(r, out, ""); err != nil {
+		return err
+	}
+	if err := out.Flush(); err != nil {
+		return err
+	}
+	if failed {
+		return errors.New("server replied with an error")
+	}
+	return nil
+}
+
+// writeCommand writes args as a RESP array of bulk strings
+func writeCommand(w *bufio.Writer, args ...string) {
+	w.WriteString("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, arg := range args {
+		w.WriteString("$" + strconv.Itoa(len(arg)) + "\r\n" + arg + "\r\n")
+	}
+}
+
+// printReply reads a RESP reply and prints it the way redis-cli does, nested arrays are indented
+func printReply(r *bufio.Reader, w io.Writer, indent string) error {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return errors.New("empty reply line")
+	}
+	switch body := line[1:]; line[0] {
+	case '+':
+		_, err = fmt.Fprintln(w, body)
+	case '-':
+		_, err = fmt.Fprintln(w, "(error)", body)
+	case ':':
+		_, err = fmt.Fprintln(w, "(integer)", body)
+	case '$':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return fmt.Errorf("malformed bulk length %q", body)
+		}
+		if n < 0 {
+			_, err = fmt.Fprintln(w, "(nil)")
+			return err
+		}
+		b := make([]byte, n+2)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, strconv.Quote(string(b[:n])))
+		return err
+	case '*':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return fmt.Errorf("malformed array length %q", body)
+		}
+		if n <= 0 {
+			_, err = fmt.Fprintln(w, "(empty array)")
+			return err
+		}
+		width := len(strconv.Itoa(n))
+		for i := range n {
+			prefix := fmt.Sprintf("%*d) ", width, i+1)
+			if i > 0 {
+				fmt.Fprint(w, indent)
+			}
+			fmt.Fprint(w, prefix)
+			if err := printReply(r, w, indent+strings.Repeat(" ", len(prefix))); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("unexpected reply %q", line)
+	}
+	return err
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ntsd/gache/v2"
+	"github.com/ntsd/gache/v2/codec/cbor"
+	gachejson "github.com/ntsd/gache/v2/codec/json"
+	"github.com/ntsd/gache/v2/codec/msgpack"
+)
+
+var (
+	codecs = map[string]gache.Codec{
+		"gob":     nil,
+		"json":    gachejson.Codec{},
+		"msgpack": msgpack.Codec{},
+		"cbor":    cbor.Codec{},
+	}
+
+	compressions = map[string]gache.Compression{
+		"none":   gache.NoCompression,
+		"gzip":   gache.Gzip,
+		"zstd":   gache.Zstd,
+		"snappy": gache.Snappy,
+	}
+)
+
+type (
+	// snapshotFlags are the flags of info, dump and convert
+	snapshotFlags struct {
+		typ, codec, keyFile, prefix string
+		json, keys                  bool
+		toCodec, compress, toKey    string
+	}
+
+	// dumped is an entry printed by dump -json
+	dumped[V any] struct {
+		Key       string     `json:"key"`
+		Value     V          `json:"value"`
+		ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	}
+)
+
+func snapshotCommand(name string, args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	var f snapshotFlags
+	fs.StringVar(&f.typ, "type", "string", "Go type of the values: string, bytes, int, float, bool or any")
+	fs.StringVar(&f.codec, "codec", "", "codec of the snapshot: gob, json, msgpack or cbor, read from the header by default")
+	fs.StringVar(&f.keyFile, "key-file", "", "file holding the key of an encrypted snapshot")
+	fs.StringVar(&f.prefix, "prefix", "", "only read the keys starting with prefix")
+	nargs := 1
+	switch name {
+	case "dump":
+		fs.BoolVar(&f.json, "json", false, "print the entries as JSON lines")
+		fs.BoolVar(&f.keys, "keys", false, "print the keys only")
+	case "convert":
+		fs.StringVar(&f.toCodec, "to-codec", "", "codec of the written snapshot, the input codec by default")
+		fs.StringVar(&f.compress, "compress", "none", "compression of the written snapshot: none, gzip, zstd or snappy")
+		fs.StringVar(&f.toKey, "to-key-file", "", "file holding the key encrypting the written snapshot")
+		nargs = 2
+	}
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: gachectl %s [flags] %s\n", name, map[int]string{1: "snapshot", 2: "in out"}[nargs])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	if fs.NArg() != nargs {
+		fs.Usage()
+		return errUsage
+	}
+
+	data, err := readInput(fs.Arg(0), stdin)
+	if err != nil {
+		return err
+	}
+	h, err := gache.ReadSnapshotInfo(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	if f.codec == "" {
+		f.codec = h.Codec
+	}
+	var out string
+	if nargs == 2 {
+		out = fs.Arg(1)
+	}
+	switch f.typ {
+	case "string":
+		return snapshot[string](name, &f, h, data, out, stdout)
+	case "bytes":
+		return snapshot[[]byte](name, &f, h, data, out, stdout)
+	case "int":
+		return snapshot[int64](name, &f, h, data, out, stdout)
+	case "float":
+		return snapshot[float64](name, &f, h, data, out, stdout)
+	case "bool":
+		return snapshot[bool](name, &f, h, data, out, stdout)
+	case "any":
+		return snapshot[any](name, &f, h, data, out, stdout)
+	}
+	return fmt.Errorf("unknown value type %q", f.typ)
+}
+
+// snapshot runs info, dump or convert for the values of type V
+func snapshot[V any](name string, f *snapshotFlags, h gache.SnapshotInfo, data []byte, out string, stdout io.Writer) error {
+	opts, err := cacheOptions[V](f.codec, f.keyFile)
+	if err != nil {
+		return err
+	}
+	g := gache.New(opts...)
+	var stats gache.ReadStats
+	readOpts := []gache.ReadOption[V]{gache.ReadReport[V](&stats)}
+	if f.prefix != "" {
+		readOpts = append(readOpts, gache.FilterKeys[V](func(key string) bool {
+			return strings.HasPrefix(key, f.prefix)
+		}))
+	}
+	readErr := g.Read(bytes.NewReader(data), readOpts...)
+
+	switch name {
+	case "info":
+		w := bufio.NewWriter(stdout)
+		fmt.Fprintf(w, "version\t%d\ncodec\t%s\ncompression\t%s\nencrypted\t%t\nbytes\t%d\n", h.Version, h.Codec, h.Compression, h.Encrypted, len(data))
+		if readErr == nil {
+			fmt.Fprintf(w, "entries\t%d\nexpired\t%d\n", stats.Loaded, stats.Expired)
+			if f.prefix != "" {
+				fmt.Fprintf(w, "filtered\t%d\n", stats.Skipped)
+			}
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		return readErr
+	case "dump":
+		if readErr != nil {
+			return readErr
+		}
+		return dump(g, f, stdout)
+	}
+	if readErr != nil {
+		return readErr
+	}
+	return convert(g, f, out, stdout)
+}
+
+// dump prints the entries of g sorted by key
+func dump[V any](g gache.Gache[V], f *snapshotFlags, stdout io.Writer) error {
+	var (
+		mu      sync.Mutex
+		entries []dumped[V]
+	)
+	// Range calls f from a goroutine per shard
+	g.Range(context.Background(), func(key string, v V, expire int64) bool {
+		e := dumped[V]{Key: key, Value: v}
+		if expire > 0 {
+			at := time.Unix(0, expire).UTC()
+			e.ExpiresAt = &at
+		}
+		mu.Lock()
+		entries = append(entries, e)
+		mu.Unlock()
+		return true
+	})
+	slices.SortFunc(entries, func(a, b dumped[V]) int {
+		return cmp.Compare(a.Key, b.Key)
+	})
+	w := bufio.NewWriter(stdout)
+	enc := json.NewEncoder(w)
+	for _, e := range entries {
+		switch {
+		case f.keys:
+			fmt.Fprintln(w, e.Key)
+		case f.json:
+			if err := enc.Encode(e); err != nil {
+				return err
+			}
+		default:
+			expires := "-"
+			if e.ExpiresAt != nil {
+				expires = e.ExpiresAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\n", e.Key, expires, format(e.Value))
+		}
+	}
+	return w.Flush()
+}
+
+// convert writes the entries of g to out with the output codec, compression and key
+func convert[V any](g gache.Gache[V], f *snapshotFlags, out string, stdout io.Writer) error {
+	if f.toCodec == "" {
+		f.toCodec = f.codec
+	}
+	opts, err := cacheOptions[V](f.toCodec, f.toKey)
+	if err != nil {
+		return err
+	}
+	c, ok := compressions[f.compress]
+	if !ok {
+		return fmt.Errorf("unknown compression %q", f.compress)
+	}
+	dst := gache.New(append(opts, gache.WithSnapshotCompression[V](c))...)
+	g.Range(context.Background(), func(key string, v V, expire int64) bool {
+		var at time.Time
+		if expire > 0 {
+			at = time.Unix(0, expire)
+		}
+		dst.SetWithExpireAt(key, v, at)
+		return true
+	})
+	if out == "-" {
+		return dst.Write(context.Background(), stdout)
+	}
+	// the snapshot is renamed over out once complete so a failed conversion never leaves a partial file
+	tmp, err := os.CreateTemp(filepath.Dir(out), "."+filepath.Base(out)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := dst.Write(context.Background(), tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), out)
+}
+
+// cacheOptions returns the options reading or writing snapshots with codec and the key stored in keyFile
+func cacheOptions[V any](codec, keyFile string) ([]gache.Option[V], error) {
+	c, ok := codecs[codec]
+	if !ok {
+		return nil, fmt.Errorf("unknown codec %q", codec)
+	}
+	opts := []gache.Option[V]{gache.WithDefaultExpiration[V](gache.NoTTL)}
+	if c != nil {
+		opts = append(opts, gache.WithCodec[V](c))
+	}
+	if keyFile != "" {
+		key, err := os.ReadFile(keyFile)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, gache.WithSnapshotEncryption[V](bytes.TrimSpace(key)))
+	}
+	return opts, nil
+}
+
+func readInput(path string, stdin io.Reader) ([]byte, error) {
+	if path == "-" {
+		return io.ReadAll(stdin)
+	}
+	return os.ReadFile(path)
+}
+
+// format renders a value on a single line, strings are quoted so keys and values stay tab separated
+func format(v any) string {
+	switch v := v.(type) {
+	case string:
+		return strconv.Quote(v)
+	case []byte:
+		return strconv.Quote(string(v))
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
@@ -0,0 +1,36 @@
+package gache
+
+import (
+	"bytes"
+	"encoding/gob"
+)
+
+type (
+	// Codec serializes snapshot frames for Write and Read, Name is recorded in the snapshot header
+	// so a snapshot is only read back with the codec that wrote it.
+	// Implementations for JSON, msgpack and CBOR live in the codec subpackages.
+	Codec interface {
+		Name() string
+		Marshal(v any) ([]byte, error)
+		Unmarshal(data []byte, v any) error
+	}
+
+	// gobCodec is the default Codec
+	gobCodec struct{}
+)
+
+func (gobCodec) Name() string {
+	return "gob"
+}
+
+func (gobCodec) Marshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gobCodec) Unmarshal(data []byte, v any) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
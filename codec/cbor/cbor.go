@@ -0,0 +1,23 @@
+// Package cbor provides a CBOR gache.Codec.
+// It lives in its own module so the core gache package stays free of the CBOR dependency.
+package cbor
+
+import "github.com/fxamacker/cbor/v2"
+
+// Codec encodes snapshot frames as CBOR arrays of {"key","value","expire"} maps
+type Codec struct{}
+
+// Name implements gache.Codec
+func (Codec) Name() string {
+	return "cbor"
+}
+
+// Marshal implements gache.Codec
+func (Codec) Marshal(v any) ([]byte, error) {
+	return cbor.Marshal(v)
+}
+
+// Unmarshal implements gache.Codec
+func (Codec) Unmarshal(data []byte, v any) error {
+	return cbor.Unmarshal(data, v)
+}
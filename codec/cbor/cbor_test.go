@@ -0,0 +1,38 @@
+package cbor
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ntsd/gache/v2"
+)
+
+func TestCodec(t *testing.T) {
+	src := gache.New(gache.WithCodec[string](Codec{}))
+	src.SetWithExpire("a", "1", time.Hour)
+	src.Set("b", "2")
+	buf := new(bytes.Buffer)
+	if err := src.Write(context.Background(), buf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(buf.Bytes(), []byte("key")) {
+		t.Fatalf("snapshot is not cbor encoded: %q", buf.Bytes())
+	}
+	snapshot := buf.Bytes()
+
+	g := gache.New(gache.WithCodec[string](Codec{}))
+	if err := g.Read(bytes.NewReader(snapshot)); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := g.Get("a"); !ok || v != "1" || g.Len() != 2 {
+		t.Fatalf("Get(a) = %q, %v, len %d", v, ok, g.Len())
+	}
+	if ttl, ok := g.TTL("a"); !ok || ttl <= 0 || ttl > time.Hour {
+		t.Fatalf("TTL(a) = %v, %v", ttl, ok)
+	}
+	if err := gache.New[string]().Read(bytes.NewReader(snapshot)); err == nil {
+		t.Fatal("gob cache read a cbor snapshot")
+	}
+}
@@ -0,0 +1,19 @@
+module github.com/ntsd/gache/v2/codec/cbor
+
+go 1.23.3
+
+require (
+	github.com/fxamacker/cbor/v2 v2.7.0
+	github.com/ntsd/gache/v2 v2.0.0
+)
+
+require (
+	github.com/klauspost/compress v1.17.11 // indirect
+	github.com/klauspost/cpuid/v2 v2.0.9 // indirect
+	github.com/kpango/fastime v1.1.9 // indirect
+	github.com/x448/float16 v0.8.4 // indirect
+	github.com/zeebo/xxh3 v1.0.2 // indirect
+	golang.org/x/sync v0.10.0 // indirect
+)
+
+replace github.com/ntsd/gache/v2 => ../../
@@ -0,0 +1,22 @@
+// Package json provides a JSON gache.Codec so snapshots can be read by non-Go tooling.
+package json
+
+import "encoding/json"
+
+// Codec encodes snapshot frames as JSON arrays of {"key","value","expire"} objects
+type Codec struct{}
+
+// Name implements gache.Codec
+func (Codec) Name() string {
+	return "json"
+}
+
+// Marshal implements gache.Codec
+func (Codec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Unmarshal implements gache.Codec
+func (Codec) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,19 @@
+module github.com/ntsd/gache/v2/codec/msgpack
+
+go 1.23.3
+
+require (
+	github.com/ntsd/gache/v2 v2.0.0
+	github.com/vmihailenco/msgpack/v5 v5.4.1
+)
+
+require (
+	github.com/klauspost/compress v1.17.11 // indirect
+	github.com/klauspost/cpuid/v2 v2.0.9 // indirect
+	github.com/kpango/fastime v1.1.9 // indirect
+	github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
+	github.com/zeebo/xxh3 v1.0.2 // indirect
+	golang.org/x/sync v0.10.0 // indirect
+)
+
+replace github.com/ntsd/gache/v2 => ../../
@@ -0,0 +1,35 @@
+// Package msgpack provides a MessagePack gache.Codec.
+// It lives in its own module so the core gache package stays free of the msgpack dependency.
+package msgpack
+
+import (
+	"bytes"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Codec encodes snapshot frames as MessagePack arrays of {"key","value","expire"} maps
+type Codec struct{}
+
+// Name implements gache.Codec
+func (Codec) Name() string {
+	return "msgpack"
+}
+
+// Marshal implements gache.Codec
+func (Codec) Marshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Unmarshal implements gache.Codec
+func (Codec) Unmarshal(data []byte, v any) error {
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	dec.SetCustomStructTag("json")
+	return dec.Decode(v)
+}
@@ -0,0 +1,81 @@
+package gache
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/s2"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression is the algorithm compressing snapshot frames, it is recorded in the snapshot header so Read detects it
+type Compression uint8
+
+const (
+	// NoCompression writes frames uncompressed
+	NoCompression Compression = iota
+	// Gzip compresses frames with gzip
+	Gzip
+	// Zstd compresses frames with Zstandard
+	Zstd
+	// Snappy compresses frames with the Snappy framing format
+	Snappy
+)
+
+// String returns the name of the compression algorithm
+func (c Compression) String() string {
+	switch c {
+	case NoCompression:
+		return "none"
+	case Gzip:
+		return "gzip"
+	case Zstd:
+		return "zstd"
+	case Snappy:
+		return "snappy"
+	}
+	return fmt.Sprintf("Compression(%d)", uint8(c))
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// compressor returns a writer compressing to w with c, Close flushes it without closing w
+func compressor(w io.Writer, c Compression) (io.WriteCloser, error) {
+	switch c {
+	case NoCompression:
+		return nopWriteCloser{w}, nil
+	case Gzip:
+		return gzip.NewWriter(w), nil
+	case Zstd:
+		return zstd.NewWriter(w)
+	case Snappy:
+		return s2.NewWriter(w, s2.WriterSnappyCompat()), nil
+	}
+	return nil, fmt.Errorf("gache: unsupported snapshot compression %s", c)
+}
+
+// decompressor returns a reader decompressing r with c, Close releases its resources without closing r
+func decompressor(r io.Reader, c Compression) (io.ReadCloser, error) {
+	switch c {
+	case NoCompression:
+		return io.NopCloser(r), nil
+	case Gzip:
+		return gzip.NewReader(r)
+	case Zstd:
+		d, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		return d.IOReadCloser(), nil
+	case Snappy:
+		return io.NopCloser(s2.NewReader(r)), nil
+	}
+	return nil, fmt.Errorf("gache: unsupported snapshot compression %s", c)
+}
@@ -0,0 +1,26 @@
+package gache
+
+type (
+	// Number is the constraint of values supported by IncrBy and DecrBy
+	Number interface {
+		~int | ~int8 | ~int16 | ~int32 | ~int64 |
+			~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr |
+			~float32 | ~float64
+	}
+)
+
+// IncrBy atomically adds delta to the value of key and returns the new value, missing keys start from zero using default expiration
+func IncrBy[V Number](g Gache[V], key string, delta V) V {
+	v, _ := g.Update(key, func(old V, _ bool) (V, bool) {
+		return old + delta, true
+	})
+	return v
+}
+
+// DecrBy atomically subtracts delta from the value of key and returns the new value, missing keys start from zero using default expiration
+func DecrBy[V Number](g Gache[V], key string, delta V) V {
+	v, _ := g.Update(key, func(old V, _ bool) (V, bool) {
+		return old - delta, true
+	})
+	return v
+}
@@ -0,0 +1,105 @@
+package gache
+
+import (
+	"context"
+	"io"
+	"reflect"
+	"slices"
+)
+
+// KeyDiff lists the keys whose live entries differ between two caches or snapshots a and b, each sorted
+type KeyDiff struct {
+	// Added keys are only live in b
+	Added []string
+	// Removed keys are only live in a
+	Removed []string
+	// Changed keys are live in both with values that are not equal
+	Changed []string
+}
+
+// Empty reports whether a and b hold the same keys and values
+func (d KeyDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// Diff compares the live entries of a and b, values are compared with equal or reflect.DeepEqual when it is nil.
+// Expirations are not compared.
+func Diff[V any](ctx context.Context, a, b Gache[V], equal func(x, y V) bool) (KeyDiff, error) {
+	if equal == nil {
+		equal = func(x, y V) bool { return reflect.DeepEqual(x, y) }
+	}
+	am := a.ToRawMap(ctx)
+	bm := b.ToRawMap(ctx)
+	if err := ctx.Err(); err != nil {
+		return KeyDiff{}, err
+	}
+	return diffMaps(am, bm, equal), nil
+}
+
+// diffMaps compares the entries of am and bm with equal
+func diffMaps[V any](am, bm map[string]V, equal func(x, y V) bool) (d KeyDiff) {
+	for key, av := range am {
+		bv, ok := bm[key]
+		switch {
+		case !ok:
+			d.Removed = append(d.Removed, key)
+		case !equal(av, bv):
+			d.Changed = append(d.Changed, key)
+		}
+	}
+	for key := range bm {
+		if _, ok := am[key]; !ok {
+			d.Added = append(d.Added, key)
+		}
+	}
+	slices.Sort(d.Added)
+	slices.Sort(d.Removed)
+	slices.Sort(d.Changed)
+	return d
+}
+
+// DiffSnapshots is Diff for the live entries of the snapshots read from a and b with the codec, encryption key and
+// logger set by opts, opts are applied once to a configuration discarded afterwards. Merging two snapshots is reading
+// both into one cache with the policy of the second Read.
+func DiffSnapshots[V any](ctx context.Context, a, b io.Reader, equal func(x, y V) bool, opts ...Option[V]) (KeyDiff, error) {
+	if equal == nil {
+		equal = func(x, y V) bool { return reflect.DeepEqual(x, y) }
+	}
+	cfg := new(gache[V])
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	// the snapshots are decoded into maps by a reader holding only the snapshot options, no cache is created
+	r := &gache[V]{codec: cfg.codec, snapshotKey: cfg.snapshotKey, logger: cfg.logger}
+	am, err := r.readMap(ctx, a)
+	if err != nil {
+		return KeyDiff{}, err
+	}
+	bm, err := r.readMap(ctx, b)
+	if err != nil {
+		return KeyDiff{}, err
+	}
+	return diffMaps(am, bm, equal), nil
+}
+
+// readMap decodes the live entries of the snapshot read from r, a key written twice keeps its last value
+func (g *gache[V]) readMap(ctx context.Context, r io.Reader) (map[string]V, error) {
+	m := make(map[string]V)
+	if _, err := g.readRecords(ctx, r, func(rec record[V]) {
+		m[rec.Key] = rec.Value
+	}); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// MergeFrom copies the live entries of src into the cache with their expirations, keys live in both are resolved by
+// the policy of opts as for Read: Overwrite by default, KeepExisting or MergeWith, and FilterKeys, RemapTTL and
+// ReadReport select, retime and count the copied entries.
+func (g *gache[V]) MergeFrom(ctx context.Context, src Gache[V], opts ...ReadOption[V]) error {
+	l := g.restorer(opts, "")
+	for e := range src.Stream(ctx) {
+		l.store(record[V]{Key: e.Key, Value: e.Value, Expire: e.Expire})
+	}
+	return l.done(0, ctx.Err())
+}
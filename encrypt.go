@@ -0,0 +1,190 @@
+package gache
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+const (
+	// encryptionNone and encryptionAESGCM are the snapshot encryption modes recorded in the header
+	encryptionNone   = 0
+	encryptionAESGCM = 1
+
+	// sealedChunk is the plaintext size of an encrypted snapshot chunk
+	sealedChunk = 64 << 10
+
+	keyIDSize = 8
+)
+
+type (
+	// sealer encrypts a stream as AES-GCM chunks of [final flag][uvarint length][ciphertext],
+	// each chunk is sealed with the header nonce xored with its index and authenticates the final flag against truncation
+	sealer struct {
+		w     io.Writer
+		aead  cipher.AEAD
+		nonce []byte
+		n     uint64
+		buf   []byte
+	}
+
+	// opener decrypts a stream written by sealer
+	opener struct {
+		r     *bufio.Reader
+		aead  cipher.AEAD
+		nonce []byte
+		n     uint64
+		buf   []byte
+		final bool
+	}
+)
+
+// newAEAD returns AES-GCM for key and the key ID recorded in snapshot headers
+func newAEAD(key []byte) (cipher.AEAD, []byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("gache: snapshot encryption key: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, nil, err
+	}
+	sum := sha256.Sum256(key)
+	return aead, sum[:keyIDSize], nil
+}
+
+// encryptionHeader returns the header fields of the snapshot encryption and the writer encrypting to w
+func (g *gache[V]) encryptionHeader(w io.Writer) ([]byte, io.WriteCloser, error) {
+	if g.snapshotKey == nil {
+		return []byte{encryptionNone}, nopWriteCloser{w}, nil
+	}
+	aead, id, err := newAEAD(g.snapshotKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, nil, err
+	}
+	header := append(append([]byte{encryptionAESGCM}, id...), nonce...)
+	return header, &sealer{w: w, aead: aead, nonce: nonce}, nil
+}
+
+// decryptor reads the encryption header fields from r and returns the reader decrypting the rest of r
+func (g *gache[V]) decryptor(r *bufio.Reader) (*bufio.Reader, error) {
+	mode, err := r.ReadByte()
+	if err != nil {
+		return nil, readErr(err)
+	}
+	switch mode {
+	case encryptionNone:
+		return r, nil
+	case encryptionAESGCM:
+	default:
+		return nil, fmt.Errorf("%w: encryption %d", ErrUnsupportedSnapshot, mode)
+	}
+	if g.snapshotKey == nil {
+		return nil, fmt.Errorf("%w: snapshot is encrypted and no key is set by WithSnapshotEncryption", ErrSnapshotKey)
+	}
+	aead, id, err := newAEAD(g.snapshotKey)
+	if err != nil {
+		return nil, err
+	}
+	field := make([]byte, keyIDSize+aead.NonceSize())
+	if _, err := io.ReadFull(r, field); err != nil {
+		return nil, readErr(err)
+	}
+	if string(field[:keyIDSize]) != string(id) {
+		return nil, fmt.Errorf("%w: snapshot encrypted with key %x, the key set has ID %x", ErrSnapshotKey, field[:keyIDSize], id)
+	}
+	return bufio.NewReader(&opener{r: r, aead: aead, nonce: field[keyIDSize:]}), nil
+}
+
+// chunkNonce returns the nonce of chunk n
+func chunkNonce(base []byte, n uint64) []byte {
+	nonce := append([]byte(nil), base...)
+	tail := nonce[len(nonce)-8:]
+	binary.BigEndian.PutUint64(tail, binary.BigEndian.Uint64(tail)^n)
+	return nonce
+}
+
+func (s *sealer) Write(p []byte) (int, error) {
+	written := len(p)
+	for len(p) > 0 {
+		m := min(sealedChunk-len(s.buf), len(p))
+		s.buf = append(s.buf, p[:m]...)
+		p = p[m:]
+		if len(s.buf) == sealedChunk {
+			if err := s.seal(false); err != nil {
+				return written - len(p), err
+			}
+		}
+	}
+	return written, nil
+}
+
+// Close seals the remaining bytes as the final chunk
+func (s *sealer) Close() error {
+	return s.seal(true)
+}
+
+func (s *sealer) seal(final bool) error {
+	flag := []byte{0}
+	if final {
+		flag[0] = 1
+	}
+	ct := s.aead.Seal(nil, chunkNonce(s.nonce, s.n), s.buf, flag)
+	s.n++
+	s.buf = s.buf[:0]
+	var prefix [1 + binary.MaxVarintLen64]byte
+	prefix[0] = flag[0]
+	if _, err := s.w.Write(prefix[:1+binary.PutUvarint(prefix[1:], uint64(len(ct)))]); err != nil {
+		return err
+	}
+	_, err := s.w.Write(ct)
+	return err
+}
+
+func (o *opener) Read(p []byte) (int, error) {
+	for len(o.buf) == 0 {
+		if o.final {
+			return 0, io.EOF
+		}
+		if err := o.open(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, o.buf)
+	o.buf = o.buf[n:]
+	return n, nil
+}
+
+func (o *opener) open() error {
+	flag, err := o.r.ReadByte()
+	if err != nil {
+		return readErr(err)
+	}
+	l, err := binary.ReadUvarint(o.r)
+	if err != nil {
+		return readErr(err)
+	}
+	if flag > 1 || l > sealedChunk+uint64(o.aead.Overhead()) {
+		return fmt.Errorf("%w: malformed encrypted chunk %d", ErrCorruptSnapshot, o.n)
+	}
+	ct := make([]byte, l)
+	if _, err := io.ReadFull(o.r, ct); err != nil {
+		return readErr(err)
+	}
+	o.buf, err = o.aead.Open(ct[:0], chunkNonce(o.nonce, o.n), ct, []byte{flag})
+	if err != nil {
+		return fmt.Errorf("%w: decrypt chunk %d: %w", ErrCorruptSnapshot, o.n, err)
+	}
+	o.n++
+	o.final = flag == 1
+	return nil
+}
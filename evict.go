@@ -0,0 +1,475 @@
+package gache
+
+import (
+	"container/heap"
+	"container/list"
+	"sync"
+	"sync/atomic"
+)
+
+// EvictionPolicy selects the entries evicted from a cache bounded by WithMaxEntries or WithMaxCost
+type EvictionPolicy int
+
+const (
+	// LRU evicts the least recently used entry
+	LRU EvictionPolicy = iota
+	// LFU evicts the least frequently used entry, ties are broken by recency
+	LFU
+	// ARC balances recency and frequency adaptively using ghost lists of recently evicted keys
+	ARC
+)
+
+type (
+	// policy tracks keys of a bounded cache and chooses which one to evict, it is guarded by evictShard
+	policy[V any] interface {
+		// set records a write of key, v is the stored value
+		set(key string, v *value[V])
+		// access records a hit of key
+		access(key string)
+		// remove forgets key when it still holds v and reports whether it did
+		remove(key string, v *value[V]) bool
+		// evict forgets the victim key when it still holds v and reports whether it did, the policy may keep a ghost of it
+		evict(key string, v *value[V]) bool
+		// victim returns the key & value to evict next other than skip
+		victim(skip string) (key string, v *value[V], ok bool)
+		// reset forgets all keys
+		reset()
+	}
+
+	// evictor bounds the number and total cost of entries, the keys of each group of cache shards are tracked by their own evictShard
+	evictor[V any] struct {
+		shards  []*evictShard[V]
+		mask    uint64
+		max     uint64
+		maxCost int64
+		cost    int64
+		// unit is the smallest expected entry cost, it estimates the entries resident under maxCost
+		unit  int64
+		weigh func(key string, val V) int64
+	}
+
+	// evictShard tracks the keys of a group of cache shards, hits and writes of other groups do not contend on its lock
+	evictShard[V any] struct {
+		mu        sync.Mutex
+		policy    policy[V]
+		admission *tinyLFU
+		costs     map[string]int64
+	}
+
+	lru[V any] struct {
+		ll    *list.List
+		items map[string]*list.Element
+	}
+
+	lruEntry[V any] struct {
+		key string
+		v   *value[V]
+	}
+
+	lfu[V any] struct {
+		h     lfuHeap[V]
+		items map[string]*lfuEntry[V]
+		tick  uint64
+	}
+
+	lfuEntry[V any] struct {
+		key   string
+		v     *value[V]
+		freq  uint64
+		tick  uint64
+		index int
+	}
+
+	// lfuHeap is a min-heap of entries ordered by frequency then last use
+	lfuHeap[V any] []*lfuEntry[V]
+)
+
+// evictShardBound is the bound of entries or cost per eviction shard, smaller caches keep a single exact policy
+const evictShardBound = 1024
+
+// init creates the eviction shards of a cache of n shards using policy p and the TinyLFU filter when admission is set.
+// Every shard tracks an equal part of the bound, victims are chosen from the shard of the written key first.
+func (ev *evictor[V]) init(n int, p EvictionPolicy, admission bool, hash func(string) uint64) {
+	bound := ev.max
+	if bound == 0 || ev.maxCost > 0 && uint64(ev.maxCost) < bound {
+		bound = uint64(ev.maxCost)
+	}
+	groups := 1
+	for groups*2 <= n && uint64(groups*2)*evictShardBound <= bound {
+		groups *= 2
+	}
+	ev.shards, ev.mask = make([]*evictShard[V], groups), uint64(groups-1)
+	for i := range ev.shards {
+		s := &evictShard[V]{
+			policy: newPolicy[V](p, ev.max/uint64(groups)),
+			costs:  make(map[string]int64),
+		}
+		if admission {
+			s.admission = newTinyLFU(max(ev.residents()/uint64(groups), 1), hash)
+		}
+		ev.shards[i] = s
+	}
+}
+
+// residents estimates the number of entries kept within the bounds, capped to sketchMaxEntries.
+// A cost bound keeps at most maxCost / unit entries, every entry costs at least 1 without a unit.
+func (ev *evictor[V]) residents() uint64 {
+	n := ev.max
+	if ev.maxCost > 0 {
+		if c := uint64(ev.maxCost / max(ev.unit, 1)); n == 0 || c < n {
+			n = c
+		}
+	}
+	return min(n, sketchMaxEntries)
+}
+
+// evictShard returns the eviction shard tracking key
+func (g *gache[V]) evictShard(key string) *evictShard[V] {
+	return g.evict.shards[g.shardIndex(key)&g.evict.mask]
+}
+
+// newPolicy returns the policy implementing p for a cache bounded to max entries, 0 means bounded by cost only
+func newPolicy[V any](p EvictionPolicy, max uint64) policy[V] {
+	switch p {
+	case LFU:
+		return newLFU[V]()
+	case ARC:
+		return newARC[V](int(max))
+	}
+	return newLRU[V]()
+}
+
+func newLRU[V any]() *lru[V] {
+	return &lru[V]{
+		ll:    list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+func (p *lru[V]) set(key string, v *value[V]) {
+	if e, ok := p.items[key]; ok {
+		e.Value.(*lruEntry[V]).v = v
+		p.ll.MoveToFront(e)
+		return
+	}
+	p.items[key] = p.ll.PushFront(&lruEntry[V]{key: key, v: v})
+}
+
+func (p *lru[V]) evict(key string, v *value[V]) bool {
+	return p.remove(key, v)
+}
+
+func (p *lru[V]) access(key string) {
+	if e, ok := p.items[key]; ok {
+		p.ll.MoveToFront(e)
+	}
+}
+
+func (p *lru[V]) remove(key string, v *value[V]) bool {
+	if e, ok := p.items[key]; ok && e.Value.(*lruEntry[V]).v == v {
+		p.ll.Remove(e)
+		delete(p.items, key)
+		return true
+	}
+	return false
+}
+
+func (p *lru[V]) victim(skip string) (key string, v *value[V], ok bool) {
+	e := p.ll.Back()
+	if e != nil && e.Value.(*lruEntry[V]).key == skip {
+		e = e.Prev()
+	}
+	if e == nil {
+		return key, nil, false
+	}
+	en := e.Value.(*lruEntry[V])
+	return en.key, en.v, true
+}
+
+func (p *lru[V]) reset() {
+	p.ll.Init()
+	clear(p.items)
+}
+
+func newLFU[V any]() *lfu[V] {
+	return &lfu[V]{
+		items: make(map[string]*lfuEntry[V]),
+	}
+}
+
+func (p *lfu[V]) set(key string, v *value[V]) {
+	p.tick++
+	if e, ok := p.items[key]; ok {
+		e.v = v
+		e.freq++
+		e.tick = p.tick
+		heap.Fix(&p.h, e.index)
+		return
+	}
+	e := &lfuEntry[V]{key: key, v: v, freq: 1, tick: p.tick}
+	p.items[key] = e
+	heap.Push(&p.h, e)
+}
+
+func (p *lfu[V]) evict(key string, v *value[V]) bool {
+	return p.remove(key, v)
+}
+
+func (p *lfu[V]) access(key string) {
+	if e, ok := p.items[key]; ok {
+		p.tick++
+		e.freq++
+		e.tick = p.tick
+		heap.Fix(&p.h, e.index)
+	}
+}
+
+func (p *lfu[V]) remove(key string, v *value[V]) bool {
+	if e, ok := p.items[key]; ok && e.v == v {
+		heap.Remove(&p.h, e.index)
+		delete(p.items, key)
+		return true
+	}
+	return false
+}
+
+func (p *lfu[V]) victim(skip string) (key string, v *value[V], ok bool) {
+	if len(p.h) == 0 {
+		return key, nil, false
+	}
+	i := 0
+	if p.h[0].key == skip {
+		// the next minimum is one of the children of the root
+		switch {
+		case len(p.h) == 1:
+			return key, nil, false
+		case len(p.h) == 2 || p.h.Less(1, 2):
+			i = 1
+		default:
+			i = 2
+		}
+	}
+	return p.h[i].key, p.h[i].v, true
+}
+
+func (p *lfu[V]) reset() {
+	p.h = p.h[:0]
+	clear(p.items)
+}
+
+func (h lfuHeap[V]) Len() int {
+	return len(h)
+}
+
+func (h lfuHeap[V]) Less(i, j int) bool {
+	if h[i].freq != h[j].freq {
+		return h[i].freq < h[j].freq
+	}
+	return h[i].tick < h[j].tick
+}
+
+func (h lfuHeap[V]) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *lfuHeap[V]) Push(x any) {
+	e := x.(*lfuEntry[V])
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *lfuHeap[V]) Pop() any {
+	old := *h
+	e := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return e
+}
+
+// admit records the write of key and evicts entries while the cache is over its bound,
+// a new key estimated less frequent than the victim is rejected when the admission filter is enabled.
+// old is the replaced value or nil when key was inserted.
+func (g *gache[V]) admit(key string, v, old *value[V]) {
+	ev := g.evict
+	if ev == nil {
+		return
+	}
+	if v.isPinned() {
+		// pinned entries are not tracked but may still push other entries out
+		g.forget(key, old)
+		g.shrink(key)
+		return
+	}
+	var cost int64
+	if ev.maxCost > 0 {
+		cost = ev.weigh(key, v.val)
+		if cost > ev.maxCost {
+			// the entry can never fit, evicting everything else would not help
+			g.forget(key, old)
+			g.evicted(key, v)
+			return
+		}
+	}
+	s := g.evictShard(key)
+	s.mu.Lock()
+	if a := s.admission; a != nil {
+		a.increment(key)
+		if old == nil && g.over(cost) {
+			if victim, _, ok := s.policy.victim(key); ok && a.estimate(key) <= a.estimate(victim) {
+				s.mu.Unlock()
+				g.reject(key, v)
+				return
+			}
+		}
+	}
+	s.policy.set(key, v)
+	if ev.maxCost > 0 {
+		atomic.AddInt64(&ev.cost, cost-s.costs[key])
+		s.costs[key] = cost
+	}
+	s.mu.Unlock()
+	g.shrink(key)
+}
+
+// shrink evicts entries other than the admitted key while the cache is over its bounds
+func (g *gache[V]) shrink(admitted string) {
+	for g.over(0) {
+		if !g.evictOne(admitted) {
+			return
+		}
+	}
+}
+
+// over reports whether the cache exceeds its bounds once an entry of cost is added
+func (g *gache[V]) over(cost int64) bool {
+	ev := g.evict
+	if ev.max > 0 && atomic.LoadUint64(&g.l) > ev.max {
+		return true
+	}
+	return ev.maxCost > 0 && atomic.LoadInt64(&ev.cost)+cost > ev.maxCost
+}
+
+// uncost removes the cost of key tracked by s, s.mu must be held
+func (ev *evictor[V]) uncost(s *evictShard[V], key string) {
+	if ev.maxCost > 0 {
+		atomic.AddInt64(&ev.cost, -s.costs[key])
+		delete(s.costs, key)
+	}
+}
+
+// touched records a hit of key
+func (g *gache[V]) touched(key string) {
+	if g.evict == nil {
+		return
+	}
+	s := g.evictShard(key)
+	s.mu.Lock()
+	s.policy.access(key)
+	if s.admission != nil {
+		s.admission.increment(key)
+	}
+	s.mu.Unlock()
+}
+
+// forget removes key holding v from the eviction policy
+func (g *gache[V]) forget(key string, v *value[V]) {
+	if g.evict == nil {
+		return
+	}
+	s := g.evictShard(key)
+	s.mu.Lock()
+	if s.policy.remove(key, v) {
+		g.evict.uncost(s, key)
+	}
+	s.mu.Unlock()
+}
+
+// resetEviction forgets all keys of the eviction policy
+func (g *gache[V]) resetEviction() {
+	if g.evict == nil {
+		return
+	}
+	for _, s := range g.evict.shards {
+		s.mu.Lock()
+		s.policy.reset()
+		var cost int64
+		for _, c := range s.costs {
+			cost += c
+		}
+		atomic.AddInt64(&g.evict.cost, -cost)
+		clear(s.costs)
+		if s.admission != nil {
+			s.admission.reset()
+		}
+		s.mu.Unlock()
+	}
+}
+
+// evictOne deletes the next victim other than the admitted key and reports whether there was one,
+// the victim is chosen by the eviction shard of the admitted key and by the following ones when it tracks no other key
+func (g *gache[V]) evictOne(admitted string) bool {
+	ev := g.evict
+	start := g.shardIndex(admitted) & ev.mask
+	for i := range uint64(len(ev.shards)) {
+		s := ev.shards[(start+i)&ev.mask]
+		s.mu.Lock()
+		key, v, ok := s.policy.victim(admitted)
+		if ok {
+			// drop the victim even if it changed concurrently, a newer write records it again
+			if s.policy.evict(key, v) {
+				ev.uncost(s, key)
+			}
+		}
+		s.mu.Unlock()
+		if ok {
+			g.evicted(key, v)
+			return true
+		}
+	}
+	return false
+}
+
+// evicted deletes key when it still holds v and records the eviction
+func (g *gache[V]) evicted(key string, v *value[V]) {
+	if !g.drop(key, v) {
+		return
+	}
+	if g.stats != nil {
+		g.stats.evictions.Add(1)
+	}
+	g.notifyEvicted(key, v.val, Evicted)
+}
+
+// reject deletes the key refused by the admission filter when it still holds v, the evicted hook is not called
+func (g *gache[V]) reject(key string, v *value[V]) {
+	if !g.drop(key, v) {
+		return
+	}
+	if g.stats != nil {
+		g.stats.rejections.Add(1)
+	}
+	g.emit(EventDeleted, key, v.val)
+}
+
+// drop deletes key spilling it to the tier when it still holds v and reports whether it did
+func (g *gache[V]) drop(key string, v *value[V]) bool {
+	// spilled before the delete so a concurrent write of key always finds the tier copy to remove
+	g.spill(key, v)
+	a := g.aof.Load()
+	a.lock(key)
+	deleted := g.shard(key).CompareAndDelete(key, v)
+	if deleted {
+		a.delete(g, key)
+	}
+	a.unlock(key)
+	if !deleted {
+		g.unspill(key)
+		return false
+	}
+	atomic.AddUint64(&g.l, ^uint64(0))
+	g.countNamespaces(key, -1)
+	g.untag(key, v, nil)
+	return true
+}
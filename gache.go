@@ -2,10 +2,13 @@ package gache
 
 import (
 	"context"
-	"encoding/gob"
 	"io"
 	"iter"
+	"log/slog"
+	"math"
+	"regexp"
 	"runtime"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -13,87 +16,286 @@ import (
 
 	"github.com/kpango/fastime"
 	"github.com/zeebo/xxh3"
+	"golang.org/x/sync/singleflight"
 )
 
 type (
 	// Gache is base interface type
 	Gache[V any] interface {
 		Clear()
+		CompareAndDelete(string, V) bool
+		CompareAndSwap(string, V, V) bool
 		Delete(string) (V, bool)
 		DeleteExpired(context.Context) uint64
+		DeleteByPrefix(context.Context, string) uint64
+		DeleteByPattern(context.Context, string) uint64
+		DeleteByRegexp(context.Context, *regexp.Regexp) uint64
+		DeleteMulti([]string) uint64
+		Digest(context.Context) []uint64
 		DisableExpiredHook() Gache[V]
+		DistributionScore() float64
 		EnableExpiredHook() Gache[V]
+		ExpireAt(string, time.Time) bool
+		ExtendExpire(string, time.Duration) bool
+		Freeze() Gache[V]
 		Range(context.Context, func(string, V, int64) bool) Gache[V]
 		RangeIter() iter.Seq2[string, V]
 		RangeIterValue() iter.Seq[V]
 		Get(string) (V, bool)
+		GetBytes([]byte) (V, bool)
 		GetWithExpire(string) (V, int64, bool)
-		Read(io.Reader) error
+		GetWithIgnoredExpire(string) (V, bool)
+		GetWithTTL(string) (V, time.Duration, bool)
+		GetWithVersion(string) (V, uint64, bool)
+		GetMulti([]string) map[string]V
+		GetOrdered([]string) []Result[V]
+		GetOrSet(string, V) (V, bool)
+		GetRefresh(string) (V, bool)
+		GetRefreshWithDur(string, time.Duration) (V, bool)
+		GetOrComputeWithRetry(string, func() (V, error), int, time.Duration) (V, error)
+		GetOrLoad(context.Context, string) (V, error)
+		GetMultiLoad(context.Context, []string) (map[string]V, error)
+		Handle(string) KeyHandle[V]
+		InvalidateTag(string) uint64
+		IsFrozen() bool
+		Keys(context.Context) []string
+		GetEntry(string) (Entry[V], bool)
+		SetNegative(string, time.Duration)
+		IsNegative(string) bool
+		Pin(string)
+		Unpin(string)
+		LazyClear()
+		ClearWithHooks(context.Context) uint64
+		CloseAOF() error
+		CloseMapped() error
+		CompactAOF(context.Context) error
+		KeysIter() iter.Seq[string]
+		LastSweep() (time.Time, time.Duration, uint64)
+		LastSweepPerShard() []ShardSweepStat
+		LastSave() SaveStatus
+		MergeFrom(context.Context, Gache[V], ...ReadOption[V]) error
+		OpenAOF(context.Context, string) error
+		OpenMapped(string) error
+		Persist(string) bool
+		Pop(string) (V, bool)
+		Read(io.Reader, ...ReadOption[V]) error
+		ReadContext(context.Context, io.Reader, ...ReadOption[V]) error
+		ReadTransform(io.Reader, func(V) (V, bool)) error
+		ReadWithResolver(io.Reader, func(string, V, V, int64, int64) (V, int64, bool)) error
 		Set(string, V)
+		SetBytes([]byte, V)
 		SetDefaultExpire(time.Duration) Gache[V]
 		SetExpiredHook(f func(context.Context, string, V)) Gache[V]
+		SetEvictedHook(f func(context.Context, string, V, Reason)) Gache[V]
+		SetSetHook(f func(ctx context.Context, key string, old, new V, existed bool)) Gache[V]
+		SetDeleteHook(f func(context.Context, string, V)) Gache[V]
+		Watch(context.Context, string) <-chan Event[V]
+		Events(uint64) []Event[V]
+		SetExpiredHookFilter(f func(string) bool) Gache[V]
+		SetIfNotExists(string, V) bool
+		SetMulti(map[string]V)
+		SetIfExpiringWithin(string, V, time.Duration, time.Duration) bool
+		SetIfVersion(string, V, uint64) bool
+		SetIfVersionWithExpireAt(string, V, uint64, time.Time) bool
 		SetWithExpire(string, V, time.Duration)
+		SetWithExpireAt(string, V, time.Time)
+		SetWithExpireIfNotExists(string, V, time.Duration) bool
+		SetWithExpireReturningOld(string, V, time.Duration) (V, bool)
+		SetWithTags(string, V, time.Duration, ...string)
 		StartExpired(context.Context, time.Duration) Gache[V]
+		StartAutosave(context.Context, time.Duration, string) Gache[V]
 		Len() int
+		LenDelta() int
+		Stats() Stats
+		ResetStats()
+		Namespace(string) Gache[V]
+		ShardKeys(int) []string
+		ShardLens() []int
 		Size() uintptr
+		Stream(context.Context) <-chan Entry[V]
 		ToMap(context.Context) *sync.Map
 		ToRawMap(context.Context) map[string]V
 		Write(context.Context, io.Writer) error
+		WriteTransform(context.Context, io.Writer, func(V) (V, bool)) error
+		WriteMapped(context.Context, io.Writer) error
 		Stop()
-
-		// TODO Future works below
-		// func ExtendExpire(string, addExp time.Duration){}
-		// func (g *gache)ExtendExpire(string, addExp time.Duration){}
-		// func GetRefresh(string)(V, bool){}
-		// func (g *gache)GetRefresh(string)(V, bool){}
-		// func GetRefreshWithDur(string, time.Duration)(V, bool){}
-		// func (g *gache)GetRefreshWithDur(string, time.Duration)(V, bool){}
-		// func GetWithIgnoredExpire(string)(V, bool){}
-		// func (g *gache)GetWithIgnoredExpire(string)(V, bool){}
-		// func Keys(context.Context)[]string{}
-		// func (g *gache)Keys(context.Context)[]string{}
-		// func Pop(string)(V, bool) // Get & Delete{}
-		// func (g *gache)Pop(string)(V, bool) // Get & Delete{}
-		// func SetIfNotExists(string, V){}
-		// func (g *gache)SetIfNotExists(string, V){}
-		// func SetWithExpireIfNotExists(string, V, time.Duration){}
-		// func (g *gache)SetWithExpireIfNotExists(string, V, time.Duration){}
+		Swap(string, V) (V, bool)
+		SyncFrom(context.Context, Gache[V]) (int, error)
+		Touch(string) bool
+		TouchMany([]string, time.Duration) uint64
+		TTL(string) (time.Duration, bool)
+		Unfreeze() Gache[V]
+		Update(string, func(V, bool) (V, bool)) (V, bool)
 	}
 
 	// gache is base instance type
 	gache[V any] struct {
-		shards         [slen]*Map[string, *value[V]]
+		shards         []*Map[string, *value[V]]
+		shardMask      uint64
 		cancel         atomic.Pointer[context.CancelFunc]
+		lastSweep      atomic.Pointer[sweep]
 		expChan        chan keyValue[V]
 		expFunc        func(context.Context, string, V)
+		expFilter      func(string) bool
 		expFuncEnabled bool
+		frozen         atomic.Bool
+		rejectEmptyKey bool
+		sweepStats     bool
+		trackEntries   bool
+		writeTimes     bool
+		stats          *counters
+		logger         *slog.Logger
+		evict          *evictor[V]
+		evictPolicy    EvictionPolicy
+		tinyLFU        bool
+		weigher        func(key string, val V) int64
+		pins           Map[string, bool]
+		pinned         int64
+		evictFunc      func(context.Context, string, V, Reason)
+		setFunc        func(context.Context, string, V, V, bool)
+		deleteFunc     func(context.Context, string, V)
+		watchers       watchers[V]
+		history        *history[V]
 		expire         int64
 		l              uint64
+		stale          uint64
+		gen            uint32
+		lastLen        uint64
+		nsLens         atomic.Pointer[namespaceLens]
+		nsMu           sync.Mutex
+		shardFunc      func(string) int
+		hasher         func(string) uint64
+		equal          func(V, V) bool
+		tags           Map[string, *Map[string, bool]]
+		group          singleflight.Group
+		loads          singleflight.Group
+		loader         func(context.Context, string) (V, time.Duration, error)
+		batchLoader    func(context.Context, []string) (map[string]V, time.Duration, error)
+		refreshWindow  int64
+		staleTTL       int64
+		staleIfError   int64
+		retry          *retry
+		breaker        *breaker
+		negatives      Map[string, int64]
+		negative       int64
+		negativeTTL    int64
+		codec          Codec
+		compression    Compression
+		snapshotKey    []byte
+		generations    int
+		aof            atomic.Pointer[aof[V]]
+		aofSync        AOFSync
+		aofCompaction  time.Duration
+		tier           Tier
+		spilled        Map[string, int64]
+		mapped         atomic.Pointer[mapped]
+		shadowed       Map[string, bool]
+		lastSave       atomic.Pointer[SaveStatus]
+		refreshing     Map[string, bool]
+		after          func(time.Duration) <-chan time.Time
 	}
 
+	// value holds the 8 byte aligned fields first so a small V (bool, uint8, ...) only adds
+	// a single padded word, the layout is as compact as Go allows without specializing V.
 	value[V any] struct {
-		val    V
-		expire int64
+		expire  int64
+		version uint64
+		meta    *entryMeta
+		gen     uint32
+		val     V
+	}
+
+	// entryMeta holds optional per-entry data shared by copies of the same entry
+	entryMeta struct {
+		tags    []string
+		created int64
+		updated atomic.Int64
+		access  atomic.Int64
+		hits    atomic.Uint64
+		pinned  atomic.Bool
+	}
+
+	// Stats is a snapshot of the operation counters enabled by WithStats
+	Stats struct {
+		Hits       uint64
+		Misses     uint64
+		Sets       uint64
+		Deletes    uint64
+		Expired    uint64
+		Evictions  uint64
+		Rejections uint64
+		Stale      uint64
+	}
+
+	counters struct {
+		hits       atomic.Uint64
+		misses     atomic.Uint64
+		sets       atomic.Uint64
+		deletes    atomic.Uint64
+		expired    atomic.Uint64
+		evictions  atomic.Uint64
+		rejections atomic.Uint64
+		stale      atomic.Uint64
+	}
+
+	sweep struct {
+		at       time.Time
+		duration time.Duration
+		removed  uint64
+		shards   []ShardSweepStat
+	}
+
+	// ShardSweepStat is the DeleteExpired measurement of a single shard
+	ShardSweepStat struct {
+		Shard    int
+		Duration time.Duration
+		Scanned  uint64
+		Removed  uint64
 	}
 
 	keyValue[V any] struct {
 		key   string
 		value V
 	}
+
+	// Result is a key lookup result returned by GetOrdered
+	Result[V any] struct {
+		Key   string
+		Value V
+		Found bool
+	}
+
+	// Entry is a key-value pair with its expiration emitted by Stream and GetEntry.
+	// UpdatedAt is the time of its last write tracked with WithWriteTimestamps, CreatedAt, LastAccess and Hits are only tracked with WithEntryMetadata
+	Entry[V any] struct {
+		Key        string
+		Value      V
+		Expire     int64
+		UpdatedAt  time.Time
+		CreatedAt  time.Time
+		LastAccess time.Time
+		Hits       uint64
+	}
 )
 
 const (
-	// slen is shards length
+	// slen is the default shards length, WithShardCount sets another one
 	slen = 512
 	// slen = 4096
 	// mask is slen-1 Hex value
 	mask = 0x1FF
 	// mask = 0xFFF
 
+	// maxShardCount is the largest shards length accepted by WithShardCount
+	maxShardCount = 1 << 16
+
 	// NoTTL can be use for disabling ttl cache expiration
 	NoTTL time.Duration = -1
 
 	maxHashKeyLength = 256
+
+	// streamBufferSize is the channel buffer size used by Stream
+	streamBufferSize = 1024
 )
 
 // New returns Gache (*gache) instance
@@ -104,7 +306,25 @@ func New[V any](opts ...Option[V]) Gache[V] {
 	}, opts...) {
 		opt(g)
 	}
+	if g.shards == nil {
+		g.shards, g.shardMask = make([]*Map[string, *value[V]], slen), mask
+	}
+	if g.equal == nil {
+		g.equal = func(a, b V) bool {
+			return any(a) == any(b)
+		}
+	}
+	if g.evict != nil {
+		g.evict.init(len(g.shards), g.evictPolicy, g.tinyLFU, g.hasher)
+		g.evict.weigh = g.weigher
+		if g.evict.weigh == nil {
+			g.evict.weigh = func(string, V) int64 {
+				return 1
+			}
+		}
+	}
 	g.Clear()
+	g.after = time.After
 	g.expChan = make(chan keyValue[V], len(g.shards)*10)
 	return g
 }
@@ -113,18 +333,90 @@ func newMap[V any]() (m *Map[string, *value[V]]) {
 	return new(Map[string, *value[V]])
 }
 
-func getShardID(key string) (id uint64) {
+// shard returns the shard the key belongs to
+func (g *gache[V]) shard(key string) *Map[string, *value[V]] {
+	return g.shards[g.shardIndex(key)]
+}
+
+// shardIndex returns the shard index of key
+func (g *gache[V]) shardIndex(key string) uint64 {
+	if g.shardFunc != nil {
+		return uint64(g.shardFunc(key)) & g.shardMask
+	}
+	if g.hasher != nil {
+		return g.hasher(key) & g.shardMask
+	}
+	return getShardID(key, g.shardMask)
+}
+
+func getShardID(key string, mask uint64) (id uint64) {
 	if len(key) > maxHashKeyLength {
 		return xxh3.HashString(key[:maxHashKeyLength]) & mask
 	}
 	return xxh3.HashString(key) & mask
 }
 
+// rejected reports whether key is refused by WithRejectEmptyKey
+func (g *gache[V]) rejected(key string) bool {
+	return g.rejectEmptyKey && len(key) == 0
+}
+
+// groupByShard returns indexes of keys grouped by shard index
+func (g *gache[V]) groupByShard(keys []string) map[uint64][]int {
+	groups := make(map[uint64][]int)
+	for i, key := range keys {
+		idx := g.shardIndex(key)
+		groups[idx] = append(groups[idx], i)
+	}
+	return groups
+}
+
 // isValid checks expiration of value
 func (v *value[V]) isValid() (valid bool) {
 	return v.expire <= 0 || fastime.UnixNanoNow() <= v.expire
 }
 
+// valid checks expiration, pinning and generation of value
+func (g *gache[V]) valid(v *value[V]) bool {
+	return !g.cleared(v) && (v.isValid() || v.isPinned())
+}
+
+// cleared reports whether value was written before the last LazyClear
+func (g *gache[V]) cleared(v *value[V]) bool {
+	return v.gen != atomic.LoadUint32(&g.gen)
+}
+
+// uncount decrements the length counter value was accounted in and records the removal to stats, eviction policy and evicted hook.
+// reason is reported for live values, expired and cleared values are reported as such.
+func (g *gache[V]) uncount(key string, v *value[V], reason Reason) {
+	g.forget(key, v)
+	g.untag(key, v, nil)
+	if v == nil {
+		atomic.AddUint64(&g.l, ^uint64(0))
+		g.countNamespaces(key, -1)
+		return
+	}
+	if g.cleared(v) {
+		atomic.AddUint64(&g.stale, ^uint64(0))
+	} else {
+		atomic.AddUint64(&g.l, ^uint64(0))
+		g.countNamespaces(key, -1)
+	}
+	reason = g.reason(v, reason)
+	if reason == Deleted {
+		g.notifyDelete(key, v.val)
+	}
+	if g.stats != nil {
+		switch reason {
+		case Expired:
+			g.stats.expired.Add(1)
+		case Deleted:
+			g.stats.deletes.Add(1)
+		}
+	}
+	g.notifyEvicted(key, v.val, reason)
+}
+
 // SetDefaultExpire set expire duration
 func (g *gache[V]) SetDefaultExpire(ex time.Duration) Gache[V] {
 	atomic.StoreInt64(&g.expire, *(*int64)(unsafe.Pointer(&ex)))
@@ -149,6 +441,30 @@ func (g *gache[V]) SetExpiredHook(f func(context.Context, string, V)) Gache[V] {
 	return g
 }
 
+// SetExpiredHookFilter set filter function deciding which expired keys fire the expired hook
+func (g *gache[V]) SetExpiredHookFilter(f func(string) bool) Gache[V] {
+	g.expFilter = f
+	return g
+}
+
+// Freeze makes the cache read-only, writes become no-ops until Unfreeze.
+// Writes already in flight when Freeze is called may still land.
+func (g *gache[V]) Freeze() Gache[V] {
+	g.frozen.Store(true)
+	return g
+}
+
+// Unfreeze makes the cache writable again
+func (g *gache[V]) Unfreeze() Gache[V] {
+	g.frozen.Store(false)
+	return g
+}
+
+// IsFrozen returns true while the cache is frozen
+func (g *gache[V]) IsFrozen() bool {
+	return g.frozen.Load()
+}
+
 // StartExpired starts delete expired value daemon
 func (g *gache[V]) StartExpired(ctx context.Context, dur time.Duration) Gache[V] {
 	go func() {
@@ -156,16 +472,23 @@ func (g *gache[V]) StartExpired(ctx context.Context, dur time.Duration) Gache[V]
 		ctx, cancel = context.WithCancel(ctx)
 		g.cancel.Store(&cancel)
 		tick := time.NewTicker(dur)
+		g.log(ctx, slog.LevelDebug, "gache: expire daemon started", "interval", dur)
 		for {
 			select {
 			case <-ctx.Done():
 				tick.Stop()
+				if n := len(g.expChan); n != 0 {
+					g.log(context.Background(), slog.LevelWarn, "gache: expired hook deliveries dropped on stop", "count", n)
+				}
+				g.log(context.Background(), slog.LevelDebug, "gache: expire daemon stopped")
 				return
 			case kv := <-g.expChan:
 				go g.expFunc(ctx, kv.key, kv.value)
 			case <-tick.C:
 				go func() {
-					g.DeleteExpired(ctx)
+					start := time.Now()
+					rows := g.DeleteExpired(ctx)
+					g.log(ctx, slog.LevelDebug, "gache: expire daemon cycle", "removed", rows, "duration", time.Since(start))
 					runtime.Gosched()
 				}()
 			}
@@ -205,81 +528,790 @@ func (g *gache[V]) ToRawMap(ctx context.Context) map[string]V {
 }
 
 // get returns value & exists from key
-func (g *gache[V]) get(key string) (v V, expire int64, ok bool) {
+func (g *gache[V]) get(shard *Map[string, *value[V]], key string) (v V, expire int64, ok bool) {
+	if g.rejected(key) {
+		return v, 0, false
+	}
 	var val *value[V]
-	shard := g.shards[getShardID(key)]
 	val, ok = shard.Load(key)
 	if !ok {
+		if g.tier != nil {
+			if v, expire, ok = g.promote(shard, key); ok {
+				if g.stats != nil {
+					g.stats.hits.Add(1)
+				}
+				return v, expire, true
+			}
+		}
+		if g.mapped.Load() != nil {
+			if v, expire, ok = g.loadMapped(shard, key); ok {
+				if g.stats != nil {
+					g.stats.hits.Add(1)
+				}
+				return v, expire, true
+			}
+		}
+		if g.stats != nil {
+			g.stats.misses.Add(1)
+		}
 		return v, 0, false
 	}
 
-	if val.isValid() {
+	if g.valid(val) {
+		g.hit(key, val)
+		if g.refreshWindow != 0 {
+			g.refreshAhead(key, val.expire)
+		}
 		return val.val, val.expire, true
 	}
 
-	g.expiration(key)
+	if g.serveStale(val) {
+		if g.stats != nil {
+			g.stats.hits.Add(1)
+			g.stats.stale.Add(1)
+		}
+		g.touched(key)
+		g.refresh(key)
+		return val.val, val.expire, true
+	}
+
+	if g.stats != nil {
+		g.stats.misses.Add(1)
+	}
+	if g.fallback(val) {
+		// kept for loads failing within the grace period of WithStaleIfError
+		return v, val.expire, false
+	}
+	g.expiration(shard, key)
 	return v, val.expire, false
 }
 
+// hit records an access of the live val of key, key is only looked up so it may borrow the memory of a byte slice
+func (g *gache[V]) hit(key string, val *value[V]) {
+	if g.trackEntries && val.meta != nil {
+		val.meta.access.Store(fastime.UnixNanoNow())
+		val.meta.hits.Add(1)
+	}
+	if g.stats != nil {
+		g.stats.hits.Add(1)
+	}
+	g.touched(key)
+}
+
+// GetEntry returns entry & exists from key without recording an access
+func (g *gache[V]) GetEntry(key string) (e Entry[V], ok bool) {
+	if g.rejected(key) {
+		return e, false
+	}
+	shard := g.shard(key)
+	val, ok := shard.Load(key)
+	if !ok {
+		return e, false
+	}
+	if !g.valid(val) {
+		g.expiration(shard, key)
+		return e, false
+	}
+	return g.entry(key, val), true
+}
+
+// entry converts stored value to Entry
+func (g *gache[V]) entry(key string, val *value[V]) Entry[V] {
+	e := Entry[V]{Key: key, Value: val.val, Expire: val.expire}
+	if updated := val.updated(); updated != 0 {
+		e.UpdatedAt = time.Unix(0, updated)
+	}
+	if val.meta != nil && val.meta.created != 0 {
+		e.CreatedAt = time.Unix(0, val.meta.created)
+		e.Hits = val.meta.hits.Load()
+		if access := val.meta.access.Load(); access != 0 {
+			e.LastAccess = time.Unix(0, access)
+		}
+	}
+	return e
+}
+
 // Get returns value & exists from key
 func (g *gache[V]) Get(key string) (v V, ok bool) {
-	v, _, ok = g.get(key)
+	v, _, ok = g.get(g.shard(key), key)
+	return v, ok
+}
+
+// GetBytes is Get for a key held in a byte slice, live hits are served without copying key into a string.
+// The functions of WithShardFunc and WithHasher receive a string sharing the memory of key and must not keep it.
+func (g *gache[V]) GetBytes(key []byte) (v V, ok bool) {
+	k := unsafe.String(unsafe.SliceData(key), len(key))
+	shard := g.shard(k)
+	if val, found := shard.Load(k); found && g.valid(val) && g.refreshWindow == 0 && !g.rejected(k) {
+		g.hit(k, val)
+		return val.val, true
+	}
+	// misses, expirations and refreshes may keep the key in loads, hooks or tiers, they get a copy
+	v, _, ok = g.get(shard, string(key))
 	return v, ok
 }
 
 // GetWithExpire returns value & expire & exists from key
 func (g *gache[V]) GetWithExpire(key string) (v V, expire int64, ok bool) {
-	return g.get(key)
+	return g.get(g.shard(key), key)
+}
+
+// GetRefresh returns value & exists from key and resets its expiration to the default expiration
+func (g *gache[V]) GetRefresh(key string) (v V, ok bool) {
+	return g.getRefresh(g.shard(key), key, atomic.LoadInt64(&g.expire))
+}
+
+// GetRefreshWithDur returns value & exists from key and resets its expiration to dur
+func (g *gache[V]) GetRefreshWithDur(key string, dur time.Duration) (v V, ok bool) {
+	return g.getRefresh(g.shard(key), key, dur.Nanoseconds())
+}
+
+func (g *gache[V]) getRefresh(shard *Map[string, *value[V]], key string, expire int64) (v V, ok bool) {
+	if g.frozen.Load() {
+		// a frozen cache keeps expirations as they are and serves the read
+		v, _, ok = g.get(shard, key)
+		return v, ok
+	}
+	old, ok := g.retime(shard, key, func(old *value[V]) (*value[V], bool) {
+		if old == nil || !g.valid(old) {
+			return nil, false
+		}
+		val := *old
+		val.expire = absExpire(expire)
+		return &val, true
+	})
+	if !ok {
+		return v, false
+	}
+	return old.val, true
+}
+
+// CompareAndSwap swaps the live value of key keeping its expiration only when it equals old.
+// Values are compared using WithEqual, by default V must be comparable like sync.Map.CompareAndSwap.
+func (g *gache[V]) CompareAndSwap(key string, old, new V) (swapped bool) {
+	_, swapped = g.update(g.shard(key), key, func(cur *value[V]) (*value[V], bool) {
+		if cur == nil || !g.valid(cur) || !g.equal(cur.val, old) {
+			return nil, false
+		}
+		val := *cur
+		val.val = new
+		return &val, true
+	})
+	return swapped
+}
+
+// CompareAndDelete deletes key only when its live value equals old
+func (g *gache[V]) CompareAndDelete(key string, old V) (deleted bool) {
+	if g.frozen.Load() || g.rejected(key) {
+		return false
+	}
+	shard := g.shard(key)
+	for {
+		cur, ok := shard.Load(key)
+		if !ok || !g.valid(cur) || !g.equal(cur.val, old) {
+			return false
+		}
+		if g.compareAndDelete(shard, key, cur) {
+			return true
+		}
+	}
+}
+
+// Update atomically replaces the value of key with the one returned by fn and returns it, fn returning false leaves the key untouched.
+// fn receives the live value & exists, it may be called multiple times on contention so it must not have side effects.
+// Existing keys keep their expiration and new keys use default expiration.
+func (g *gache[V]) Update(key string, fn func(old V, exists bool) (V, bool)) (v V, ok bool) {
+	var nv V
+	_, ok = g.update(g.shard(key), key, func(old *value[V]) (*value[V], bool) {
+		var (
+			cur    V
+			exists = old != nil && g.valid(old)
+			val    value[V]
+		)
+		if exists {
+			cur = old.val
+			val = *old
+		} else {
+			val.expire = absExpire(atomic.LoadInt64(&g.expire))
+		}
+		nv, ok = fn(cur, exists)
+		if !ok {
+			return nil, false
+		}
+		val.val = nv
+		return &val, true
+	})
+	if !ok {
+		return v, false
+	}
+	return nv, true
+}
+
+// GetOrSet returns the live value of key if present, otherwise it sets val using default expiration and returns it
+func (g *gache[V]) GetOrSet(key string, val V) (actual V, loaded bool) {
+	old, _ := g.update(g.shard(key), key, func(old *value[V]) (*value[V], bool) {
+		if old != nil && g.valid(old) {
+			return nil, false
+		}
+		return &value[V]{
+			expire: absExpire(atomic.LoadInt64(&g.expire)),
+			val:    val,
+		}, true
+	})
+	if old != nil && g.valid(old) {
+		return old.val, true
+	}
+	return val, false
+}
+
+// GetMulti returns live values of keys, lookups are grouped by shard
+func (g *gache[V]) GetMulti(keys []string) map[string]V {
+	m := make(map[string]V, len(keys))
+	for idx, is := range g.groupByShard(keys) {
+		shard := g.shards[idx]
+		for _, i := range is {
+			if v, _, ok := g.get(shard, keys[i]); ok {
+				m[keys[i]] = v
+			}
+		}
+	}
+	return m
+}
+
+// SetMulti sets all key-values using default expiration, writes are grouped by shard
+func (g *gache[V]) SetMulti(kvs map[string]V) {
+	keys := make([]string, 0, len(kvs))
+	for k := range kvs {
+		keys = append(keys, k)
+	}
+	expire := atomic.LoadInt64(&g.expire)
+	for idx, is := range g.groupByShard(keys) {
+		shard := g.shards[idx]
+		for _, i := range is {
+			g.set(shard, keys[i], kvs[keys[i]], expire)
+		}
+	}
+}
+
+// DeleteMulti deletes keys and returns the number of deleted keys, deletes are grouped by shard
+func (g *gache[V]) DeleteMulti(keys []string) (rows uint64) {
+	for idx, is := range g.groupByShard(keys) {
+		shard := g.shards[idx]
+		for _, i := range is {
+			if _, ok := g.delete(shard, keys[i]); ok {
+				rows++
+			}
+		}
+	}
+	return rows
+}
+
+// GetOrdered returns lookup results of keys in the same order as keys, lookups are grouped by shard
+func (g *gache[V]) GetOrdered(keys []string) []Result[V] {
+	res := make([]Result[V], len(keys))
+	for idx, is := range g.groupByShard(keys) {
+		shard := g.shards[idx]
+		for _, i := range is {
+			res[i].Key = keys[i]
+			res[i].Value, _, res[i].Found = g.get(shard, keys[i])
+		}
+	}
+	return res
+}
+
+// GetWithTTL returns value & remaining lifetime & exists from key, NoTTL is returned for keys without expiration
+func (g *gache[V]) GetWithTTL(key string) (v V, ttl time.Duration, ok bool) {
+	v, expire, ok := g.get(g.shard(key), key)
+	if !ok {
+		return v, 0, false
+	}
+	return v, remaining(expire), true
+}
+
+// TTL returns remaining lifetime of key, NoTTL is returned for keys without expiration
+func (g *gache[V]) TTL(key string) (ttl time.Duration, ok bool) {
+	return g.ttl(g.shard(key), key)
+}
+
+// ttl returns remaining lifetime of key stored in shard
+func (g *gache[V]) ttl(shard *Map[string, *value[V]], key string) (ttl time.Duration, ok bool) {
+	_, expire, ok := g.get(shard, key)
+	if !ok {
+		return 0, false
+	}
+	return remaining(expire), true
+}
+
+// remaining converts unix nano expiration to remaining lifetime
+func remaining(expire int64) time.Duration {
+	if expire <= 0 {
+		return NoTTL
+	}
+	return time.Duration(max(expire-fastime.UnixNanoNow(), 0))
+}
+
+// GetWithIgnoredExpire returns value & exists from key even if it is expired and not deleted yet, values removed by LazyClear are not returned
+func (g *gache[V]) GetWithIgnoredExpire(key string) (v V, ok bool) {
+	if g.rejected(key) {
+		return v, false
+	}
+	val, ok := g.shard(key).Load(key)
+	if !ok || g.cleared(val) {
+		return v, false
+	}
+	return val.val, true
+}
+
+// GetWithVersion returns value & version & exists from key
+func (g *gache[V]) GetWithVersion(key string) (v V, version uint64, ok bool) {
+	if g.rejected(key) {
+		return v, 0, false
+	}
+	shard := g.shard(key)
+	val, ok := shard.Load(key)
+	if !ok {
+		return v, 0, false
+	}
+	if !g.valid(val) {
+		g.expiration(shard, key)
+		return v, 0, false
+	}
+	return val.val, val.version, true
+}
+
+// GetOrComputeWithRetry returns value of key or computes, caches and returns it using fn.
+// fn is retried up to retries times unless it reports ErrNotFound, waiting backoff doubled after every attempt up to
+// 32 times backoff with jitter as WithLoaderRetry does. Concurrent callers for the same key share one computation and
+// failures are not cached.
+func (g *gache[V]) GetOrComputeWithRetry(key string, fn func() (V, error), retries int, backoff time.Duration) (v V, err error) {
+	v, ok := g.Get(key)
+	if ok {
+		return v, nil
+	}
+	res, err, _ := g.group.Do(key, func() (any, error) {
+		if v, ok := g.Get(key); ok {
+			return v, nil
+		}
+		var v V
+		err := g.withRetry(context.Background(), &retry{attempts: retries, backoff: backoff, max: 32 * backoff}, func(context.Context) (err error) {
+			v, err = fn()
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		g.Set(key, v)
+		return v, nil
+	})
+	if err != nil {
+		return v, err
+	}
+	v, _ = res.(V)
+	return v, nil
 }
 
 // set sets key-value & expiration to Gache
-func (g *gache[V]) set(key string, val V, expire int64) {
+func (g *gache[V]) set(shard *Map[string, *value[V]], key string, val V, expire int64) {
+	g.update(shard, key, func(*value[V]) (*value[V], bool) {
+		return &value[V]{
+			expire: absExpire(expire),
+			val:    val,
+		}, true
+	})
+}
+
+// absExpire converts relative expiration to unix nano expiration
+func absExpire(expire int64) int64 {
 	if expire > 0 {
-		expire = fastime.UnixNanoNow() + expire
+		return fastime.UnixNanoNow() + expire
+	}
+	return expire
+}
+
+// unixExpire converts absolute expiration time to unix nano expiration, zero time means no expiration
+func unixExpire(t time.Time) int64 {
+	if t.IsZero() {
+		return NoTTL.Nanoseconds()
+	}
+	if exp := t.UnixNano(); exp > 0 {
+		return exp
 	}
-	shard := g.shards[getShardID(key)]
-	_, loaded := shard.Swap(key, &value[V]{
-		expire: expire,
-		val:    val,
+	// keep times before the unix epoch expired instead of never expiring
+	return 1
+}
+
+// update atomically replaces the value of key by the one returned from f and bumps its version.
+// f receives the stored value (nil if absent) and reports whether to write, it may be called multiple times on contention.
+func (g *gache[V]) update(shard *Map[string, *value[V]], key string, f func(old *value[V]) (*value[V], bool)) (old *value[V], written bool) {
+	return g.write(shard, key, f, true)
+}
+
+// retime is update for f keeping the stored value and only changing its expiration, the version is kept and the replaced value is not reported to the evicted hook
+func (g *gache[V]) retime(shard *Map[string, *value[V]], key string, f func(old *value[V]) (*value[V], bool)) (old *value[V], written bool) {
+	return g.write(shard, key, f, false)
+}
+
+// write implements update, replaced reports the write to the set hook and the old value to the evicted hook
+func (g *gache[V]) write(shard *Map[string, *value[V]], key string, f func(old *value[V]) (*value[V], bool), replaced bool) (old *value[V], written bool) {
+	if g.frozen.Load() || g.rejected(key) {
+		return nil, false
+	}
+	a := g.aof.Load()
+	for {
+		old, ok := shard.Load(key)
+		if !ok {
+			old = nil
+		}
+		val, ok := f(old)
+		if !ok {
+			return old, false
+		}
+		val.version = 1
+		if old != nil {
+			val.version = old.version
+			if replaced {
+				val.version++
+			}
+		}
+		if g.writeTimes && replaced {
+			if val.meta == nil {
+				val.meta = new(entryMeta)
+			}
+			// copies share the meta of old and are stamped, new meta keeps the write time set by SyncFrom
+			if val.meta.updated.Load() == 0 || old != nil && val.meta == old.meta {
+				val.meta.updated.Store(fastime.UnixNanoNow())
+			}
+		}
+		val.gen = atomic.LoadUint32(&g.gen)
+		g.pin(key, val)
+		if g.trackEntries {
+			// copies of an entry share its meta, only new entries start tracking
+			if val.meta == nil {
+				val.meta = new(entryMeta)
+			}
+			if val.meta.created == 0 {
+				val.meta.created = fastime.UnixNanoNow()
+			}
+		}
+		if old == nil {
+			a.lock(key)
+			if _, loaded := shard.LoadOrStore(key, val); !loaded {
+				a.set(g, key, val)
+				a.unlock(key)
+				g.unspill(key)
+				g.shadow(key)
+				atomic.AddUint64(&g.l, 1)
+				g.countNamespaces(key, 1)
+				if g.stats != nil {
+					g.stats.sets.Add(1)
+				}
+				g.admit(key, val, nil)
+				g.negated(key)
+				if replaced {
+					g.notifySet(key, nil, val)
+				}
+				return nil, true
+			}
+			a.unlock(key)
+			continue
+		}
+		a.lock(key)
+		if shard.CompareAndSwap(key, old, val) {
+			a.set(g, key, val)
+			a.unlock(key)
+			g.unspill(key)
+			g.shadow(key)
+			if g.stats != nil {
+				g.stats.sets.Add(1)
+			}
+			if g.cleared(old) {
+				atomic.AddUint64(&g.stale, ^uint64(0))
+				atomic.AddUint64(&g.l, 1)
+				g.countNamespaces(key, 1)
+			}
+			g.admit(key, val, old)
+			g.negated(key)
+			g.untag(key, old, val)
+			if replaced {
+				g.notifyEvicted(key, old.val, g.reason(old, Replaced))
+				g.notifySet(key, old, val)
+			}
+			return old, true
+		}
+		a.unlock(key)
+	}
+}
+
+// SetIfNotExists sets key-value using default expiration only when key is absent or expired
+func (g *gache[V]) SetIfNotExists(key string, val V) bool {
+	return g.setIfNotExists(g.shard(key), key, val, atomic.LoadInt64(&g.expire))
+}
+
+// SetWithExpireIfNotExists sets key-value & expiration only when key is absent or expired
+func (g *gache[V]) SetWithExpireIfNotExists(key string, val V, expire time.Duration) bool {
+	return g.setIfNotExists(g.shard(key), key, val, expire.Nanoseconds())
+}
+
+func (g *gache[V]) setIfNotExists(shard *Map[string, *value[V]], key string, val V, expire int64) (ok bool) {
+	_, ok = g.update(shard, key, func(old *value[V]) (*value[V], bool) {
+		if old != nil && g.valid(old) {
+			return nil, false
+		}
+		return &value[V]{
+			expire: absExpire(expire),
+			val:    val,
+		}, true
 	})
-	if !loaded {
-		atomic.AddUint64(&g.l, 1)
+	return ok
+}
+
+// SetIfVersion sets key-value using default expiration only when the stored version equals expected.
+// Version 0 matches an absent or expired key, versions restart from 1 once a key is deleted.
+func (g *gache[V]) SetIfVersion(key string, val V, expected uint64) bool {
+	return g.setIfVersion(key, val, expected, absExpire(atomic.LoadInt64(&g.expire)))
+}
+
+// SetIfVersionWithExpireAt sets key-value expiring at t only when the stored version equals expected, zero t means no expiration
+func (g *gache[V]) SetIfVersionWithExpireAt(key string, val V, expected uint64, t time.Time) bool {
+	return g.setIfVersion(key, val, expected, unixExpire(t))
+}
+
+func (g *gache[V]) setIfVersion(key string, val V, expected uint64, expire int64) (ok bool) {
+	_, ok = g.update(g.shard(key), key, func(old *value[V]) (*value[V], bool) {
+		var version uint64
+		if old != nil && g.valid(old) {
+			version = old.version
+		}
+		if version != expected {
+			return nil, false
+		}
+		return &value[V]{
+			expire: expire,
+			val:    val,
+		}, true
+	})
+	return ok
+}
+
+// TouchMany resets expiration of all live keys and returns the number of touched keys
+func (g *gache[V]) TouchMany(keys []string, expire time.Duration) (rows uint64) {
+	exp := absExpire(expire.Nanoseconds())
+	for idx, is := range g.groupByShard(keys) {
+		shard := g.shards[idx]
+		for _, i := range is {
+			if g.touch(shard, keys[i], exp) {
+				rows++
+			}
+		}
 	}
+	return rows
+}
+
+// Touch resets expiration of a live key to the default expiration
+func (g *gache[V]) Touch(key string) bool {
+	return g.touch(g.shard(key), key, absExpire(atomic.LoadInt64(&g.expire)))
+}
+
+// touch sets unix nano expiration of a live key
+func (g *gache[V]) touch(shard *Map[string, *value[V]], key string, expire int64) (ok bool) {
+	_, ok = g.retime(shard, key, func(old *value[V]) (*value[V], bool) {
+		if old == nil || !g.valid(old) {
+			return nil, false
+		}
+		val := *old
+		val.expire = expire
+		return &val, true
+	})
+	return ok
+}
+
+// ExtendExpire adds add to the expiration of a live key, keys without expiration are left as is
+func (g *gache[V]) ExtendExpire(key string, add time.Duration) (ok bool) {
+	_, ok = g.retime(g.shard(key), key, func(old *value[V]) (*value[V], bool) {
+		if old == nil || !g.valid(old) {
+			return nil, false
+		}
+		val := *old
+		if val.expire > 0 {
+			val.expire += add.Nanoseconds()
+		}
+		return &val, true
+	})
+	return ok
+}
+
+// SetIfExpiringWithin sets key-value & expiration only when key is absent or expires within window
+func (g *gache[V]) SetIfExpiringWithin(key string, val V, window, expire time.Duration) (ok bool) {
+	_, ok = g.update(g.shard(key), key, func(old *value[V]) (*value[V], bool) {
+		if old != nil && g.valid(old) &&
+			(old.expire <= 0 || old.expire-fastime.UnixNanoNow() >= window.Nanoseconds()) {
+			return nil, false
+		}
+		return &value[V]{
+			expire: absExpire(expire.Nanoseconds()),
+			val:    val,
+		}, true
+	})
+	return ok
 }
 
 // SetWithExpire sets key-value & expiration to Gache
 func (g *gache[V]) SetWithExpire(key string, val V, expire time.Duration) {
-	g.set(key, val, *(*int64)(unsafe.Pointer(&expire)))
+	g.set(g.shard(key), key, val, *(*int64)(unsafe.Pointer(&expire)))
+}
+
+// SetWithExpireReturningOld sets key-value & expiration to Gache and returns the previous live value
+func (g *gache[V]) SetWithExpireReturningOld(key string, val V, expire time.Duration) (v V, loaded bool) {
+	return g.swap(g.shard(key), key, val, expire.Nanoseconds())
+}
+
+// SetWithExpireAt sets key-value expiring at t, zero t means no expiration
+func (g *gache[V]) SetWithExpireAt(key string, val V, t time.Time) {
+	g.update(g.shard(key), key, func(*value[V]) (*value[V], bool) {
+		return &value[V]{
+			expire: unixExpire(t),
+			val:    val,
+		}, true
+	})
+}
+
+// ExpireAt sets expiration of a live key to t, zero t means no expiration
+func (g *gache[V]) ExpireAt(key string, t time.Time) bool {
+	return g.touch(g.shard(key), key, unixExpire(t))
+}
+
+// Persist removes the expiration of a live key
+func (g *gache[V]) Persist(key string) bool {
+	return g.touch(g.shard(key), key, NoTTL.Nanoseconds())
+}
+
+// Swap sets key-value using default expiration and returns the previous live value
+func (g *gache[V]) Swap(key string, val V) (prev V, loaded bool) {
+	return g.swap(g.shard(key), key, val, atomic.LoadInt64(&g.expire))
+}
+
+func (g *gache[V]) swap(shard *Map[string, *value[V]], key string, val V, expire int64) (v V, loaded bool) {
+	old, _ := g.update(shard, key, func(*value[V]) (*value[V], bool) {
+		return &value[V]{
+			expire: absExpire(expire),
+			val:    val,
+		}, true
+	})
+	if old != nil && g.valid(old) {
+		return old.val, true
+	}
+	return v, false
 }
 
 // Set sets key-value to Gache using default expiration
 func (g *gache[V]) Set(key string, val V) {
-	g.set(key, val, atomic.LoadInt64(&g.expire))
+	g.set(g.shard(key), key, val, atomic.LoadInt64(&g.expire))
+}
+
+// SetBytes is Set for a key held in a byte slice, key is copied since the cache keeps it
+func (g *gache[V]) SetBytes(key []byte, val V) {
+	g.Set(string(key), val)
 }
 
 // Delete deletes value from Gache using key
 func (g *gache[V]) Delete(key string) (v V, loaded bool) {
-	var val *value[V]
-	val, loaded = g.shards[getShardID(key)].LoadAndDelete(key)
-	if loaded {
-		atomic.AddUint64(&g.l, ^uint64(0))
-	}
+	return g.delete(g.shard(key), key)
+}
+
+// delete deletes value from shard using key
+func (g *gache[V]) delete(shard *Map[string, *value[V]], key string) (v V, loaded bool) {
+	g.unspill(key)
+	g.shadow(key)
+	val, loaded := g.loadAndDelete(shard, key, Deleted)
 	if val != nil && loaded {
 		return val.val, loaded
 	}
 	return v, loaded
 }
 
-func (g *gache[V]) expiration(key string) {
-	v, loaded := g.Delete(key)
+// loadAndDelete deletes key from shard and returns the stored value
+func (g *gache[V]) loadAndDelete(shard *Map[string, *value[V]], key string, reason Reason) (val *value[V], loaded bool) {
+	if g.frozen.Load() || g.rejected(key) {
+		return nil, false
+	}
+	a := g.aof.Load()
+	a.lock(key)
+	val, loaded = shard.LoadAndDelete(key)
+	if loaded && reason != Expired {
+		a.delete(g, key)
+	}
+	a.unlock(key)
+	if loaded {
+		g.uncount(key, val, reason)
+	}
+	return val, loaded
+}
+
+// Pop returns and deletes the live value of key in one operation
+func (g *gache[V]) Pop(key string) (v V, ok bool) {
+	val, loaded := g.loadAndDelete(g.shard(key), key, Deleted)
+	if !loaded || val == nil {
+		return v, false
+	}
+	if !g.valid(val) {
+		if !g.cleared(val) {
+			g.notifyExpired(key, val.val)
+		}
+		return v, false
+	}
+	return val.val, true
+}
 
-	if loaded && g.expFuncEnabled {
+// compareAndDelete deletes key from shard only when it still holds old
+func (g *gache[V]) compareAndDelete(shard *Map[string, *value[V]], key string, old *value[V]) (deleted bool) {
+	if g.frozen.Load() {
+		return false
+	}
+	a := g.aof.Load()
+	a.lock(key)
+	deleted = shard.CompareAndDelete(key, old)
+	if deleted {
+		a.delete(g, key)
+	}
+	a.unlock(key)
+	if deleted {
+		g.uncount(key, old, Deleted)
+	}
+	return deleted
+}
+
+func (g *gache[V]) expiration(shard *Map[string, *value[V]], key string) {
+	val, loaded := g.loadAndDelete(shard, key, Expired)
+
+	if loaded && val != nil && !g.cleared(val) {
+		g.notifyExpired(key, val.val)
+	}
+}
+
+// notifyExpired sends the expired key-value to the expired hook
+func (g *gache[V]) notifyExpired(key string, v V) {
+	if g.expFuncEnabled && (g.expFilter == nil || g.expFilter(key)) {
 		g.expChan <- keyValue[V]{key: key, value: v}
 	}
 }
 
 // DeleteExpired deletes expired value from Gache it can be cancel using context
 func (g *gache[V]) DeleteExpired(ctx context.Context) (rows uint64) {
+	start := time.Now()
+	var stats []ShardSweepStat
+	if g.sweepStats {
+		stats = make([]ShardSweepStat, len(g.shards))
+	}
+	defer func() {
+		g.lastSweep.Store(&sweep{
+			at:       start,
+			duration: time.Since(start),
+			removed:  rows,
+			shards:   stats,
+		})
+	}()
+	g.deleteExpiredNegatives()
+	g.deleteSpilled(true)
 	var wg sync.WaitGroup
 	for i := range g.shards {
 		wg.Add(1)
@@ -289,10 +1321,96 @@ func (g *gache[V]) DeleteExpired(ctx context.Context) (rows uint64) {
 			case <-c.Done():
 				return
 			default:
+				var (
+					begin            time.Time
+					scanned, removed uint64
+				)
+				if stats != nil {
+					begin = time.Now()
+				}
 				g.shards[idx].Range(func(k string, v *value[V]) (ok bool) {
-					if !v.isValid() {
-						g.expiration(k)
+					scanned++
+					if !g.valid(v) && !g.serveStale(v) && !g.fallback(v) {
+						g.expiration(g.shards[idx], k)
+						removed++
+					}
+					return true
+				})
+				atomic.AddUint64(&rows, removed)
+				if stats != nil {
+					stats[idx] = ShardSweepStat{
+						Shard:    idx,
+						Duration: time.Since(begin),
+						Scanned:  scanned,
+						Removed:  removed,
+					}
+				}
+			}
+		}(ctx, i)
+	}
+	wg.Wait()
+	return atomic.LoadUint64(&rows)
+}
+
+// DeleteByPrefix deletes all keys starting with prefix and returns the number of deleted live keys, it can be cancel using context
+func (g *gache[V]) DeleteByPrefix(ctx context.Context, prefix string) uint64 {
+	return g.deleteWhere(ctx, func(k string) bool {
+		return strings.HasPrefix(k, prefix)
+	}, false)
+}
+
+// DeleteByPattern deletes all keys matching the glob pattern where * matches any sequence and ? matches any single character
+func (g *gache[V]) DeleteByPattern(ctx context.Context, pattern string) uint64 {
+	return g.DeleteByRegexp(ctx, globRegexp(pattern))
+}
+
+// DeleteByRegexp deletes all keys matching re and returns the number of deleted live keys
+func (g *gache[V]) DeleteByRegexp(ctx context.Context, re *regexp.Regexp) uint64 {
+	return g.deleteWhere(ctx, re.MatchString, false)
+}
+
+// globRegexp compiles glob pattern to an anchored regexp
+func globRegexp(pattern string) *regexp.Regexp {
+	return regexp.MustCompile("^(?s:" + globExpr(pattern) + ")$")
+}
+
+// globExpr converts glob pattern to an unanchored regexp expression
+func globExpr(pattern string) string {
+	expr := regexp.QuoteMeta(pattern)
+	expr = strings.ReplaceAll(expr, `\*`, ".*")
+	return strings.ReplaceAll(expr, `\?`, ".")
+}
+
+// deleteWhere deletes keys matched by f from all shards in parallel and returns the number of deleted live keys,
+// notify invokes the expired hook for them and reports them to the evicted hook as cleared
+func (g *gache[V]) deleteWhere(ctx context.Context, f func(string) bool, notify bool) (rows uint64) {
+	var wg sync.WaitGroup
+	for i := range g.shards {
+		wg.Add(1)
+		go func(c context.Context, idx int) {
+			defer wg.Done()
+			select {
+			case <-c.Done():
+				return
+			default:
+				shard := g.shards[idx]
+				shard.Range(func(k string, v *value[V]) (ok bool) {
+					if !f(k) {
+						return true
+					}
+					if !g.valid(v) {
+						g.expiration(shard, k)
+						return true
+					}
+					reason := Deleted
+					if notify {
+						reason = Cleared
+					}
+					if v, ok := g.loadAndDelete(shard, k, reason); ok && v != nil {
 						atomic.AddUint64(&rows, 1)
+						if notify {
+							g.notifyExpired(k, v.val)
+						}
 					}
 					return true
 				})
@@ -303,6 +1421,22 @@ func (g *gache[V]) DeleteExpired(ctx context.Context) (rows uint64) {
 	return atomic.LoadUint64(&rows)
 }
 
+// LastSweep returns start time, duration and removed rows of the last completed DeleteExpired
+func (g *gache[V]) LastSweep() (at time.Time, duration time.Duration, removed uint64) {
+	if s := g.lastSweep.Load(); s != nil {
+		return s.at, s.duration, s.removed
+	}
+	return at, duration, removed
+}
+
+// LastSweepPerShard returns per-shard stats of the last completed DeleteExpired, it requires WithSweepStats
+func (g *gache[V]) LastSweepPerShard() []ShardSweepStat {
+	if s := g.lastSweep.Load(); s != nil && s.shards != nil {
+		return append([]ShardSweepStat(nil), s.shards...)
+	}
+	return nil
+}
+
 // Range calls f sequentially for each key and value present in the Gache.
 func (g *gache[V]) Range(ctx context.Context, f func(string, V, int64) bool) Gache[V] {
 	wg := new(sync.WaitGroup)
@@ -315,10 +1449,10 @@ func (g *gache[V]) Range(ctx context.Context, f func(string, V, int64) bool) Gac
 				return
 			default:
 				g.shards[idx].Range(func(k string, v *value[V]) (ok bool) {
-					if v.isValid() {
+					if g.valid(v) {
 						return f(k, v.val, v.expire)
 					}
-					g.expiration(k)
+					g.expiration(g.shards[idx], k)
 					return true
 				})
 			}
@@ -333,24 +1467,48 @@ func (g *gache[V]) RangeIter() iter.Seq2[string, V] {
 	return func(yield func(string, V) bool) {
 		for _, s := range g.shards {
 			for k, v := range s.RangeIter() {
-				if v.isValid() {
+				if g.valid(v) {
 					if !yield(k, v.val) {
 						return
 					}
 				} else {
-					g.expiration(k)
+					g.expiration(s, k)
 				}
 			}
 		}
 	}
 }
 
+// Keys returns all live keys, it can be cancel using context
+func (g *gache[V]) Keys(ctx context.Context) []string {
+	keys := make([]string, 0, g.Len())
+	mu := new(sync.Mutex)
+	g.Range(ctx, func(key string, _ V, _ int64) bool {
+		mu.Lock()
+		keys = append(keys, key)
+		mu.Unlock()
+		return true
+	})
+	return keys
+}
+
+// KeysIter returns iterator of live keys
+func (g *gache[V]) KeysIter() iter.Seq[string] {
+	return func(yield func(string) bool) {
+		for k := range g.RangeIter() {
+			if !yield(k) {
+				return
+			}
+		}
+	}
+}
+
 // RangeIterValue returns iterator value for Gache
 func (g *gache[V]) RangeIterValue() iter.Seq[V] {
 	return func(yield func(V) bool) {
 		for _, s := range g.shards {
 			for v := range s.RangeIterValue() {
-				if v.isValid() {
+				if g.valid(v) {
 					if !yield(v.val) {
 						return
 					}
@@ -360,44 +1518,191 @@ func (g *gache[V]) RangeIterValue() iter.Seq[V] {
 	}
 }
 
+// Stream emits all live entries to the returned channel which is closed when done or ctx is canceled
+func (g *gache[V]) Stream(ctx context.Context) <-chan Entry[V] {
+	ch := make(chan Entry[V], streamBufferSize)
+	go func() {
+		defer close(ch)
+		for _, s := range g.shards {
+			for k, v := range s.RangeIter() {
+				if !g.valid(v) {
+					g.expiration(s, k)
+					continue
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case ch <- g.entry(k, v):
+				}
+			}
+		}
+	}()
+	return ch
+}
+
 // Len returns stored object length
 func (g *gache[V]) Len() int {
 	l := atomic.LoadUint64(&g.l)
 	return *(*int)(unsafe.Pointer(&l))
 }
 
+// ShardLens returns the length of each shard as counted by DistributionScore, deleted entries not yet reclaimed included
+func (g *gache[V]) ShardLens() []int {
+	lens := make([]int, len(g.shards))
+	for i, shard := range g.shards {
+		lens[i] = shard.Len()
+	}
+	return lens
+}
+
+// ShardKeys returns the live keys of shard i, nil when i is out of range.
+// Walking the shards up to the length of ShardLens visits the cache one shard at a time.
+func (g *gache[V]) ShardKeys(i int) (keys []string) {
+	if i < 0 || i >= len(g.shards) {
+		return nil
+	}
+	for key, val := range g.shards[i].RangeIter() {
+		if g.valid(val) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// DistributionScore returns coefficient of variation of per-shard lengths, 0 means keys are evenly distributed
+func (g *gache[V]) DistributionScore() float64 {
+	var sum, sqSum float64
+	for _, shard := range g.shards {
+		l := float64(shard.Len())
+		sum += l
+		sqSum += l * l
+	}
+	if sum == 0 {
+		return 0
+	}
+	n := float64(len(g.shards))
+	mean := sum / n
+	return math.Sqrt(math.Max(sqSum/n-mean*mean, 0)) / mean
+}
+
+// Stats returns a snapshot of the operation counters, all counters are zero unless WithStats is set.
+// Sets counts every successful write including expiration updates, expired entries removed by Delete are counted as Expired.
+// Stale counts expired values served by WithStaleTTL and WithStaleIfError.
+func (g *gache[V]) Stats() (s Stats) {
+	if g.stats == nil {
+		return s
+	}
+	return Stats{
+		Hits:       g.stats.hits.Load(),
+		Misses:     g.stats.misses.Load(),
+		Sets:       g.stats.sets.Load(),
+		Deletes:    g.stats.deletes.Load(),
+		Expired:    g.stats.expired.Load(),
+		Evictions:  g.stats.evictions.Load(),
+		Rejections: g.stats.rejections.Load(),
+		Stale:      g.stats.stale.Load(),
+	}
+}
+
+// ResetStats sets all operation counters to zero
+func (g *gache[V]) ResetStats() {
+	if g.stats == nil {
+		return
+	}
+	g.stats.hits.Store(0)
+	g.stats.misses.Store(0)
+	g.stats.sets.Store(0)
+	g.stats.deletes.Store(0)
+	g.stats.expired.Store(0)
+	g.stats.evictions.Store(0)
+	g.stats.rejections.Store(0)
+	g.stats.stale.Store(0)
+}
+
+// LenDelta returns the change of stored object length since the previous LenDelta call
+func (g *gache[V]) LenDelta() int {
+	l := atomic.LoadUint64(&g.l)
+	prev := atomic.SwapUint64(&g.lastLen, l)
+	return int(l) - int(prev)
+}
+
 func (g *gache[V]) Size() (size uintptr) {
 	size += unsafe.Sizeof(g.expFuncEnabled) // bool
+	size += unsafe.Sizeof(g.frozen)         // atomic.Bool
+	size += unsafe.Sizeof(g.rejectEmptyKey) // bool
+	size += unsafe.Sizeof(g.sweepStats)     // bool
+	size += unsafe.Sizeof(g.trackEntries)   // bool
+	size += unsafe.Sizeof(g.writeTimes)     // bool
+	size += unsafe.Sizeof(g.stats)          // *counters
+	size += unsafe.Sizeof(g.logger)         // *slog.Logger
+	size += unsafe.Sizeof(g.evict)          // *evictor[V]
+	size += unsafe.Sizeof(g.evictPolicy)    // EvictionPolicy
+	size += unsafe.Sizeof(g.tinyLFU)        // bool
+	size += unsafe.Sizeof(g.weigher)        // func(string, V) int64
+	size += g.pins.Size()                   // Map[string, bool]
+	size += unsafe.Sizeof(g.pinned)         // int64
+	size += unsafe.Sizeof(g.evictFunc)      // func(context.Context, string, V, Reason)
+	size += unsafe.Sizeof(g.setFunc)        // func(context.Context, string, V, V, bool)
+	size += unsafe.Sizeof(g.deleteFunc)     // func(context.Context, string, V)
+	size += unsafe.Sizeof(g.watchers)       // watchers[V]
+	size += unsafe.Sizeof(g.history)        // *history[V]
+	size += unsafe.Sizeof(g.nsLens)         // atomic.Pointer[namespaceLens]
 	size += unsafe.Sizeof(g.expire)         // int64
 	size += unsafe.Sizeof(g.l)              // uint64
+	size += unsafe.Sizeof(g.stale)          // uint64
+	size += unsafe.Sizeof(g.gen)            // uint32
+	size += unsafe.Sizeof(g.lastLen)        // uint64
 	size += unsafe.Sizeof(g.cancel)         // atomic.Pointer[context.CancelFunc]
+	size += unsafe.Sizeof(g.lastSweep)      // atomic.Pointer[sweep]
 	size += unsafe.Sizeof(g.expChan)        // chan keyValue[V]
 	size += unsafe.Sizeof(g.expFunc)        // func(context.Context, string, V)
+	size += unsafe.Sizeof(g.expFilter)      // func(string) bool
+	size += unsafe.Sizeof(g.shardFunc)      // func(string) int
+	size += unsafe.Sizeof(g.hasher)         // func(string) uint64
+	size += unsafe.Sizeof(g.shards)         // []*Map[string, *value[V]]
+	size += unsafe.Sizeof(g.shardMask)      // uint64
+	size += unsafe.Sizeof(g.equal)          // func(V, V) bool
+	size += g.tags.Size()                   // Map[string, *Map[string, bool]]
+	size += unsafe.Sizeof(g.group)          // singleflight.Group
+	size += unsafe.Sizeof(g.loads)          // singleflight.Group
+	size += unsafe.Sizeof(g.loader)         // func(context.Context, string) (V, time.Duration, error)
+	size += unsafe.Sizeof(g.batchLoader)    // func(context.Context, []string) (map[string]V, time.Duration, error)
+	size += unsafe.Sizeof(g.refreshWindow)  // int64
+	size += unsafe.Sizeof(g.staleTTL)       // int64
+	size += unsafe.Sizeof(g.staleIfError)   // int64
+	size += unsafe.Sizeof(g.retry)          // *retry
+	size += unsafe.Sizeof(g.breaker)        // *breaker
+	size += g.negatives.Size()              // Map[string, int64]
+	size += unsafe.Sizeof(g.negative)       // int64
+	size += unsafe.Sizeof(g.negativeTTL)    // int64
+	size += unsafe.Sizeof(g.codec)          // Codec
+	size += unsafe.Sizeof(g.compression)    // Compression
+	size += unsafe.Sizeof(g.snapshotKey)    // []byte
+	size += unsafe.Sizeof(g.generations)    // int
+	size += unsafe.Sizeof(g.aof)            // atomic.Pointer[aof[V]]
+	size += unsafe.Sizeof(g.aofSync)        // AOFSync
+	size += unsafe.Sizeof(g.aofCompaction)  // time.Duration
+	size += unsafe.Sizeof(g.tier)           // Tier
+	size += g.spilled.Size()                // Map[string, int64]
+	size += unsafe.Sizeof(g.mapped)         // atomic.Pointer[mapped]
+	size += g.shadowed.Size()               // Map[string, bool]
+	size += unsafe.Sizeof(g.lastSave)       // atomic.Pointer[SaveStatus]
+	size += g.refreshing.Size()             // Map[string, bool]
+	size += unsafe.Sizeof(g.after)          // func(time.Duration) <-chan time.Time
+	if g.stats != nil {
+		size += unsafe.Sizeof(*g.stats)
+	}
 	for _, shard := range g.shards {
 		size += shard.Size()
 	}
 	return size
 }
 
-// Write writes all cached data to writer
-func (g *gache[V]) Write(ctx context.Context, w io.Writer) error {
-	m := g.ToRawMap(ctx)
-	gob.Register(map[string]V{})
-	return gob.NewEncoder(w).Encode(&m)
-}
-
-// Read reads reader data to cache
-func (g *gache[V]) Read(r io.Reader) error {
-	var m map[string]V
-	gob.Register(map[string]V{})
-	err := gob.NewDecoder(r).Decode(&m)
-	if err != nil {
-		return err
+// log emits a record to the logger set by WithLogger
+func (g *gache[V]) log(ctx context.Context, level slog.Level, msg string, args ...any) {
+	if g.logger != nil {
+		g.logger.Log(ctx, level, msg, args...)
 	}
-	for k, v := range m {
-		go g.Set(k, v)
-	}
-	return nil
 }
 
 // Stop kills expire daemon
@@ -410,15 +1715,74 @@ func (g *gache[V]) Stop() {
 
 // Clear deletes all key and value present in the Gache.
 func (g *gache[V]) Clear() {
+	if g.frozen.Load() {
+		return
+	}
 	for i := range g.shards {
 		if g.shards[i] == nil {
 			g.shards[i] = newMap[V]()
 		} else {
+			if g.observed() {
+				for k, v := range g.shards[i].RangeIter() {
+					if g.valid(v) {
+						g.notifyEvicted(k, v.val, Cleared)
+					}
+				}
+			}
 			g.shards[i].Clear()
 		}
 	}
+	if a := g.aof.Load(); a != nil {
+		a.append(g, aofRecord[V]{Op: aofClear})
+	}
+	g.deleteSpilled(false)
+	g.CloseMapped()
+	g.tags.Clear()
+	g.negatives.Clear()
+	atomic.StoreInt64(&g.negative, 0)
+	atomic.StoreUint64(&g.l, 0)
+	atomic.StoreUint64(&g.stale, 0)
+	g.resetNamespaces()
+	g.resetEviction()
+}
+
+// ClearWithHooks deletes all key and value present in the Gache, the expired hook is invoked for every removed entry and the count of removed entries is returned
+func (g *gache[V]) ClearWithHooks(ctx context.Context) uint64 {
+	rows := g.deleteWhere(ctx, func(string) bool {
+		return true
+	}, true)
+	if !g.frozen.Load() {
+		g.tags.Clear()
+	}
+	return rows
+}
+
+// LazyClear marks all key and value present in the Gache as deleted in O(1),
+// the marked entries are reclaimed lazily on access and by DeleteExpired without firing the expired hook.
+// Len may drift when entries are written concurrently with LazyClear.
+func (g *gache[V]) LazyClear() {
+	if g.frozen.Load() {
+		return
+	}
+	atomic.AddUint32(&g.gen, 1)
+	if a := g.aof.Load(); a != nil {
+		a.append(g, aofRecord[V]{Op: aofClear})
+	}
+	g.deleteSpilled(false)
+	g.CloseMapped()
+	atomic.AddUint64(&g.stale, atomic.SwapUint64(&g.l, 0))
+	g.resetNamespaces()
+	g.tags.Clear()
+	g.resetEviction()
 }
 
 func (v *value[V]) Size() (size uintptr) {
-	return unsafe.Sizeof(v.expire) + unsafe.Sizeof(v.val)
+	size = unsafe.Sizeof(v.expire) + unsafe.Sizeof(v.version) + unsafe.Sizeof(v.meta) + unsafe.Sizeof(v.gen) + unsafe.Sizeof(v.val)
+	if v.meta != nil {
+		size += unsafe.Sizeof(*v.meta)
+		for _, tag := range v.meta.tags {
+			size += uintptr(len(tag))
+		}
+	}
+	return size
 }
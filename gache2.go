@@ -0,0 +1,372 @@
+package gache
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"reflect"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"github.com/kpango/fastime"
+	"github.com/zeebo/xxh3"
+)
+
+type (
+	// Gache2 is a cache of keys of any comparable type, it avoids formatting ints, arrays or small structs into string
+	// keys. It offers the core operations of Gache, keys are hashed by the hasher set by WithHasher2 to select their shard.
+	Gache2[K comparable, V any] interface {
+		Clear()
+		Delete(K) (V, bool)
+		DeleteExpired(context.Context) uint64
+		ExpireAt(K, time.Time) bool
+		Get(K) (V, bool)
+		GetOrSet(K, V) (V, bool)
+		GetWithExpire(K) (V, int64, bool)
+		GetWithTTL(K) (V, time.Duration, bool)
+		Keys(context.Context) []K
+		Len() int
+		Persist(K) bool
+		Range(context.Context, func(K, V, int64) bool) Gache2[K, V]
+		RangeIter() iter.Seq2[K, V]
+		Set(K, V)
+		SetDefaultExpire(time.Duration) Gache2[K, V]
+		SetIfNotExists(K, V) bool
+		SetWithExpire(K, V, time.Duration)
+		SetWithExpireAt(K, V, time.Time)
+		StartExpired(context.Context, time.Duration) Gache2[K, V]
+		Stop()
+	}
+
+	// Option2 configures New2
+	Option2[K comparable, V any] func(g *gache2[K, V]) error
+
+	// gache2 is the Gache2 instance type
+	gache2[K comparable, V any] struct {
+		shards []*Map[K, *value2[V]]
+		mask   uint64
+		hash   func(K) uint64
+		expire int64
+		l      atomic.Int64
+		cancel atomic.Pointer[context.CancelFunc]
+	}
+
+	// value2 is a stored value of Gache2 with its unix nano expiration, zero or negative never expires
+	value2[V any] struct {
+		expire int64
+		val    V
+	}
+)
+
+// WithHasher2 sets the function hashing keys to select their shard, it is required for key types other than strings,
+// bools, integers and arrays of them
+func WithHasher2[K comparable, V any](hash func(key K) uint64) Option2[K, V] {
+	return func(g *gache2[K, V]) error {
+		if hash != nil {
+			g.hash = hash
+		}
+		return nil
+	}
+}
+
+// WithDefaultExpiration2 sets the expiration of Set, 30 seconds by default
+func WithDefaultExpiration2[K comparable, V any](dur time.Duration) Option2[K, V] {
+	return func(g *gache2[K, V]) error {
+		if dur > 0 {
+			g.expire = dur.Nanoseconds()
+		}
+		return nil
+	}
+}
+
+// WithShardCount2 is WithShardCount for Gache2
+func WithShardCount2[K comparable, V any](n int) Option2[K, V] {
+	return func(g *gache2[K, V]) error {
+		if n > 0 {
+			n = shardCount(n)
+			g.shards, g.mask = make([]*Map[K, *value2[V]], n), uint64(n-1)
+		}
+		return nil
+	}
+}
+
+// New2 returns a Gache2 instance, it panics when K has no default hasher and WithHasher2 is not passed
+func New2[K comparable, V any](opts ...Option2[K, V]) Gache2[K, V] {
+	g := new(gache2[K, V])
+	for _, opt := range append([]Option2[K, V]{
+		WithDefaultExpiration2[K, V](time.Second * 30),
+	}, opts...) {
+		opt(g)
+	}
+	if g.shards == nil {
+		g.shards, g.mask = make([]*Map[K, *value2[V]], slen), mask
+	}
+	if g.hash == nil {
+		g.hash = keyHasher[K]()
+	}
+	if g.hash == nil {
+		panic(fmt.Sprintf("gache: New2 needs WithHasher2 for key type %s", reflect.TypeFor[K]()))
+	}
+	for i := range g.shards {
+		g.shards[i] = new(Map[K, *value2[V]])
+	}
+	return g
+}
+
+// keyHasher returns the default hasher of K, nil for types whose memory does not identify their value like
+// floats, pointers, interfaces and structs that may hold padding or strings
+func keyHasher[K comparable]() func(K) uint64 {
+	t := reflect.TypeFor[K]()
+	if t.Kind() == reflect.String {
+		return func(key K) uint64 {
+			s := *(*string)(unsafe.Pointer(&key))
+			if len(s) > maxHashKeyLength {
+				s = s[:maxHashKeyLength]
+			}
+			return xxh3.HashString(s)
+		}
+	}
+	if !plainMemory(t) {
+		return nil
+	}
+	size := t.Size()
+	return func(key K) uint64 {
+		return xxh3.Hash(unsafe.Slice((*byte)(unsafe.Pointer(&key)), size))
+	}
+}
+
+// plainMemory reports whether equal values of t have equal bytes
+func plainMemory(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return true
+	case reflect.Array:
+		return plainMemory(t.Elem())
+	}
+	return false
+}
+
+func (g *gache2[K, V]) shard(key K) *Map[K, *value2[V]] {
+	return g.shards[g.hash(key)&g.mask]
+}
+
+func (v *value2[V]) valid() bool {
+	return v.expire <= 0 || fastime.UnixNanoNow() <= v.expire
+}
+
+// Get returns value & exists from key
+func (g *gache2[K, V]) Get(key K) (v V, ok bool) {
+	v, _, ok = g.GetWithExpire(key)
+	return v, ok
+}
+
+// GetWithExpire returns value & expire & exists from key
+func (g *gache2[K, V]) GetWithExpire(key K) (v V, expire int64, ok bool) {
+	shard := g.shard(key)
+	val, ok := shard.Load(key)
+	if !ok {
+		return v, 0, false
+	}
+	if !val.valid() {
+		if shard.CompareAndDelete(key, val) {
+			g.l.Add(-1)
+		}
+		return v, 0, false
+	}
+	return val.val, val.expire, true
+}
+
+// GetWithTTL returns value & remaining lifetime & exists from key, NoTTL is returned for keys without expiration
+func (g *gache2[K, V]) GetWithTTL(key K) (v V, ttl time.Duration, ok bool) {
+	v, expire, ok := g.GetWithExpire(key)
+	if !ok {
+		return v, 0, false
+	}
+	if expire <= 0 {
+		return v, NoTTL, true
+	}
+	return v, max(time.Duration(expire-fastime.UnixNanoNow()), 0), true
+}
+
+// Set sets key-value to Gache2 using default expiration
+func (g *gache2[K, V]) Set(key K, val V) {
+	g.set(key, val, absExpire(atomic.LoadInt64(&g.expire)))
+}
+
+// SetWithExpire sets key-value & expiration to Gache2
+func (g *gache2[K, V]) SetWithExpire(key K, val V, expire time.Duration) {
+	g.set(key, val, absExpire(expire.Nanoseconds()))
+}
+
+// SetWithExpireAt sets key-value expiring at t, zero t means no expiration
+func (g *gache2[K, V]) SetWithExpireAt(key K, val V, t time.Time) {
+	g.set(key, val, unixExpire(t))
+}
+
+func (g *gache2[K, V]) set(key K, val V, expire int64) {
+	if _, loaded := g.shard(key).Swap(key, &value2[V]{expire: expire, val: val}); !loaded {
+		g.l.Add(1)
+	}
+}
+
+// SetIfNotExists sets key-value using default expiration only when key is not live
+func (g *gache2[K, V]) SetIfNotExists(key K, val V) bool {
+	_, loaded := g.GetOrSet(key, val)
+	return !loaded
+}
+
+// GetOrSet returns the live value of key if present, otherwise it sets val using default expiration and returns it
+func (g *gache2[K, V]) GetOrSet(key K, val V) (actual V, loaded bool) {
+	shard := g.shard(key)
+	nv := &value2[V]{expire: absExpire(atomic.LoadInt64(&g.expire)), val: val}
+	for {
+		old, loaded := shard.LoadOrStore(key, nv)
+		if !loaded {
+			g.l.Add(1)
+			return val, false
+		}
+		if old.valid() {
+			return old.val, true
+		}
+		if shard.CompareAndSwap(key, old, nv) {
+			return val, false
+		}
+	}
+}
+
+// Delete deletes value from Gache2 using key, it returns the deleted live value
+func (g *gache2[K, V]) Delete(key K) (v V, loaded bool) {
+	old, loaded := g.shard(key).LoadAndDelete(key)
+	if !loaded {
+		return v, false
+	}
+	g.l.Add(-1)
+	if !old.valid() {
+		return v, false
+	}
+	return old.val, true
+}
+
+// ExpireAt sets expiration of a live key to t, zero t means no expiration
+func (g *gache2[K, V]) ExpireAt(key K, t time.Time) bool {
+	return g.retime(key, unixExpire(t))
+}
+
+// Persist removes the expiration of a live key
+func (g *gache2[K, V]) Persist(key K) bool {
+	return g.retime(key, NoTTL.Nanoseconds())
+}
+
+func (g *gache2[K, V]) retime(key K, expire int64) bool {
+	shard := g.shard(key)
+	for {
+		old, ok := shard.Load(key)
+		if !ok || !old.valid() {
+			return false
+		}
+		if shard.CompareAndSwap(key, old, &value2[V]{expire: expire, val: old.val}) {
+			return true
+		}
+	}
+}
+
+// Range calls f for every live key-value and its unix nano expiration until f returns false or ctx is done
+func (g *gache2[K, V]) Range(ctx context.Context, f func(K, V, int64) bool) Gache2[K, V] {
+	for _, shard := range g.shards {
+		if ctx.Err() != nil {
+			return g
+		}
+		for k, v := range shard.RangeIter() {
+			if v.valid() && !f(k, v.val, v.expire) {
+				return g
+			}
+		}
+	}
+	return g
+}
+
+// RangeIter returns an iterator over the live key-values
+func (g *gache2[K, V]) RangeIter() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		for _, shard := range g.shards {
+			for k, v := range shard.RangeIter() {
+				if v.valid() && !yield(k, v.val) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// Keys returns the live keys
+func (g *gache2[K, V]) Keys(ctx context.Context) []K {
+	keys := make([]K, 0, g.Len())
+	g.Range(ctx, func(key K, _ V, _ int64) bool {
+		keys = append(keys, key)
+		return true
+	})
+	return keys
+}
+
+// Len returns the number of stored keys, expired keys not yet deleted included
+func (g *gache2[K, V]) Len() int {
+	return int(g.l.Load())
+}
+
+// DeleteExpired deletes the expired keys and returns their number
+func (g *gache2[K, V]) DeleteExpired(ctx context.Context) (rows uint64) {
+	for _, shard := range g.shards {
+		if ctx.Err() != nil {
+			return rows
+		}
+		for k, v := range shard.RangeIter() {
+			if !v.valid() && shard.CompareAndDelete(k, v) {
+				g.l.Add(-1)
+				rows++
+			}
+		}
+	}
+	return rows
+}
+
+// Clear deletes all keys
+func (g *gache2[K, V]) Clear() {
+	for _, shard := range g.shards {
+		shard.Clear()
+	}
+	g.l.Store(0)
+}
+
+// SetDefaultExpire sets the expiration of Set, NoTTL disables it
+func (g *gache2[K, V]) SetDefaultExpire(ex time.Duration) Gache2[K, V] {
+	atomic.StoreInt64(&g.expire, ex.Nanoseconds())
+	return g
+}
+
+// StartExpired starts the daemon deleting expired keys every dur until ctx is done or Stop is called
+func (g *gache2[K, V]) StartExpired(ctx context.Context, dur time.Duration) Gache2[K, V] {
+	ctx, cancel := context.WithCancel(ctx)
+	g.cancel.Store(&cancel)
+	go func() {
+		tick := time.NewTicker(dur)
+		defer tick.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-tick.C:
+				g.DeleteExpired(ctx)
+			}
+		}
+	}()
+	return g
+}
+
+// Stop stops the expire daemon started by StartExpired
+func (g *gache2[K, V]) Stop() {
+	if c := g.cancel.Load(); c != nil {
+		(*c)()
+	}
+}
@@ -173,6 +173,25 @@ func BenchmarkGacheSetBigDataWithTTL(b *testing.B) {
 		func(k string) { g.Get(k) })
 }
 
+func BenchmarkGacheBoolMemoryPerEntry(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var before, after runtime.MemStats
+		runtime.GC()
+		runtime.ReadMemStats(&before)
+		g := New[bool](
+			WithDefaultExpiration[bool](NoTTL),
+		)
+		for j := 0; j < 10000; j++ {
+			g.Set(Int64Key(int64(j)), j%2 == 0)
+		}
+		runtime.GC()
+		runtime.ReadMemStats(&after)
+		b.ReportMetric(float64(after.HeapAlloc-before.HeapAlloc)/float64(g.Len()), "B/entry")
+		runtime.KeepAlive(g)
+	}
+}
+
 func TestMain(m *testing.M) {
 	setup()
 	code := m.Run()
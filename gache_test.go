@@ -0,0 +1,3161 @@
+package gache
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"hash/maphash"
+	"io"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/kpango/fastime"
+	"github.com/zeebo/xxh3"
+)
+
+// setExpired stores an already expired value for key
+func setExpired[V any](g Gache[V], key string, val V) {
+	gc := g.(*gache[V])
+	gc.update(gc.shard(key), key, func(*value[V]) (*value[V], bool) {
+		return &value[V]{val: val, expire: 1}, true
+	})
+}
+
+func TestHandle(t *testing.T) {
+	g := New[int]()
+	h := g.Handle("key")
+	if _, ok := h.Get(); ok {
+		t.Fatal("empty handle returned a value")
+	}
+	h.Set(1)
+	if v, ok := g.Get("key"); !ok || v != 1 {
+		t.Fatalf("Get after handle Set = %d, %v", v, ok)
+	}
+	if ttl, ok := h.TTL(); !ok || ttl <= 0 || ttl > time.Second*30 {
+		t.Fatalf("TTL = %v, %v", ttl, ok)
+	}
+	h.SetWithExpire(2, NoTTL)
+	if ttl, ok := h.TTL(); !ok || ttl != NoTTL {
+		t.Fatalf("TTL without expiration = %v, %v", ttl, ok)
+	}
+	g.Clear()
+	h.Set(3)
+	if v, ok := h.Get(); !ok || v != 3 {
+		t.Fatalf("Get after Clear = %d, %v", v, ok)
+	}
+	if v, ok := h.Delete(); !ok || v != 3 {
+		t.Fatalf("Delete = %d, %v", v, ok)
+	}
+	if g.Len() != 0 {
+		t.Fatalf("Len after Delete = %d", g.Len())
+	}
+}
+
+func TestSetIfExpiringWithin(t *testing.T) {
+	g := New[int]()
+	if !g.SetIfExpiringWithin("key", 1, time.Second, time.Minute) {
+		t.Fatal("absent key was not set")
+	}
+	if g.SetIfExpiringWithin("key", 2, time.Second, time.Minute) {
+		t.Fatal("key with plenty of life was overwritten")
+	}
+	if !g.SetIfExpiringWithin("key", 3, time.Hour, time.Minute) {
+		t.Fatal("key expiring within window was not overwritten")
+	}
+	g.SetWithExpire("key", 4, NoTTL)
+	if g.SetIfExpiringWithin("key", 5, time.Hour, time.Minute) {
+		t.Fatal("key without expiration was overwritten")
+	}
+	if v, ok := g.Get("key"); !ok || v != 4 {
+		t.Fatalf("Get = %d, %v", v, ok)
+	}
+	if g.Len() != 1 {
+		t.Fatalf("Len = %d", g.Len())
+	}
+}
+
+func TestStream(t *testing.T) {
+	g := New[int]()
+	for i := 0; i < 100; i++ {
+		g.Set(strconv.Itoa(i), i)
+	}
+	setExpired(g, "expired", -1)
+
+	m := make(map[string]int)
+	for e := range g.Stream(context.Background()) {
+		m[e.Key] = e.Value
+	}
+	if len(m) != 100 {
+		t.Fatalf("Stream emitted %d entries", len(m))
+	}
+	if _, ok := m["expired"]; ok {
+		t.Fatal("Stream emitted expired entry")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := g.Stream(ctx)
+	cancel()
+	for range ch {
+	}
+}
+
+func TestLastSweep(t *testing.T) {
+	g := New[int]()
+	if at, _, _ := g.LastSweep(); !at.IsZero() {
+		t.Fatalf("LastSweep before any sweep = %v", at)
+	}
+	setExpired(g, "expired", 1)
+	g.Set("live", 2)
+	before := time.Now()
+	g.DeleteExpired(context.Background())
+	at, dur, removed := g.LastSweep()
+	if at.Before(before) || dur <= 0 || removed != 1 {
+		t.Fatalf("LastSweep = %v, %v, %d", at, dur, removed)
+	}
+}
+
+func TestWithShardFunc(t *testing.T) {
+	g := New(WithShardFunc[int](func(key string) int {
+		if key == "negative" {
+			return -1
+		}
+		return slen + 3
+	})).(*gache[int])
+	g.Set("a", 1)
+	g.Set("negative", 2)
+	if g.shards[3].Len() != 1 || g.shards[mask].Len() != 1 {
+		t.Fatal("shard func index was not masked into range")
+	}
+	if v, ok := g.Get("negative"); !ok || v != 2 {
+		t.Fatalf("Get = %d, %v", v, ok)
+	}
+}
+
+func TestWithHasher(t *testing.T) {
+	var calls atomic.Int64
+	seed := maphash.MakeSeed()
+	g := New(WithShardCount[int](8), WithTinyLFU[int](), WithMaxEntries[int](100), WithHasher[int](func(key string) uint64 {
+		calls.Add(1)
+		return maphash.String(seed, key)
+	})).(*gache[int])
+	for i := range 50 {
+		g.Set(strconv.Itoa(i), i)
+	}
+	if v, ok := g.Get("42"); !ok || v != 42 {
+		t.Fatalf("Get = %d, %v", v, ok)
+	}
+	if calls.Load() == 0 {
+		t.Fatal("hasher was not called")
+	}
+	if got, want := g.shardIndex("42"), maphash.String(seed, "42")&7; got != want {
+		t.Fatalf("shard index = %d, want %d", got, want)
+	}
+
+	// every key hashing alike lands in one shard, the shard function still takes precedence
+	same := New(WithHasher[int](func(string) uint64 { return 5 })).(*gache[int])
+	for i := range 10 {
+		same.Set(strconv.Itoa(i), i)
+	}
+	if lens := same.ShardLens(); lens[5] != 10 {
+		t.Fatalf("shard 5 holds %d keys, want 10", lens[5])
+	}
+	if keys := same.ShardKeys(5); len(keys) != 10 || same.ShardKeys(4) != nil || same.ShardKeys(slen) != nil {
+		t.Fatalf("ShardKeys(5) = %v", keys)
+	}
+	same.Set("ns:1", 1)
+	if keys := same.Namespace("ns:").ShardKeys(5); !slices.Equal(keys, []string{"1"}) {
+		t.Fatalf("namespace ShardKeys(5) = %v", keys)
+	}
+	if New(WithHasher[int](func(string) uint64 { return 5 }), WithShardFunc[int](func(string) int { return 1 })).(*gache[int]).shardIndex("k") != 1 {
+		t.Fatal("WithShardFunc did not override WithHasher")
+	}
+}
+
+func TestWithShardCount(t *testing.T) {
+	for _, n := range []int{1, 16, 4096} {
+		g := New(WithShardCount[int](n)).(*gache[int])
+		if len(g.shards) != n || len(g.ShardLens()) != n {
+			t.Fatalf("WithShardCount(%d) made %d shards", n, len(g.shards))
+		}
+		for i := range 1000 {
+			g.Set(strconv.Itoa(i), i)
+		}
+		if v, ok := g.Get("999"); !ok || v != 999 || g.Len() != 1000 {
+			t.Fatalf("WithShardCount(%d) Get = %d, %v with %d entries", n, v, ok, g.Len())
+		}
+		if n == 16 && slices.Contains(g.ShardLens(), 0) {
+			t.Fatalf("WithShardCount(%d) left shards empty: %v", n, g.ShardLens())
+		}
+	}
+	for n, want := range map[int]int{0: slen, -4: slen, 3: 4, 100: 128, maxShardCount * 2: maxShardCount} {
+		if g := New(WithShardCount[int](n)).(*gache[int]); len(g.shards) != want || g.shardMask != uint64(want-1) {
+			t.Fatalf("WithShardCount(%d) made %d shards, want %d", n, len(g.shards), want)
+		}
+		if g := New2(WithShardCount2[int, int](n)).(*gache2[int, int]); len(g.shards) != want {
+			t.Fatalf("WithShardCount2(%d) made %d shards, want %d", n, len(g.shards), want)
+		}
+	}
+	// compared empty so only the shards are measured
+	if New(WithShardCount[int](4)).Size() >= New[int]().Size() {
+		t.Fatal("4 shards are not smaller than the default shards")
+	}
+}
+func TestLenDelta(t *testing.T) {
+	g := New[int]()
+	for i := 0; i < 10; i++ {
+		g.Set(strconv.Itoa(i), i)
+	}
+	if d := g.LenDelta(); d != 10 {
+		t.Fatalf("LenDelta after 10 sets = %d", d)
+	}
+	if d := g.LenDelta(); d != 0 {
+		t.Fatalf("LenDelta without change = %d", d)
+	}
+	g.Delete("0")
+	g.Delete("1")
+	if d := g.LenDelta(); d != -2 {
+		t.Fatalf("LenDelta after 2 deletes = %d", d)
+	}
+}
+
+func TestVersion(t *testing.T) {
+	g := New[string]()
+	if !g.SetIfVersion("key", "a", 0) {
+		t.Fatal("absent key did not match version 0")
+	}
+	_, v1, ok := g.GetWithVersion("key")
+	if !ok || v1 != 1 {
+		t.Fatalf("GetWithVersion = %d, %v", v1, ok)
+	}
+	g.Set("key", "b")
+	if g.SetIfVersion("key", "c", v1) {
+		t.Fatal("stale version was accepted")
+	}
+	val, v2, _ := g.GetWithVersion("key")
+	if val != "b" || v2 <= v1 {
+		t.Fatalf("GetWithVersion after Set = %s, %d", val, v2)
+	}
+	g.GetRefresh("key")
+	g.Touch("key")
+	g.ExpireAt("key", time.Now().Add(time.Hour))
+	if _, v, _ := g.GetWithVersion("key"); v != v2 {
+		t.Fatalf("expiration updates changed the version from %d to %d", v2, v)
+	}
+	if !g.SetIfVersion("key", "c", v2) {
+		t.Fatal("current version was rejected")
+	}
+	at := time.Now().Add(time.Hour)
+	if g.SetIfVersionWithExpireAt("key", "d", v2, at) || !g.SetIfVersionWithExpireAt("key", "d", v2+1, at) {
+		t.Fatal("SetIfVersionWithExpireAt did not check the version")
+	}
+	if _, v, _ := g.GetWithVersion("key"); v != v2+2 {
+		t.Fatalf("version after SetIfVersionWithExpireAt = %d, want %d", v, v2+2)
+	}
+	if ttl, _ := g.TTL("key"); ttl <= 59*time.Minute || ttl > 61*time.Minute {
+		t.Fatalf("TTL after SetIfVersionWithExpireAt = %v", ttl)
+	}
+	if g.Len() != 1 {
+		t.Fatalf("Len = %d", g.Len())
+	}
+	if v, ok := g.Freeze().GetRefresh("key"); !ok || v != "d" {
+		t.Fatalf("GetRefresh of frozen cache = %q, %v", v, ok)
+	}
+}
+
+func TestGetOrComputeWithRetry(t *testing.T) {
+	g := New[int]().(*gache[int])
+	var waits []time.Duration
+	g.after = func(d time.Duration) <-chan time.Time {
+		waits = append(waits, d)
+		ch := make(chan time.Time, 1)
+		ch <- time.Time{}
+		return ch
+	}
+	errFailed := errors.New("failed")
+
+	calls := 0
+	v, err := g.GetOrComputeWithRetry("key", func() (int, error) {
+		calls++
+		if calls < 3 {
+			return 0, errFailed
+		}
+		return 42, nil
+	}, 3, time.Second)
+	if err != nil || v != 42 || calls != 3 || len(waits) != 2 {
+		t.Fatalf("GetOrComputeWithRetry = %d, %v after %d calls and %d waits", v, err, calls, len(waits))
+	}
+	if v, err := g.GetOrComputeWithRetry("key", func() (int, error) {
+		t.Fatal("cached value was recomputed")
+		return 0, nil
+	}, 0, 0); err != nil || v != 42 {
+		t.Fatalf("cached GetOrComputeWithRetry = %d, %v", v, err)
+	}
+
+	calls = 0
+	if _, err := g.GetOrComputeWithRetry("fail", func() (int, error) {
+		calls++
+		return 0, errFailed
+	}, 2, time.Second); !errors.Is(err, errFailed) || calls != 3 {
+		t.Fatalf("failing GetOrComputeWithRetry = %v after %d calls", err, calls)
+	}
+	if _, ok := g.Get("fail"); ok {
+		t.Fatal("failure was cached")
+	}
+	// waits double up to 32 times backoff and are jittered down to half
+	waits = nil
+	g.GetOrComputeWithRetry("backoff", func() (int, error) {
+		return 0, errFailed
+	}, 8, time.Second)
+	jittered := false
+	for i, d := range waits {
+		nominal := min(time.Second<<i, 32*time.Second)
+		if d < nominal/2 || d > nominal {
+			t.Fatalf("wait %d = %v, want within [%v, %v]", i, d, nominal/2, nominal)
+		}
+		jittered = jittered || d != nominal
+	}
+	if len(waits) != 8 || !jittered {
+		t.Fatalf("waits = %v", waits)
+	}
+	calls = 0
+	if _, err := g.GetOrComputeWithRetry("missing", func() (int, error) {
+		calls++
+		return 0, ErrNotFound
+	}, 2, time.Second); !errors.Is(err, ErrNotFound) || calls != 1 {
+		t.Fatalf("GetOrComputeWithRetry reporting ErrNotFound = %v after %d calls", err, calls)
+	}
+}
+
+func TestTouchMany(t *testing.T) {
+	g := New[int]()
+	g.Set("a", 1)
+	g.Set("b", 2)
+	setExpired(g, "expired", 3)
+	if n := g.TouchMany([]string{"a", "b", "expired", "missing"}, time.Hour); n != 2 {
+		t.Fatalf("TouchMany = %d", n)
+	}
+	if _, exp, _ := g.GetWithExpire("a"); time.Duration(exp-time.Now().UnixNano()) < time.Minute*59 {
+		t.Fatalf("expiration was not extended: %d", exp)
+	}
+}
+
+func TestDistributionScore(t *testing.T) {
+	g := New[int]()
+	if s := g.DistributionScore(); s != 0 {
+		t.Fatalf("DistributionScore of empty cache = %f", s)
+	}
+	for i := 0; i < slen*100; i++ {
+		g.Set(strconv.Itoa(i), i)
+	}
+	even := g.DistributionScore()
+	if even <= 0 || even > 0.5 {
+		t.Fatalf("DistributionScore of hashed keys = %f", even)
+	}
+
+	skewed := New(WithShardFunc[int](func(string) int { return 0 }))
+	for i := 0; i < slen; i++ {
+		skewed.Set(strconv.Itoa(i), i)
+	}
+	if s := skewed.DistributionScore(); s <= even {
+		t.Fatalf("DistributionScore of single shard = %f, hashed = %f", s, even)
+	}
+	if lens := skewed.ShardLens(); len(lens) != slen || lens[0] != slen || lens[1] != 0 {
+		t.Fatalf("ShardLens of single shard = %v", lens)
+	}
+}
+
+func TestSetExpiredHookFilter(t *testing.T) {
+	g := New[int]().
+		SetExpiredHook(func(context.Context, string, int) {}).
+		EnableExpiredHook().
+		SetExpiredHookFilter(func(key string) bool { return strings.HasPrefix(key, "hook:") }).(*gache[int])
+	setExpired[int](g, "hook:a", 1)
+	setExpired[int](g, "other", 2)
+	if n := g.DeleteExpired(context.Background()); n != 2 {
+		t.Fatalf("DeleteExpired = %d", n)
+	}
+	if len(g.expChan) != 1 {
+		t.Fatalf("expired hook queued %d keys", len(g.expChan))
+	}
+	if kv := <-g.expChan; kv.key != "hook:a" {
+		t.Fatalf("expired hook queued %s", kv.key)
+	}
+}
+
+func TestValueSizeSmall(t *testing.T) {
+	// expire, version and meta take three words, gen and a small V must share one padded word
+	word := unsafe.Sizeof(int64(0))
+	base := 3 * word
+	for name, size := range map[string]uintptr{
+		"bool":   unsafe.Sizeof(value[bool]{}),
+		"uint8":  unsafe.Sizeof(value[uint8]{}),
+		"uint32": unsafe.Sizeof(value[uint32]{}),
+		"int32":  unsafe.Sizeof(value[int32]{}),
+	} {
+		if size != base+word {
+			t.Errorf("value[%s] size = %d, want %d", name, size, base+word)
+		}
+	}
+}
+
+func TestStats(t *testing.T) {
+	g := New(WithStats[int]())
+	g.Set("a", 1)
+	g.Set("b", 2)
+	g.Get("a")
+	g.Get("a")
+	g.Get("missing")
+	g.Delete("b")
+	setExpired(g, "c", 3)
+	g.Get("c")
+	want := Stats{Hits: 2, Misses: 2, Sets: 3, Deletes: 1, Expired: 1}
+	if s := g.Stats(); s != want {
+		t.Fatalf("Stats = %+v, want %+v", s, want)
+	}
+	g.ResetStats()
+	if s := g.Stats(); s != (Stats{}) {
+		t.Fatalf("Stats after ResetStats = %+v", s)
+	}
+	if s := New[int]().Stats(); s != (Stats{}) {
+		t.Fatalf("Stats without WithStats = %+v", s)
+	}
+}
+
+func TestWithExpvar(t *testing.T) {
+	g := New(WithExpvar[int]("gache_test_expvar"))
+	g.Set("a", 1)
+	g.Get("a")
+	g.Get("missing")
+	var got map[string]uint64
+	if err := json.Unmarshal([]byte(expvar.Get("gache_test_expvar").String()), &got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]uint64{"entries": 1, "hits": 1, "misses": 1, "sets": 1, "deletes": 0, "expired": 0}
+	if !maps.Equal(got, want) {
+		t.Fatalf("expvar = %v, want %v", got, want)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Fatal("publishing a duplicate name did not panic")
+		}
+	}()
+	New(WithExpvar[int]("gache_test_expvar"))
+}
+
+func TestWithLogger(t *testing.T) {
+	buf := new(bytes.Buffer)
+	g := New(WithLogger[int](slog.New(slog.NewTextHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug}))))
+	g.Set("a", 1)
+	snapshot := new(bytes.Buffer)
+	if err := g.Write(context.Background(), snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Read(strings.NewReader("corrupt")); err == nil {
+		t.Fatal("Read of corrupt snapshot succeeded")
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"level=DEBUG msg=\"gache: snapshot written\" entries=1",
+		"level=WARN msg=\"gache: snapshot decode failed\" error=",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("log output is missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestWithMaxEntries(t *testing.T) {
+	g := New(WithMaxEntries[int](2), WithStats[int]())
+	g.Set("a", 1)
+	g.Set("b", 2)
+	g.Get("a")
+	g.Set("c", 3)
+	if _, ok := g.Get("b"); ok {
+		t.Fatal("least recently used key b was not evicted")
+	}
+	for _, k := range []string{"a", "c"} {
+		if _, ok := g.Get(k); !ok {
+			t.Fatalf("key %s was evicted", k)
+		}
+	}
+	g.Set("a", 10)
+	g.Set("d", 4)
+	if _, ok := g.Get("c"); ok || g.Len() != 2 {
+		t.Fatalf("key c was not evicted after overwriting a, Len = %d", g.Len())
+	}
+	if n := g.Stats().Evictions; n != 2 {
+		t.Fatalf("Evictions = %d", n)
+	}
+	g.Delete("a")
+	g.Set("e", 5)
+	if _, ok := g.Get("d"); !ok || g.Len() != 2 {
+		t.Fatalf("deleted key was not forgotten by the policy, Len = %d", g.Len())
+	}
+
+	bounded := New(WithMaxEntries[int](100))
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				bounded.Set(strconv.Itoa(i*1000+j), j)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if l := bounded.Len(); l > 100 {
+		t.Fatalf("Len = %d exceeds max entries", l)
+	}
+
+	// large bounds track keys in one eviction shard per group of cache shards
+	large := New(WithMaxEntries[int](1<<14), WithDefaultExpiration[int](NoTTL))
+	if n := len(large.(*gache[int]).evict.shards); n != 16 {
+		t.Fatalf("eviction shards = %d, want 16", n)
+	}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 1<<12; j++ {
+				large.Set(strconv.Itoa(i<<12+j), j)
+				large.Get(strconv.Itoa(i<<12 + j/2))
+			}
+		}(i)
+	}
+	wg.Wait()
+	if l := large.Len(); l > 1<<14 || l < 1<<13 {
+		t.Fatalf("Len = %d, want up to %d", l, 1<<14)
+	}
+}
+
+func TestEvictionPolicyLFU(t *testing.T) {
+	g := New(WithEvictionPolicy[int](LFU), WithMaxEntries[int](2))
+	exists := func(key string) bool {
+		_, ok := g.GetEntry(key)
+		return ok
+	}
+	g.Set("hot", 1)
+	g.Get("hot")
+	g.Get("hot")
+	g.Set("warm", 2)
+	g.Get("warm")
+	g.Set("cold", 3)
+	if exists("warm") || !exists("hot") || !exists("cold") {
+		t.Fatal("least frequently used key warm was not evicted in favor of the new key")
+	}
+	for i := 0; i < 3; i++ {
+		g.Get("cold")
+	}
+	g.Set("new", 4)
+	if exists("hot") || !exists("cold") || !exists("new") {
+		t.Fatal("least frequently used key hot was not evicted")
+	}
+}
+
+func TestEvictionPolicyARC(t *testing.T) {
+	g := New(WithEvictionPolicy[int](ARC), WithMaxEntries[int](4))
+	exists := func(key string) bool {
+		_, ok := g.GetEntry(key)
+		return ok
+	}
+	g.Set("a", 1)
+	g.Set("b", 2)
+	g.Get("a")
+	g.Get("b")
+	for i := 0; i < 20; i++ {
+		g.Set("scan"+strconv.Itoa(i), i)
+	}
+	if !exists("a") || !exists("b") || g.Len() != 4 {
+		t.Fatalf("frequently used keys were evicted by a scan, Len = %d", g.Len())
+	}
+
+	p := g.(*gache[int]).evict.shards[0].policy.(*arc[int])
+	if p.lists[arcB1].Len() == 0 {
+		t.Fatal("evicted scan keys were not remembered as ghosts")
+	}
+	target := p.p
+	g.Set("scan17", 17)
+	if p.p <= target {
+		t.Fatalf("ghost hit did not grow the recency target, p = %d", p.p)
+	}
+	if !exists("scan17") {
+		t.Fatal("key returning from a ghost list was not stored")
+	}
+}
+
+func TestSetEvictedHook(t *testing.T) {
+	type removal struct {
+		key    string
+		val    int
+		reason Reason
+	}
+	var got []removal
+	g := New(WithMaxEntries[int](3))
+	g.SetEvictedHook(func(_ context.Context, key string, val int, reason Reason) {
+		got = append(got, removal{key, val, reason})
+	})
+	g.Set("a", 1)
+	g.Set("a", 2)
+	g.Touch("a")
+	g.Delete("a")
+	setExpired(g, "b", 3)
+	g.Get("b")
+	g.Set("c", 4)
+	g.Set("d", 5)
+	g.Set("e", 6)
+	g.Set("f", 7)
+	g.Clear()
+	want := []removal{
+		{"a", 1, Replaced},
+		{"a", 2, Deleted},
+		{"b", 3, Expired},
+		{"c", 4, Evicted},
+	}
+	if len(got) != len(want)+3 || !slices.Equal(got[:len(want)], want) {
+		t.Fatalf("removals = %v, want prefix %v", got, want)
+	}
+	for _, r := range got[len(want):] {
+		if r.reason != Cleared {
+			t.Fatalf("removal by Clear = %v", r)
+		}
+	}
+	if s := Cleared.String(); s != "Cleared" {
+		t.Fatalf("Cleared.String() = %s", s)
+	}
+}
+
+func TestSetDeleteHooks(t *testing.T) {
+	var (
+		sets    []string
+		deletes []string
+	)
+	g := New[int]().
+		SetSetHook(func(_ context.Context, key string, old, val int, existed bool) {
+			sets = append(sets, key+":"+strconv.Itoa(old)+">"+strconv.Itoa(val)+":"+strconv.FormatBool(existed))
+		}).
+		SetDeleteHook(func(_ context.Context, key string, val int) {
+			deletes = append(deletes, key+":"+strconv.Itoa(val))
+		})
+	g.Set("a", 1)
+	g.Set("a", 2)
+	g.ExtendExpire("a", time.Hour)
+	setExpired(g, "b", 3)
+	g.Set("b", 4)
+	g.Delete("a")
+	g.Delete("missing")
+	wantSets := []string{"a:0>1:false", "a:1>2:true", "b:0>3:false", "b:0>4:false"}
+	if !slices.Equal(sets, wantSets) {
+		t.Fatalf("set hook calls = %v, want %v", sets, wantSets)
+	}
+	if !slices.Equal(deletes, []string{"a:2"}) {
+		t.Fatalf("delete hook calls = %v", deletes)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	g := New(WithMaxEntries[int](2))
+	ctx, cancel := context.WithCancel(context.Background())
+	events := g.Watch(ctx, "cfg:*")
+	nsEvents := g.Namespace("cfg:").Watch(ctx, "a")
+	g.Set("cfg:a", 1)
+	g.Set("cfg:a", 2)
+	g.Set("other", 3)
+	g.Delete("cfg:a")
+	setExpired(g, "cfg:b", 4)
+	g.Get("cfg:b")
+	g.Set("cfg:c", 5)
+	g.Set("cfg:d", 6)
+	g.Set("cfg:e", 7)
+	cancel()
+
+	var got []string
+	for e := range events {
+		got = append(got, e.Type.String()+" "+e.Key+" "+strconv.Itoa(e.Value))
+	}
+	want := []string{
+		"Created cfg:a 1",
+		"Updated cfg:a 2",
+		"Deleted cfg:a 2",
+		"Created cfg:b 4",
+		"Expired cfg:b 4",
+		"Created cfg:c 5",
+		"Created cfg:d 6",
+		"Deleted cfg:c 5",
+		"Created cfg:e 7",
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("events = %v, want %v", got, want)
+	}
+	var nsGot []string
+	for e := range nsEvents {
+		nsGot = append(nsGot, e.Type.String()+" "+e.Key)
+	}
+	if !slices.Equal(nsGot, []string{"Created a", "Updated a", "Deleted a"}) {
+		t.Fatalf("namespace events = %v", nsGot)
+	}
+}
+
+func TestEvents(t *testing.T) {
+	g := New(WithEventHistory[int](3))
+	if events := g.Events(0); len(events) != 0 {
+		t.Fatalf("Events of empty history = %v", events)
+	}
+	g.Set("a", 1)
+	g.Set("b", 2)
+	events := g.Events(0)
+	if len(events) != 2 || events[0].Seq != 1 || events[1].Key != "b" || events[1].Type != EventCreated {
+		t.Fatalf("Events = %+v", events)
+	}
+	g.Set("a", 3)
+	g.Delete("b")
+	events = g.Events(0)
+	if len(events) != 3 || events[0].Seq != 2 || events[2].Type != EventDeleted {
+		t.Fatalf("Events after wrap = %+v", events)
+	}
+	if events := g.Events(3); len(events) != 1 || events[0].Seq != 4 {
+		t.Fatalf("Events(3) = %+v", events)
+	}
+	if events := g.Events(4); len(events) != 0 {
+		t.Fatalf("Events(4) = %+v", events)
+	}
+	if events := g.Namespace("a").Events(0); len(events) != 1 || events[0].Key != "" {
+		t.Fatalf("namespace Events = %+v", events)
+	}
+	if New[int]().Events(0) != nil {
+		t.Fatal("Events without history is not nil")
+	}
+}
+
+func TestGetOrLoad(t *testing.T) {
+	if _, err := New[int]().GetOrLoad(context.Background(), "key"); !errors.Is(err, ErrNoLoader) {
+		t.Fatalf("GetOrLoad without loader error = %v", err)
+	}
+
+	var calls atomic.Int64
+	release := make(chan struct{})
+	errFailed := errors.New("failed")
+	g := New(WithLoader(func(_ context.Context, key string) (int, time.Duration, error) {
+		calls.Add(1)
+		<-release
+		if key == "bad" {
+			return 0, 0, errFailed
+		}
+		return len(key), time.Hour, nil
+	}))
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if v, err := g.GetOrLoad(context.Background(), "key"); err != nil || v != 3 {
+				t.Errorf("GetOrLoad = %d, %v", v, err)
+			}
+		}()
+	}
+	for calls.Load() == 0 {
+		runtime.Gosched()
+	}
+	close(release)
+	wg.Wait()
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("loader called %d times for concurrent misses", n)
+	}
+	if ttl, ok := g.TTL("key"); !ok || ttl <= 0 || ttl > time.Hour {
+		t.Fatalf("TTL of loaded key = %v, %v", ttl, ok)
+	}
+	if v, err := g.GetOrLoad(context.Background(), "key"); err != nil || v != 3 || calls.Load() != 1 {
+		t.Fatalf("GetOrLoad of cached key = %d, %v", v, err)
+	}
+	if _, err := g.GetOrLoad(context.Background(), "bad"); !errors.Is(err, errFailed) {
+		t.Fatalf("GetOrLoad error = %v", err)
+	}
+	if _, ok := g.Get("bad"); ok {
+		t.Fatal("failed load was stored")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := g.GetOrLoad(ctx, "canceled"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("GetOrLoad with canceled context error = %v", err)
+	}
+}
+
+func TestGetMultiLoad(t *testing.T) {
+	var batches [][]string
+	g := New(WithBatchLoader(func(_ context.Context, keys []string) (map[string]int, time.Duration, error) {
+		batches = append(batches, keys)
+		m := make(map[string]int)
+		for _, key := range keys {
+			if key != "unknown" {
+				m[key] = len(key)
+			}
+		}
+		return m, time.Hour, nil
+	}))
+	g.Set("cached", 0)
+	m, err := g.GetMultiLoad(context.Background(), []string{"cached", "a", "bb", "unknown", "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !maps.Equal(m, map[string]int{"cached": 0, "a": 1, "bb": 2}) {
+		t.Fatalf("GetMultiLoad = %v", m)
+	}
+	if len(batches) != 1 || !slices.Equal(batches[0], []string{"a", "bb", "unknown"}) {
+		t.Fatalf("batch loader calls = %v", batches)
+	}
+	if v, ok := g.Get("bb"); !ok || v != 2 {
+		t.Fatal("batch loaded value was not stored")
+	}
+
+	errFailed := errors.New("failed")
+	single := New(WithLoader(func(_ context.Context, key string) (int, time.Duration, error) {
+		if key == "bad" {
+			return 0, 0, errFailed
+		}
+		return len(key), 0, nil
+	}))
+	m, err = single.GetMultiLoad(context.Background(), []string{"a", "bad", "ccc"})
+	if !errors.Is(err, errFailed) || !maps.Equal(m, map[string]int{"a": 1, "ccc": 3}) {
+		t.Fatalf("GetMultiLoad with loader = %v, %v", m, err)
+	}
+	if _, err := New[int]().GetMultiLoad(context.Background(), []string{"a"}); !errors.Is(err, ErrNoLoader) {
+		t.Fatalf("GetMultiLoad without loader error = %v", err)
+	}
+}
+
+func TestWithRefreshAhead(t *testing.T) {
+	var calls atomic.Int64
+	loaded := make(chan struct{}, 10)
+	g := New(
+		WithLoader(func(context.Context, string) (int, time.Duration, error) {
+			defer func() { loaded <- struct{}{} }()
+			return int(calls.Add(1)), time.Hour, nil
+		}),
+		WithRefreshAhead[int](time.Minute),
+	)
+	g.SetWithExpire("key", 0, 30*time.Second)
+	if v, ok := g.Get("key"); !ok || v != 0 {
+		t.Fatalf("Get within refresh window = %d, %v", v, ok)
+	}
+	<-loaded
+	for _, ok := g.(*gache[int]).refreshing.Load("key"); ok; _, ok = g.(*gache[int]).refreshing.Load("key") {
+		runtime.Gosched()
+	}
+	if v, _ := g.Get("key"); v != 1 {
+		t.Fatalf("Get after refresh = %d", v)
+	}
+	if ttl, _ := g.TTL("key"); ttl < time.Minute {
+		t.Fatalf("TTL after refresh = %v", ttl)
+	}
+	g.Get("key")
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("loader called %d times for a key outside the refresh window", n)
+	}
+}
+
+func TestWithStaleTTL(t *testing.T) {
+	release := make(chan struct{})
+	var calls atomic.Int64
+	g := New(
+		WithLoader(func(context.Context, string) (int, time.Duration, error) {
+			<-release
+			return int(calls.Add(1)), time.Hour, nil
+		}),
+		WithStaleTTL[int](time.Hour),
+	)
+	gc := g.(*gache[int])
+	gc.update(gc.shard("key"), "key", func(*value[int]) (*value[int], bool) {
+		return &value[int]{expire: fastime.UnixNanoNow() - time.Minute.Nanoseconds()}, true
+	})
+	if n := g.DeleteExpired(context.Background()); n != 0 {
+		t.Fatalf("DeleteExpired removed %d stale entries", n)
+	}
+	for range 3 {
+		if v, ok := g.Get("key"); !ok || v != 0 {
+			t.Fatalf("Get of stale entry = %d, %v", v, ok)
+		}
+	}
+	close(release)
+	for _, ok := gc.refreshing.Load("key"); ok; _, ok = gc.refreshing.Load("key") {
+		runtime.Gosched()
+	}
+	if v, _ := g.Get("key"); v != 1 {
+		t.Fatalf("Get after refresh = %d", v)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("loader called %d times", n)
+	}
+
+	g = New[int](WithStaleTTL[int](time.Hour))
+	setExpired(g, "key", 0)
+	if _, ok := g.Get("key"); ok {
+		t.Fatal("stale entry served without a loader")
+	}
+}
+
+func TestWithStaleIfError(t *testing.T) {
+	errBackend := errors.New("backend down")
+	g := New(
+		WithLoader(func(context.Context, string) (int, time.Duration, error) {
+			return 0, 0, errBackend
+		}),
+		WithStaleIfError[int](time.Hour),
+		WithStats[int](),
+	)
+	gc := g.(*gache[int])
+	gc.update(gc.shard("key"), "key", func(*value[int]) (*value[int], bool) {
+		return &value[int]{val: 1, expire: fastime.UnixNanoNow() - time.Minute.Nanoseconds()}, true
+	})
+	setExpired(g, "old", 2)
+	if _, ok := g.Get("key"); ok {
+		t.Fatal("Get returned an expired entry")
+	}
+	if n := g.DeleteExpired(context.Background()); n != 1 {
+		t.Fatalf("DeleteExpired removed %d entries, want the one past its grace period", n)
+	}
+	if v, err := g.GetOrLoad(context.Background(), "key"); err != nil || v != 1 {
+		t.Fatalf("GetOrLoad with failing loader = %d, %v", v, err)
+	}
+	if _, err := g.GetOrLoad(context.Background(), "old"); !errors.Is(err, errBackend) {
+		t.Fatalf("GetOrLoad past grace period error = %v", err)
+	}
+	if s := g.Stats(); s.Stale != 1 {
+		t.Fatalf("Stats.Stale = %d", s.Stale)
+	}
+}
+
+func TestWithLoaderRetry(t *testing.T) {
+	var calls atomic.Int64
+	g := New(
+		WithLoader(func(context.Context, string) (int, time.Duration, error) {
+			if calls.Add(1) < 3 {
+				return 0, 0, errors.New("unavailable")
+			}
+			return 1, 0, nil
+		}),
+		WithLoaderRetry[int](2, time.Millisecond, 2*time.Millisecond),
+	)
+	if v, err := g.GetOrLoad(context.Background(), "key"); err != nil || v != 1 {
+		t.Fatalf("GetOrLoad = %d, %v", v, err)
+	}
+	if n := calls.Load(); n != 3 {
+		t.Fatalf("loader called %d times", n)
+	}
+}
+
+func TestWithCircuitBreaker(t *testing.T) {
+	var calls atomic.Int64
+	errBackend := errors.New("backend down")
+	g := New(
+		WithLoader(func(context.Context, string) (int, time.Duration, error) {
+			calls.Add(1)
+			return 0, 0, errBackend
+		}),
+		WithCircuitBreaker[int](2, time.Hour),
+	)
+	ctx := context.Background()
+	for range 2 {
+		if _, err := g.GetOrLoad(ctx, "key"); !errors.Is(err, errBackend) {
+			t.Fatalf("GetOrLoad error = %v", err)
+		}
+	}
+	if _, err := g.GetOrLoad(ctx, "key"); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("GetOrLoad with open circuit error = %v", err)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Fatalf("loader called %d times", n)
+	}
+
+	b := g.(*gache[int]).breaker
+	b.open -= time.Hour.Nanoseconds()
+	if allowed, probe := b.allow(); !allowed || !probe {
+		t.Fatal("half-open circuit did not allow a probe")
+	}
+	if allowed, _ := b.allow(); allowed {
+		t.Fatal("half-open circuit allowed a second probe")
+	}
+	// a load allowed before the circuit opened does not end the probe
+	b.done(false, false)
+	if allowed, _ := b.allow(); allowed {
+		t.Fatal("a load other than the probe ended probing")
+	}
+	b.done(true, true)
+	if allowed, probe := b.allow(); !allowed || probe {
+		t.Fatal("circuit not closed after a successful probe")
+	}
+}
+
+func TestNegativeCaching(t *testing.T) {
+	var calls atomic.Int64
+	g := New(
+		WithLoader(func(_ context.Context, key string) (int, time.Duration, error) {
+			calls.Add(1)
+			if key == "missing" {
+				return 0, 0, fmt.Errorf("select %s: %w", key, ErrNotFound)
+			}
+			return 1, 0, nil
+		}),
+		WithNegativeTTL[int](time.Hour),
+		WithLoaderRetry[int](3, time.Millisecond, time.Millisecond),
+	)
+	ctx := context.Background()
+	for range 2 {
+		if _, err := g.GetOrLoad(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("GetOrLoad of missing key error = %v", err)
+		}
+	}
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("loader called %d times for a missing key", n)
+	}
+	if !g.IsNegative("missing") {
+		t.Fatal("missing key not cached as negative")
+	}
+	if m, err := g.GetMultiLoad(ctx, []string{"missing", "key"}); err != nil || len(m) != 1 || m["key"] != 1 {
+		t.Fatalf("GetMultiLoad = %v, %v", m, err)
+	}
+
+	g.Set("key", 2)
+	g.SetNegative("key", time.Hour)
+	if _, ok := g.Get("key"); ok {
+		t.Fatal("SetNegative kept the stored value")
+	}
+	if _, err := g.GetOrLoad(ctx, "key"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("GetOrLoad of negative key error = %v", err)
+	}
+	g.Set("key", 3)
+	if g.IsNegative("key") {
+		t.Fatal("Set did not clear the negative entry")
+	}
+	g.SetNegative("expired", time.Hour)
+	gc := g.(*gache[int])
+	gc.negatives.Store("expired", 1)
+	g.DeleteExpired(ctx)
+	if _, ok := gc.negatives.Load("expired"); ok {
+		t.Fatal("DeleteExpired kept an expired negative entry")
+	}
+}
+
+func TestMemoize(t *testing.T) {
+	var calls atomic.Int64
+	release := make(chan struct{})
+	g := New[string]()
+	square := Memoize(g, strconv.Itoa, func(_ context.Context, n int) (string, error) {
+		calls.Add(1)
+		<-release
+		if n < 0 {
+			return "", errors.New("negative")
+		}
+		return strconv.Itoa(n * n), nil
+	})
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if v, err := square(ctx, 3); err != nil || v != "9" {
+				t.Errorf("square(3) = %q, %v", v, err)
+			}
+		}()
+	}
+	for calls.Load() == 0 {
+		runtime.Gosched()
+	}
+	close(release)
+	wg.Wait()
+	if v, _ := square(ctx, 3); v != "9" {
+		t.Fatalf("memoized square(3) = %q", v)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("fn called %d times", n)
+	}
+	if v, ok := g.Get("3"); !ok || v != "9" {
+		t.Fatalf("cached result = %q, %v", v, ok)
+	}
+	for range 2 {
+		if _, err := square(ctx, -1); err == nil {
+			t.Fatal("square(-1) succeeded")
+		}
+	}
+	if n := calls.Load(); n != 3 {
+		t.Fatalf("fn called %d times, errors must not be cached", n)
+	}
+
+	cube := MemoizeWithExpire(g, time.Minute, func(n int) string { return "cube:" + strconv.Itoa(n) }, func(_ context.Context, n int) (string, error) {
+		return strconv.Itoa(n * n * n), nil
+	})
+	cube(ctx, 2)
+	if ttl, ok := g.TTL("cube:2"); !ok || ttl <= 0 || ttl > time.Minute {
+		t.Fatalf("TTL of memoized result = %v, %v", ttl, ok)
+	}
+}
+
+func TestPin(t *testing.T) {
+	g := New(WithMaxEntries[int](2))
+	g.Pin("config")
+	g.Set("config", 1)
+	g.Set("a", 2)
+	g.Set("b", 3)
+	g.Set("c", 4)
+	if _, ok := g.GetEntry("config"); !ok || g.Len() != 2 {
+		t.Fatalf("pinned key was evicted, Len = %d", g.Len())
+	}
+
+	setExpired(g, "config", 5)
+	if n := g.DeleteExpired(context.Background()); n != 0 {
+		t.Fatalf("DeleteExpired removed %d pinned entries", n)
+	}
+	if v, ok := g.Get("config"); !ok || v != 5 {
+		t.Fatalf("Get of expired pinned key = %d, %v", v, ok)
+	}
+
+	g.Unpin("config")
+	if _, ok := g.Get("config"); ok {
+		t.Fatal("expired key is readable after Unpin")
+	}
+
+	g.Set("d", 6)
+	g.Pin("d")
+	g.Set("e", 7)
+	g.Set("f", 8)
+	if _, ok := g.GetEntry("d"); !ok {
+		t.Fatal("key pinned after Set was evicted")
+	}
+	g.Unpin("d")
+	g.Set("h", 9)
+	g.Set("i", 10)
+	if _, ok := g.GetEntry("d"); ok {
+		t.Fatal("unpinned key was not evicted")
+	}
+}
+
+func TestWithTinyLFU(t *testing.T) {
+	g := New(WithMaxEntries[int](10), WithTinyLFU[int](), WithStats[int]())
+	var evicted atomic.Int64
+	g.SetEvictedHook(func(context.Context, string, int, Reason) {
+		evicted.Add(1)
+	})
+	for i := 0; i < 10; i++ {
+		key := "hot" + strconv.Itoa(i)
+		g.Set(key, i)
+		for j := 0; j < 5; j++ {
+			g.Get(key)
+		}
+	}
+	for i := 0; i < 100; i++ {
+		g.Set("once"+strconv.Itoa(i), i)
+	}
+	for i := 0; i < 10; i++ {
+		if _, ok := g.GetEntry("hot" + strconv.Itoa(i)); !ok {
+			t.Fatalf("frequently used key hot%d was evicted by one-hit keys", i)
+		}
+	}
+	if l := g.Len(); l != 10 {
+		t.Fatalf("Len = %d", l)
+	}
+	if n := g.Stats().Rejections; n != 100 || evicted.Load() != 0 {
+		t.Fatalf("Rejections = %d, evicted hook calls = %d", n, evicted.Load())
+	}
+
+	key := "rising"
+	for i := 0; i < 10; i++ {
+		g.Set(key, i)
+	}
+	if _, ok := g.GetEntry(key); !ok {
+		t.Fatal("frequently written key was not admitted")
+	}
+}
+
+func TestWithTinyLFUCost(t *testing.T) {
+	for name, opt := range map[string]Option[int]{
+		"cost":   WithMaxCost[int](100),
+		"memory": WithMaxMemory[int](100 * entrySize("hot00", 0)),
+	} {
+		g := New(opt, WithTinyLFU[int](), WithDefaultExpiration[int](NoTTL))
+		for i := range 100 {
+			key := fmt.Sprintf("hot%02d", i)
+			g.Set(key, i)
+			for range 5 {
+				g.Get(key)
+			}
+		}
+		for i := range 1000 {
+			g.Set(fmt.Sprintf("x%04d", i), i)
+		}
+		kept := 0
+		for i := range 100 {
+			if _, ok := g.GetEntry(fmt.Sprintf("hot%02d", i)); ok {
+				kept++
+			}
+		}
+		if kept < 90 {
+			t.Fatalf("%s bound kept %d of 100 hot keys", name, kept)
+		}
+	}
+}
+
+func TestWithMaxCost(t *testing.T) {
+	g := New(WithMaxCost[string](10), WithWeigher(func(_ string, v string) int64 {
+		return int64(len(v))
+	}))
+	g.Set("a", "xxxx")
+	g.Set("b", "xxxx")
+	g.Set("c", "xx")
+	if g.Len() != 3 {
+		t.Fatalf("Len = %d", g.Len())
+	}
+	g.Set("d", "xxx")
+	if _, ok := g.GetEntry("a"); ok || g.Len() != 3 {
+		t.Fatalf("least recently used key a was not evicted, Len = %d", g.Len())
+	}
+	g.Set("c", "xxxxxx")
+	if _, ok := g.GetEntry("b"); ok {
+		t.Fatal("growing key c did not evict b")
+	}
+	if cost := atomic.LoadInt64(&g.(*gache[string]).evict.cost); cost != 9 {
+		t.Fatalf("cost = %d, want 9", cost)
+	}
+	g.Set("huge", "xxxxxxxxxxx")
+	if _, ok := g.GetEntry("huge"); ok || g.Len() != 2 {
+		t.Fatalf("entry costing more than max was stored, Len = %d", g.Len())
+	}
+	g.Delete("c")
+	if cost := atomic.LoadInt64(&g.(*gache[string]).evict.cost); cost != 3 {
+		t.Fatalf("cost after Delete = %d, want 3", cost)
+	}
+}
+
+type sized int
+
+func (s sized) Size() uintptr {
+	return uintptr(s)
+}
+
+func TestWithMaxMemory(t *testing.T) {
+	base := entrySize("k", sized(0))
+	if got := entrySize("k", sized(100)); got != base+100 {
+		t.Fatalf("Sizer entry size = %d, want %d", got, base+100)
+	}
+	small, large := entrySize("k", []byte("x")), entrySize("k", make([]byte, 1000))
+	if large-small != 999 {
+		t.Fatalf("reflected slice size difference = %d, want 999", large-small)
+	}
+	type node struct {
+		next *node
+		name string
+	}
+	cyclic := &node{name: "a"}
+	cyclic.next = cyclic
+	if entrySize("k", cyclic) <= entrySize("k", (*node)(nil)) {
+		t.Fatal("referenced memory of pointer was not counted")
+	}
+
+	g := New(WithMaxMemory[[]byte](10 * large))
+	for i := 0; i < 20; i++ {
+		g.Set(strconv.Itoa(i), make([]byte, 1000))
+	}
+	if l := g.Len(); l > 10 {
+		t.Fatalf("Len = %d exceeds the memory budget", l)
+	}
+}
+
+func TestGetEntry(t *testing.T) {
+	g := New(WithEntryMetadata[int]())
+	before := time.Now().Add(-time.Second)
+	g.Set("key", 1)
+	g.Get("key")
+	g.Get("key")
+	g.ExtendExpire("key", time.Hour)
+	e, ok := g.GetEntry("key")
+	if !ok || e.Key != "key" || e.Value != 1 || e.Hits != 2 {
+		t.Fatalf("GetEntry = %+v, %v", e, ok)
+	}
+	if e.CreatedAt.Before(before) || e.LastAccess.Before(e.CreatedAt) {
+		t.Fatalf("CreatedAt = %v, LastAccess = %v", e.CreatedAt, e.LastAccess)
+	}
+	g.Set("key", 2)
+	if e, _ := g.GetEntry("key"); e.Hits != 0 || !e.LastAccess.IsZero() {
+		t.Fatalf("overwritten entry kept metadata: %+v", e)
+	}
+	if _, ok := g.GetEntry("missing"); ok {
+		t.Fatal("GetEntry found missing key")
+	}
+
+	plain := New[int]()
+	plain.Set("key", 1)
+	plain.Get("key")
+	if e, ok := plain.GetEntry("key"); !ok || e.Hits != 0 || !e.CreatedAt.IsZero() {
+		t.Fatalf("untracked GetEntry = %+v, %v", e, ok)
+	}
+}
+
+// nextTick waits until the coarse clock stamping writes advances so the following writes are newer
+func nextTick() {
+	for now := fastime.UnixNanoNow(); fastime.UnixNanoNow() == now; {
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSyncFrom(t *testing.T) {
+	ctx := context.Background()
+	local, peer := New(WithWriteTimestamps[int]()), New(WithWriteTimestamps[int]())
+	local.SetDefaultExpire(NoTTL)
+	peer.SetDefaultExpire(NoTTL)
+	local.Set("newer-local", 1)
+	peer.Set("older-peer", 2)
+	for i := range 100 {
+		peer.SetWithExpire("shared:"+strconv.Itoa(i), i, time.Hour)
+	}
+	nextTick()
+	local.Set("older-peer", 10)
+	peer.Set("newer-peer", 3)
+	nextTick()
+	peer.Set("newer-local", 20)
+	nextTick()
+	local.Set("newer-local", 100)
+
+	n, err := local.SyncFrom(ctx, peer)
+	if err != nil || n != 101 {
+		t.Fatalf("SyncFrom copied %d entries, %v, want 101", n, err)
+	}
+	for key, want := range map[string]int{"newer-local": 100, "older-peer": 10, "newer-peer": 3, "shared:42": 42} {
+		if v, ok := local.Get(key); !ok || v != want {
+			t.Fatalf("Get(%s) after sync = %d, %v, want %d", key, v, ok, want)
+		}
+	}
+	pe, _ := peer.GetEntry("shared:7")
+	if le, _ := local.GetEntry("shared:7"); le.Expire != pe.Expire || !le.UpdatedAt.Equal(pe.UpdatedAt) {
+		t.Fatalf("synced entry %+v, peer entry %+v", le, pe)
+	}
+	if n, err := local.SyncFrom(ctx, peer); n != 0 || err != nil {
+		t.Fatalf("second SyncFrom copied %d entries, %v", n, err)
+	}
+
+	// once the peer takes the local writes back the digests match
+	if n, _ := peer.SyncFrom(ctx, local); n != 2 {
+		t.Fatalf("reverse SyncFrom copied %d entries, want 2", n)
+	}
+	if !slices.Equal(local.Digest(ctx), peer.Digest(ctx)) {
+		t.Fatal("digests of synced caches differ")
+	}
+	peer.Set("shared:1", -1)
+	diff := 0
+	for i, d := range local.Digest(ctx) {
+		if d != peer.Digest(ctx)[i] {
+			diff++
+		}
+	}
+	if diff != 1 {
+		t.Fatalf("%d buckets differ after one write, want 1", diff)
+	}
+
+	ns := New(WithWriteTimestamps[int]()).Namespace("ns:")
+	if n, err := ns.SyncFrom(ctx, peer); err != nil || n != peer.Len() {
+		t.Fatalf("namespace SyncFrom copied %d entries, %v, want %d", n, err, peer.Len())
+	}
+	if !slices.Equal(ns.Digest(ctx), peer.Digest(ctx)) {
+		t.Fatal("digest of synced namespace differs")
+	}
+
+	// without write timestamps only missing keys are copied
+	plain, plainPeer := New[int](), New[int]()
+	plain.Set("shared:1", 1)
+	plainPeer.Set("shared:1", 2)
+	plainPeer.Set("shared:2", 2)
+	if e, _ := plain.GetEntry("shared:1"); !e.UpdatedAt.IsZero() {
+		t.Fatalf("UpdatedAt without WithWriteTimestamps = %v", e.UpdatedAt)
+	}
+	if n, _ := plain.SyncFrom(ctx, plainPeer); n != 1 {
+		t.Fatalf("SyncFrom without write timestamps copied %d entries, want 1", n)
+	}
+	if v, _ := plain.Get("shared:1"); v != 1 {
+		t.Fatalf("SyncFrom without write timestamps overwrote shared:1 with %d", v)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	ctx := context.Background()
+	a, b := New[[]int](), New[[]int]()
+	a.Set("same", []int{1})
+	b.Set("same", []int{1})
+	a.Set("changed", []int{1})
+	b.Set("changed", []int{2})
+	a.Set("removed", nil)
+	b.Set("added", nil)
+	setExpired(a, "expired", []int{0})
+
+	want := KeyDiff{Added: []string{"added"}, Removed: []string{"removed"}, Changed: []string{"changed"}}
+	d, err := Diff(ctx, a, b, nil)
+	if err != nil || !reflect.DeepEqual(d, want) || d.Empty() {
+		t.Fatalf("Diff = %+v, %v, want %+v", d, err, want)
+	}
+	d, _ = Diff(ctx, a, b, func(x, y []int) bool { return len(x) == len(y) })
+	if len(d.Changed) != 0 {
+		t.Fatalf("Diff with equal = %+v", d)
+	}
+
+	var sa, sb bytes.Buffer
+	if err := a.Write(ctx, &sa); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Write(ctx, &sb); err != nil {
+		t.Fatal(err)
+	}
+	// options other than the snapshot ones are not applied twice, a second WithExpvar would panic
+	name := "diff" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	d, err = DiffSnapshots(ctx, &sa, &sb, nil, WithDefaultExpiration[[]int](NoTTL), WithExpvar[[]int](name))
+	if err != nil || !reflect.DeepEqual(d, want) {
+		t.Fatalf("DiffSnapshots = %+v, %v, want %+v", d, err, want)
+	}
+	if d, _ := Diff(ctx, a, a, nil); !d.Empty() {
+		t.Fatalf("Diff of a cache with itself = %+v", d)
+	}
+}
+
+func TestMergeFrom(t *testing.T) {
+	ctx := context.Background()
+	dst, src := New[int](), New[int]()
+	dst.SetDefaultExpire(NoTTL)
+	dst.Set("both", 1)
+	dst.Set("dst", 2)
+	src.SetWithExpire("both", 10, time.Hour)
+	src.SetWithExpire("src", 20, time.Hour)
+
+	var stats ReadStats
+	if err := dst.MergeFrom(ctx, src, KeepExisting[int](), ReadReport[int](&stats)); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := dst.Get("both"); v != 1 || stats.Loaded != 2 {
+		t.Fatalf("KeepExisting merge Get(both) = %d reporting %+v", v, stats)
+	}
+	if _, ttl, ok := dst.GetWithTTL("src"); !ok || ttl <= 59*time.Minute || ttl > 61*time.Minute {
+		t.Fatalf("merged src TTL = %v, %v", ttl, ok)
+	}
+
+	if err := dst.MergeFrom(ctx, src, MergeWith(func(_ string, existing, incoming int) int {
+		return existing + incoming
+	})); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := dst.Get("both"); v != 11 {
+		t.Fatalf("MergeWith merge Get(both) = %d, want 11", v)
+	}
+	if err := dst.MergeFrom(ctx, src); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := dst.Get("both"); v != 10 {
+		t.Fatalf("overwriting merge Get(both) = %d, want 10", v)
+	}
+
+	ns := New[int]().Namespace("ns:")
+	if err := ns.MergeFrom(ctx, src, FilterKeys[int](func(key string) bool { return key == "src" })); err != nil {
+		t.Fatal(err)
+	}
+	if keys := ns.Keys(ctx); len(keys) != 1 || keys[0] != "src" {
+		t.Fatalf("namespace merge keys = %v", keys)
+	}
+}
+
+func TestClearWithHooks(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		removed = map[string]int{}
+		wg      sync.WaitGroup
+	)
+	wg.Add(3)
+	g := New[int]().
+		SetExpiredHook(func(_ context.Context, k string, v int) {
+			mu.Lock()
+			removed[k] = v
+			mu.Unlock()
+			wg.Done()
+		}).
+		EnableExpiredHook()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	g.StartExpired(ctx, time.Hour)
+	g.Set("a", 1)
+	g.Set("b", 2)
+	g.Namespace("ns:").Set("c", 3)
+	if n := g.ClearWithHooks(context.Background()); n != 3 {
+		t.Fatalf("ClearWithHooks = %d, want 3", n)
+	}
+	wg.Wait()
+	if g.Len() != 0 || len(removed) != 3 || removed["a"] != 1 || removed["ns:c"] != 3 {
+		t.Fatalf("Len = %d, hooks = %v", g.Len(), removed)
+	}
+}
+
+func TestLazyClear(t *testing.T) {
+	var expired atomic.Int64
+	g := New[int]().
+		SetExpiredHook(func(context.Context, string, int) { expired.Add(1) }).
+		EnableExpiredHook()
+	g.Set("a", 1)
+	g.Set("b", 2)
+	g.SetWithTags("c", 3, 0, "t")
+	g.LazyClear()
+	if l := g.Len(); l != 0 {
+		t.Fatalf("Len after LazyClear = %d", l)
+	}
+	if _, ok := g.Get("a"); ok {
+		t.Fatal("cleared key a is still readable")
+	}
+	if _, ok := g.GetWithIgnoredExpire("b"); ok {
+		t.Fatal("cleared key b is readable ignoring expiration")
+	}
+	if n := g.InvalidateTag("t"); n != 0 {
+		t.Fatalf("InvalidateTag after LazyClear = %d", n)
+	}
+	g.Set("b", 20)
+	if v, ok := g.Get("b"); !ok || v != 20 || g.Len() != 1 {
+		t.Fatalf("Get after rewrite = %d, %v, Len = %d", v, ok, g.Len())
+	}
+	g.DeleteExpired(context.Background())
+	if l := g.Len(); l != 1 {
+		t.Fatalf("Len after reclaim = %d", l)
+	}
+	if atomic.LoadUint64(&g.(*gache[int]).stale) != 0 {
+		t.Fatal("stale entries were not reclaimed")
+	}
+	if n := expired.Load(); n != 0 {
+		t.Fatalf("expired hook fired %d times for cleared entries", n)
+	}
+}
+
+func TestSnapshotExpiration(t *testing.T) {
+	src := New[int]()
+	src.SetWithExpire("ttl", 1, time.Hour)
+	src.SetWithExpire("forever", 2, NoTTL)
+	buf := new(bytes.Buffer)
+	if err := src.Write(context.Background(), buf); err != nil {
+		t.Fatal(err)
+	}
+	_, want, _ := src.GetWithExpire("ttl")
+
+	g := New[int]().SetDefaultExpire(time.Minute)
+	if err := g.Read(buf); err != nil {
+		t.Fatal(err)
+	}
+	if v, exp, ok := g.GetWithExpire("ttl"); !ok || v != 1 || exp != want {
+		t.Fatalf("restored ttl entry = %d, %d, %v, want expiration %d", v, exp, ok, want)
+	}
+	if ttl, ok := g.TTL("forever"); !ok || ttl != NoTTL {
+		t.Fatalf("restored entry without expiration has TTL %v, %v", ttl, ok)
+	}
+
+	buf.Reset()
+	frame, err := gobCodec{}.Marshal([]record[int]{{Key: "expired", Value: 3, Expire: 1}, {Key: "live", Value: 4}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	frames := new(bytes.Buffer)
+	if err := writeFrame(frames, frame); err != nil {
+		t.Fatal(err)
+	}
+	// no compression, the gob codec and no encryption, then the frames, the end frame, count and checksum
+	buf.WriteString(snapshotMagic + "\x03\x00\x03gob\x00")
+	buf.Write(frames.Bytes())
+	buf.Write(binary.BigEndian.AppendUint64(binary.AppendUvarint([]byte{0}, 2), xxh3.Hash(frames.Bytes())))
+	g.Clear()
+	if err := g.Read(buf); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := g.Get("expired"); ok || g.Len() != 1 {
+		t.Fatalf("Read restored an expired entry, len %d", g.Len())
+	}
+
+	buf.Reset()
+	if err := gob.NewEncoder(buf).Encode(map[string]int{"legacy": 5}); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Read(buf); err != nil {
+		t.Fatal(err)
+	}
+	if ttl, ok := g.TTL("legacy"); !ok || ttl <= 0 || ttl > time.Minute {
+		t.Fatalf("legacy snapshot entry TTL = %v, %v", ttl, ok)
+	}
+}
+
+// cancelWriter writes to w and calls cancel on its after-th write
+type cancelWriter struct {
+	w      *bytes.Buffer
+	after  int
+	cancel context.CancelFunc
+}
+
+func (w *cancelWriter) Write(p []byte) (int, error) {
+	if w.after--; w.after == 0 {
+		w.cancel()
+	}
+	return w.w.Write(p)
+}
+
+func TestSnapshotFrames(t *testing.T) {
+	src := New[int]()
+	const n = 3*snapshotFrameRecords + 1
+	for i := range n {
+		src.Set(strconv.Itoa(i), i)
+	}
+	buf := new(bytes.Buffer)
+	if err := src.Write(context.Background(), buf); err != nil {
+		t.Fatal(err)
+	}
+	g := New[int]()
+	if err := g.Read(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	if g.Len() != n {
+		t.Fatalf("Len after Read = %d, want %d", g.Len(), n)
+	}
+	for i := range n {
+		if v, ok := g.Get(strconv.Itoa(i)); !ok || v != i {
+			t.Fatalf("Get(%d) = %d, %v", i, v, ok)
+		}
+	}
+	if err := g.Read(bytes.NewReader(buf.Bytes()[:buf.Len()-1])); err == nil {
+		t.Fatal("Read of truncated snapshot succeeded")
+	}
+
+	// a damaged frame fails before any of its records is stored
+	damaged := bytes.Clone(buf.Bytes())
+	first := len(snapshotMagic) + 4 + len("gob")
+	l, n1 := binary.Uvarint(damaged[first:])
+	var batch []record[int]
+	if err := (gobCodec{}).Unmarshal(damaged[first+n1:first+n1+int(l)], &batch); err != nil {
+		t.Fatal(err)
+	}
+	second := first + n1 + int(l) + 8
+	_, n2 := binary.Uvarint(damaged[second:])
+	damaged[second+n2] ^= 0xff
+	g.Clear()
+	if err := g.Read(bytes.NewReader(damaged)); !errors.Is(err, ErrCorruptSnapshot) || !strings.Contains(err.Error(), "frame checksum") {
+		t.Fatalf("Read of damaged frame = %v", err)
+	}
+	if g.Len() != len(batch) {
+		t.Fatalf("Len after damaged frame = %d, want the records of the first frame only", g.Len())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cw := &cancelWriter{w: new(bytes.Buffer), after: 2, cancel: cancel}
+	if err := src.Write(ctx, cw); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Write canceled after the first frame = %v, want %v", err, context.Canceled)
+	}
+	if err := New[int]().Read(bytes.NewReader(cw.w.Bytes())); !errors.Is(err, ErrCorruptSnapshot) {
+		t.Fatalf("Read of canceled snapshot = %v, want %v", err, ErrCorruptSnapshot)
+	}
+
+	buf.Reset()
+	buf.WriteString(snapshotMagic + "\x02")
+	enc := gob.NewEncoder(buf)
+	for _, rec := range []record[int]{{Key: "a", Value: 1}, {Key: "b", Value: 2}} {
+		if err := enc.Encode(&rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	g.Clear()
+	if err := g.Read(buf); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := g.Get("b"); !ok || v != 2 || g.Len() != 2 {
+		t.Fatalf("Read of version 2 snapshot = %d, %v, len %d", v, ok, g.Len())
+	}
+}
+
+func TestWithSnapshotCompression(t *testing.T) {
+	plain := new(bytes.Buffer)
+	src := New[string]()
+	for i := range 1000 {
+		src.Set(strconv.Itoa(i), strings.Repeat("value", 20))
+	}
+	if err := src.Write(context.Background(), plain); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []Compression{Gzip, Zstd, Snappy} {
+		t.Run(c.String(), func(t *testing.T) {
+			src := New(WithSnapshotCompression[string](c))
+			for i := range 1000 {
+				src.Set(strconv.Itoa(i), strings.Repeat("value", 20))
+			}
+			buf := new(bytes.Buffer)
+			if err := src.Write(context.Background(), buf); err != nil {
+				t.Fatal(err)
+			}
+			if buf.Len() >= plain.Len()/2 {
+				t.Fatalf("compressed snapshot is %d bytes, uncompressed %d", buf.Len(), plain.Len())
+			}
+			g := New[string]()
+			if err := g.Read(buf); err != nil {
+				t.Fatal(err)
+			}
+			if v, ok := g.Get("999"); !ok || v != strings.Repeat("value", 20) || g.Len() != 1000 {
+				t.Fatalf("Get(999) = %q, %v, len %d", v, ok, g.Len())
+			}
+		})
+	}
+	for name, opt := range map[string]Option[string]{
+		"compression": WithSnapshotCompression[string](Snappy + 1),
+		"sync policy": WithAOFSync[string](AOFSyncNever + 1),
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("New with an unknown %s did not panic", name)
+				}
+			}()
+			New(opt)
+		}()
+	}
+}
+
+func TestWithSnapshotEncryption(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, 32)
+	src := New(WithSnapshotEncryption[string](key), WithSnapshotCompression[string](Zstd))
+	for i := range 2000 {
+		src.Set(strconv.Itoa(i), "session-"+strconv.Itoa(i))
+	}
+	buf := new(bytes.Buffer)
+	if err := src.Write(context.Background(), buf); err != nil {
+		t.Fatal(err)
+	}
+	snapshot := buf.Bytes()
+	if bytes.Contains(snapshot, []byte("session-")) {
+		t.Fatal("snapshot contains plaintext values")
+	}
+
+	g := New(WithSnapshotEncryption[string](key))
+	if err := g.Read(bytes.NewReader(snapshot)); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := g.Get("1999"); !ok || v != "session-1999" || g.Len() != 2000 {
+		t.Fatalf("Get(1999) = %q, %v, len %d", v, ok, g.Len())
+	}
+	for name, g := range map[string]Gache[string]{
+		"no key":    New[string](),
+		"other key": New(WithSnapshotEncryption[string](bytes.Repeat([]byte{2}, 32))),
+	} {
+		if err := g.Read(bytes.NewReader(snapshot)); err == nil {
+			t.Errorf("Read with %s succeeded", name)
+		}
+	}
+	tampered := bytes.Clone(snapshot)
+	tampered[len(tampered)-1] ^= 1
+	if err := New(WithSnapshotEncryption[string](key)).Read(bytes.NewReader(tampered)); err == nil {
+		t.Fatal("Read of tampered snapshot succeeded")
+	}
+	if err := New(WithSnapshotEncryption[string](key)).Read(bytes.NewReader(snapshot[:len(snapshot)-20])); err == nil {
+		t.Fatal("Read of truncated snapshot succeeded")
+	}
+	if err := New(WithSnapshotEncryption[string]([]byte("short"))).Write(context.Background(), io.Discard); err == nil {
+		t.Fatal("Write with an invalid key succeeded")
+	}
+}
+
+func TestSnapshotChecksum(t *testing.T) {
+	src := New[int]()
+	for i := range 100 {
+		src.Set(strconv.Itoa(i), i)
+	}
+	buf := new(bytes.Buffer)
+	if err := src.Write(context.Background(), buf); err != nil {
+		t.Fatal(err)
+	}
+	snapshot := buf.Bytes()
+	if info, err := ReadSnapshotInfo(bytes.NewReader(snapshot)); err != nil || info != (SnapshotInfo{Version: snapshotVersion, Codec: "gob"}) {
+		t.Fatalf("ReadSnapshotInfo = %+v, %v", info, err)
+	}
+	g := New[int]()
+	if err := g.Read(bytes.NewReader(snapshot)); err != nil || g.Len() != 100 {
+		t.Fatalf("Read = %v, len %d", err, g.Len())
+	}
+
+	corrupted := func(f func(b []byte) []byte) []byte {
+		return f(bytes.Clone(snapshot))
+	}
+	for name, b := range map[string][]byte{
+		"payload":  corrupted(func(b []byte) []byte { b[len(b)/2] ^= 0xff; return b }),
+		"checksum": corrupted(func(b []byte) []byte { b[len(b)-1] ^= 0xff; return b }),
+		"count":    corrupted(func(b []byte) []byte { b[len(b)-9]++; return b }),
+		"trailer":  snapshot[:len(snapshot)-10],
+		"header":   snapshot[:len(snapshotMagic)+2],
+		"legacy":   []byte("corrupt"),
+	} {
+		if err := New[int]().Read(bytes.NewReader(b)); !errors.Is(err, ErrCorruptSnapshot) {
+			t.Errorf("Read of corrupted %s = %v, want ErrCorruptSnapshot", name, err)
+		}
+	}
+
+	for name, b := range map[string][]byte{
+		"version":     corrupted(func(b []byte) []byte { b[len(snapshotMagic)] = 99; return b }),
+		"compression": corrupted(func(b []byte) []byte { b[len(snapshotMagic)+1] = 99; return b }),
+	} {
+		if err := New[int]().Read(bytes.NewReader(b)); !errors.Is(err, ErrUnsupportedSnapshot) {
+			t.Errorf("Read of %s 99 = %v, want ErrUnsupportedSnapshot", name, err)
+		}
+	}
+	if err := New[string]().Read(bytes.NewReader(snapshot)); !errors.Is(err, ErrCorruptSnapshot) {
+		t.Errorf("Read of int snapshot into string cache = %v, want ErrCorruptSnapshot", err)
+	}
+
+	key := bytes.Repeat([]byte{1}, 32)
+	buf.Reset()
+	if err := New[int](WithSnapshotEncryption[int](key)).SetDefaultExpire(0).Write(context.Background(), buf); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := ReadSnapshotInfo(bytes.NewReader(buf.Bytes())); err != nil || !info.Encrypted {
+		t.Fatalf("ReadSnapshotInfo of encrypted snapshot = %+v, %v", info, err)
+	}
+	for _, g := range []Gache[int]{New[int](), New[int](WithSnapshotEncryption[int](bytes.Repeat([]byte{2}, 32)))} {
+		if err := g.Read(bytes.NewReader(buf.Bytes())); !errors.Is(err, ErrSnapshotKey) {
+			t.Errorf("Read of encrypted snapshot = %v, want ErrSnapshotKey", err)
+		}
+	}
+}
+
+func TestReadOptions(t *testing.T) {
+	src := New[int]()
+	src.SetWithExpire("shared", 1, time.Hour)
+	src.Set("incoming", 2)
+	buf := new(bytes.Buffer)
+	if err := src.Write(context.Background(), buf); err != nil {
+		t.Fatal(err)
+	}
+	read := func(opts ...ReadOption[int]) Gache[int] {
+		t.Helper()
+		g := New[int]()
+		g.SetWithExpire("shared", 10, time.Minute)
+		if err := g.Read(bytes.NewReader(buf.Bytes()), opts...); err != nil {
+			t.Fatal(err)
+		}
+		if v, ok := g.Get("incoming"); !ok || v != 2 {
+			t.Fatalf("Get(incoming) = %d, %v", v, ok)
+		}
+		return g
+	}
+	for name, tt := range map[string]struct {
+		opts []ReadOption[int]
+		want int
+		ttl  time.Duration
+	}{
+		"default":   {nil, 1, time.Hour},
+		"overwrite": {[]ReadOption[int]{KeepExisting[int](), Overwrite[int]()}, 1, time.Hour},
+		"keep":      {[]ReadOption[int]{KeepExisting[int]()}, 10, time.Minute},
+		"merge": {[]ReadOption[int]{MergeWith(func(key string, existing, incoming int) int {
+			return existing + incoming
+		})}, 11, time.Hour},
+	} {
+		g := read(tt.opts...)
+		if v, ok := g.Get("shared"); !ok || v != tt.want {
+			t.Errorf("%s: Get(shared) = %d, %v, want %d", name, v, ok, tt.want)
+		}
+		if ttl, ok := g.TTL("shared"); !ok || ttl <= tt.ttl-time.Second || ttl > tt.ttl {
+			t.Errorf("%s: TTL(shared) = %v, want %v", name, ttl, tt.ttl)
+		}
+	}
+
+	src.Namespace("p:").Set("shared", 3)
+	nsBuf := new(bytes.Buffer)
+	if err := src.Namespace("p:").Write(context.Background(), nsBuf); err != nil {
+		t.Fatal(err)
+	}
+	g := New[int]()
+	ns := g.Namespace("q:")
+	ns.Set("shared", 4)
+	var keys []string
+	if err := ns.Read(nsBuf, MergeWith(func(key string, existing, incoming int) int {
+		keys = append(keys, key)
+		return existing * incoming
+	})); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := ns.Get("shared"); !ok || v != 12 || !slices.Equal(keys, []string{"shared"}) {
+		t.Fatalf("namespace merge = %d, %v, keys %v", v, ok, keys)
+	}
+}
+
+func TestReadRemapAndFilter(t *testing.T) {
+	src := New[int]()
+	src.SetWithExpire("hour", 1, time.Hour)
+	src.SetWithExpire("forever", 2, NoTTL)
+	src.SetWithExpire("short", 3, time.Minute)
+	src.Set("skip:a", 4)
+	buf := new(bytes.Buffer)
+	if err := src.Write(context.Background(), buf); err != nil {
+		t.Fatal(err)
+	}
+
+	g := New[int]()
+	var stats ReadStats
+	err := g.Read(bytes.NewReader(buf.Bytes()), CapTTL[int](10*time.Minute), FilterKeys[int](func(key string) bool {
+		return !strings.HasPrefix(key, "skip:")
+	}), ReadReport[int](&stats))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats != (ReadStats{Loaded: 3, Skipped: 1}) {
+		t.Fatalf("ReadStats = %+v", stats)
+	}
+	for key, want := range map[string]time.Duration{"hour": 10 * time.Minute, "forever": 10 * time.Minute, "short": time.Minute} {
+		if ttl, ok := g.TTL(key); !ok || ttl <= want-time.Second || ttl > want {
+			t.Errorf("TTL(%s) = %v, %v, want %v", key, ttl, ok, want)
+		}
+	}
+	if _, ok := g.Get("skip:a"); ok {
+		t.Fatal("filtered key was read")
+	}
+
+	g = New[int]()
+	var remapped []string
+	if err := g.Namespace("p:").Read(bytes.NewReader(buf.Bytes()), RemapTTL[int](func(key string, ttl time.Duration) time.Duration {
+		remapped = append(remapped, key)
+		if key == "hour" {
+			return NoTTL
+		}
+		return ttl
+	}), ReadReport[int](&stats)); err != nil {
+		t.Fatal(err)
+	}
+	if stats != (ReadStats{Loaded: 4}) || len(remapped) != 4 || !slices.Contains(remapped, "hour") {
+		t.Fatalf("namespace ReadStats = %+v, remapped %v", stats, remapped)
+	}
+	if ttl, ok := g.TTL("p:hour"); !ok || ttl != NoTTL {
+		t.Fatalf("TTL of remapped key = %v, %v", ttl, ok)
+	}
+	if ttl, ok := g.TTL("p:forever"); !ok || ttl != NoTTL {
+		t.Fatalf("TTL of key without expiration = %v, %v", ttl, ok)
+	}
+
+	// entries may expire between Write and Read
+	buf.Reset()
+	buf.WriteString(snapshotMagic + "\x02")
+	enc := gob.NewEncoder(buf)
+	for _, rec := range []record[int]{{Key: "live", Value: 1}, {Key: "expired", Value: 2, Expire: 1}} {
+		if err := enc.Encode(&rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := New[int]().Read(buf, ReadReport[int](&stats)); err != nil || stats != (ReadStats{Loaded: 1, Expired: 1}) {
+		t.Fatalf("ReadStats of snapshot with expired entry = %+v, %v", stats, err)
+	}
+}
+
+func TestReadContext(t *testing.T) {
+	src := New[int]()
+	for i := range 10 {
+		src.Set(strconv.Itoa(i), i+1)
+	}
+	buf := new(bytes.Buffer)
+	if err := src.Write(context.Background(), buf); err != nil {
+		t.Fatal(err)
+	}
+	snapshot := buf.Bytes()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	g := New[int]()
+	if err := g.ReadContext(ctx, bytes.NewReader(snapshot)); !errors.Is(err, context.Canceled) {
+		t.Fatalf("ReadContext with done context = %v, want %v", err, context.Canceled)
+	}
+	if keys := g.Keys(context.Background()); len(keys) != 0 {
+		t.Fatalf("keys after aborted decode = %v, want none", keys)
+	}
+
+	// an abort while storing keeps the entries stored so far
+	for i := range 10 {
+		g.Set(strconv.Itoa(i), 0)
+	}
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	var stats ReadStats
+	err := g.ReadContext(ctx, bytes.NewReader(snapshot), ReadReport[int](&stats), MergeWith(func(_ string, _, incoming int) int {
+		cancel()
+		return incoming
+	}))
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("ReadContext canceled while storing = %v, want %v", err, context.Canceled)
+	}
+	merged := 0
+	for i := range 10 {
+		if v, _ := g.Get(strconv.Itoa(i)); v != 0 {
+			merged++
+		}
+	}
+	if merged != 1 || stats.Loaded != 1 {
+		t.Fatalf("merged %d entries reporting %+v, want 1", merged, stats)
+	}
+
+	ns := New[int]().Namespace("p:")
+	if err := ns.ReadContext(context.Background(), bytes.NewReader(snapshot)); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := ns.Get("9"); !ok || v != 10 {
+		t.Fatalf("namespace Get(9) = %v, %v", v, ok)
+	}
+
+	// entries are stored as frames are decoded, the frames before a truncation are kept
+	for i := range 3 * snapshotFrameRecords {
+		src.Set(strconv.Itoa(i), i)
+	}
+	buf.Reset()
+	if err := src.Write(context.Background(), buf); err != nil {
+		t.Fatal(err)
+	}
+	truncated := buf.Bytes()[:buf.Len()-20]
+	g = New[int]()
+	if err := g.ReadContext(context.Background(), bytes.NewReader(truncated)); !errors.Is(err, ErrCorruptSnapshot) {
+		t.Fatalf("ReadContext of truncated snapshot = %v, want ErrCorruptSnapshot", err)
+	}
+	if g.Len() < 2*snapshotFrameRecords {
+		t.Fatalf("Len after truncated read = %d, want the complete frames stored", g.Len())
+	}
+	if err := g.ReadWithResolver(bytes.NewReader(truncated), func(_ string, existing, _ int, exp, _ int64) (int, int64, bool) {
+		return existing, exp, true
+	}); !errors.Is(err, ErrCorruptSnapshot) {
+		t.Fatalf("ReadWithResolver of truncated snapshot = %v, want ErrCorruptSnapshot", err)
+	}
+}
+
+func TestStartAutosave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.snapshot")
+	g := New[int](WithAutosaveGenerations[int](3))
+	if s := g.LastSave(); s.Saves != 0 || !s.At.IsZero() {
+		t.Fatalf("LastSave before autosave = %+v", s)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	g.StartAutosave(ctx, time.Millisecond, path)
+	var last int
+	for g.LastSave().Saves < 4 {
+		last++
+		g.Set("key", last)
+		runtime.Gosched()
+	}
+	cancel()
+	saves := g.LastSave().Saves
+	for g.LastSave().Saves == saves {
+		runtime.Gosched()
+	}
+	s := g.LastSave()
+	if s.Err != nil || s.Path != path || s.Bytes == 0 || s.Failures != 0 {
+		t.Fatalf("LastSave = %+v", s)
+	}
+	for _, name := range []string{path, path + ".1", path + ".2"} {
+		f, err := os.Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = New[int]().Read(f)
+		f.Close()
+		if err != nil {
+			t.Fatalf("Read %s: %v", name, err)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Fatalf("Stat of fourth generation = %v", err)
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 3 {
+		t.Fatalf("autosave directory has %d files, want 3", len(entries))
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	restored := New[int]()
+	if err := restored.Read(f); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := restored.Get("key"); !ok || v != last {
+		t.Fatalf("restored key = %d, %v", v, ok)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	g = New[int]()
+	g.StartAutosave(ctx, time.Millisecond, filepath.Join(path, "missing", "cache.snapshot"))
+	for g.LastSave().Failures == 0 {
+		runtime.Gosched()
+	}
+	if s := g.LastSave(); s.Err == nil || s.Saves != 0 {
+		t.Fatalf("LastSave of unwritable path = %+v", s)
+	}
+}
+
+func TestAOF(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.aof")
+	g := New[int](WithAOFSync[int](AOFSyncAlways))
+	if err := g.OpenAOF(context.Background(), path); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.OpenAOF(context.Background(), path); !errors.Is(err, ErrAOFOpen) {
+		t.Fatalf("second OpenAOF = %v, want ErrAOFOpen", err)
+	}
+	g.Set("cleared", 1)
+	g.Clear()
+	g.Set("a", 1)
+	g.Set("a", 10)
+	g.SetWithExpire("b", 2, time.Hour)
+	g.Set("c", 3)
+	g.Delete("c")
+	g.SetWithExpire("d", 4, time.Hour)
+	g.Persist("d")
+	if err := g.CloseAOF(); err != nil {
+		t.Fatal(err)
+	}
+	g.Set("unlogged", 5)
+
+	check := func(name string) {
+		t.Helper()
+		g := New[int]()
+		if err := g.OpenAOF(context.Background(), path); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		defer g.CloseAOF()
+		if got := g.ToRawMap(context.Background()); !maps.Equal(got, map[string]int{"a": 10, "b": 2, "d": 4}) {
+			t.Fatalf("%s: replayed %v", name, got)
+		}
+		if ttl, ok := g.TTL("b"); !ok || ttl <= 0 || ttl > time.Hour {
+			t.Fatalf("%s: TTL of b = %v, %v", name, ttl, ok)
+		}
+		if ttl, ok := g.TTL("d"); !ok || ttl != NoTTL {
+			t.Fatalf("%s: TTL of d = %v, %v", name, ttl, ok)
+		}
+	}
+	check("replay")
+
+	g = New[int]()
+	if err := g.OpenAOF(context.Background(), path); err != nil {
+		t.Fatal(err)
+	}
+	before, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.CompactAOF(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	g.Set("e", 5)
+	g.Delete("e")
+	if err := g.CloseAOF(); err != nil {
+		t.Fatal(err)
+	}
+	after, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.Size() >= before.Size() {
+		t.Fatalf("log size after compaction = %d, before %d", after.Size(), before.Size())
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 1 {
+		t.Fatalf("log directory has %d files after compaction", len(entries))
+	}
+	check("compacted")
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte{0x40, 1, 2, 3})
+	f.Close()
+	check("torn")
+	if info, _ := os.Stat(path); info.Size() != after.Size() {
+		t.Fatalf("log size after truncating torn record = %d, want %d", info.Size(), after.Size())
+	}
+
+	// a damaged record before the end fails the replay and keeps the log intact
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := len(aofMagic) + 2 + int(data[len(aofMagic)+1])
+	l, n := binary.Uvarint(data[first:])
+	data[first+n+int(l)-1] ^= 0xff
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := New[int]().OpenAOF(context.Background(), path); !errors.Is(err, ErrCorruptSnapshot) {
+		t.Fatalf("OpenAOF of damaged log = %v, want ErrCorruptSnapshot", err)
+	}
+	if kept, _ := os.ReadFile(path); !bytes.Equal(kept, data) {
+		t.Fatalf("damaged log was rewritten to %d bytes, want %d", len(kept), len(data))
+	}
+
+	if err := os.WriteFile(path, []byte("not a log"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := New[int]().OpenAOF(context.Background(), path); !errors.Is(err, ErrCorruptSnapshot) {
+		t.Fatalf("OpenAOF of foreign file = %v, want ErrCorruptSnapshot", err)
+	}
+}
+
+type memTier struct {
+	mu sync.Mutex
+	m  map[string][]byte
+}
+
+func (t *memTier) Get(key string) ([]byte, bool, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	b, ok := t.m[key]
+	return b, ok, nil
+}
+
+func (t *memTier) Set(key string, value []byte, _ int64) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.m[key] = value
+	return nil
+}
+
+func (t *memTier) Delete(key string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.m, key)
+	return nil
+}
+
+func (t *memTier) keys() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return slices.Sorted(maps.Keys(t.m))
+}
+
+func TestWithTier(t *testing.T) {
+	tier := &memTier{m: make(map[string][]byte)}
+	g := New(WithMaxEntries[int](2), WithTier[int](tier), WithStats[int]())
+	g.Set("a", 1)
+	g.Set("b", 2)
+	g.Set("c", 3)
+	if keys := tier.keys(); !slices.Equal(keys, []string{"a"}) {
+		t.Fatalf("tier keys after eviction = %v", keys)
+	}
+	if v, ok := g.Get("a"); !ok || v != 1 {
+		t.Fatalf("Get of spilled key = %d, %v", v, ok)
+	}
+	if keys := tier.keys(); !slices.Equal(keys, []string{"b"}) || g.Len() != 2 {
+		t.Fatalf("tier keys after promotion = %v, Len = %d", keys, g.Len())
+	}
+	if s := g.Stats(); s.Hits != 1 || s.Misses != 0 {
+		t.Fatalf("Stats after promotion = %+v", s)
+	}
+
+	g.Set("b", 20)
+	if v, ok := g.Get("b"); !ok || v != 20 || slices.Contains(tier.keys(), "b") {
+		t.Fatalf("Get of overwritten spilled key = %d, %v, tier keys %v", v, ok, tier.keys())
+	}
+	spilled := tier.keys()
+	if len(spilled) != 1 {
+		t.Fatalf("tier keys = %v", spilled)
+	}
+	g.Delete(spilled[0])
+	if _, ok := g.Get(spilled[0]); ok || len(tier.keys()) != 0 {
+		t.Fatalf("deleted spilled key %s still readable, tier keys %v", spilled[0], tier.keys())
+	}
+	if _, ok := g.Get("missing"); ok {
+		t.Fatal("Get of missing key succeeded")
+	}
+
+	g.Set("d", 4)
+	g.Set("e", 5)
+	if len(tier.keys()) == 0 {
+		t.Fatal("no key spilled")
+	}
+	g.Clear()
+	if keys := tier.keys(); len(keys) != 0 {
+		t.Fatalf("tier keys after Clear = %v", keys)
+	}
+}
+
+func TestOpenMapped(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.map")
+	src := New[string]()
+	for i := range 1000 {
+		src.Set(strconv.Itoa(i), "v"+strconv.Itoa(i))
+	}
+	src.SetWithExpire("ttl", "t", time.Hour)
+	setExpired(src, "expired", "x")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := src.WriteMapped(context.Background(), f); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	g := New[string]()
+	if err := g.OpenMapped(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.OpenMapped(path); !errors.Is(err, ErrMappedOpen) {
+		t.Fatalf("second OpenMapped = %v, want ErrMappedOpen", err)
+	}
+	if g.Len() != 0 {
+		t.Fatalf("Len after OpenMapped = %d, want 0", g.Len())
+	}
+	for _, i := range []int{0, 500, 999} {
+		if v, ok := g.Get(strconv.Itoa(i)); !ok || v != "v"+strconv.Itoa(i) {
+			t.Fatalf("Get(%d) = %q, %v", i, v, ok)
+		}
+	}
+	if g.Len() != 3 {
+		t.Fatalf("Len after reading 3 entries = %d", g.Len())
+	}
+	if ttl, ok := g.TTL("ttl"); !ok || ttl <= 0 || ttl > time.Hour {
+		t.Fatalf("TTL of mapped entry = %v, %v", ttl, ok)
+	}
+	for _, key := range []string{"expired", "missing"} {
+		if _, ok := g.Get(key); ok {
+			t.Fatalf("Get(%s) succeeded", key)
+		}
+	}
+
+	g.Delete("1")
+	g.Set("2", "new")
+	if v, ok := g.Get("2"); !ok || v != "new" {
+		t.Fatalf("Get of overwritten mapped key = %q, %v", v, ok)
+	}
+	setExpired(g, "3", "expired")
+	for _, key := range []string{"1", "3"} {
+		if v, ok := g.Get(key); ok {
+			t.Fatalf("Get of shadowed key %s = %q", key, v)
+		}
+	}
+	if err := g.CloseMapped(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := g.Get("4"); ok {
+		t.Fatal("Get after CloseMapped read the snapshot")
+	}
+	if v, ok := g.Get("500"); !ok || v != "v500" {
+		t.Fatalf("Get of read entry after CloseMapped = %q, %v", v, ok)
+	}
+
+	ns := src.Namespace("p:")
+	ns.Set("a", "1")
+	f, err = os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ns.WriteMapped(context.Background(), f); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	g = New[string]()
+	if err := g.Namespace("q:").OpenMapped(path); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := g.Get("q:a"); !ok || v != "1" {
+		t.Fatalf("Get of namespaced mapped key = %q, %v", v, ok)
+	}
+	if _, ok := g.Get("a"); ok {
+		t.Fatal("Get of mapped key outside the namespace succeeded")
+	}
+
+	os.WriteFile(path, []byte("GACHEMAP\x01\x03gob-truncated-file"), 0o644)
+	if err := New[string]().OpenMapped(path); !errors.Is(err, ErrCorruptSnapshot) {
+		t.Fatalf("OpenMapped of corrupt file = %v, want ErrCorruptSnapshot", err)
+	}
+}
+
+func TestReadWithResolver(t *testing.T) {
+	src := New[int]()
+	src.Set("new", 1)
+	src.Set("keep", 2)
+	src.Set("sum", 3)
+	src.Set("drop", 4)
+	buf := new(bytes.Buffer)
+	if err := src.Write(context.Background(), buf); err != nil {
+		t.Fatal(err)
+	}
+
+	g := New[int]()
+	g.Set("keep", 20)
+	g.Set("sum", 30)
+	g.Set("drop", 40)
+	err := g.ReadWithResolver(buf, func(key string, existing, incoming int, existingExp, incomingExp int64) (int, int64, bool) {
+		switch key {
+		case "keep":
+			return existing, existingExp, true
+		case "sum":
+			return existing + incoming, NoTTL.Nanoseconds(), true
+		}
+		return 0, 0, false
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]int{"new": 1, "keep": 20, "sum": 33} {
+		if v, ok := g.Get(key); !ok || v != want {
+			t.Errorf("Get(%s) = %d, %v, want %d", key, v, ok, want)
+		}
+	}
+	if _, ok := g.Get("drop"); ok {
+		t.Error("dropped key is still cached")
+	}
+	if g.Len() != 3 {
+		t.Errorf("Len = %d", g.Len())
+	}
+}
+
+func TestFreeze(t *testing.T) {
+	g := New[int]()
+	g.Set("key", 1)
+	if g.Freeze().IsFrozen() != true {
+		t.Fatal("IsFrozen = false after Freeze")
+	}
+	g.Set("key", 2)
+	g.Set("other", 3)
+	g.Delete("key")
+	g.Clear()
+	if v, ok := g.Get("key"); !ok || v != 1 || g.Len() != 1 {
+		t.Fatalf("frozen cache was modified: %d, %v, len %d", v, ok, g.Len())
+	}
+	g.Unfreeze().Set("key", 2)
+	if v, _ := g.Get("key"); v != 2 {
+		t.Fatalf("Set after Unfreeze = %d", v)
+	}
+}
+
+func TestTransform(t *testing.T) {
+	src := New[string]()
+	src.Set("public", "value")
+	src.Set("secret", "password")
+	buf := new(bytes.Buffer)
+	err := src.WriteTransform(context.Background(), buf, func(v string) (string, bool) {
+		return strings.ToUpper(v), v != "password"
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := New[string]()
+	err = g.ReadTransform(buf, func(v string) (string, bool) {
+		return strings.ToLower(v) + "!", true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := g.Get("public"); !ok || v != "value!" {
+		t.Fatalf("Get(public) = %s, %v", v, ok)
+	}
+	if _, ok := g.Get("secret"); ok {
+		t.Fatal("dropped entry was written")
+	}
+}
+
+func TestGetOrdered(t *testing.T) {
+	g := New[int]()
+	g.Set("a", 1)
+	g.Set("b", 2)
+	keys := []string{"b", "missing", "a", "b", "a"}
+	res := g.GetOrdered(keys)
+	want := []Result[int]{
+		{Key: "b", Value: 2, Found: true},
+		{Key: "missing"},
+		{Key: "a", Value: 1, Found: true},
+		{Key: "b", Value: 2, Found: true},
+		{Key: "a", Value: 1, Found: true},
+	}
+	if len(res) != len(want) {
+		t.Fatalf("GetOrdered returned %d results", len(res))
+	}
+	for i := range want {
+		if res[i] != want[i] {
+			t.Errorf("result %d = %+v, want %+v", i, res[i], want[i])
+		}
+	}
+}
+
+func TestWithRejectEmptyKey(t *testing.T) {
+	g := New[int]()
+	g.Set("", 1)
+	if _, ok := g.Get(""); !ok {
+		t.Fatal("empty key is rejected by default")
+	}
+
+	g = New(WithRejectEmptyKey[int]())
+	g.Set("", 1)
+	if g.SetIfVersion("", 1, 0) {
+		t.Fatal("SetIfVersion accepted empty key")
+	}
+	if _, ok := g.Get(""); ok || g.Len() != 0 {
+		t.Fatal("empty key was stored")
+	}
+}
+
+func TestLastSweepPerShard(t *testing.T) {
+	g := New[int]()
+	g.DeleteExpired(context.Background())
+	if stats := g.LastSweepPerShard(); stats != nil {
+		t.Fatal("per-shard stats recorded without WithSweepStats")
+	}
+
+	g = New(WithShardFunc[int](func(string) int { return 7 }), WithSweepStats[int]())
+	g.Set("live", 1)
+	setExpired(g, "expired", 2)
+	g.DeleteExpired(context.Background())
+	stats := g.LastSweepPerShard()
+	if len(stats) != slen {
+		t.Fatalf("LastSweepPerShard returned %d shards", len(stats))
+	}
+	if s := stats[7]; s.Shard != 7 || s.Scanned != 2 || s.Removed != 1 {
+		t.Fatalf("shard stat = %+v", s)
+	}
+}
+
+func TestSetWithExpireReturningOld(t *testing.T) {
+	g := New[int]()
+	if _, ok := g.SetWithExpireReturningOld("key", 1, time.Minute); ok {
+		t.Fatal("absent key reported a previous value")
+	}
+	if v, ok := g.SetWithExpireReturningOld("key", 2, time.Minute); !ok || v != 1 {
+		t.Fatalf("SetWithExpireReturningOld = %d, %v", v, ok)
+	}
+	setExpired(g, "key", 3)
+	if _, ok := g.SetWithExpireReturningOld("key", 4, time.Minute); ok {
+		t.Fatal("expired value was returned")
+	}
+	if v, _ := g.Get("key"); v != 4 {
+		t.Fatalf("Get = %d", v)
+	}
+}
+
+func TestGetOrSet(t *testing.T) {
+	g := New[int]()
+	if v, loaded := g.GetOrSet("key", 1); loaded || v != 1 {
+		t.Fatalf("GetOrSet absent = %d, %v", v, loaded)
+	}
+	if v, loaded := g.GetOrSet("key", 2); !loaded || v != 1 {
+		t.Fatalf("GetOrSet present = %d, %v", v, loaded)
+	}
+	setExpired(g, "key", 3)
+	if v, loaded := g.GetOrSet("key", 4); loaded || v != 4 {
+		t.Fatalf("GetOrSet expired = %d, %v", v, loaded)
+	}
+
+	var wg sync.WaitGroup
+	var stored atomic.Int64
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if _, loaded := g.GetOrSet("race", i); !loaded {
+				stored.Add(1)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if stored.Load() != 1 {
+		t.Fatalf("%d concurrent GetOrSet calls stored a value", stored.Load())
+	}
+}
+
+func TestSetIfNotExists(t *testing.T) {
+	g := New[int]()
+	if !g.SetIfNotExists("key", 1) {
+		t.Fatal("absent key was not set")
+	}
+	if g.SetIfNotExists("key", 2) || g.SetWithExpireIfNotExists("key", 3, time.Minute) {
+		t.Fatal("existing key was overwritten")
+	}
+	setExpired(g, "key", 4)
+	if !g.SetWithExpireIfNotExists("key", 5, NoTTL) {
+		t.Fatal("expired key was not overwritten")
+	}
+	if v, exp, _ := g.GetWithExpire("key"); v != 5 || exp != NoTTL.Nanoseconds() {
+		t.Fatalf("GetWithExpire = %d, %d", v, exp)
+	}
+}
+
+func TestPop(t *testing.T) {
+	g := New[int]()
+	g.Set("token", 1)
+	var wg sync.WaitGroup
+	var popped atomic.Int64
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if v, ok := g.Pop("token"); ok && v == 1 {
+				popped.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if popped.Load() != 1 || g.Len() != 0 {
+		t.Fatalf("token popped %d times, len %d", popped.Load(), g.Len())
+	}
+	setExpired(g, "expired", 2)
+	if _, ok := g.Pop("expired"); ok || g.Len() != 0 {
+		t.Fatal("expired value was popped")
+	}
+}
+
+func TestKeys(t *testing.T) {
+	g := New[int]()
+	for i := 0; i < 10; i++ {
+		g.Set(strconv.Itoa(i), i)
+	}
+	setExpired(g, "expired", -1)
+	keys := g.Keys(context.Background())
+	slices.Sort(keys)
+	if !slices.Equal(keys, []string{"0", "1", "2", "3", "4", "5", "6", "7", "8", "9"}) {
+		t.Fatalf("Keys = %v", keys)
+	}
+	var iterated []string
+	for k := range g.KeysIter() {
+		iterated = append(iterated, k)
+	}
+	slices.Sort(iterated)
+	if !slices.Equal(keys, iterated) {
+		t.Fatalf("KeysIter = %v", iterated)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if keys := g.Keys(ctx); len(keys) != 0 {
+		t.Fatalf("Keys with canceled context = %v", keys)
+	}
+}
+
+func TestExtendExpireAndTouch(t *testing.T) {
+	g := New[int]()
+	g.SetWithExpire("key", 1, time.Minute)
+	_, before, _ := g.GetWithExpire("key")
+	if !g.ExtendExpire("key", time.Hour) {
+		t.Fatal("ExtendExpire failed on live key")
+	}
+	if _, after, _ := g.GetWithExpire("key"); after-before != time.Hour.Nanoseconds() {
+		t.Fatalf("ExtendExpire extended by %v", time.Duration(after-before))
+	}
+	if !g.Touch("key") {
+		t.Fatal("Touch failed on live key")
+	}
+	if ttl, _ := g.Handle("key").TTL(); ttl > time.Second*30 {
+		t.Fatalf("Touch did not reset to default expiration: %v", ttl)
+	}
+	setExpired(g, "expired", 2)
+	if g.ExtendExpire("expired", time.Hour) || g.Touch("expired") || g.Touch("missing") {
+		t.Fatal("expired or missing key was extended")
+	}
+}
+
+func TestGetRefresh(t *testing.T) {
+	g := New[int]()
+	g.SetWithExpire("key", 1, time.Second)
+	if v, ok := g.GetRefreshWithDur("key", time.Hour); !ok || v != 1 {
+		t.Fatalf("GetRefreshWithDur = %d, %v", v, ok)
+	}
+	if ttl, _ := g.Handle("key").TTL(); ttl < time.Minute*59 {
+		t.Fatalf("GetRefreshWithDur did not extend expiration: %v", ttl)
+	}
+	if v, ok := g.GetRefresh("key"); !ok || v != 1 {
+		t.Fatalf("GetRefresh = %d, %v", v, ok)
+	}
+	if ttl, _ := g.Handle("key").TTL(); ttl > time.Second*30 {
+		t.Fatalf("GetRefresh did not reset expiration: %v", ttl)
+	}
+	if _, ok := g.GetRefresh("missing"); ok {
+		t.Fatal("GetRefresh found missing key")
+	}
+}
+
+func TestGetWithIgnoredExpire(t *testing.T) {
+	g := New[int]()
+	setExpired(g, "stale", 1)
+	if v, ok := g.GetWithIgnoredExpire("stale"); !ok || v != 1 {
+		t.Fatalf("GetWithIgnoredExpire = %d, %v", v, ok)
+	}
+	if _, ok := g.Get("stale"); ok {
+		t.Fatal("Get returned expired value")
+	}
+	if _, ok := g.GetWithIgnoredExpire("stale"); ok {
+		t.Fatal("expired value survived Get")
+	}
+}
+
+func TestCompareAndSwap(t *testing.T) {
+	g := New[int]()
+	g.SetWithExpire("counter", 0, time.Hour)
+	_, exp, _ := g.GetWithExpire("counter")
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				v, _ := g.Get("counter")
+				if g.CompareAndSwap("counter", v, v+1) {
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if v, e, _ := g.GetWithExpire("counter"); v != 100 || e != exp {
+		t.Fatalf("counter = %d, expire changed %v", v, e != exp)
+	}
+	if g.CompareAndSwap("missing", 0, 1) {
+		t.Fatal("CompareAndSwap succeeded on missing key")
+	}
+
+	gs := New(WithEqual(slices.Equal[[]int]))
+	gs.Set("slice", []int{1, 2})
+	if !gs.CompareAndSwap("slice", []int{1, 2}, []int{3}) {
+		t.Fatal("CompareAndSwap with WithEqual failed")
+	}
+}
+
+func TestCompareAndDelete(t *testing.T) {
+	g := New[string]()
+	g.Set("key", "observed")
+	g.Set("key", "newer")
+	if g.CompareAndDelete("key", "observed") {
+		t.Fatal("newer value was deleted")
+	}
+	if !g.CompareAndDelete("key", "newer") || g.Len() != 0 {
+		t.Fatal("CompareAndDelete did not delete matching value")
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	g := New[[]int]()
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			g.Update("list", func(old []int, _ bool) ([]int, bool) {
+				return append(slices.Clone(old), i), true
+			})
+		}(i)
+	}
+	wg.Wait()
+	if v, _ := g.Get("list"); len(v) != 100 {
+		t.Fatalf("Update lost writes: %d values", len(v))
+	}
+	if _, ok := g.Update("list", func([]int, bool) ([]int, bool) { return nil, false }); ok {
+		t.Fatal("Update reported a write when fn declined")
+	}
+	if v, ok := g.Update("new", func(_ []int, exists bool) ([]int, bool) {
+		return []int{1}, !exists
+	}); !ok || len(v) != 1 || g.Len() != 2 {
+		t.Fatalf("Update on absent key = %v, %v", v, ok)
+	}
+}
+
+func TestSwap(t *testing.T) {
+	g := New[int]()
+	if _, loaded := g.Swap("key", 1); loaded {
+		t.Fatal("Swap on absent key reported previous value")
+	}
+	if prev, loaded := g.Swap("key", 2); !loaded || prev != 1 {
+		t.Fatalf("Swap = %d, %v", prev, loaded)
+	}
+	if v, _ := g.Get("key"); v != 2 || g.Len() != 1 {
+		t.Fatalf("Get after Swap = %d, len %d", v, g.Len())
+	}
+}
+
+func TestMulti(t *testing.T) {
+	g := New[int]()
+	kvs := make(map[string]int)
+	keys := make([]string, 0, 500)
+	for i := 0; i < 500; i++ {
+		kvs[strconv.Itoa(i)] = i
+		keys = append(keys, strconv.Itoa(i))
+	}
+	g.SetMulti(kvs)
+	if g.Len() != 500 {
+		t.Fatalf("Len after SetMulti = %d", g.Len())
+	}
+	got := g.GetMulti(append(keys, "missing"))
+	if len(got) != 500 || got["42"] != 42 {
+		t.Fatalf("GetMulti returned %d values", len(got))
+	}
+	if n := g.DeleteMulti(append(keys[:100], "missing")); n != 100 || g.Len() != 400 {
+		t.Fatalf("DeleteMulti = %d, len %d", n, g.Len())
+	}
+}
+
+func TestExpireAt(t *testing.T) {
+	g := New[int]()
+	at := time.Now().Add(time.Hour)
+	g.SetWithExpireAt("key", 1, at)
+	if _, exp, ok := g.GetWithExpire("key"); !ok || exp != at.UnixNano() {
+		t.Fatalf("GetWithExpire = %d, %v", exp, ok)
+	}
+	if !g.ExpireAt("key", time.Time{}) {
+		t.Fatal("ExpireAt failed on live key")
+	}
+	if ttl, _ := g.Handle("key").TTL(); ttl != NoTTL {
+		t.Fatalf("ExpireAt zero time TTL = %v", ttl)
+	}
+	if !g.ExpireAt("key", time.Now().Add(-time.Hour)) {
+		t.Fatal("ExpireAt failed on live key")
+	}
+	if _, ok := g.Get("key"); ok {
+		t.Fatal("key expiring in the past is still live")
+	}
+	g.SetWithExpireAt("old", 2, time.Unix(-1, 0))
+	if _, ok := g.Get("old"); ok {
+		t.Fatal("key expiring before epoch is live")
+	}
+}
+
+func TestPersist(t *testing.T) {
+	g := New[int]()
+	g.SetWithExpire("key", 1, time.Minute)
+	if !g.Persist("key") {
+		t.Fatal("Persist failed on live key")
+	}
+	if v, exp, ok := g.GetWithExpire("key"); !ok || v != 1 || exp != NoTTL.Nanoseconds() {
+		t.Fatalf("GetWithExpire after Persist = %d, %d, %v", v, exp, ok)
+	}
+	if g.Persist("missing") {
+		t.Fatal("Persist succeeded on missing key")
+	}
+}
+
+func TestTTL(t *testing.T) {
+	g := New[int]()
+	g.SetWithExpire("key", 1, time.Hour)
+	g.SetWithExpire("forever", 2, NoTTL)
+	if ttl, ok := g.TTL("key"); !ok || ttl <= time.Minute*59 || ttl > time.Hour {
+		t.Fatalf("TTL = %v, %v", ttl, ok)
+	}
+	if v, ttl, ok := g.GetWithTTL("forever"); !ok || v != 2 || ttl != NoTTL {
+		t.Fatalf("GetWithTTL = %d, %v, %v", v, ttl, ok)
+	}
+	if _, ok := g.TTL("missing"); ok {
+		t.Fatal("TTL found missing key")
+	}
+}
+
+func TestIncrBy(t *testing.T) {
+	g := New[int64]()
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			IncrBy(g, "counter", 2)
+			DecrBy(g, "counter", 1)
+		}()
+	}
+	wg.Wait()
+	if v, _ := g.Get("counter"); v != 100 {
+		t.Fatalf("counter = %d", v)
+	}
+	if v := IncrBy(g, "counter", 5); v != 105 {
+		t.Fatalf("IncrBy = %d", v)
+	}
+}
+
+func TestDeleteByPrefix(t *testing.T) {
+	g := New[int]()
+	for i := 0; i < 100; i++ {
+		g.Set("user:42:"+strconv.Itoa(i), i)
+		g.Set("user:43:"+strconv.Itoa(i), i)
+	}
+	setExpired(g, "user:42:expired", -1)
+	if n := g.DeleteByPrefix(context.Background(), "user:42:"); n != 100 {
+		t.Fatalf("DeleteByPrefix = %d", n)
+	}
+	if g.Len() != 100 {
+		t.Fatalf("Len after DeleteByPrefix = %d", g.Len())
+	}
+	if _, ok := g.Get("user:43:1"); !ok {
+		t.Fatal("unrelated key was deleted")
+	}
+}
+
+func TestDeleteByPattern(t *testing.T) {
+	g := New[int]()
+	for _, k := range []string{"user:1:profile", "user:2:profile", "user:2:settings", "user:10/x:profile", "admin:1:profile", "user:1:profile.bak"} {
+		g.Set(k, 0)
+	}
+	if n := g.DeleteByPattern(context.Background(), "user:*:profile"); n != 3 {
+		t.Fatalf("DeleteByPattern = %d", n)
+	}
+	if n := g.DeleteByPattern(context.Background(), "user:?:settings"); n != 1 {
+		t.Fatalf("DeleteByPattern with ? = %d", n)
+	}
+	if n := g.DeleteByRegexp(context.Background(), regexp.MustCompile(`\.bak$`)); n != 1 {
+		t.Fatalf("DeleteByRegexp = %d", n)
+	}
+	if keys := g.Keys(context.Background()); len(keys) != 1 || keys[0] != "admin:1:profile" {
+		t.Fatalf("remaining keys = %v", keys)
+	}
+}
+
+func TestTags(t *testing.T) {
+	g := New[int]()
+	g.SetWithTags("user:1", 1, time.Minute, "user", "db:users")
+	g.SetWithTags("user:2", 2, time.Minute, "user")
+	g.SetWithTags("order:1", 3, time.Minute, "db:orders")
+	g.SetWithTags("user:3", 4, time.Minute, "user")
+	g.Set("user:3", 5)
+
+	if n := g.InvalidateTag("user"); n != 2 {
+		t.Fatalf("InvalidateTag = %d", n)
+	}
+	if _, ok := g.Get("user:1"); ok {
+		t.Fatal("tagged key survived InvalidateTag")
+	}
+	if v, ok := g.Get("user:3"); !ok || v != 5 {
+		t.Fatal("key overwritten without tags was invalidated")
+	}
+	if n := g.InvalidateTag("user"); n != 0 {
+		t.Fatalf("second InvalidateTag = %d", n)
+	}
+	if n := g.InvalidateTag("db:orders"); n != 1 || g.Len() != 1 {
+		t.Fatalf("InvalidateTag(db:orders) = %d, len %d", n, g.Len())
+	}
+}
+
+func TestTagsChurn(t *testing.T) {
+	indexed := func(g Gache[int]) (n int) {
+		g.(*gache[int]).tags.Range(func(_ string, keys *Map[string, bool]) bool {
+			keys.Range(func(string, bool) bool {
+				n++
+				return true
+			})
+			return true
+		})
+		return n
+	}
+	g := New(WithMaxEntries[int](100))
+	for i := range 1000 {
+		g.SetWithTags(strconv.Itoa(i), i, time.Minute, "all", "n"+strconv.Itoa(i%10))
+	}
+	if n := indexed(g); n != 2*g.Len() {
+		t.Fatalf("index after eviction = %d keys, want %d", n, 2*g.Len())
+	}
+	keys := g.Keys(context.Background())
+	for i, key := range keys {
+		switch i % 3 {
+		case 0:
+			g.Delete(key)
+		case 1:
+			g.ExpireAt(key, time.Unix(0, 1))
+		case 2:
+			g.Set(key, i)
+		}
+	}
+	g.DeleteExpired(context.Background())
+	if n := indexed(g); n != 0 {
+		t.Fatalf("index after delete, expire and overwrite = %d keys, want 0", n)
+	}
+	g.(*gache[int]).tags.Range(func(tag string, _ *Map[string, bool]) bool {
+		t.Fatalf("index keeps the empty tag %q", tag)
+		return false
+	})
+}
+
+func TestNamespace(t *testing.T) {
+	g := New[int]()
+	a := g.Namespace("a:")
+	b := g.Namespace("b:")
+	a.Set("key", 1)
+	b.Set("key", 2)
+	b.Set("other", 3)
+	if v, ok := a.Get("key"); !ok || v != 1 {
+		t.Fatalf("a.Get = %d, %v", v, ok)
+	}
+	if v, ok := g.Get("b:key"); !ok || v != 2 {
+		t.Fatalf("root Get of namespaced key = %d, %v", v, ok)
+	}
+	if a.Len() != 1 || b.Len() != 2 || g.Len() != 3 {
+		t.Fatalf("Len a=%d b=%d root=%d", a.Len(), b.Len(), g.Len())
+	}
+	keys := b.Keys(context.Background())
+	slices.Sort(keys)
+	if !slices.Equal(keys, []string{"key", "other"}) {
+		t.Fatalf("b.Keys = %v", keys)
+	}
+	if res := b.GetOrdered([]string{"other", "key"}); res[0].Key != "other" || res[0].Value != 3 {
+		t.Fatalf("b.GetOrdered = %+v", res)
+	}
+	if m := b.GetMulti([]string{"key"}); m["key"] != 2 {
+		t.Fatalf("b.GetMulti = %v", m)
+	}
+	a.Namespace("x:").Set("k", 4)
+	if v, _ := g.Get("a:x:k"); v != 4 || g.Len() != 4 {
+		t.Fatalf("nested namespace key = %d, len %d", v, g.Len())
+	}
+
+	buf := new(bytes.Buffer)
+	if err := b.Write(context.Background(), buf); err != nil {
+		t.Fatal(err)
+	}
+	b.Clear()
+	if b.Len() != 0 || a.Len() != 2 {
+		t.Fatalf("Clear was not scoped: a=%d b=%d", a.Len(), b.Len())
+	}
+	c := g.Namespace("c:")
+	if err := c.ReadTransform(buf, func(v int) (int, bool) { return v, true }); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := g.Get("c:other"); !ok || v != 3 {
+		t.Fatalf("namespaced Read = %d, %v", v, ok)
+	}
+
+	// namespace lengths are counted by the writes of the root, a later namespace counts the keys already stored
+	g.Set("b:root", 5)
+	g.Delete("a:key")
+	if a.Len() != 1 || b.Len() != 1 || g.Namespace("c:").Len() != 2 || g.Namespace("a:x:").Len() != 1 {
+		t.Fatalf("Len after root writes a=%d b=%d c=%d", a.Len(), b.Len(), c.Len())
+	}
+	g.LazyClear()
+	b.Set("new", 6)
+	if a.Len() != 0 || b.Len() != 1 || c.Len() != 0 {
+		t.Fatalf("Len after LazyClear a=%d b=%d c=%d", a.Len(), b.Len(), c.Len())
+	}
+	g.Clear()
+	if b.Len() != 0 {
+		t.Fatalf("Len after Clear = %d", b.Len())
+	}
+}
+
+func TestGache2(t *testing.T) {
+	g := New2[int, string]().SetDefaultExpire(NoTTL)
+	for i := range 100 {
+		g.Set(i, strconv.Itoa(i))
+	}
+	if v, ok := g.Get(42); !ok || v != "42" || g.Len() != 100 {
+		t.Fatalf("Get(42) = %q, %v, len %d", v, ok, g.Len())
+	}
+	if _, ttl, ok := g.GetWithTTL(1); !ok || ttl != NoTTL {
+		t.Fatalf("GetWithTTL(1) = %v, %v", ttl, ok)
+	}
+	g.SetWithExpireAt(1, "old", time.Unix(0, 1))
+	if _, ok := g.Get(1); ok || g.Len() != 99 {
+		t.Fatalf("expired key returned, len %d", g.Len())
+	}
+	if !g.SetIfNotExists(1, "new") || g.SetIfNotExists(1, "again") {
+		t.Fatal("SetIfNotExists did not only set the missing key")
+	}
+	g.SetWithExpire(2, "ttl", time.Hour)
+	if _, ttl, _ := g.GetWithTTL(2); ttl <= 59*time.Minute || ttl > 61*time.Minute {
+		t.Fatalf("GetWithTTL(2) = %v", ttl)
+	}
+	if !g.Persist(2) || g.ExpireAt(-1, time.Now()) {
+		t.Fatal("Persist or ExpireAt of a missing key")
+	}
+	g.ExpireAt(3, time.Unix(0, 1))
+	if n := g.DeleteExpired(context.Background()); n != 1 || g.Len() != 99 {
+		t.Fatalf("DeleteExpired = %d, len %d", n, g.Len())
+	}
+	if v, ok := g.Delete(4); !ok || v != "4" {
+		t.Fatalf("Delete(4) = %q, %v", v, ok)
+	}
+	if keys := g.Keys(context.Background()); len(keys) != 98 || slices.Contains(keys, 3) {
+		t.Fatalf("Keys = %v", keys)
+	}
+	n := 0
+	for range g.RangeIter() {
+		n++
+	}
+	if n != g.Len() {
+		t.Fatalf("RangeIter yielded %d of %d", n, g.Len())
+	}
+	if allocs := testing.AllocsPerRun(100, func() { g.Get(42) }); allocs != 0 {
+		t.Fatalf("Get allocates %v times", allocs)
+	}
+	g.Clear()
+	if g.Len() != 0 {
+		t.Fatalf("Len after Clear = %d", g.Len())
+	}
+
+	ids := New2[[16]byte, int](WithShardCount2[[16]byte, int](4))
+	ids.Set([16]byte{1}, 1)
+	if v, ok := ids.Get([16]byte{1}); !ok || v != 1 {
+		t.Fatalf("array key Get = %d, %v", v, ok)
+	}
+
+	type point struct {
+		x, y int32
+		name string
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("New2 of a struct key without hasher did not panic")
+			}
+		}()
+		New2[point, int]()
+	}()
+	points := New2[point, int](WithHasher2[point, int](func(p point) uint64 {
+		return uint64(uint32(p.x))<<32 | uint64(uint32(p.y))
+	}))
+	points.Set(point{1, 2, "a"}, 3)
+	if v, ok := points.Get(point{1, 2, "a"}); !ok || v != 3 {
+		t.Fatalf("struct key Get = %d, %v", v, ok)
+	}
+	if _, ok := points.Get(point{1, 2, "b"}); ok {
+		t.Fatal("keys of the same hash were not compared")
+	}
+}
+
+func TestGetBytes(t *testing.T) {
+	g := New(WithStats[int](), WithMaxEntries[int](100), WithDefaultExpiration[int](NoTTL))
+	buf := []byte("GET user:1 user:2")
+	g.SetBytes(buf[4:10], 1)
+	copy(buf[4:10], "xxxxxx")
+	if v, ok := g.Get("user:1"); !ok || v != 1 {
+		t.Fatal("SetBytes kept the memory of the key")
+	}
+	copy(buf[4:10], "user:1")
+	if v, ok := g.GetBytes(buf[4:10]); !ok || v != 1 {
+		t.Fatalf("GetBytes = %d, %v", v, ok)
+	}
+	if _, ok := g.GetBytes(buf[11:]); ok {
+		t.Fatal("GetBytes of a missing key")
+	}
+	if s := g.Stats(); s.Hits != 2 || s.Misses != 1 {
+		t.Fatalf("Stats = %+v", s)
+	}
+	if allocs := testing.AllocsPerRun(100, func() { g.GetBytes(buf[4:10]) }); allocs != 0 {
+		t.Fatalf("GetBytes hit allocates %v times", allocs)
+	}
+
+	setExpired(g, "user:2", 2)
+	if _, ok := g.GetBytes(buf[11:]); ok || g.Len() != 1 {
+		t.Fatalf("GetBytes of an expired key, len %d", g.Len())
+	}
+	n := g.Namespace("user:")
+	n.SetBytes([]byte("3"), 3)
+	if v, ok := n.GetBytes([]byte("1")); !ok || v != 1 {
+		t.Fatalf("namespaced GetBytes = %d, %v", v, ok)
+	}
+	if v, ok := g.Get("user:3"); !ok || v != 3 {
+		t.Fatalf("namespaced SetBytes = %d, %v", v, ok)
+	}
+	key := []byte("1")
+	if allocs := testing.AllocsPerRun(100, func() { n.GetBytes(key) }); allocs != 0 {
+		t.Fatalf("namespaced GetBytes hit allocates %v times", allocs)
+	}
+	root := testing.AllocsPerRun(100, func() { g.SetBytes(buf[4:10], 1) })
+	if allocs := testing.AllocsPerRun(100, func() { n.SetBytes(key, 1) }); allocs > root {
+		t.Fatalf("namespaced SetBytes allocates %v times, root SetBytes %v", allocs, root)
+	}
+}
@@ -0,0 +1,4 @@
+// Package gachepb holds the generated protobuf and gRPC code of the Cache service served by the remote package.
+package gachepb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative gache.proto
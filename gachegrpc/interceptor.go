@@ -0,0 +1,91 @@
+// Package gachegrpc provides gRPC response caching backed by gache.
+// It lives in its own module so the core gache package stays free of the gRPC dependency.
+package gachegrpc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/ntsd/gache/v2"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+)
+
+type (
+	// Option configures UnaryClientInterceptor
+	Option func(*interceptor)
+
+	interceptor struct {
+		cache gache.Gache[[]byte]
+		ttls  map[string]time.Duration
+	}
+)
+
+// WithMethodTTL caches responses of the full method name such as "/pkg.Service/Method" for ttl,
+// zero ttl uses the default expiration of the cache
+func WithMethodTTL(method string, ttl time.Duration) Option {
+	return func(i *interceptor) {
+		i.ttls[method] = ttl
+	}
+}
+
+// UnaryClientInterceptor caches the proto responses of the methods set by WithMethodTTL in g keyed by method and request hash.
+// Only idempotent methods should be configured, cache hits do not fill grpc.Header and grpc.Trailer call options.
+func UnaryClientInterceptor(g gache.Gache[[]byte], opts ...Option) grpc.UnaryClientInterceptor {
+	i := &interceptor{
+		cache: g,
+		ttls:  make(map[string]time.Duration),
+	}
+	for _, opt := range opts {
+		opt(i)
+	}
+	return i.intercept
+}
+
+func (i *interceptor) intercept(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	ttl, ok := i.ttls[method]
+	if !ok {
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+	in, ok := req.(proto.Message)
+	out, ok2 := reply.(proto.Message)
+	if !ok || !ok2 {
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+	key, err := Key(method, in)
+	if err != nil {
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+	if b, ok := i.cache.Get(key); ok {
+		if err := proto.Unmarshal(b, out); err == nil {
+			return nil
+		}
+		i.cache.Delete(key)
+		proto.Reset(out)
+	}
+	if err := invoker(ctx, method, req, reply, cc, opts...); err != nil {
+		return err
+	}
+	b, err := proto.Marshal(out)
+	if err != nil {
+		return nil
+	}
+	if ttl == 0 {
+		i.cache.Set(key, b)
+	} else {
+		i.cache.SetWithExpire(key, b, ttl)
+	}
+	return nil
+}
+
+// Key returns the cache key of a call of method with req, the request is hashed from its deterministic encoding
+func Key(method string, req proto.Message) (string, error) {
+	b, err := proto.MarshalOptions{Deterministic: true}.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return method + ":" + hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,91 @@
+package gachegrpc
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ntsd/gache/v2"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+const (
+	echoMethod  = "/test.Echo/Echo"
+	countMethod = "/test.Echo/Count"
+)
+
+func dial(t *testing.T, calls *atomic.Int64, opts ...grpc.DialOption) *grpc.ClientConn {
+	t.Helper()
+	handler := func(_ any, ctx context.Context, dec func(any) error, _ grpc.UnaryServerInterceptor) (any, error) {
+		in := new(wrapperspb.StringValue)
+		if err := dec(in); err != nil {
+			return nil, err
+		}
+		calls.Add(1)
+		return wrapperspb.String("echo " + in.GetValue()), nil
+	}
+	srv := grpc.NewServer()
+	srv.RegisterService(&grpc.ServiceDesc{
+		ServiceName: "test.Echo",
+		HandlerType: (*any)(nil),
+		Methods: []grpc.MethodDesc{
+			{MethodName: "Echo", Handler: handler},
+			{MethodName: "Count", Handler: handler},
+		},
+	}, struct{}{})
+	lis := bufconn.Listen(1 << 20)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+	opts = append(opts,
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return lis.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	conn, err := grpc.NewClient("passthrough:///bufnet", opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestUnaryClientInterceptor(t *testing.T) {
+	var calls atomic.Int64
+	g := gache.New[[]byte]()
+	conn := dial(t, &calls, grpc.WithUnaryInterceptor(UnaryClientInterceptor(g, WithMethodTTL(echoMethod, time.Minute))))
+	ctx := context.Background()
+	for _, method := range []string{echoMethod, countMethod} {
+		calls.Store(0)
+		for range 3 {
+			out := new(wrapperspb.StringValue)
+			if err := conn.Invoke(ctx, method, wrapperspb.String("a"), out); err != nil {
+				t.Fatal(err)
+			}
+			if out.GetValue() != "echo a" {
+				t.Fatalf("%s reply = %q", method, out.GetValue())
+			}
+		}
+		want := int64(1)
+		if method == countMethod {
+			want = 3
+		}
+		if n := calls.Load(); n != want {
+			t.Fatalf("%s reached the server %d times, want %d", method, n, want)
+		}
+	}
+	out := new(wrapperspb.StringValue)
+	if err := conn.Invoke(ctx, echoMethod, wrapperspb.String("b"), out); err != nil || out.GetValue() != "echo b" {
+		t.Fatalf("Echo b = %q, %v", out.GetValue(), err)
+	}
+	key, err := Key(echoMethod, wrapperspb.String("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ttl, ok := g.TTL(key); !ok || ttl <= 0 || ttl > time.Minute {
+		t.Fatalf("TTL of cached reply = %v, %v", ttl, ok)
+	}
+}
@@ -0,0 +1,136 @@
+package remote
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/ntsd/gache/v2"
+	"github.com/ntsd/gache/v2/gachegrpc/gachepb"
+	"google.golang.org/grpc"
+)
+
+// Client calls the Cache service of a remote Server
+type Client[V any] struct {
+	rpc   gachepb.CacheClient
+	codec gache.Codec
+}
+
+// NewClient returns a Client calling the Cache service over cc
+func NewClient[V any](cc grpc.ClientConnInterface, opts ...Option) *Client[V] {
+	return &Client[V]{rpc: gachepb.NewCacheClient(cc), codec: newOptions(opts).codec}
+}
+
+// Get returns the live value of key
+func (c *Client[V]) Get(ctx context.Context, key string) (v V, ok bool, err error) {
+	v, _, ok, err = c.GetWithTTL(ctx, key)
+	return v, ok, err
+}
+
+// GetWithTTL returns the live value of key and its remaining lifetime, gache.NoTTL for keys without expiration
+func (c *Client[V]) GetWithTTL(ctx context.Context, key string) (v V, ttl time.Duration, ok bool, err error) {
+	res, err := c.rpc.Get(ctx, &gachepb.GetRequest{Key: key})
+	if err != nil || !res.GetFound() {
+		return v, 0, false, err
+	}
+	if err := c.codec.Unmarshal(res.GetValue(), &v); err != nil {
+		return v, 0, false, err
+	}
+	return v, time.Duration(res.GetTtl()), true, nil
+}
+
+// Set stores key-value expiring after ttl, zero uses the default expiration of the served cache and gache.NoTTL never expires
+func (c *Client[V]) Set(ctx context.Context, key string, v V, ttl time.Duration) error {
+	b, err := c.codec.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = c.rpc.Set(ctx, &gachepb.SetRequest{Key: key, Value: b, Ttl: int64(ttl)})
+	return err
+}
+
+// Delete removes key and reports whether it was live
+func (c *Client[V]) Delete(ctx context.Context, key string) (bool, error) {
+	res, err := c.rpc.Delete(ctx, &gachepb.DeleteRequest{Key: key})
+	return res.GetDeleted(), err
+}
+
+// MGet returns the live values of keys, missing keys are absent from the map
+func (c *Client[V]) MGet(ctx context.Context, keys ...string) (map[string]V, error) {
+	res, err := c.rpc.MGet(ctx, &gachepb.MGetRequest{Keys: keys})
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]V, len(res.GetValues()))
+	for k, b := range res.GetValues() {
+		var v V
+		if err := c.codec.Unmarshal(b, &v); err != nil {
+			return nil, err
+		}
+		values[k] = v
+	}
+	return values, nil
+}
+
+// Watch delivers the events of keys matching the glob pattern until ctx is canceled or the stream fails,
+// the channel is closed then and events the value codec cannot decode are dropped
+func (c *Client[V]) Watch(ctx context.Context, pattern string) (<-chan gache.Event[V], error) {
+	stream, err := c.rpc.Watch(ctx, &gachepb.WatchRequest{Pattern: pattern})
+	if err != nil {
+		return nil, err
+	}
+	ch := make(chan gache.Event[V])
+	go func() {
+		defer close(ch)
+		for {
+			ev, err := stream.Recv()
+			if err != nil {
+				return
+			}
+			var v V
+			if err := c.codec.Unmarshal(ev.GetValue(), &v); err != nil {
+				continue
+			}
+			select {
+			case ch <- gache.Event[V]{Seq: ev.GetSeq(), Type: gache.EventType(ev.GetType()), Key: ev.GetKey(), Value: v}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// Snapshot writes a snapshot of the served cache to w, it is read back by Read with the codec of the served cache
+func (c *Client[V]) Snapshot(ctx context.Context, w io.Writer) error {
+	// canceling ends the stream when w fails before it is drained
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := c.rpc.Snapshot(ctx, &gachepb.SnapshotRequest{})
+	if err != nil {
+		return err
+	}
+	for {
+		chunk, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(chunk.GetData()); err != nil {
+			return err
+		}
+	}
+}
+
+// Warm reads a snapshot of the served cache into g, g must use the same WithCodec as the served cache
+func (c *Client[V]) Warm(ctx context.Context, g gache.Gache[V], opts ...gache.ReadOption[V]) error {
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(c.Snapshot(ctx, pw))
+	}()
+	err := g.ReadContext(ctx, pr, opts...)
+	pr.CloseWithError(err)
+	return err
+}
@@ -0,0 +1,202 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ntsd/gache/v2/peers"
+	"google.golang.org/grpc"
+)
+
+// ErrNoNodes is returned by the calls of a Cluster without nodes
+var ErrNoNodes = errors.New("remote: cluster has no nodes")
+
+// Cluster shards keys across the Servers of its nodes on a consistent hash ring, so adding or removing a node only
+// moves the keys it owns. With WithReplication every key is written to that many nodes and read from the first
+// replica holding it, reads survive the loss of a replica and keep finding keys whose owner changed.
+type Cluster[V any] struct {
+	ring        *peers.Ring
+	mu          sync.RWMutex
+	clients     map[string]*Client[V]
+	opts        []Option
+	replication int
+}
+
+// NewCluster returns a Cluster without nodes, the options apply to the Client of every node
+func NewCluster[V any](opts ...Option) *Cluster[V] {
+	o := newOptions(opts)
+	return &Cluster[V]{
+		ring:        peers.NewRing(o.virtualNodes),
+		clients:     make(map[string]*Client[V]),
+		opts:        opts,
+		replication: o.replication,
+	}
+}
+
+// Add adds the node named name served over cc, name places the node on the ring and must be the same for every client
+func (c *Cluster[V]) Add(name string, cc grpc.ClientConnInterface) {
+	c.mu.Lock()
+	c.clients[name] = NewClient[V](cc, c.opts...)
+	c.mu.Unlock()
+	c.ring.Add(name)
+}
+
+// Remove removes the node named name, closing its connection is left to the caller
+func (c *Cluster[V]) Remove(name string) {
+	c.ring.Remove(name)
+	c.mu.Lock()
+	delete(c.clients, name)
+	c.mu.Unlock()
+}
+
+// Nodes returns the names of the nodes sorted
+func (c *Cluster[V]) Nodes() []string {
+	return c.ring.Nodes()
+}
+
+// Owners returns the names of the nodes storing key, the owner first
+func (c *Cluster[V]) Owners(key string) []string {
+	return c.ring.GetN(key, c.replication)
+}
+
+// Get returns the live value of key from the first replica holding it
+func (c *Cluster[V]) Get(ctx context.Context, key string) (v V, ok bool, err error) {
+	v, _, ok, err = c.GetWithTTL(ctx, key)
+	return v, ok, err
+}
+
+// GetWithTTL returns the live value of key and its remaining lifetime from the first replica holding it,
+// an error is only returned when no replica answered
+func (c *Cluster[V]) GetWithTTL(ctx context.Context, key string) (v V, ttl time.Duration, ok bool, err error) {
+	clients := c.replicas(key)
+	if len(clients) == 0 {
+		return v, 0, false, ErrNoNodes
+	}
+	var errs []error
+	for _, client := range clients {
+		v, ttl, ok, err := client.GetWithTTL(ctx, key)
+		if ok {
+			return v, ttl, true, nil
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) == len(clients) {
+		return v, 0, false, errors.Join(errs...)
+	}
+	return v, 0, false, nil
+}
+
+// Set stores key-value on every replica concurrently, see Client.Set for ttl
+func (c *Cluster[V]) Set(ctx context.Context, key string, v V, ttl time.Duration) error {
+	return c.each(key, func(client *Client[V]) error {
+		return client.Set(ctx, key, v, ttl)
+	})
+}
+
+// Delete removes key from every replica concurrently and reports whether it was live on one of them
+func (c *Cluster[V]) Delete(ctx context.Context, key string) (bool, error) {
+	var deleted atomic.Bool
+	err := c.each(key, func(client *Client[V]) error {
+		ok, err := client.Delete(ctx, key)
+		if ok {
+			deleted.Store(true)
+		}
+		return err
+	})
+	return deleted.Load(), err
+}
+
+// MGet returns the live values of keys with one call per node and replica rank,
+// keys missing on their owner are asked to their next replica
+func (c *Cluster[V]) MGet(ctx context.Context, keys ...string) (map[string]V, error) {
+	if c.ring.Len() == 0 {
+		return nil, ErrNoNodes
+	}
+	values := make(map[string]V, len(keys))
+	owners := make(map[string][]string, len(keys))
+	for _, key := range keys {
+		owners[key] = c.Owners(key)
+	}
+	var (
+		mu   sync.Mutex
+		errs []error
+	)
+	for rank := range c.replication {
+		batches := make(map[string][]string)
+		for _, key := range keys {
+			if _, ok := values[key]; !ok && rank < len(owners[key]) {
+				node := owners[key][rank]
+				batches[node] = append(batches[node], key)
+			}
+		}
+		if len(batches) == 0 {
+			break
+		}
+		errs = errs[:0]
+		var wg sync.WaitGroup
+		for node, batch := range batches {
+			client := c.client(node)
+			if client == nil {
+				continue
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				found, err := client.MGet(ctx, batch...)
+				mu.Lock()
+				defer mu.Unlock()
+				if err != nil {
+					errs = append(errs, err)
+					return
+				}
+				for k, v := range found {
+					values[k] = v
+				}
+			}()
+		}
+		wg.Wait()
+	}
+	return values, errors.Join(errs...)
+}
+
+// replicas returns the clients of the replicas of key, the owner first
+func (c *Cluster[V]) replicas(key string) []*Client[V] {
+	owners := c.Owners(key)
+	clients := make([]*Client[V], 0, len(owners))
+	for _, node := range owners {
+		if client := c.client(node); client != nil {
+			clients = append(clients, client)
+		}
+	}
+	return clients
+}
+
+func (c *Cluster[V]) client(node string) *Client[V] {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.clients[node]
+}
+
+// each calls f with the client of every replica of key concurrently and joins their errors
+func (c *Cluster[V]) each(key string, f func(*Client[V]) error) error {
+	clients := c.replicas(key)
+	if len(clients) == 0 {
+		return ErrNoNodes
+	}
+	errs := make([]error, len(clients))
+	var wg sync.WaitGroup
+	for i, client := range clients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = f(client)
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
@@ -0,0 +1,92 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/ntsd/gache/v2"
+)
+
+func TestCluster(t *testing.T) {
+	ctx := context.Background()
+	c := NewCluster[user](WithReplication(2))
+	if _, _, err := c.Get(ctx, "a"); !errors.Is(err, ErrNoNodes) {
+		t.Fatalf("Get without nodes = %v", err)
+	}
+	caches := make(map[string]gache.Gache[user])
+	for i := range 4 {
+		name := "node" + strconv.Itoa(i)
+		caches[name] = gache.New[user]()
+		c.Add(name, conn(t, caches[name]))
+	}
+
+	const keys = 200
+	for i := range keys {
+		if err := c.Set(ctx, strconv.Itoa(i), user{Age: i}, gache.NoTTL); err != nil {
+			t.Fatal(err)
+		}
+	}
+	total := 0
+	for name, g := range caches {
+		if g.Len() == 0 {
+			t.Fatalf("%s stores no key", name)
+		}
+		total += g.Len()
+	}
+	if total != 2*keys {
+		t.Fatalf("the nodes store %d entries, want %d", total, 2*keys)
+	}
+	owners := c.Owners("7")
+	if len(owners) != 2 || owners[0] == owners[1] {
+		t.Fatalf("Owners = %v", owners)
+	}
+	if _, ok := caches[owners[1]].Get("7"); !ok {
+		t.Fatal("key missing on its second replica")
+	}
+
+	// the owner of a key losing it is read through the next replica
+	caches[owners[0]].Delete("7")
+	if v, ok, err := c.Get(ctx, "7"); err != nil || !ok || v.Age != 7 {
+		t.Fatalf("Get from second replica = %v, %v, %v", v, ok, err)
+	}
+	all := make([]string, keys)
+	for i := range all {
+		all[i] = strconv.Itoa(i)
+	}
+	values, err := c.MGet(ctx, all...)
+	if err != nil || len(values) != keys || values["7"].Age != 7 {
+		t.Fatalf("MGet = %d values, %v", len(values), err)
+	}
+
+	// removing a node only moves the keys it owned
+	before := make(map[string][]string, keys)
+	for _, key := range all {
+		before[key] = c.Owners(key)
+	}
+	c.Remove("node3")
+	moved := 0
+	for _, key := range all {
+		if c.Owners(key)[0] != before[key][0] {
+			moved++
+			if before[key][0] != "node3" {
+				t.Fatalf("key %s moved from %s", key, before[key][0])
+			}
+		}
+	}
+	if moved == 0 || moved > keys/2 {
+		t.Fatalf("%d keys moved on removal", moved)
+	}
+	values, err = c.MGet(ctx, all...)
+	if err != nil || len(values) != keys {
+		t.Fatalf("MGet after removal = %d values, %v", len(values), err)
+	}
+
+	if ok, err := c.Delete(ctx, "8"); !ok || err != nil {
+		t.Fatalf("Delete = %v, %v", ok, err)
+	}
+	if _, ok, _ := c.Get(ctx, "8"); ok {
+		t.Fatal("deleted key still readable")
+	}
+}
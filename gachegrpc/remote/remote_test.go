@@ -0,0 +1,159 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ntsd/gache/v2"
+	"github.com/ntsd/gache/v2/gachegrpc/gachepb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+type user struct {
+	Name string
+	Age  int
+}
+
+func dial[V any](t *testing.T, g gache.Gache[V]) *Client[V] {
+	t.Helper()
+	return NewClient[V](conn(t, g))
+}
+
+func conn[V any](t *testing.T, g gache.Gache[V]) *grpc.ClientConn {
+	t.Helper()
+	srv := grpc.NewServer()
+	gachepb.RegisterCacheServer(srv, NewServer(g))
+	lis := bufconn.Listen(1 << 20)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+	cc, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return lis.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cc.Close() })
+	return cc
+}
+
+func TestClient(t *testing.T) {
+	g := gache.New[user]()
+	c := dial(t, g)
+	ctx := context.Background()
+
+	if _, ok, err := c.Get(ctx, "a"); ok || err != nil {
+		t.Fatalf("Get of missing key = %v, %v", ok, err)
+	}
+	if err := c.Set(ctx, "a", user{"alice", 30}, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Set(ctx, "b", user{"bob", 40}, gache.NoTTL); err != nil {
+		t.Fatal(err)
+	}
+	v, ttl, ok, err := c.GetWithTTL(ctx, "a")
+	if err != nil || !ok || v != (user{"alice", 30}) || ttl <= 59*time.Minute || ttl > 61*time.Minute {
+		t.Fatalf("GetWithTTL(a) = %v, %v, %v, %v", v, ttl, ok, err)
+	}
+	if _, ttl, _, _ := c.GetWithTTL(ctx, "b"); ttl != gache.NoTTL {
+		t.Fatalf("TTL of key without expiration = %v", ttl)
+	}
+	if local, ok := g.Get("b"); !ok || local.Name != "bob" {
+		t.Fatalf("served cache Get(b) = %v, %v", local, ok)
+	}
+
+	values, err := c.MGet(ctx, "a", "b", "missing")
+	if err != nil || len(values) != 2 || values["b"].Age != 40 {
+		t.Fatalf("MGet = %v, %v", values, err)
+	}
+	if ok, err := c.Delete(ctx, "a"); !ok || err != nil {
+		t.Fatalf("Delete(a) = %v, %v", ok, err)
+	}
+	if ok, _ := c.Delete(ctx, "a"); ok {
+		t.Fatal("Delete of deleted key reported live")
+	}
+}
+
+func TestClientWatch(t *testing.T) {
+	g := gache.New[user]()
+	c := dial(t, g)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events, err := c.Watch(ctx, "user:*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the subscription is registered once the server handles the stream, retry until the first event arrives
+	var ev gache.Event[user]
+	deadline := time.After(5 * time.Second)
+	for i := 0; ; i++ {
+		g.Set("user:"+strconv.Itoa(i), user{Name: "u"})
+		select {
+		case ev = <-events:
+		case <-time.After(10 * time.Millisecond):
+			continue
+		case <-deadline:
+			t.Fatal("no event received")
+		}
+		break
+	}
+	if ev.Type != gache.EventCreated || ev.Value.Name != "u" {
+		t.Fatalf("event = %+v", ev)
+	}
+	g.Set("other", user{})
+	g.Delete(ev.Key)
+	for ev := range events {
+		if ev.Key == "other" {
+			t.Fatalf("event of unwatched key %+v", ev)
+		}
+		if ev.Type == gache.EventDeleted {
+			break
+		}
+	}
+	cancel()
+	for range events {
+	}
+}
+
+func TestClientSnapshot(t *testing.T) {
+	g := gache.New[user]()
+	for i := range 5000 {
+		g.Set(strconv.Itoa(i), user{Name: strconv.Itoa(i), Age: i})
+	}
+	c := dial(t, g)
+	ctx := context.Background()
+
+	var buf bytes.Buffer
+	if err := c.Snapshot(ctx, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() <= snapshotChunkSize {
+		t.Fatalf("snapshot of %d bytes fits a single chunk", buf.Len())
+	}
+	local := gache.New[user]()
+	if err := local.Read(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	warm := gache.New[user]()
+	var stats gache.ReadStats
+	if err := c.Warm(ctx, warm, gache.ReadReport[user](&stats)); err != nil {
+		t.Fatal(err)
+	}
+	if stats.Loaded != 5000 {
+		t.Fatalf("Warm loaded %d entries, want 5000", stats.Loaded)
+	}
+	if v, ok := warm.Get("4999"); !ok || v.Age != 4999 {
+		t.Fatalf("warmed Get(4999) = %v, %v", v, ok)
+	}
+	if v, ok := local.Get("42"); !ok || v.Age != 42 {
+		t.Fatalf("read Get(42) = %v, %v", v, ok)
+	}
+}
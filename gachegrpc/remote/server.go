@@ -0,0 +1,183 @@
+// Package remote serves a gache over the gRPC Cache service of gachepb and provides its client,
+// so one warmed instance can serve sibling processes over localhost gRPC.
+package remote
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/gob"
+	"errors"
+	"time"
+
+	"github.com/ntsd/gache/v2"
+	"github.com/ntsd/gache/v2/gachegrpc/gachepb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// snapshotChunkSize is the size of the chunks streamed by Snapshot
+const snapshotChunkSize = 32 << 10
+
+type (
+	// Option configures NewServer, NewClient and NewCluster
+	Option func(*options)
+
+	options struct {
+		codec        gache.Codec
+		virtualNodes int
+		replication  int
+	}
+
+	// Server implements gachepb.CacheServer for a gache, register it with gachepb.RegisterCacheServer
+	Server[V any] struct {
+		gachepb.UnimplementedCacheServer
+		cache gache.Gache[V]
+		codec gache.Codec
+	}
+
+	// gobCodec is the default Codec
+	gobCodec struct{}
+
+	// chunkWriter sends the bytes written to it as snapshot chunks
+	chunkWriter struct {
+		stream grpc.ServerStreamingServer[gachepb.SnapshotChunk]
+	}
+)
+
+// WithCodec sets the codec encoding values on the wire, server and clients must use the same one, gob by default
+func WithCodec(c gache.Codec) Option {
+	return func(o *options) {
+		if c != nil {
+			o.codec = c
+		}
+	}
+}
+
+// WithVirtualNodes sets the number of points of each node on the ring of NewCluster, peers.DefaultReplicas by default
+func WithVirtualNodes(n int) Option {
+	return func(o *options) {
+		o.virtualNodes = n
+	}
+}
+
+// WithReplication sets the number of nodes of NewCluster storing every key, one by default
+func WithReplication(n int) Option {
+	return func(o *options) {
+		o.replication = max(n, 1)
+	}
+}
+
+func newOptions(opts []Option) options {
+	o := options{codec: gobCodec{}, replication: 1}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// NewServer returns a Server for g
+func NewServer[V any](g gache.Gache[V], opts ...Option) *Server[V] {
+	return &Server[V]{cache: g, codec: newOptions(opts).codec}
+}
+
+func (s *Server[V]) Get(_ context.Context, req *gachepb.GetRequest) (*gachepb.GetResponse, error) {
+	v, ttl, ok := s.cache.GetWithTTL(req.GetKey())
+	if !ok {
+		return &gachepb.GetResponse{}, nil
+	}
+	b, err := s.marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return &gachepb.GetResponse{Found: true, Value: b, Ttl: int64(ttl)}, nil
+}
+
+func (s *Server[V]) Set(_ context.Context, req *gachepb.SetRequest) (*gachepb.SetResponse, error) {
+	var v V
+	if err := s.codec.Unmarshal(req.GetValue(), &v); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "remote: decode value of %q: %v", req.GetKey(), err)
+	}
+	if req.GetTtl() == 0 {
+		s.cache.Set(req.GetKey(), v)
+	} else {
+		s.cache.SetWithExpire(req.GetKey(), v, time.Duration(req.GetTtl()))
+	}
+	return &gachepb.SetResponse{}, nil
+}
+
+func (s *Server[V]) Delete(_ context.Context, req *gachepb.DeleteRequest) (*gachepb.DeleteResponse, error) {
+	_, ok := s.cache.Delete(req.GetKey())
+	return &gachepb.DeleteResponse{Deleted: ok}, nil
+}
+
+func (s *Server[V]) MGet(_ context.Context, req *gachepb.MGetRequest) (*gachepb.MGetResponse, error) {
+	values := make(map[string][]byte, len(req.GetKeys()))
+	for k, v := range s.cache.GetMulti(req.GetKeys()) {
+		b, err := s.marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		values[k] = b
+	}
+	return &gachepb.MGetResponse{Values: values}, nil
+}
+
+// Watch streams the events of gache.Watch, events are dropped when the client falls behind
+func (s *Server[V]) Watch(req *gachepb.WatchRequest, stream grpc.ServerStreamingServer[gachepb.Event]) error {
+	for ev := range s.cache.Watch(stream.Context(), req.GetPattern()) {
+		b, err := s.marshal(ev.Value)
+		if err != nil {
+			return err
+		}
+		if err := stream.Send(&gachepb.Event{Seq: ev.Seq, Type: gachepb.Event_Type(ev.Type), Key: ev.Key, Value: b}); err != nil {
+			return err
+		}
+	}
+	return stream.Context().Err()
+}
+
+// Snapshot streams the output of Write, it is encoded by the WithCodec of the served cache rather than the wire codec
+func (s *Server[V]) Snapshot(_ *gachepb.SnapshotRequest, stream grpc.ServerStreamingServer[gachepb.SnapshotChunk]) error {
+	bw := bufio.NewWriterSize(chunkWriter{stream}, snapshotChunkSize)
+	if err := s.cache.Write(stream.Context(), bw); err != nil {
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return status.FromContextError(err).Err()
+		}
+		return status.Errorf(codes.Internal, "remote: write snapshot: %v", err)
+	}
+	return bw.Flush()
+}
+
+func (s *Server[V]) marshal(v V) ([]byte, error) {
+	b, err := s.codec.Marshal(v)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "remote: encode value: %v", err)
+	}
+	return b, nil
+}
+
+func (w chunkWriter) Write(b []byte) (int, error) {
+	// Send marshals the chunk before returning so b may be reused by the caller
+	if err := w.stream.Send(&gachepb.SnapshotChunk{Data: b}); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (gobCodec) Name() string {
+	return "gob"
+}
+
+func (gobCodec) Marshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gobCodec) Unmarshal(data []byte, v any) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
@@ -0,0 +1,211 @@
+package gachehttp
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ntsd/gache/v2"
+)
+
+// DefaultMaxBodySize is the largest response body cached by Middleware and Transport unless WithMaxBodySize or
+// WithTransportMaxBodySize is set
+const DefaultMaxBodySize = 1 << 20
+
+type (
+	// CachedResponse is a response recorded by Middleware
+	CachedResponse struct {
+		Status int
+		Header http.Header
+		Body   []byte
+	}
+
+	// MiddlewareOption configures Middleware
+	MiddlewareOption func(*middleware)
+
+	middleware struct {
+		cache   gache.Gache[CachedResponse]
+		keyFn   func(*http.Request) string
+		ttlFn   func(*http.Request) time.Duration
+		vary    []string
+		maxBody int
+	}
+
+	// recorder passes the response through to the client while recording it
+	recorder struct {
+		http.ResponseWriter
+		status   int
+		header   http.Header
+		body     bytes.Buffer
+		maxBody  int
+		overflow bool
+	}
+)
+
+// WithVaryHeaders adds the values of request headers to the cache key
+func WithVaryHeaders(headers ...string) MiddlewareOption {
+	return func(m *middleware) {
+		for _, h := range headers {
+			m.vary = append(m.vary, http.CanonicalHeaderKey(h))
+		}
+	}
+}
+
+// WithMaxBodySize sets the largest response body in bytes cached by Middleware, larger responses are served uncached
+func WithMaxBodySize(n int) MiddlewareOption {
+	return func(m *middleware) {
+		if n > 0 {
+			m.maxBody = n
+		}
+	}
+}
+
+// DefaultKey returns the method and request URI of r
+func DefaultKey(r *http.Request) string {
+	return r.Method + " " + r.URL.RequestURI()
+}
+
+// Middleware caches GET and HEAD responses of the wrapped handler in g and reports HIT or MISS in the X-Cache header.
+// keyFn defaults to DefaultKey and is followed by the WithVaryHeaders values, ttlFn returns the expiration per request
+// where zero skips caching, the default expiration of g is used when ttlFn is nil.
+// Responses with a status not cacheable by default, Set-Cookie, Cache-Control no-store or private, or Vary * are not cached.
+func Middleware(g gache.Gache[CachedResponse], keyFn func(*http.Request) string, ttlFn func(*http.Request) time.Duration, opts ...MiddlewareOption) func(http.Handler) http.Handler {
+	m := &middleware{
+		cache:   g,
+		keyFn:   keyFn,
+		ttlFn:   ttlFn,
+		maxBody: DefaultMaxBodySize,
+	}
+	if m.keyFn == nil {
+		m.keyFn = DefaultKey
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			m.serve(next, w, r)
+		})
+	}
+}
+
+func (m *middleware) serve(next http.Handler, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		next.ServeHTTP(w, r)
+		return
+	}
+	var ttl time.Duration
+	if m.ttlFn != nil {
+		if ttl = m.ttlFn(r); ttl <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+	}
+	key := m.key(r)
+	if res, ok := m.cache.Get(key); ok {
+		h := w.Header()
+		for k, v := range res.Header {
+			h[k] = append([]string(nil), v...)
+		}
+		h.Set(HeaderCache, hit)
+		w.WriteHeader(res.Status)
+		if r.Method != http.MethodHead {
+			w.Write(res.Body)
+		}
+		return
+	}
+
+	rec := &recorder{ResponseWriter: w, maxBody: m.maxBody}
+	next.ServeHTTP(rec, r)
+	if rec.status == 0 {
+		rec.WriteHeader(http.StatusOK)
+	}
+	// HEAD responses have no body to replay to GET requests
+	if r.Method == http.MethodHead || rec.overflow || !storable(rec.status, rec.header) {
+		return
+	}
+	res := CachedResponse{
+		Status: rec.status,
+		Header: rec.header,
+		Body:   bytes.Clone(rec.body.Bytes()),
+	}
+	if m.ttlFn == nil {
+		m.cache.Set(key, res)
+	} else {
+		m.cache.SetWithExpire(key, res, ttl)
+	}
+}
+
+// key returns the cache key of r, HEAD requests share the key of GET
+func (m *middleware) key(r *http.Request) string {
+	if r.Method == http.MethodHead {
+		get := *r
+		get.Method = http.MethodGet
+		r = &get
+	}
+	key := m.keyFn(r)
+	if len(m.vary) == 0 {
+		return key
+	}
+	var b strings.Builder
+	b.WriteString(key)
+	for _, h := range m.vary {
+		b.WriteString("\n")
+		b.WriteString(h)
+		b.WriteString(": ")
+		b.WriteString(strings.Join(r.Header.Values(h), ","))
+	}
+	return b.String()
+}
+
+// storable reports whether a response with status and header may be cached
+func storable(status int, header http.Header) bool {
+	if !cacheableStatus(status) || header.Get("Set-Cookie") != "" || strings.TrimSpace(header.Get("Vary")) == "*" {
+		return false
+	}
+	cc := cacheControl(header)
+	_, noStore := cc["no-store"]
+	_, private := cc["private"]
+	return !noStore && !private
+}
+
+func (r *recorder) WriteHeader(status int) {
+	if r.status != 0 {
+		return
+	}
+	r.status = status
+	r.header = r.Header().Clone()
+	r.Header().Set(HeaderCache, miss)
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.WriteHeader(http.StatusOK)
+	}
+	if !r.overflow {
+		if r.body.Len()+len(b) > r.maxBody {
+			r.overflow = true
+			r.body = bytes.Buffer{}
+		} else {
+			r.body.Write(b)
+		}
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// Flush implements http.Flusher when the wrapped writer does
+func (r *recorder) Flush() {
+	if r.status == 0 {
+		r.WriteHeader(http.StatusOK)
+	}
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the wrapped writer for http.ResponseController
+func (r *recorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
@@ -0,0 +1,84 @@
+package gachehttp
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ntsd/gache/v2"
+)
+
+func TestMiddleware(t *testing.T) {
+	var calls atomic.Int64
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		switch r.URL.Path {
+		case "/cookie":
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "1"})
+		case "/large":
+			io.WriteString(w, strings.Repeat("x", 64))
+			return
+		case "/error":
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, r.URL.Path+" "+r.Header.Get("Accept-Language"))
+	})
+	g := gache.New[CachedResponse]()
+	ttls := map[string]time.Duration{"/nocache": 0}
+	h := Middleware(g, nil, func(r *http.Request) time.Duration {
+		if ttl, ok := ttls[r.URL.Path]; ok {
+			return ttl
+		}
+		return time.Minute
+	}, WithVaryHeaders("accept-language"), WithMaxBodySize(32))(handler)
+
+	serve := func(method, path, lang string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Accept-Language", lang)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+	for i, want := range []string{miss, hit} {
+		w := serve(http.MethodGet, "/page", "en")
+		if w.Code != http.StatusOK || w.Body.String() != "/page en" || w.Header().Get(HeaderCache) != want {
+			t.Fatalf("GET /page #%d = %d %q %s, want %s", i, w.Code, w.Body.String(), w.Header().Get(HeaderCache), want)
+		}
+		if ct := w.Header().Get("Content-Type"); ct != "text/plain" {
+			t.Fatalf("GET /page #%d Content-Type = %q", i, ct)
+		}
+	}
+	if w := serve(http.MethodGet, "/page", "th"); w.Body.String() != "/page th" || w.Header().Get(HeaderCache) != miss {
+		t.Fatalf("GET /page th = %q %s", w.Body.String(), w.Header().Get(HeaderCache))
+	}
+	if w := serve(http.MethodHead, "/page", "en"); w.Header().Get(HeaderCache) != hit || w.Body.Len() != 0 {
+		t.Fatalf("HEAD /page = %q %s", w.Body.String(), w.Header().Get(HeaderCache))
+	}
+	if n := calls.Load(); n != 2 {
+		t.Fatalf("handler called %d times", n)
+	}
+
+	for _, path := range []string{"/cookie", "/large", "/error", "/nocache"} {
+		serve(http.MethodGet, path, "en")
+		calls.Store(0)
+		if w := serve(http.MethodGet, path, "en"); w.Header().Get(HeaderCache) == hit || calls.Load() != 1 {
+			t.Fatalf("GET %s served from cache", path)
+		}
+	}
+	if w := serve(http.MethodGet, "/large", "en"); w.Body.Len() != 64 {
+		t.Fatalf("GET /large body length = %d", w.Body.Len())
+	}
+	calls.Store(0)
+	serve(http.MethodPost, "/page", "en")
+	if calls.Load() != 1 {
+		t.Fatal("POST served from cache")
+	}
+	if ttl, ok := g.TTL(DefaultKey(httptest.NewRequest(http.MethodGet, "/page", nil)) + "\nAccept-Language: en"); !ok || ttl <= 0 || ttl > time.Minute {
+		t.Fatalf("TTL of cached response = %v, %v", ttl, ok)
+	}
+}
@@ -0,0 +1,318 @@
+// Package gachehttp provides HTTP response caching backed by gache.
+package gachehttp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ntsd/gache/v2"
+)
+
+const (
+	// HeaderCache reports whether a response was served from the cache
+	HeaderCache = "X-Cache"
+
+	hit         = "HIT"
+	miss        = "MISS"
+	revalidated = "REVALIDATED"
+
+	// indexHeader is the length of the zero marker and generation starting the Vary index of a URL, cached
+	// responses start with their non zero freshness deadline instead
+	indexHeader = 16
+)
+
+type (
+	// Transport is an http.RoundTripper caching GET responses in a Gache[[]byte] as a private cache.
+	// Fresh responses are served without a request, stale responses with an ETag or Last-Modified are revalidated conditionally.
+	// Responses without expiration but with validators are stored with the default expiration of the cache.
+	// Responses with a Vary header are cached per value of the varied request headers.
+	Transport struct {
+		cache   gache.Gache[[]byte]
+		base    http.RoundTripper
+		maxBody int
+	}
+
+	// TransportOption configures NewTransport
+	TransportOption func(*Transport)
+
+	// readCloser is a response body read from r and closed by c
+	readCloser struct {
+		io.Reader
+		io.Closer
+	}
+)
+
+// WithTransportMaxBodySize sets the largest response body in bytes cached by Transport, larger responses are passed through uncached
+func WithTransportMaxBodySize(n int) TransportOption {
+	return func(t *Transport) {
+		if n > 0 {
+			t.maxBody = n
+		}
+	}
+}
+
+// NewTransport returns Transport caching the responses of base in g, http.DefaultTransport is used when base is nil
+func NewTransport(g gache.Gache[[]byte], base http.RoundTripper, opts ...TransportOption) *Transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	t := &Transport{cache: g, base: base, maxBody: DefaultMaxBodySize}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+// Client returns http.Client using t
+func (t *Transport) Client() *http.Client {
+	return &http.Client{Transport: t}
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	key := req.URL.String()
+	if req.Method != http.MethodGet || req.Header.Get("Range") != "" {
+		resp, err := t.base.RoundTrip(req)
+		if err == nil && !safe(req.Method) && resp.StatusCode < http.StatusBadRequest {
+			t.cache.Delete(key)
+		}
+		return resp, err
+	}
+	reqCC := cacheControl(req.Header)
+	if _, ok := reqCC["no-store"]; ok {
+		return t.base.RoundTrip(req)
+	}
+
+	cached, fresh := t.lookup(key, req)
+	if cached != nil && fresh {
+		if _, ok := reqCC["no-cache"]; !ok && reqCC["max-age"] != "0" {
+			cached.Header.Set(HeaderCache, hit)
+			return cached, nil
+		}
+	}
+
+	out := req
+	if cached != nil {
+		etag, modified := cached.Header.Get("ETag"), cached.Header.Get("Last-Modified")
+		if etag != "" || modified != "" {
+			out = req.Clone(req.Context())
+			if etag != "" {
+				out.Header.Set("If-None-Match", etag)
+			}
+			if modified != "" {
+				out.Header.Set("If-Modified-Since", modified)
+			}
+		}
+	}
+	resp, err := t.base.RoundTrip(out)
+	if err != nil {
+		return nil, err
+	}
+	if cached != nil && out != req && resp.StatusCode == http.StatusNotModified {
+		resp.Body.Close()
+		for _, h := range []string{"Cache-Control", "Date", "ETag", "Expires", "Last-Modified"} {
+			if v := resp.Header.Get(h); v != "" {
+				cached.Header.Set(h, v)
+			}
+		}
+		cached.Header.Del(HeaderCache)
+		t.store(key, req, cached)
+		cached.Header.Set(HeaderCache, revalidated)
+		return cached, nil
+	}
+	t.store(key, req, resp)
+	resp.Header.Set(HeaderCache, miss)
+	return resp, nil
+}
+
+// lookup returns the cached response of key matching the varied headers of req and whether it is fresh
+func (t *Transport) lookup(key string, req *http.Request) (*http.Response, bool) {
+	b, ok := t.cache.Get(key)
+	if ok && isIndex(b) {
+		key = variantKey(key, b, req)
+		b, ok = t.cache.Get(key)
+	}
+	if !ok || len(b) < 8 {
+		return nil, false
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(b[8:])), req)
+	if err != nil {
+		t.cache.Delete(key)
+		return nil, false
+	}
+	fresh := time.Now().UnixNano() < int64(binary.BigEndian.Uint64(b))
+	return resp, fresh
+}
+
+// store caches resp of req under key when it is cacheable, the body of resp stays readable.
+// A body failing to be read leaves resp uncached and its error to the reader of the body.
+func (t *Transport) store(key string, req *http.Request, resp *http.Response) {
+	if !cacheable(resp) {
+		if _, ok := cacheControl(resp.Header)["no-store"]; ok {
+			t.cache.Delete(key)
+		}
+		return
+	}
+	lifetime := freshness(resp.Header, time.Now())
+	validated := resp.Header.Get("ETag") != "" || resp.Header.Get("Last-Modified") != ""
+	if lifetime <= 0 && !validated {
+		return
+	}
+	if resp.ContentLength > int64(t.maxBody) {
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, int64(t.maxBody)+1))
+	resp.Body = readCloser{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+	if err != nil || len(body) > t.maxBody {
+		return
+	}
+	dump, err := httputil.DumpResponse(resp, true)
+	if err != nil {
+		return
+	}
+	b := make([]byte, 8, 8+len(dump))
+	binary.BigEndian.PutUint64(b, uint64(time.Now().Add(lifetime).UnixNano()))
+	b = append(b, dump...)
+
+	dest, idx := key, t.index(key, resp.Header)
+	if idx != nil {
+		dest = variantKey(key, idx, req)
+	}
+	if validated {
+		t.cache.Set(dest, b)
+	} else {
+		t.cache.SetWithExpire(dest, b, lifetime)
+	}
+	if idx != nil {
+		// the index lives as long as its longest lived variant
+		_, expire, _ := t.cache.GetWithExpire(dest)
+		if cur, current, ok := t.cache.GetWithExpire(key); !ok || !bytes.Equal(cur, idx) || current > 0 && (expire <= 0 || expire > current) {
+			var at time.Time
+			if expire > 0 {
+				at = time.Unix(0, expire)
+			}
+			t.cache.SetWithExpireAt(key, idx, at)
+		}
+	}
+}
+
+// index returns the Vary index of key for the Vary header of h, nil without Vary. The index is kept while its header
+// names are unchanged, a new one gets a new generation so variants cached before a deletion of key are not served.
+func (t *Transport) index(key string, h http.Header) []byte {
+	var names []string
+	for _, v := range h.Values("Vary") {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	vary := strings.Join(names, ",")
+	if b, ok := t.cache.Get(key); ok && isIndex(b) && string(b[indexHeader:]) == vary {
+		return b
+	}
+	b := binary.BigEndian.AppendUint64(make([]byte, 8, indexHeader+len(vary)), uint64(time.Now().UnixNano()))
+	return append(b, vary...)
+}
+
+// isIndex reports whether the entry b is a Vary index
+func isIndex(b []byte) bool {
+	return len(b) >= indexHeader && binary.BigEndian.Uint64(b) == 0
+}
+
+// variantKey returns the key of the response to req among the variants of key listed by idx
+func variantKey(key string, idx []byte, req *http.Request) string {
+	var sb strings.Builder
+	sb.WriteString(key)
+	sb.WriteByte(0)
+	sb.Write(idx[8:indexHeader])
+	for _, name := range strings.Split(string(idx[indexHeader:]), ",") {
+		sb.WriteByte(0)
+		sb.WriteString(strings.Join(req.Header.Values(name), ","))
+	}
+	return sb.String()
+}
+
+// cacheable reports whether resp may be stored
+func cacheable(resp *http.Response) bool {
+	if !cacheableStatus(resp.StatusCode) {
+		return false
+	}
+	if _, ok := cacheControl(resp.Header)["no-store"]; ok {
+		return false
+	}
+	return strings.TrimSpace(resp.Header.Get("Vary")) != "*"
+}
+
+// cacheableStatus reports whether responses with status code are cacheable by default
+func cacheableStatus(code int) bool {
+	switch code {
+	case http.StatusOK, http.StatusNonAuthoritativeInfo, http.StatusNoContent, http.StatusMultipleChoices,
+		http.StatusMovedPermanently, http.StatusNotFound, http.StatusGone:
+		return true
+	}
+	return false
+}
+
+// freshness returns the remaining freshness lifetime of a response with header h
+func freshness(h http.Header, now time.Time) time.Duration {
+	cc := cacheControl(h)
+	if _, ok := cc["no-cache"]; ok {
+		return 0
+	}
+	var lifetime time.Duration
+	if s, ok := cc["max-age"]; ok {
+		secs, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return 0
+		}
+		lifetime = time.Duration(secs) * time.Second
+	} else if s := h.Get("Expires"); s != "" {
+		expires, err := http.ParseTime(s)
+		if err != nil {
+			return 0
+		}
+		date := now
+		if d, err := http.ParseTime(h.Get("Date")); err == nil {
+			date = d
+		}
+		lifetime = expires.Sub(date)
+	}
+	if age, err := strconv.ParseInt(h.Get("Age"), 10, 64); err == nil {
+		lifetime -= time.Duration(age) * time.Second
+	}
+	return lifetime
+}
+
+// cacheControl parses the Cache-Control directives of h
+func cacheControl(h http.Header) map[string]string {
+	cc := make(map[string]string)
+	for _, d := range strings.Split(h.Get("Cache-Control"), ",") {
+		d = strings.TrimSpace(d)
+		if d == "" {
+			continue
+		}
+		k, v, _ := strings.Cut(d, "=")
+		cc[strings.ToLower(strings.TrimSpace(k))] = strings.Trim(strings.TrimSpace(v), `"`)
+	}
+	return cc
+}
+
+// safe reports whether method does not modify the resource
+func safe(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,216 @@
+package gachehttp
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ntsd/gache/v2"
+)
+
+func get(t *testing.T, c *http.Client, url string, header ...string) (string, string) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body), resp.Header.Get(HeaderCache)
+}
+
+func TestTransport(t *testing.T) {
+	var requests atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		switch r.URL.Path {
+		case "/fresh":
+			w.Header().Set("Cache-Control", "max-age=60")
+		case "/etag":
+			w.Header().Set("Cache-Control", "no-cache")
+			w.Header().Set("ETag", `"v1"`)
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		case "/vary":
+			w.Header().Set("Cache-Control", "max-age=60")
+			w.Header().Set("Vary", "Accept-Language")
+			io.WriteString(w, r.Header.Get("Accept-Language"))
+			return
+		case "/nostore":
+			w.Header().Set("Cache-Control", "no-store")
+		}
+		if r.Method == http.MethodPost {
+			return
+		}
+		io.WriteString(w, "body "+r.URL.Path)
+	}))
+	defer srv.Close()
+	g := gache.New[[]byte]().SetDefaultExpire(time.Hour)
+	c := NewTransport(g, nil).Client()
+
+	for i, want := range []string{miss, hit, hit} {
+		if body, status := get(t, c, srv.URL+"/fresh"); body != "body /fresh" || status != want {
+			t.Fatalf("GET /fresh #%d = %q, %s, want %s", i, body, status, want)
+		}
+	}
+	if n := requests.Load(); n != 1 {
+		t.Fatalf("origin received %d requests for a fresh response", n)
+	}
+	if _, status := get(t, c, srv.URL+"/fresh", "Cache-Control", "no-cache"); status == hit {
+		t.Fatal("request with no-cache served from cache")
+	}
+
+	requests.Store(0)
+	for i, want := range []string{miss, revalidated, revalidated} {
+		if body, status := get(t, c, srv.URL+"/etag"); body != "body /etag" || status != want {
+			t.Fatalf("GET /etag #%d = %q, %s, want %s", i, body, status, want)
+		}
+	}
+	if n := requests.Load(); n != 3 {
+		t.Fatalf("origin received %d requests for a revalidated response", n)
+	}
+
+	if body, _ := get(t, c, srv.URL+"/vary", "Accept-Language", "en"); body != "en" {
+		t.Fatalf("GET /vary en = %q", body)
+	}
+	if body, status := get(t, c, srv.URL+"/vary", "Accept-Language", "th"); body != "th" || status != miss {
+		t.Fatalf("GET /vary th = %q, %s", body, status)
+	}
+	for _, lang := range []string{"en", "th"} {
+		if body, status := get(t, c, srv.URL+"/vary", "Accept-Language", lang); body != lang || status != hit {
+			t.Fatalf("GET /vary %s again = %q, %s", lang, body, status)
+		}
+	}
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/vary", nil)
+	req.Header.Set("Accept-Language", "en")
+	resp, err := c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	for name := range resp.Header {
+		if strings.HasPrefix(name, "X-Gache") {
+			t.Fatalf("cached response has internal header %s", name)
+		}
+	}
+	if resp, err = c.Post(srv.URL+"/vary", "text/plain", nil); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if _, status := get(t, c, srv.URL+"/vary", "Accept-Language", "en"); status != miss {
+		t.Fatalf("GET /vary after POST = %s, want %s", status, miss)
+	}
+
+	get(t, c, srv.URL+"/nostore")
+	if _, ok := g.Get(srv.URL + "/nostore"); ok {
+		t.Fatal("no-store response cached")
+	}
+
+	resp, err = c.Post(srv.URL+"/fresh", "text/plain", strings.NewReader("update"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if _, status := get(t, c, srv.URL+"/fresh"); status != miss {
+		t.Fatalf("GET after POST = %s, want %s", status, miss)
+	}
+
+	small := NewTransport(gache.New[[]byte](), nil, WithTransportMaxBodySize(4)).Client()
+	for range 2 {
+		if body, status := get(t, small, srv.URL+"/fresh"); body != "body /fresh" || status == hit {
+			t.Fatalf("GET of a body over the limit = %q, %s", body, status)
+		}
+	}
+}
+
+type (
+	roundTripFunc func(*http.Request) (*http.Response, error)
+
+	// failingBody returns its content then err and records its close
+	failingBody struct {
+		r      io.Reader
+		err    error
+		closed bool
+	}
+)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func (b *failingBody) Read(p []byte) (int, error) {
+	if n, _ := b.r.Read(p); n > 0 {
+		return n, nil
+	}
+	return 0, b.err
+}
+
+func (b *failingBody) Close() error {
+	b.closed = true
+	return nil
+}
+
+func TestTransportBodyError(t *testing.T) {
+	body := &failingBody{r: strings.NewReader("partial"), err: io.ErrUnexpectedEOF}
+	g := gache.New[[]byte]()
+	tr := NewTransport(g, roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Cache-Control": {"max-age=60"}},
+			Body:       body,
+			Request:    req,
+		}, nil
+	}))
+	req, err := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := tr.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip of a failing body = %v", err)
+	}
+	if b, err := io.ReadAll(resp.Body); string(b) != "partial" || err != io.ErrUnexpectedEOF {
+		t.Fatalf("read of a failing body = %q, %v", b, err)
+	}
+	resp.Body.Close()
+	if !body.closed {
+		t.Fatal("failing body not closed")
+	}
+	if g.Len() != 0 {
+		t.Fatalf("failing body cached %d entries", g.Len())
+	}
+}
+
+func TestFreshness(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, tt := range []struct {
+		header http.Header
+		want   time.Duration
+	}{
+		{http.Header{"Cache-Control": {"public, max-age=120"}}, 2 * time.Minute},
+		{http.Header{"Cache-Control": {"max-age=120"}, "Age": {"20"}}, 100 * time.Second},
+		{http.Header{"Cache-Control": {"no-cache, max-age=120"}}, 0},
+		{http.Header{"Date": {now.Format(http.TimeFormat)}, "Expires": {now.Add(time.Hour).Format(http.TimeFormat)}}, time.Hour},
+		{http.Header{"Expires": {"0"}}, 0},
+	} {
+		if got := freshness(tt.header, now); got != tt.want {
+			t.Errorf("freshness(%v) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
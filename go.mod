@@ -3,9 +3,11 @@ module github.com/ntsd/gache/v2
 go 1.23.3
 
 require (
+	github.com/klauspost/compress v1.17.11
 	github.com/kpango/fastime v1.1.9
 	github.com/kpango/glg v1.6.15
 	github.com/zeebo/xxh3 v1.0.2
+	golang.org/x/sync v0.10.0
 )
 
 require (
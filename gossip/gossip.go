@@ -0,0 +1,191 @@
+// Package gossip replicates the invalidations of a gache to its replicas over memberlist gossip, so the replicas of
+// a service converge without a central broker. Deletions of g and the expirations set through the Replicator are
+// broadcast to every member which applies them to its own cache; delivery is eventual and best effort, and
+// invalidations of the same key by different members are applied in the order they arrive.
+package gossip
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hashicorp/memberlist"
+	"github.com/ntsd/gache/v2"
+)
+
+const (
+	opDelete byte = iota + 1
+	opExpire
+)
+
+type (
+	// Replicator is the memberlist member of a cache broadcasting its invalidations to the other members
+	Replicator[V any] struct {
+		cache    gache.Gache[V]
+		list     atomic.Pointer[memberlist.Memberlist]
+		queue    *memberlist.TransmitLimitedQueue
+		applying sync.Map
+	}
+
+	// broadcast is a queued invalidation, a newer one of the same key replaces it
+	broadcast struct {
+		key string
+		msg []byte
+	}
+)
+
+var errMalformed = errors.New("gossip: malformed message")
+
+// New joins g to a new memberlist created with conf, memberlist.DefaultLANConfig when conf is nil.
+// The delegate of conf is set to the Replicator and it takes over the delete hook of g.
+func New[V any](g gache.Gache[V], conf *memberlist.Config) (*Replicator[V], error) {
+	if conf == nil {
+		conf = memberlist.DefaultLANConfig()
+	}
+	r := &Replicator[V]{cache: g}
+	r.queue = &memberlist.TransmitLimitedQueue{NumNodes: r.numNodes, RetransmitMult: conf.RetransmitMult}
+	conf.Delegate = r
+	list, err := memberlist.Create(conf)
+	if err != nil {
+		return nil, err
+	}
+	r.list.Store(list)
+	g.SetDeleteHook(func(_ context.Context, key string, _ V) {
+		if _, ok := r.applying.Load(key); !ok {
+			r.queue.QueueBroadcast(newBroadcast(opDelete, key, 0))
+		}
+	})
+	return r, nil
+}
+
+// Join joins the cluster through the members at addrs and returns the number of them contacted
+func (r *Replicator[V]) Join(addrs ...string) (int, error) {
+	return r.list.Load().Join(addrs)
+}
+
+// Memberlist returns the underlying memberlist
+func (r *Replicator[V]) Memberlist() *memberlist.Memberlist {
+	return r.list.Load()
+}
+
+// Delete deletes key locally and broadcasts the deletion, it is broadcast even when key is not live locally
+func (r *Replicator[V]) Delete(key string) (V, bool) {
+	v, ok := r.apply(key, func() (V, bool) { return r.cache.Delete(key) })
+	r.queue.QueueBroadcast(newBroadcast(opDelete, key, 0))
+	return v, ok
+}
+
+// Expire sets the expiration of key to ttl from now locally and on the members, NoTTL removes it
+func (r *Replicator[V]) Expire(key string, ttl time.Duration) bool {
+	var t time.Time
+	if ttl >= 0 {
+		t = time.Now().Add(ttl)
+	}
+	return r.ExpireAt(key, t)
+}
+
+// ExpireAt sets the expiration of key to t locally and on the members, zero t removes it.
+// The members expire key at the same instant so clock skew between them shifts it.
+func (r *Replicator[V]) ExpireAt(key string, t time.Time) bool {
+	var expire int64
+	if !t.IsZero() {
+		expire = t.UnixNano()
+	}
+	r.queue.QueueBroadcast(newBroadcast(opExpire, key, expire))
+	return r.cache.ExpireAt(key, t)
+}
+
+// Leave broadcasts the departure of the member waiting up to timeout and shuts memberlist down
+func (r *Replicator[V]) Leave(timeout time.Duration) error {
+	list := r.list.Load()
+	return errors.Join(list.Leave(timeout), list.Shutdown())
+}
+
+// NodeMeta implements memberlist.Delegate
+func (r *Replicator[V]) NodeMeta(int) []byte {
+	return nil
+}
+
+// NotifyMsg implements memberlist.Delegate by applying a received invalidation
+func (r *Replicator[V]) NotifyMsg(b []byte) {
+	op, key, expire, err := decode(b)
+	if err != nil {
+		return
+	}
+	switch op {
+	case opDelete:
+		r.apply(key, func() (V, bool) { return r.cache.Delete(key) })
+	case opExpire:
+		var t time.Time
+		if expire != 0 {
+			t = time.Unix(0, expire)
+		}
+		r.cache.ExpireAt(key, t)
+	}
+}
+
+// GetBroadcasts implements memberlist.Delegate
+func (r *Replicator[V]) GetBroadcasts(overhead, limit int) [][]byte {
+	return r.queue.GetBroadcasts(overhead, limit)
+}
+
+// LocalState implements memberlist.Delegate, invalidations are not part of the state exchanged on join
+func (r *Replicator[V]) LocalState(bool) []byte {
+	return nil
+}
+
+// MergeRemoteState implements memberlist.Delegate
+func (r *Replicator[V]) MergeRemoteState([]byte, bool) {}
+
+// apply runs f deleting key without broadcasting the deletion from the delete hook
+func (r *Replicator[V]) apply(key string, f func() (V, bool)) (V, bool) {
+	r.applying.Store(key, struct{}{})
+	defer r.applying.Delete(key)
+	return f()
+}
+
+func (r *Replicator[V]) numNodes() int {
+	if list := r.list.Load(); list != nil {
+		return list.NumMembers()
+	}
+	return 1
+}
+
+// newBroadcast encodes op as its byte, the varint unix nano expiration and the key
+func newBroadcast(op byte, key string, expire int64) *broadcast {
+	msg := binary.AppendVarint([]byte{op}, expire)
+	return &broadcast{key: key, msg: append(msg, key...)}
+}
+
+func decode(b []byte) (op byte, key string, expire int64, err error) {
+	if len(b) < 2 {
+		return 0, "", 0, errMalformed
+	}
+	expire, n := binary.Varint(b[1:])
+	if n <= 0 {
+		return 0, "", 0, errMalformed
+	}
+	return b[0], string(b[1+n:]), expire, nil
+}
+
+// Name implements memberlist.NamedBroadcast
+func (b *broadcast) Name() string {
+	return b.key
+}
+
+// Invalidates implements memberlist.Broadcast
+func (b *broadcast) Invalidates(other memberlist.Broadcast) bool {
+	o, ok := other.(*broadcast)
+	return ok && o.key == b.key
+}
+
+// Message implements memberlist.Broadcast
+func (b *broadcast) Message() []byte {
+	return b.msg
+}
+
+// Finished implements memberlist.Broadcast
+func (*broadcast) Finished() {}
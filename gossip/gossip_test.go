@@ -0,0 +1,126 @@
+package gossip
+
+import (
+	"io"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/memberlist"
+	"github.com/ntsd/gache/v2"
+)
+
+func cluster(t *testing.T, n int) ([]*Replicator[string], []gache.Gache[string]) {
+	t.Helper()
+	var (
+		replicas []*Replicator[string]
+		caches   []gache.Gache[string]
+	)
+	for i := range n {
+		conf := memberlist.DefaultLocalConfig()
+		conf.Name = "node" + strconv.Itoa(i)
+		conf.BindAddr, conf.BindPort, conf.AdvertisePort = "127.0.0.1", 0, 0
+		conf.GossipInterval = 10 * time.Millisecond
+		// the local config transmits a broadcast twice for 3 nodes, one piggybacked on a probe can starve a member
+		conf.RetransmitMult = 8
+		conf.LogOutput = io.Discard
+		g := gache.New[string]()
+		g.SetDefaultExpire(gache.NoTTL)
+		r, err := New(g, conf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { r.Leave(time.Second) })
+		if i > 0 {
+			node := replicas[0].Memberlist().LocalNode()
+			if _, err := r.Join(net.JoinHostPort(node.Addr.String(), strconv.Itoa(int(node.Port)))); err != nil {
+				t.Fatal(err)
+			}
+		}
+		replicas, caches = append(replicas, r), append(caches, g)
+	}
+	return replicas, caches
+}
+
+// eventually polls cond until it holds or the deadline passes
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("%s was not replicated", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestReplicator(t *testing.T) {
+	replicas, caches := cluster(t, 3)
+	// every node must know the others before broadcasting, retransmits are budgeted by the known member count
+	eventually(t, "membership", func() bool {
+		for _, r := range replicas {
+			if r.Memberlist().NumMembers() != 3 {
+				return false
+			}
+		}
+		return true
+	})
+	for _, g := range caches {
+		g.Set("a", "1")
+		g.Set("b", "2")
+		g.Set("c", "3")
+	}
+
+	// a deletion of the cache itself is broadcast by the delete hook
+	caches[0].Delete("a")
+	eventually(t, "delete hook", func() bool {
+		_, ok1 := caches[1].Get("a")
+		_, ok2 := caches[2].Get("a")
+		return !ok1 && !ok2
+	})
+
+	// a deletion through the replicator reaches members holding a key it does not hold
+	caches[1].Delete("b")
+	replicas[2].Delete("b")
+	eventually(t, "Delete", func() bool {
+		_, ok := caches[0].Get("b")
+		return !ok
+	})
+
+	replicas[1].Expire("c", time.Hour)
+	eventually(t, "Expire", func() bool {
+		for _, g := range caches {
+			if ttl, ok := g.TTL("c"); !ok || ttl == gache.NoTTL || ttl > 61*time.Minute {
+				return false
+			}
+		}
+		return true
+	})
+	// invalidations of a key by different members apply in arrival order, so persisting uses another key
+	for _, g := range caches {
+		g.SetWithExpire("d", "4", time.Hour)
+	}
+	replicas[0].Expire("d", gache.NoTTL)
+	eventually(t, "Persist", func() bool {
+		for _, g := range caches {
+			if ttl, _ := g.TTL("d"); ttl != gache.NoTTL {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+func TestDecode(t *testing.T) {
+	op, key, expire, err := decode(newBroadcast(opExpire, "key", 1234).Message())
+	if err != nil || op != opExpire || key != "key" || expire != 1234 {
+		t.Fatalf("decode = %d, %q, %d, %v", op, key, expire, err)
+	}
+	if _, _, _, err := decode([]byte{opDelete}); err == nil {
+		t.Fatal("decode of truncated message succeeded")
+	}
+	if !newBroadcast(opDelete, "k", 0).Invalidates(newBroadcast(opExpire, "k", 1)) {
+		t.Fatal("broadcast does not invalidate an older one of the same key")
+	}
+}
@@ -0,0 +1,59 @@
+package gache
+
+import (
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+// KeyHandle is bound to a single key and the shard it belongs to, so that
+// repeated operations on the same key skip re-hashing it.
+//
+// The shard is resolved once when the handle is created, so a KeyHandle must
+// not be used concurrently with anything that replaces the shard array of
+// its Gache. Clear keeps the existing shards and does not invalidate handles.
+type KeyHandle[V any] struct {
+	g     *gache[V]
+	shard *Map[string, *value[V]]
+	key   string
+}
+
+// Handle returns KeyHandle bound to key
+func (g *gache[V]) Handle(key string) KeyHandle[V] {
+	return KeyHandle[V]{
+		g:     g,
+		shard: g.shard(key),
+		key:   key,
+	}
+}
+
+// Key returns the key bound to the handle
+func (h KeyHandle[V]) Key() string {
+	return h.key
+}
+
+// Get returns value & exists of the bound key
+func (h KeyHandle[V]) Get() (v V, ok bool) {
+	v, _, ok = h.g.get(h.shard, h.key)
+	return v, ok
+}
+
+// Set sets value to the bound key using default expiration
+func (h KeyHandle[V]) Set(val V) {
+	h.g.set(h.shard, h.key, val, atomic.LoadInt64(&h.g.expire))
+}
+
+// SetWithExpire sets value & expiration to the bound key
+func (h KeyHandle[V]) SetWithExpire(val V, expire time.Duration) {
+	h.g.set(h.shard, h.key, val, *(*int64)(unsafe.Pointer(&expire)))
+}
+
+// Delete deletes the bound key
+func (h KeyHandle[V]) Delete() (v V, loaded bool) {
+	return h.g.delete(h.shard, h.key)
+}
+
+// TTL returns remaining lifetime of the bound key, NoTTL is returned for keys without expiration
+func (h KeyHandle[V]) TTL() (ttl time.Duration, ok bool) {
+	return h.g.ttl(h.shard, h.key)
+}
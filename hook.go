@@ -0,0 +1,43 @@
+package gache
+
+import "context"
+
+// SetSetHook sets the function called after every write of a value, old is the replaced live value when existed is true.
+// It is called synchronously by the writing goroutine, changing only the expiration of a value does not call it.
+func (g *gache[V]) SetSetHook(f func(ctx context.Context, key string, old, new V, existed bool)) Gache[V] {
+	g.setFunc = f
+	return g
+}
+
+// SetDeleteHook sets the function called after a live value is deleted explicitly, expired, evicted and cleared values are reported by SetEvictedHook.
+// It is called synchronously by the deleting goroutine.
+func (g *gache[V]) SetDeleteHook(f func(ctx context.Context, key string, val V)) Gache[V] {
+	g.deleteFunc = f
+	return g
+}
+
+// notifySet calls the set hook and emits the write to watchers, old is nil when key was absent
+func (g *gache[V]) notifySet(key string, old, val *value[V]) {
+	if g.setFunc == nil && !g.emitting() {
+		return
+	}
+	var prev V
+	existed := old != nil && g.reason(old, Replaced) == Replaced
+	if existed {
+		prev = old.val
+		g.emit(EventUpdated, key, val.val)
+	} else {
+		g.emit(EventCreated, key, val.val)
+	}
+	if g.setFunc != nil {
+		g.setFunc(context.Background(), key, prev, val.val, existed)
+	}
+}
+
+// notifyDelete calls the delete hook and emits the deletion to watchers
+func (g *gache[V]) notifyDelete(key string, val V) {
+	g.emit(EventDeleted, key, val)
+	if g.deleteFunc != nil {
+		g.deleteFunc(context.Background(), key, val)
+	}
+}
@@ -0,0 +1,204 @@
+package gache
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kpango/fastime"
+)
+
+// ErrNoLoader is returned by GetOrLoad when the cache has no loader set by WithLoader
+var ErrNoLoader = errors.New("gache: no loader")
+
+// GetOrLoad returns value of key or loads it using the loader set by WithLoader and stores it.
+// Concurrent misses of the same key share one loader call which is not canceled when a single caller gives up.
+func (g *gache[V]) GetOrLoad(ctx context.Context, key string) (v V, err error) {
+	if v, ok := g.Get(key); ok {
+		return v, nil
+	}
+	if g.IsNegative(key) {
+		return v, ErrNotFound
+	}
+	if g.loader == nil {
+		return v, ErrNoLoader
+	}
+	return g.load(ctx, key)
+}
+
+// GetMultiLoad returns values of keys loading the missing ones and storing them.
+// The batch loader set by WithBatchLoader is called once with all missing keys, otherwise missing keys are loaded concurrently by the loader.
+// Keys the loaders do not return are left out of the result and cached as missing with WithNegativeTTL,
+// loaded values are returned along with the error of failed loads.
+func (g *gache[V]) GetMultiLoad(ctx context.Context, keys []string) (map[string]V, error) {
+	m := g.GetMulti(keys)
+	var missing []string
+	for _, key := range keys {
+		if _, ok := m[key]; !ok && !g.IsNegative(key) {
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) == 0 {
+		return m, nil
+	}
+	if g.batchLoader != nil {
+		var (
+			loaded map[string]V
+			ttl    time.Duration
+		)
+		err := g.call(ctx, func(ctx context.Context) (err error) {
+			loaded, ttl, err = g.batchLoader(ctx, slices.Compact(slices.Sorted(slices.Values(missing))))
+			return err
+		})
+		for key, v := range loaded {
+			g.store(key, v, ttl)
+			m[key] = v
+		}
+		if err == nil && g.negativeTTL != 0 {
+			for _, key := range missing {
+				if _, ok := loaded[key]; !ok {
+					g.SetNegative(key, time.Duration(g.negativeTTL))
+				}
+			}
+		}
+		return m, err
+	}
+	if g.loader == nil {
+		return m, ErrNoLoader
+	}
+	var (
+		mu   sync.Mutex
+		wg   sync.WaitGroup
+		errs []error
+	)
+	for _, key := range missing {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := g.load(ctx, key)
+			mu.Lock()
+			defer mu.Unlock()
+			if errors.Is(err, ErrNotFound) {
+				return
+			}
+			if err != nil {
+				errs = append(errs, err)
+				return
+			}
+			m[key] = v
+		}()
+	}
+	wg.Wait()
+	return m, errors.Join(errs...)
+}
+
+// load calls the loader of key through singleflight and stores the loaded value
+func (g *gache[V]) load(ctx context.Context, key string) (v V, err error) {
+	lctx := context.WithoutCancel(ctx)
+	ch := g.loads.DoChan(key, func() (any, error) {
+		if v, ok := g.Get(key); ok {
+			return v, nil
+		}
+		v, ttl, err := g.callLoader(lctx, key)
+		if g.notFound(key, err) {
+			return nil, ErrNotFound
+		}
+		if err != nil {
+			if v, ok := g.fallbackValue(key); ok {
+				g.log(lctx, slog.LevelWarn, "gache: serving stale value", "key", key, "error", err)
+				return v, nil
+			}
+			return nil, err
+		}
+		g.store(key, v, ttl)
+		return v, nil
+	})
+	select {
+	case <-ctx.Done():
+		return v, ctx.Err()
+	case res := <-ch:
+		if res.Err != nil {
+			return v, res.Err
+		}
+		v, _ = res.Val.(V)
+		return v, nil
+	}
+}
+
+// callLoader calls the loader of key with the retry policy and the circuit breaker
+func (g *gache[V]) callLoader(ctx context.Context, key string) (v V, ttl time.Duration, err error) {
+	err = g.call(ctx, func(ctx context.Context) (err error) {
+		v, ttl, err = g.loader(ctx, key)
+		return err
+	})
+	return v, ttl, err
+}
+
+// refreshAhead reloads key in background when its expiration is within the refresh-ahead window
+func (g *gache[V]) refreshAhead(key string, expire int64) {
+	if g.loader == nil || expire <= 0 || expire-fastime.UnixNanoNow() > g.refreshWindow {
+		return
+	}
+	g.refresh(key)
+}
+
+// refresh reloads key in background unless a refresh of key is already running, failures keep the stored value
+func (g *gache[V]) refresh(key string) {
+	if _, loaded := g.refreshing.LoadOrStore(key, true); loaded {
+		return
+	}
+	go func() {
+		defer g.refreshing.Delete(key)
+		ctx := context.Background()
+		// share the call with concurrent misses loading the same key
+		g.loads.Do(key, func() (any, error) {
+			v, ttl, err := g.callLoader(ctx, key)
+			if g.notFound(key, err) {
+				return nil, err
+			}
+			if err != nil {
+				g.log(ctx, slog.LevelWarn, "gache: refresh failed", "key", key, "error", err)
+				return nil, err
+			}
+			g.store(key, v, ttl)
+			return v, nil
+		})
+	}()
+}
+
+// serveStale reports whether expired val is still served by WithStaleTTL while it is refreshed
+func (g *gache[V]) serveStale(v *value[V]) bool {
+	return g.staleTTL != 0 && g.loader != nil && v.expire > 0 && !g.cleared(v) &&
+		fastime.UnixNanoNow() <= v.expire+g.staleTTL
+}
+
+// fallback reports whether expired val is kept for failing loads by WithStaleIfError
+func (g *gache[V]) fallback(v *value[V]) bool {
+	return g.staleIfError != 0 && v.expire > 0 && !g.cleared(v) &&
+		fastime.UnixNanoNow() <= v.expire+g.staleIfError
+}
+
+// fallbackValue returns the expired value of key kept by WithStaleIfError
+func (g *gache[V]) fallbackValue(key string) (v V, ok bool) {
+	val, ok := g.shard(key).Load(key)
+	if !ok || !g.fallback(val) {
+		return v, false
+	}
+	if g.stats != nil {
+		g.stats.stale.Add(1)
+	}
+	return val.val, true
+}
+
+// store sets loaded key-value expiring after ttl, zero ttl uses default expiration and negative ttl never expires
+func (g *gache[V]) store(key string, val V, ttl time.Duration) {
+	expire := ttl.Nanoseconds()
+	if ttl == 0 {
+		expire = atomic.LoadInt64(&g.expire)
+	}
+	g.set(g.shard(key), key, val, expire)
+}
@@ -0,0 +1,55 @@
+package gache
+
+import (
+	"context"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// Memoize returns fn caching its results in g under keyFn of the argument with the default expiration of g.
+// Concurrent calls of the same key share one fn call which is not canceled when a single caller gives up, errors are not cached.
+func Memoize[K, V any](g Gache[V], keyFn func(K) string, fn func(context.Context, K) (V, error)) func(context.Context, K) (V, error) {
+	return memoize(g, keyFn, fn, func(key string, v V) {
+		g.Set(key, v)
+	})
+}
+
+// MemoizeWithExpire is Memoize caching the results for expire
+func MemoizeWithExpire[K, V any](g Gache[V], expire time.Duration, keyFn func(K) string, fn func(context.Context, K) (V, error)) func(context.Context, K) (V, error) {
+	return memoize(g, keyFn, fn, func(key string, v V) {
+		g.SetWithExpire(key, v, expire)
+	})
+}
+
+func memoize[K, V any](g Gache[V], keyFn func(K) string, fn func(context.Context, K) (V, error), set func(string, V)) func(context.Context, K) (V, error) {
+	var group singleflight.Group
+	return func(ctx context.Context, arg K) (v V, err error) {
+		key := keyFn(arg)
+		if v, ok := g.Get(key); ok {
+			return v, nil
+		}
+		fctx := context.WithoutCancel(ctx)
+		ch := group.DoChan(key, func() (any, error) {
+			if v, ok := g.Get(key); ok {
+				return v, nil
+			}
+			v, err := fn(fctx, arg)
+			if err != nil {
+				return nil, err
+			}
+			set(key, v)
+			return v, nil
+		})
+		select {
+		case <-ctx.Done():
+			return v, ctx.Err()
+		case res := <-ch:
+			if res.Err != nil {
+				return v, res.Err
+			}
+			v, _ = res.Val.(V)
+			return v, nil
+		}
+	}
+}
@@ -0,0 +1,141 @@
+// Package prometheus provides a Prometheus collector for gache.
+// It lives in its own module so the core gache package stays free of the Prometheus dependency.
+package prometheus
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/ntsd/gache/v2"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const namespace = "gache"
+
+type (
+	// Source is the part of Gache read by Collector, every Gache[V] implements it
+	Source interface {
+		Len() int
+		Stats() gache.Stats
+		DistributionScore() float64
+		Write(context.Context, io.Writer) error
+	}
+
+	// Collector exposes entries, operation counters, shard distribution and snapshot write durations of a cache.
+	// Operation counters require the cache to be created with gache.WithStats.
+	Collector struct {
+		src          Source
+		entries      *prometheus.Desc
+		hits         *prometheus.Desc
+		misses       *prometheus.Desc
+		sets         *prometheus.Desc
+		deletes      *prometheus.Desc
+		expired      *prometheus.Desc
+		stale        *prometheus.Desc
+		hitRatio     *prometheus.Desc
+		distribution *prometheus.Desc
+		writes       prometheus.Histogram
+	}
+
+	// Option configures Collector
+	Option func(*config)
+
+	config struct {
+		labels  prometheus.Labels
+		buckets []float64
+	}
+)
+
+// WithConstLabels adds labels to every metric of the collector, the cache label is always set
+func WithConstLabels(labels prometheus.Labels) Option {
+	return func(c *config) {
+		for k, v := range labels {
+			c.labels[k] = v
+		}
+	}
+}
+
+// WithWriteBuckets sets the histogram buckets in seconds of snapshot write durations, prometheus.DefBuckets is used by default
+func WithWriteBuckets(buckets []float64) Option {
+	return func(c *config) {
+		if len(buckets) != 0 {
+			c.buckets = buckets
+		}
+	}
+}
+
+// NewCollector returns Collector of src labeled with cache name
+func NewCollector(name string, src Source, opts ...Option) *Collector {
+	c := &config{
+		labels:  prometheus.Labels{},
+		buckets: prometheus.DefBuckets,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.labels["cache"] = name
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "", name), help, nil, c.labels)
+	}
+	return &Collector{
+		src:          src,
+		entries:      desc("entries", "Number of entries stored in the cache."),
+		hits:         desc("hits_total", "Number of lookups finding a live entry."),
+		misses:       desc("misses_total", "Number of lookups finding no live entry."),
+		sets:         desc("sets_total", "Number of successful writes."),
+		deletes:      desc("deletes_total", "Number of live entries deleted."),
+		expired:      desc("expired_total", "Number of expired entries removed."),
+		stale:        desc("stale_total", "Number of expired values served in place of a refresh or a failed load."),
+		hitRatio:     desc("hit_ratio", "Ratio of hits to lookups since the stats were last reset."),
+		distribution: desc("shard_distribution_score", "Coefficient of variation of per-shard entry counts, 0 means even distribution."),
+		writes: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace:   namespace,
+			Name:        "snapshot_write_duration_seconds",
+			Help:        "Duration of snapshot writes made through the collector.",
+			ConstLabels: c.labels,
+			Buckets:     c.buckets,
+		}),
+	}
+}
+
+// Write writes a snapshot of the cache to w and records its duration
+func (c *Collector) Write(ctx context.Context, w io.Writer) error {
+	start := time.Now()
+	err := c.src.Write(ctx, w)
+	c.writes.Observe(time.Since(start).Seconds())
+	return err
+}
+
+// Describe implements prometheus.Collector
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.entries
+	ch <- c.hits
+	ch <- c.misses
+	ch <- c.sets
+	ch <- c.deletes
+	ch <- c.expired
+	ch <- c.stale
+	ch <- c.hitRatio
+	ch <- c.distribution
+	c.writes.Describe(ch)
+}
+
+// Collect implements prometheus.Collector
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	s := c.src.Stats()
+	var ratio float64
+	if lookups := s.Hits + s.Misses; lookups != 0 {
+		ratio = float64(s.Hits) / float64(lookups)
+	}
+	ch <- prometheus.MustNewConstMetric(c.entries, prometheus.GaugeValue, float64(c.src.Len()))
+	ch <- prometheus.MustNewConstMetric(c.hits, prometheus.CounterValue, float64(s.Hits))
+	ch <- prometheus.MustNewConstMetric(c.misses, prometheus.CounterValue, float64(s.Misses))
+	ch <- prometheus.MustNewConstMetric(c.sets, prometheus.CounterValue, float64(s.Sets))
+	ch <- prometheus.MustNewConstMetric(c.deletes, prometheus.CounterValue, float64(s.Deletes))
+	ch <- prometheus.MustNewConstMetric(c.expired, prometheus.CounterValue, float64(s.Expired))
+	ch <- prometheus.MustNewConstMetric(c.stale, prometheus.CounterValue, float64(s.Stale))
+	ch <- prometheus.MustNewConstMetric(c.hitRatio, prometheus.GaugeValue, ratio)
+	ch <- prometheus.MustNewConstMetric(c.distribution, prometheus.GaugeValue, c.src.DistributionScore())
+	c.writes.Collect(ch)
+}
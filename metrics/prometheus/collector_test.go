@@ -0,0 +1,47 @@
+package prometheus
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/ntsd/gache/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCollector(t *testing.T) {
+	g := gache.New(gache.WithStats[int]())
+	g.Set("a", 1)
+	g.Set("b", 2)
+	g.Get("a")
+	g.Get("missing")
+
+	c := NewCollector("test", g, WithConstLabels(prometheus.Labels{"env": "ci"}))
+	if err := c.Write(context.Background(), new(bytes.Buffer)); err != nil {
+		t.Fatal(err)
+	}
+	reg := prometheus.NewPedanticRegistry()
+	if err := reg.Register(c); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `
+# HELP gache_entries Number of entries stored in the cache.
+# TYPE gache_entries gauge
+gache_entries{cache="test",env="ci"} 2
+# HELP gache_hit_ratio Ratio of hits to lookups since the stats were last reset.
+# TYPE gache_hit_ratio gauge
+gache_hit_ratio{cache="test",env="ci"} 0.5
+# HELP gache_sets_total Number of successful writes.
+# TYPE gache_sets_total counter
+gache_sets_total{cache="test",env="ci"} 2
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(want), "gache_entries", "gache_hit_ratio", "gache_sets_total"); err != nil {
+		t.Fatal(err)
+	}
+	if n := testutil.CollectAndCount(c, "gache_snapshot_write_duration_seconds"); n != 1 {
+		t.Fatalf("snapshot write histogram count = %d", n)
+	}
+}
@@ -0,0 +1,306 @@
+package gache
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/kpango/fastime"
+	"github.com/zeebo/xxh3"
+)
+
+const (
+	// mappedMagic starts and ends every mapped snapshot
+	mappedMagic = "GACHEMAP"
+
+	// mappedVersion is the format written by WriteMapped, the header is followed by the entries as uvarint key length, key,
+	// big endian expiration, uvarint value length and codec encoded value, then the index of big endian xxh3 key hash and
+	// entry offset pairs sorted by hash and the trailer of index offset, entry count and mappedMagic
+	mappedVersion = 1
+
+	mappedIndexEntry = 16
+	mappedTrailer    = 16 + len(mappedMagic)
+)
+
+// ErrMappedOpen is returned by OpenMapped when a mapped snapshot is already open
+var ErrMappedOpen = errors.New("gache: mapped snapshot already open")
+
+// mapped is a snapshot file mapped into memory, its entries are decoded on first access
+type mapped struct {
+	mu     sync.RWMutex
+	data   []byte
+	index  []byte
+	count  uint64
+	prefix string
+}
+
+// WriteMapped writes the live entries as a mapped snapshot for OpenMapped, it ignores WithSnapshotCompression and WithSnapshotEncryption
+func (g *gache[V]) WriteMapped(ctx context.Context, w io.Writer) error {
+	return g.writeMapped(ctx, w, nil)
+}
+
+// OpenMapped maps the snapshot written by WriteMapped at path without decoding it, Get and the methods built on it decode
+// an entry into memory on the first miss of its key. Written and deleted keys shadow the snapshot, Clear and LazyClear close it.
+// Unread entries are not counted by Len nor visited by Range and Write.
+func (g *gache[V]) OpenMapped(path string) error {
+	return g.openMapped(path, "")
+}
+
+// CloseMapped unmaps the snapshot of OpenMapped, entries not yet read are dropped
+func (g *gache[V]) CloseMapped() error {
+	m := g.mapped.Swap(nil)
+	if m == nil {
+		return nil
+	}
+	g.shadowed.Clear()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data := m.data
+	m.data, m.index, m.count = nil, nil, 0
+	return munmap(data)
+}
+
+func (g *gache[V]) writeMapped(ctx context.Context, w io.Writer, strip func(string) (string, bool)) (err error) {
+	defer func() {
+		if err != nil {
+			g.log(context.Background(), slog.LevelWarn, "gache: mapped snapshot write failed", "error", err)
+		}
+	}()
+	codec := g.snapshotCodec()
+	if len(codec.Name()) > math.MaxUint8 {
+		return fmt.Errorf("gache: codec name %q exceeds %d bytes", codec.Name(), math.MaxUint8)
+	}
+	bw := bufio.NewWriter(w)
+	cw := &countWriter{w: bw}
+	header := append(append([]byte(mappedMagic), mappedVersion, byte(len(codec.Name()))), codec.Name()...)
+	if _, err := cw.Write(header); err != nil {
+		return err
+	}
+	type entry struct{ hash, offset uint64 }
+	var (
+		index []entry
+		buf   []byte
+	)
+	for _, shard := range g.shards {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		for k, v := range shard.RangeIter() {
+			if !g.valid(v) {
+				continue
+			}
+			key := k
+			if strip != nil {
+				var ok bool
+				if key, ok = strip(k); !ok {
+					continue
+				}
+			}
+			b, err := codec.Marshal(v.val)
+			if err != nil {
+				return err
+			}
+			index = append(index, entry{xxh3.HashString(key), uint64(cw.n)})
+			buf = binary.AppendUvarint(buf[:0], uint64(len(key)))
+			buf = append(buf, key...)
+			buf = binary.BigEndian.AppendUint64(buf, uint64(v.expire))
+			buf = binary.AppendUvarint(buf, uint64(len(b)))
+			if _, err := cw.Write(append(buf, b...)); err != nil {
+				return err
+			}
+		}
+	}
+	slices.SortFunc(index, func(a, b entry) int {
+		return cmp.Or(cmp.Compare(a.hash, b.hash), cmp.Compare(a.offset, b.offset))
+	})
+	indexOffset := uint64(cw.n)
+	for _, e := range index {
+		buf = binary.BigEndian.AppendUint64(buf[:0], e.hash)
+		if _, err := cw.Write(binary.BigEndian.AppendUint64(buf, e.offset)); err != nil {
+			return err
+		}
+	}
+	buf = binary.BigEndian.AppendUint64(buf[:0], indexOffset)
+	buf = binary.BigEndian.AppendUint64(buf, uint64(len(index)))
+	if _, err := cw.Write(append(buf, mappedMagic...)); err != nil {
+		return err
+	}
+	g.log(ctx, slog.LevelDebug, "gache: mapped snapshot written", "entries", len(index), "bytes", cw.n)
+	return bw.Flush()
+}
+
+func (g *gache[V]) openMapped(path, prefix string) error {
+	if g.mapped.Load() != nil {
+		return ErrMappedOpen
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() < int64(len(mappedMagic)+2+mappedTrailer) {
+		return fmt.Errorf("%w: mapped snapshot of %d bytes", ErrCorruptSnapshot, info.Size())
+	}
+	data, err := mmap(f, int(info.Size()))
+	if err != nil {
+		return err
+	}
+	m := &mapped{data: data, prefix: prefix}
+	if err := m.validate(g.snapshotCodec()); err != nil {
+		munmap(data)
+		return err
+	}
+	if !g.mapped.CompareAndSwap(nil, m) {
+		munmap(data)
+		return ErrMappedOpen
+	}
+	g.log(context.Background(), slog.LevelDebug, "gache: mapped snapshot opened", "path", path, "entries", m.count)
+	return nil
+}
+
+// validate checks the header, trailer and index bounds of the mapped data
+func (m *mapped) validate(codec Codec) error {
+	data := m.data
+	if string(data[:len(mappedMagic)]) != mappedMagic || string(data[len(data)-len(mappedMagic):]) != mappedMagic {
+		return fmt.Errorf("%w: not a mapped snapshot", ErrCorruptSnapshot)
+	}
+	if version := data[len(mappedMagic)]; version != mappedVersion {
+		return fmt.Errorf("%w: mapped snapshot version %d", ErrUnsupportedSnapshot, version)
+	}
+	headerLen := len(mappedMagic) + 2 + int(data[len(mappedMagic)+1])
+	if headerLen > len(data)-mappedTrailer {
+		return fmt.Errorf("%w: truncated mapped snapshot header", ErrCorruptSnapshot)
+	}
+	if name := string(data[len(mappedMagic)+2 : headerLen]); name != codec.Name() {
+		return fmt.Errorf("%w: encoded by %q codec, reading with %q codec", ErrUnsupportedSnapshot, name, codec.Name())
+	}
+	trailer := data[len(data)-mappedTrailer:]
+	offset, count := binary.BigEndian.Uint64(trailer), binary.BigEndian.Uint64(trailer[8:])
+	end := uint64(len(data) - mappedTrailer)
+	if offset < uint64(headerLen) || offset > end || (end-offset)/mappedIndexEntry != count || (end-offset)%mappedIndexEntry != 0 {
+		return fmt.Errorf("%w: mapped snapshot index out of bounds", ErrCorruptSnapshot)
+	}
+	m.index, m.count = data[offset:end], count
+	return nil
+}
+
+// lookup returns the expiration and encoded value of key, f is called with the read lock held as the value aliases the mapping
+func (m *mapped) lookup(key string, f func(expire int64, value []byte) error) (ok bool, err error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	key, ok = strings.CutPrefix(key, m.prefix)
+	if !ok || m.count == 0 {
+		return false, nil
+	}
+	h := xxh3.HashString(key)
+	hash := func(i uint64) uint64 {
+		return binary.BigEndian.Uint64(m.index[i*mappedIndexEntry:])
+	}
+	lo, hi := uint64(0), m.count
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		if hash(mid) < h {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	for i := lo; i < m.count && hash(i) == h; i++ {
+		off := binary.BigEndian.Uint64(m.index[i*mappedIndexEntry+8:])
+		k, expire, value, err := m.entry(off)
+		if err != nil {
+			return false, err
+		}
+		if k == key {
+			if f == nil {
+				return true, nil
+			}
+			return true, f(expire, value)
+		}
+	}
+	return false, nil
+}
+
+// entry decodes the entry at off, the returned key and value alias the mapping
+func (m *mapped) entry(off uint64) (key string, expire int64, value []byte, err error) {
+	if off >= uint64(len(m.data)) {
+		return "", 0, nil, fmt.Errorf("%w: entry offset %d out of bounds", ErrCorruptSnapshot, off)
+	}
+	b := m.data[off:]
+	l, n := binary.Uvarint(b)
+	if n <= 0 || l > uint64(len(b)-n) {
+		return "", 0, nil, fmt.Errorf("%w: entry at %d truncated", ErrCorruptSnapshot, off)
+	}
+	b = b[n:]
+	k := b[:l]
+	b = b[l:]
+	if len(b) < 8 {
+		return "", 0, nil, fmt.Errorf("%w: entry at %d truncated", ErrCorruptSnapshot, off)
+	}
+	expire = int64(binary.BigEndian.Uint64(b))
+	b = b[8:]
+	l, n = binary.Uvarint(b)
+	if n <= 0 || l > uint64(len(b)-n) {
+		return "", 0, nil, fmt.Errorf("%w: entry at %d truncated", ErrCorruptSnapshot, off)
+	}
+	return string(k), expire, b[n : n+int(l)], nil
+}
+
+// loadMapped decodes key from the mapped snapshot into memory on a miss
+func (g *gache[V]) loadMapped(shard *Map[string, *value[V]], key string) (v V, expire int64, ok bool) {
+	m := g.mapped.Load()
+	if m == nil {
+		return v, 0, false
+	}
+	if _, shadowed := g.shadowed.Load(key); shadowed {
+		return v, 0, false
+	}
+	found, err := m.lookup(key, func(exp int64, b []byte) error {
+		expire = exp
+		if exp > 0 && exp < fastime.UnixNanoNow() {
+			return nil
+		}
+		ok = true
+		// decoded from a copy so no codec keeps a reference into the mapping after CloseMapped
+		return g.snapshotCodec().Unmarshal(bytes.Clone(b), &v)
+	})
+	if err != nil {
+		g.log(context.Background(), slog.LevelWarn, "gache: mapped snapshot read failed", "key", key, "error", err)
+		g.shadowed.Store(key, true)
+		return v, 0, false
+	}
+	if !found || !ok {
+		return v, 0, false
+	}
+	_, ok = g.update(shard, key, func(old *value[V]) (*value[V], bool) {
+		if old != nil && g.valid(old) {
+			return nil, false
+		}
+		return &value[V]{expire: expire, val: v}, true
+	})
+	return v, expire, ok
+}
+
+// shadow hides the mapped snapshot entry of a written or deleted key
+func (g *gache[V]) shadow(key string) {
+	if m := g.mapped.Load(); m != nil {
+		if found, _ := m.lookup(key, nil); found {
+			g.shadowed.Store(key, true)
+		}
+	}
+}
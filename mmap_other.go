@@ -0,0 +1,21 @@
+//go:build !unix
+
+package gache
+
+import (
+	"io"
+	"os"
+)
+
+// mmap reads f into memory on platforms without mmap support
+func mmap(f *os.File, size int) ([]byte, error) {
+	b := make([]byte, size)
+	if _, err := io.ReadFull(f, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func munmap([]byte) error {
+	return nil
+}
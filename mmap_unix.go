@@ -0,0 +1,20 @@
+//go:build unix
+
+package gache
+
+import (
+	"os"
+	"syscall"
+)
+
+// mmap maps size bytes of f read-only
+func mmap(f *os.File, size int) ([]byte, error) {
+	return syscall.Mmap(int(f.Fd()), 0, size, syscall.PROT_READ, syscall.MAP_SHARED)
+}
+
+func munmap(b []byte) error {
+	if b == nil {
+		return nil
+	}
+	return syscall.Munmap(b)
+}
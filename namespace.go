@@ -0,0 +1,711 @@
+package gache
+
+import (
+	"context"
+	"io"
+	"iter"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// namespace is a Gache view prefixing all keys of the shared root gache.
+// Key operations, Range, Clear, Len and snapshots are scoped to the namespace,
+// expiration settings, hooks, the expire daemon and Freeze are shared with the root.
+type namespace[V any] struct {
+	g       *gache[V]
+	prefix  string
+	l       *atomic.Int64
+	lastLen uint64
+}
+
+// keyBuffers pools the buffers prefixed byte slice keys are built in, GetBytes and SetBytes of the root cache do not keep them
+var keyBuffers = sync.Pool{New: func() any { return new([]byte) }}
+
+// namespaceLens counts the stored keys of every prefix a namespace was created for, it is replaced as a whole to add one
+type namespaceLens struct {
+	// sizes are the distinct prefix lengths in ascending order
+	sizes  []int
+	counts map[string]*atomic.Int64
+}
+
+// Namespace returns Gache prefixing all keys with prefix while sharing shards and expire daemon with g.
+// The first namespace of a prefix counts its keys once, then writes of g keep the count of Len. Len may drift
+// when keys of prefix are written while it is counted. Hooks receive prefixed keys and Stats covers the whole cache.
+func (g *gache[V]) Namespace(prefix string) Gache[V] {
+	return &namespace[V]{g: g, prefix: prefix, l: g.namespaceLen(prefix)}
+}
+
+// namespaceLen returns the key counter of prefix, registering and counting it on first use
+func (g *gache[V]) namespaceLen(prefix string) *atomic.Int64 {
+	g.nsMu.Lock()
+	defer g.nsMu.Unlock()
+	cur := g.nsLens.Load()
+	if cur != nil {
+		if c, ok := cur.counts[prefix]; ok {
+			return c
+		}
+	}
+	next := &namespaceLens{counts: map[string]*atomic.Int64{prefix: new(atomic.Int64)}}
+	sizes := map[int]bool{len(prefix): true}
+	if cur != nil {
+		for p, c := range cur.counts {
+			next.counts[p] = c
+			sizes[len(p)] = true
+		}
+	}
+	for size := range sizes {
+		next.sizes = append(next.sizes, size)
+	}
+	slices.Sort(next.sizes)
+	c := next.counts[prefix]
+	g.nsLens.Store(next)
+	// counted like Len, expired keys not yet deleted included
+	for _, shard := range g.shards {
+		for key, val := range shard.RangeIter() {
+			if strings.HasPrefix(key, prefix) && !g.cleared(val) {
+				c.Add(1)
+			}
+		}
+	}
+	return c
+}
+
+// countNamespaces adds delta to the key counters of the namespaces holding key
+func (g *gache[V]) countNamespaces(key string, delta int64) {
+	lens := g.nsLens.Load()
+	if lens == nil {
+		return
+	}
+	for _, size := range lens.sizes {
+		if size > len(key) {
+			return
+		}
+		if c, ok := lens.counts[key[:size]]; ok {
+			c.Add(delta)
+		}
+	}
+}
+
+// resetNamespaces sets the key counters of all namespaces to zero
+func (g *gache[V]) resetNamespaces() {
+	if lens := g.nsLens.Load(); lens != nil {
+		for _, c := range lens.counts {
+			c.Store(0)
+		}
+	}
+}
+
+func (n *namespace[V]) key(key string) string {
+	return n.prefix + key
+}
+
+func (n *namespace[V]) keys(keys []string) []string {
+	pks := make([]string, len(keys))
+	for i, key := range keys {
+		pks[i] = n.prefix + key
+	}
+	return pks
+}
+
+// strip returns key without prefix and whether key belongs to the namespace
+func (n *namespace[V]) strip(key string) (string, bool) {
+	return strings.CutPrefix(key, n.prefix)
+}
+
+func (n *namespace[V]) Namespace(prefix string) Gache[V] {
+	return n.g.Namespace(n.prefix + prefix)
+}
+
+func (n *namespace[V]) Clear() {
+	n.g.DeleteByPrefix(context.Background(), n.prefix)
+}
+
+func (n *namespace[V]) ClearWithHooks(ctx context.Context) uint64 {
+	return n.g.deleteWhere(ctx, func(k string) bool {
+		return strings.HasPrefix(k, n.prefix)
+	}, true)
+}
+
+// LazyClear falls back to Clear because a namespace shares shards with its parent
+func (n *namespace[V]) LazyClear() {
+	n.Clear()
+}
+
+// GetOrLoad passes the prefixed key to the loader of the parent cache
+func (n *namespace[V]) GetOrLoad(ctx context.Context, key string) (V, error) {
+	return n.g.GetOrLoad(ctx, n.key(key))
+}
+
+// GetMultiLoad passes the prefixed keys to the loaders of the parent cache
+func (n *namespace[V]) GetMultiLoad(ctx context.Context, keys []string) (map[string]V, error) {
+	m, err := n.g.GetMultiLoad(ctx, n.keys(keys))
+	return n.unprefix(m), err
+}
+
+func (n *namespace[V]) GetEntry(key string) (Entry[V], bool) {
+	e, ok := n.g.GetEntry(n.key(key))
+	if ok {
+		e.Key = key
+	}
+	return e, ok
+}
+
+func (n *namespace[V]) SetNegative(key string, ttl time.Duration) {
+	n.g.SetNegative(n.key(key), ttl)
+}
+
+func (n *namespace[V]) IsNegative(key string) bool {
+	return n.g.IsNegative(n.key(key))
+}
+
+func (n *namespace[V]) Pin(key string) {
+	n.g.Pin(n.key(key))
+}
+
+func (n *namespace[V]) Unpin(key string) {
+	n.g.Unpin(n.key(key))
+}
+
+func (n *namespace[V]) CompareAndDelete(key string, old V) bool {
+	return n.g.CompareAndDelete(n.key(key), old)
+}
+
+func (n *namespace[V]) CompareAndSwap(key string, old, new V) bool {
+	return n.g.CompareAndSwap(n.key(key), old, new)
+}
+
+func (n *namespace[V]) Delete(key string) (V, bool) {
+	return n.g.Delete(n.key(key))
+}
+
+func (n *namespace[V]) DeleteExpired(ctx context.Context) uint64 {
+	return n.g.DeleteExpired(ctx)
+}
+
+func (n *namespace[V]) DeleteByPrefix(ctx context.Context, prefix string) uint64 {
+	return n.g.DeleteByPrefix(ctx, n.key(prefix))
+}
+
+func (n *namespace[V]) DeleteByPattern(ctx context.Context, pattern string) uint64 {
+	return n.g.DeleteByRegexp(ctx, n.glob(pattern))
+}
+
+// glob returns regexp matching prefixed keys of the glob pattern
+func (n *namespace[V]) glob(pattern string) *regexp.Regexp {
+	return regexp.MustCompile("^(?s:" + regexp.QuoteMeta(n.prefix) + globExpr(pattern) + ")$")
+}
+
+func (n *namespace[V]) DeleteByRegexp(ctx context.Context, re *regexp.Regexp) uint64 {
+	return n.g.deleteWhere(ctx, func(key string) bool {
+		key, ok := n.strip(key)
+		return ok && re.MatchString(key)
+	}, false)
+}
+
+func (n *namespace[V]) DeleteMulti(keys []string) uint64 {
+	return n.g.DeleteMulti(n.keys(keys))
+}
+
+func (n *namespace[V]) DisableExpiredHook() Gache[V] {
+	n.g.DisableExpiredHook()
+	return n
+}
+
+func (n *namespace[V]) DistributionScore() float64 {
+	return n.g.DistributionScore()
+}
+
+func (n *namespace[V]) ShardKeys(i int) (keys []string) {
+	for _, key := range n.g.ShardKeys(i) {
+		if key, ok := n.strip(key); ok {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func (n *namespace[V]) ShardLens() []int {
+	return n.g.ShardLens()
+}
+
+func (n *namespace[V]) EnableExpiredHook() Gache[V] {
+	n.g.EnableExpiredHook()
+	return n
+}
+
+func (n *namespace[V]) ExpireAt(key string, t time.Time) bool {
+	return n.g.ExpireAt(n.key(key), t)
+}
+
+func (n *namespace[V]) ExtendExpire(key string, add time.Duration) bool {
+	return n.g.ExtendExpire(n.key(key), add)
+}
+
+func (n *namespace[V]) Freeze() Gache[V] {
+	n.g.Freeze()
+	return n
+}
+
+func (n *namespace[V]) Range(ctx context.Context, f func(string, V, int64) bool) Gache[V] {
+	n.g.Range(ctx, func(key string, val V, exp int64) bool {
+		if key, ok := n.strip(key); ok {
+			return f(key, val, exp)
+		}
+		return true
+	})
+	return n
+}
+
+func (n *namespace[V]) RangeIter() iter.Seq2[string, V] {
+	return func(yield func(string, V) bool) {
+		for key, val := range n.g.RangeIter() {
+			if key, ok := n.strip(key); ok && !yield(key, val) {
+				return
+			}
+		}
+	}
+}
+
+func (n *namespace[V]) RangeIterValue() iter.Seq[V] {
+	return func(yield func(V) bool) {
+		for _, val := range n.RangeIter() {
+			if !yield(val) {
+				return
+			}
+		}
+	}
+}
+
+func (n *namespace[V]) Get(key string) (V, bool) {
+	return n.g.Get(n.key(key))
+}
+
+func (n *namespace[V]) GetBytes(key []byte) (V, bool) {
+	b := keyBuffers.Get().(*[]byte)
+	*b = append(append((*b)[:0], n.prefix...), key...)
+	v, ok := n.g.GetBytes(*b)
+	keyBuffers.Put(b)
+	return v, ok
+}
+
+func (n *namespace[V]) GetWithExpire(key string) (V, int64, bool) {
+	return n.g.GetWithExpire(n.key(key))
+}
+
+func (n *namespace[V]) GetWithIgnoredExpire(key string) (V, bool) {
+	return n.g.GetWithIgnoredExpire(n.key(key))
+}
+
+func (n *namespace[V]) GetWithTTL(key string) (V, time.Duration, bool) {
+	return n.g.GetWithTTL(n.key(key))
+}
+
+func (n *namespace[V]) GetWithVersion(key string) (V, uint64, bool) {
+	return n.g.GetWithVersion(n.key(key))
+}
+
+func (n *namespace[V]) GetMulti(keys []string) map[string]V {
+	return n.unprefix(n.g.GetMulti(n.keys(keys)))
+}
+
+// unprefix returns pm keyed by keys without prefix
+func (n *namespace[V]) unprefix(pm map[string]V) map[string]V {
+	m := make(map[string]V, len(pm))
+	for key, val := range pm {
+		m[key[len(n.prefix):]] = val
+	}
+	return m
+}
+
+func (n *namespace[V]) GetOrdered(keys []string) []Result[V] {
+	res := n.g.GetOrdered(n.keys(keys))
+	for i := range res {
+		res[i].Key = keys[i]
+	}
+	return res
+}
+
+func (n *namespace[V]) GetOrSet(key string, val V) (V, bool) {
+	return n.g.GetOrSet(n.key(key), val)
+}
+
+func (n *namespace[V]) GetRefresh(key string) (V, bool) {
+	return n.g.GetRefresh(n.key(key))
+}
+
+func (n *namespace[V]) GetRefreshWithDur(key string, dur time.Duration) (V, bool) {
+	return n.g.GetRefreshWithDur(n.key(key), dur)
+}
+
+func (n *namespace[V]) GetOrComputeWithRetry(key string, fn func() (V, error), retries int, backoff time.Duration) (V, error) {
+	return n.g.GetOrComputeWithRetry(n.key(key), fn, retries, backoff)
+}
+
+// Handle returns KeyHandle bound to the prefixed key
+func (n *namespace[V]) Handle(key string) KeyHandle[V] {
+	return n.g.Handle(n.key(key))
+}
+
+// InvalidateTag invalidates tag set through this namespace, tags are prefixed like keys
+func (n *namespace[V]) InvalidateTag(tag string) uint64 {
+	return n.g.InvalidateTag(n.key(tag))
+}
+
+func (n *namespace[V]) IsFrozen() bool {
+	return n.g.IsFrozen()
+}
+
+func (n *namespace[V]) Keys(ctx context.Context) []string {
+	var (
+		keys []string
+		mu   sync.Mutex
+	)
+	n.Range(ctx, func(key string, _ V, _ int64) bool {
+		mu.Lock()
+		keys = append(keys, key)
+		mu.Unlock()
+		return true
+	})
+	return keys
+}
+
+func (n *namespace[V]) KeysIter() iter.Seq[string] {
+	return func(yield func(string) bool) {
+		for key := range n.RangeIter() {
+			if !yield(key) {
+				return
+			}
+		}
+	}
+}
+
+func (n *namespace[V]) LastSweep() (time.Time, time.Duration, uint64) {
+	return n.g.LastSweep()
+}
+
+func (n *namespace[V]) LastSweepPerShard() []ShardSweepStat {
+	return n.g.LastSweepPerShard()
+}
+
+// OpenAOF logs the writes of the whole cache
+func (n *namespace[V]) OpenAOF(ctx context.Context, path string) error {
+	return n.g.OpenAOF(ctx, path)
+}
+
+func (n *namespace[V]) CloseAOF() error {
+	return n.g.CloseAOF()
+}
+
+func (n *namespace[V]) CompactAOF(ctx context.Context) error {
+	return n.g.CompactAOF(ctx)
+}
+
+// OpenMapped maps a snapshot written by the WriteMapped of a namespace with the same prefix
+func (n *namespace[V]) OpenMapped(path string) error {
+	return n.g.openMapped(path, n.prefix)
+}
+
+func (n *namespace[V]) CloseMapped() error {
+	return n.g.CloseMapped()
+}
+
+func (n *namespace[V]) LastSave() SaveStatus {
+	return n.g.LastSave()
+}
+
+func (n *namespace[V]) Persist(key string) bool {
+	return n.g.Persist(n.key(key))
+}
+
+func (n *namespace[V]) Pop(key string) (V, bool) {
+	return n.g.Pop(n.key(key))
+}
+
+func (n *namespace[V]) Read(r io.Reader, opts ...ReadOption[V]) error {
+	return n.ReadContext(context.Background(), r, opts...)
+}
+
+func (n *namespace[V]) ReadContext(ctx context.Context, r io.Reader, opts ...ReadOption[V]) error {
+	l := n.g.restorer(opts, n.prefix)
+	expired, err := n.g.readRecords(ctx, r, func(rec record[V]) {
+		rec.Key = n.key(rec.Key)
+		l.store(rec)
+	})
+	return l.done(expired, err)
+}
+
+func (n *namespace[V]) MergeFrom(ctx context.Context, src Gache[V], opts ...ReadOption[V]) error {
+	l := n.g.restorer(opts, n.prefix)
+	for e := range src.Stream(ctx) {
+		l.store(record[V]{Key: n.key(e.Key), Value: e.Value, Expire: e.Expire})
+	}
+	return l.done(0, ctx.Err())
+}
+
+func (n *namespace[V]) ReadTransform(r io.Reader, decode func(V) (V, bool)) error {
+	_, err := n.g.readRecords(context.Background(), r, func(rec record[V]) {
+		if val, ok := decode(rec.Value); ok {
+			n.g.restore(n.key(rec.Key), val, rec.Expire)
+		}
+	})
+	return err
+}
+
+func (n *namespace[V]) ReadWithResolver(r io.Reader, resolve func(string, V, V, int64, int64) (V, int64, bool)) error {
+	strip := func(key string, existing, incoming V, existingExp, incomingExp int64) (V, int64, bool) {
+		return resolve(key[len(n.prefix):], existing, incoming, existingExp, incomingExp)
+	}
+	_, err := n.g.readRecords(context.Background(), r, func(rec record[V]) {
+		rec.Key = n.key(rec.Key)
+		n.g.merge(rec, strip)
+	})
+	return err
+}
+
+func (n *namespace[V]) Set(key string, val V) {
+	n.g.Set(n.key(key), val)
+}
+
+func (n *namespace[V]) SetBytes(key []byte, val V) {
+	b := keyBuffers.Get().(*[]byte)
+	*b = append(append((*b)[:0], n.prefix...), key...)
+	n.g.SetBytes(*b, val)
+	keyBuffers.Put(b)
+}
+
+func (n *namespace[V]) SetDefaultExpire(ex time.Duration) Gache[V] {
+	n.g.SetDefaultExpire(ex)
+	return n
+}
+
+func (n *namespace[V]) SetExpiredHook(f func(context.Context, string, V)) Gache[V] {
+	n.g.SetExpiredHook(f)
+	return n
+}
+
+func (n *namespace[V]) SetEvictedHook(f func(context.Context, string, V, Reason)) Gache[V] {
+	n.g.SetEvictedHook(f)
+	return n
+}
+
+func (n *namespace[V]) SetSetHook(f func(context.Context, string, V, V, bool)) Gache[V] {
+	n.g.SetSetHook(f)
+	return n
+}
+
+func (n *namespace[V]) SetDeleteHook(f func(context.Context, string, V)) Gache[V] {
+	n.g.SetDeleteHook(f)
+	return n
+}
+
+func (n *namespace[V]) Watch(ctx context.Context, pattern string) <-chan Event[V] {
+	events := n.g.watch(ctx, n.glob(pattern))
+	ch := make(chan Event[V], streamBufferSize)
+	go func() {
+		defer close(ch)
+		for e := range events {
+			e.Key, _ = n.strip(e.Key)
+			// events are delivered while ch has room, the forwarder only gives up on a full ch once ctx is done
+			select {
+			case ch <- e:
+				continue
+			default:
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case ch <- e:
+			}
+		}
+	}()
+	return ch
+}
+
+func (n *namespace[V]) Events(since uint64) []Event[V] {
+	var events []Event[V]
+	for _, e := range n.g.Events(since) {
+		if key, ok := n.strip(e.Key); ok {
+			e.Key = key
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+func (n *namespace[V]) SetExpiredHookFilter(f func(string) bool) Gache[V] {
+	n.g.SetExpiredHookFilter(f)
+	return n
+}
+
+func (n *namespace[V]) SetIfNotExists(key string, val V) bool {
+	return n.g.SetIfNotExists(n.key(key), val)
+}
+
+func (n *namespace[V]) SetMulti(kvs map[string]V) {
+	pkvs := make(map[string]V, len(kvs))
+	for key, val := range kvs {
+		pkvs[n.key(key)] = val
+	}
+	n.g.SetMulti(pkvs)
+}
+
+func (n *namespace[V]) SetIfExpiringWithin(key string, val V, window, expire time.Duration) bool {
+	return n.g.SetIfExpiringWithin(n.key(key), val, window, expire)
+}
+
+func (n *namespace[V]) SetIfVersion(key string, val V, expected uint64) bool {
+	return n.g.SetIfVersion(n.key(key), val, expected)
+}
+
+func (n *namespace[V]) SetIfVersionWithExpireAt(key string, val V, expected uint64, t time.Time) bool {
+	return n.g.SetIfVersionWithExpireAt(n.key(key), val, expected, t)
+}
+
+func (n *namespace[V]) SetWithExpire(key string, val V, expire time.Duration) {
+	n.g.SetWithExpire(n.key(key), val, expire)
+}
+
+func (n *namespace[V]) SetWithExpireAt(key string, val V, t time.Time) {
+	n.g.SetWithExpireAt(n.key(key), val, t)
+}
+
+func (n *namespace[V]) SetWithExpireIfNotExists(key string, val V, expire time.Duration) bool {
+	return n.g.SetWithExpireIfNotExists(n.key(key), val, expire)
+}
+
+func (n *namespace[V]) SetWithExpireReturningOld(key string, val V, expire time.Duration) (V, bool) {
+	return n.g.SetWithExpireReturningOld(n.key(key), val, expire)
+}
+
+func (n *namespace[V]) SetWithTags(key string, val V, expire time.Duration, tags ...string) {
+	n.g.SetWithTags(n.key(key), val, expire, n.keys(tags)...)
+}
+
+func (n *namespace[V]) StartExpired(ctx context.Context, dur time.Duration) Gache[V] {
+	n.g.StartExpired(ctx, dur)
+	return n
+}
+
+// StartAutosave saves the entries of the namespace only
+func (n *namespace[V]) StartAutosave(ctx context.Context, interval time.Duration, path string) Gache[V] {
+	n.g.autosave(ctx, interval, path, n.Write)
+	return n
+}
+
+func (n *namespace[V]) Len() int {
+	return int(max(n.l.Load(), 0))
+}
+
+func (n *namespace[V]) LenDelta() int {
+	l := uint64(n.Len())
+	prev := atomic.SwapUint64(&n.lastLen, l)
+	return int(l) - int(prev)
+}
+
+func (n *namespace[V]) Stats() Stats {
+	return n.g.Stats()
+}
+
+func (n *namespace[V]) ResetStats() {
+	n.g.ResetStats()
+}
+
+func (n *namespace[V]) Size() uintptr {
+	return n.g.Size()
+}
+
+func (n *namespace[V]) Digest(ctx context.Context) []uint64 {
+	return n.g.digest(ctx, n.strip)
+}
+
+func (n *namespace[V]) SyncFrom(ctx context.Context, other Gache[V]) (int, error) {
+	return syncFrom(ctx, n, other, func(e Entry[V]) bool {
+		return n.g.storeSynced(n.key(e.Key), e)
+	})
+}
+
+func (n *namespace[V]) Stream(ctx context.Context) <-chan Entry[V] {
+	ch := make(chan Entry[V], streamBufferSize)
+	go func() {
+		defer close(ch)
+		for e := range n.g.Stream(ctx) {
+			key, ok := n.strip(e.Key)
+			if !ok {
+				continue
+			}
+			e.Key = key
+			select {
+			case <-ctx.Done():
+				return
+			case ch <- e:
+			}
+		}
+	}()
+	return ch
+}
+
+func (n *namespace[V]) ToMap(ctx context.Context) *sync.Map {
+	m := new(sync.Map)
+	n.Range(ctx, func(key string, val V, _ int64) bool {
+		m.Store(key, val)
+		return true
+	})
+	return m
+}
+
+func (n *namespace[V]) ToRawMap(ctx context.Context) map[string]V {
+	m := make(map[string]V)
+	mu := new(sync.Mutex)
+	n.Range(ctx, func(key string, val V, _ int64) bool {
+		mu.Lock()
+		m[key] = val
+		mu.Unlock()
+		return true
+	})
+	return m
+}
+
+func (n *namespace[V]) Write(ctx context.Context, w io.Writer) error {
+	return n.g.writeSnapshot(ctx, w, n.strip, nil)
+}
+
+func (n *namespace[V]) WriteTransform(ctx context.Context, w io.Writer, encode func(V) (V, bool)) error {
+	return n.g.writeSnapshot(ctx, w, n.strip, encode)
+}
+
+func (n *namespace[V]) WriteMapped(ctx context.Context, w io.Writer) error {
+	return n.g.writeMapped(ctx, w, n.strip)
+}
+
+func (n *namespace[V]) Stop() {
+	n.g.Stop()
+}
+
+func (n *namespace[V]) Swap(key string, val V) (V, bool) {
+	return n.g.Swap(n.key(key), val)
+}
+
+func (n *namespace[V]) Touch(key string) bool {
+	return n.g.Touch(n.key(key))
+}
+
+func (n *namespace[V]) TouchMany(keys []string, expire time.Duration) uint64 {
+	return n.g.TouchMany(n.keys(keys), expire)
+}
+
+func (n *namespace[V]) TTL(key string) (time.Duration, bool) {
+	return n.g.TTL(n.key(key))
+}
+
+func (n *namespace[V]) Unfreeze() Gache[V] {
+	n.g.Unfreeze()
+	return n
+}
+
+func (n *namespace[V]) Update(key string, fn func(V, bool) (V, bool)) (V, bool) {
+	return n.g.Update(n.key(key), fn)
+}
@@ -0,0 +1,86 @@
+package gache
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/kpango/fastime"
+)
+
+// ErrNotFound is returned by a loader for keys missing in the backend and by GetOrLoad for keys cached as missing
+var ErrNotFound = errors.New("gache: not found")
+
+// SetNegative deletes key and records it as missing for ttl, zero ttl uses default expiration and negative ttl never expires.
+// GetOrLoad returns ErrNotFound for the key without calling the loader until the key is set again.
+func (g *gache[V]) SetNegative(key string, ttl time.Duration) {
+	if g.frozen.Load() || g.rejected(key) {
+		return
+	}
+	g.Delete(key)
+	expire := ttl.Nanoseconds()
+	if ttl == 0 {
+		expire = atomic.LoadInt64(&g.expire)
+	}
+	if _, loaded := g.negatives.Swap(key, absExpire(expire)); !loaded {
+		atomic.AddInt64(&g.negative, 1)
+	}
+}
+
+// IsNegative reports whether key is cached as missing by SetNegative or a loader returning ErrNotFound
+func (g *gache[V]) IsNegative(key string) bool {
+	if atomic.LoadInt64(&g.negative) == 0 {
+		return false
+	}
+	expire, ok := g.negatives.Load(key)
+	if !ok {
+		return false
+	}
+	if expire > 0 && fastime.UnixNanoNow() > expire {
+		g.unnegate(key, expire)
+		return false
+	}
+	return true
+}
+
+// unnegate removes the negative entry of key stored with expire
+func (g *gache[V]) unnegate(key string, expire int64) {
+	if g.negatives.CompareAndDelete(key, expire) {
+		atomic.AddInt64(&g.negative, -1)
+	}
+}
+
+// negated removes the negative entry of key after a value is written
+func (g *gache[V]) negated(key string) {
+	if atomic.LoadInt64(&g.negative) == 0 {
+		return
+	}
+	if _, loaded := g.negatives.LoadAndDelete(key); loaded {
+		atomic.AddInt64(&g.negative, -1)
+	}
+}
+
+// deleteExpiredNegatives removes expired negative entries
+func (g *gache[V]) deleteExpiredNegatives() {
+	if atomic.LoadInt64(&g.negative) == 0 {
+		return
+	}
+	now := fastime.UnixNanoNow()
+	g.negatives.Range(func(key string, expire int64) bool {
+		if expire > 0 && now > expire {
+			g.unnegate(key, expire)
+		}
+		return true
+	})
+}
+
+// notFound caches key as missing when the loader returned ErrNotFound and WithNegativeTTL is set
+func (g *gache[V]) notFound(key string, err error) bool {
+	if !errors.Is(err, ErrNotFound) {
+		return false
+	}
+	if g.negativeTTL != 0 {
+		g.SetNegative(key, time.Duration(g.negativeTTL))
+	}
+	return true
+}
@@ -1,7 +1,12 @@
 package gache
 
 import (
+	"bytes"
 	"context"
+	"expvar"
+	"fmt"
+	"log/slog"
+	"math/bits"
 	"time"
 )
 
@@ -38,3 +43,373 @@ func WithExpiredHookFunc[V any](f func(ctx context.Context, key string, v V)) Op
 		return nil
 	}
 }
+
+// WithShardFunc sets the function selecting the shard index of key, the returned index is masked to the shard range
+func WithShardFunc[V any](f func(key string) int) Option[V] {
+	return func(g *gache[V]) error {
+		if f != nil {
+			g.shardFunc = f
+		}
+		return nil
+	}
+}
+
+// WithHasher sets the function hashing keys to select their shard and count them for WithTinyLFU, xxh3 of the first
+// 256 bytes by default. A hash seeded with hash/maphash.MakeSeed resists hash flooding by crafted keys, snapshots,
+// mapped files and Digest keep using xxh3 so they stay compatible with caches using another hasher.
+func WithHasher[V any](hash func(key string) uint64) Option[V] {
+	return func(g *gache[V]) error {
+		if hash != nil {
+			g.hasher = hash
+		}
+		return nil
+	}
+}
+
+// WithShardCount sets the number of shards, 512 by default. n is rounded up to a power of two and capped to 65536,
+// zero or less keeps the default. Fewer shards save the memory of small caches and more shards reduce lock contention
+// on machines with many cores.
+func WithShardCount[V any](n int) Option[V] {
+	return func(g *gache[V]) error {
+		if n > 0 {
+			n = shardCount(n)
+			g.shards, g.shardMask = make([]*Map[string, *value[V]], n), uint64(n-1)
+		}
+		return nil
+	}
+}
+
+// shardCount rounds n up to a power of two up to maxShardCount
+func shardCount(n int) int {
+	if n >= maxShardCount {
+		return maxShardCount
+	}
+	return 1 << bits.Len(uint(n-1))
+}
+
+// WithRejectEmptyKey makes operations on the empty key no-ops reporting the key as absent
+func WithRejectEmptyKey[V any]() Option[V] {
+	return func(g *gache[V]) error {
+		g.rejectEmptyKey = true
+		return nil
+	}
+}
+
+// WithSweepStats enables per-shard DeleteExpired measurements returned by LastSweepPerShard
+func WithSweepStats[V any]() Option[V] {
+	return func(g *gache[V]) error {
+		g.sweepStats = true
+		return nil
+	}
+}
+
+// WithEntryMetadata enables tracking creation time, last access and hit count of entries returned by GetEntry
+func WithEntryMetadata[V any]() Option[V] {
+	return func(g *gache[V]) error {
+		g.trackEntries = true
+		return nil
+	}
+}
+
+// WithWriteTimestamps enables tracking the time of the last write of entries returned as Entry.UpdatedAt,
+// Digest only reflects the keys and SyncFrom only copies missing keys without it
+func WithWriteTimestamps[V any]() Option[V] {
+	return func(g *gache[V]) error {
+		g.writeTimes = true
+		return nil
+	}
+}
+
+// WithStats enables the hit, miss, set, delete and expired counters returned by Stats
+func WithStats[V any]() Option[V] {
+	return func(g *gache[V]) error {
+		g.stats = new(counters)
+		return nil
+	}
+}
+
+// WithExpvar enables stats and publishes entries and operation counters of the cache under name in expvar,
+// it panics if name is already published as expvar.Publish does
+func WithExpvar[V any](name string) Option[V] {
+	return func(g *gache[V]) error {
+		if g.stats == nil {
+			g.stats = new(counters)
+		}
+		expvar.Publish(name, expvar.Func(func() any {
+			s := g.Stats()
+			return map[string]uint64{
+				"entries": uint64(g.Len()),
+				"hits":    s.Hits,
+				"misses":  s.Misses,
+				"sets":    s.Sets,
+				"deletes": s.Deletes,
+				"expired": s.Expired,
+			}
+		}))
+		return nil
+	}
+}
+
+// WithLogger sets the logger receiving expire daemon, snapshot and dropped hook delivery events
+func WithLogger[V any](l *slog.Logger) Option[V] {
+	return func(g *gache[V]) error {
+		g.logger = l
+		return nil
+	}
+}
+
+// WithCodec sets the codec encoding the snapshots of Write and decoding them in Read, gob is used by default
+func WithCodec[V any](c Codec) Option[V] {
+	return func(g *gache[V]) error {
+		g.codec = c
+		return nil
+	}
+}
+
+// WithSnapshotCompression compresses the snapshots of Write with c, Read detects the compression from the snapshot header.
+// It panics for unknown algorithms.
+func WithSnapshotCompression[V any](c Compression) Option[V] {
+	return func(g *gache[V]) error {
+		if c > Snappy {
+			panic(fmt.Sprintf("gache: unsupported snapshot compression %s", c))
+		}
+		g.compression = c
+		return nil
+	}
+}
+
+// WithSnapshotEncryption encrypts the snapshots of Write with AES-GCM using a 16, 24 or 32 byte key,
+// the header records a key ID so Read rejects snapshots of other keys, Write fails for keys of other lengths
+func WithSnapshotEncryption[V any](key []byte) Option[V] {
+	return func(g *gache[V]) error {
+		g.snapshotKey = bytes.Clone(key)
+		if _, _, err := newAEAD(key); err != nil {
+			return err
+		}
+		return nil
+	}
+}
+
+// WithAutosaveGenerations keeps the n - 1 previous snapshots of StartAutosave next to the current one
+func WithAutosaveGenerations[V any](n int) Option[V] {
+	return func(g *gache[V]) error {
+		if n > 0 {
+			g.generations = n
+		}
+		return nil
+	}
+}
+
+// WithTier spills the entries evicted from memory to t and reads them back into memory on a miss of Get and the methods built on it,
+// the keys and expirations of spilled entries stay in memory so misses of other keys never reach t
+func WithTier[V any](t Tier) Option[V] {
+	return func(g *gache[V]) error {
+		g.tier = t
+		return nil
+	}
+}
+
+// WithAOFSync sets the policy syncing the log of OpenAOF to disk, AOFSyncEverySecond is used by default.
+// It panics for unknown policies.
+func WithAOFSync[V any](s AOFSync) Option[V] {
+	return func(g *gache[V]) error {
+		if s > AOFSyncNever {
+			panic(fmt.Sprintf("gache: unsupported append-only log sync policy %d", s))
+		}
+		g.aofSync = s
+		return nil
+	}
+}
+
+// WithAOFCompaction sets the interval the log of OpenAOF is rewritten from the live entries at
+func WithAOFCompaction[V any](interval time.Duration) Option[V] {
+	return func(g *gache[V]) error {
+		if interval > 0 {
+			g.aofCompaction = interval
+		}
+		return nil
+	}
+}
+
+// WithMaxEntries bounds the cache to n entries, entries chosen by the eviction policy are evicted when it is exceeded
+func WithMaxEntries[V any](n int) Option[V] {
+	return func(g *gache[V]) error {
+		if n > 0 {
+			g.bounded().max = uint64(n)
+		}
+		return nil
+	}
+}
+
+// WithMaxCost bounds the total cost of entries weighed by WithWeigher, entries chosen by the eviction policy are evicted when it is exceeded.
+// Every entry costs 1 without a weigher and entries costing more than max are never stored.
+func WithMaxCost[V any](max int64) Option[V] {
+	return func(g *gache[V]) error {
+		if max > 0 {
+			g.bounded().maxCost = max
+		}
+		return nil
+	}
+}
+
+// WithWeigher sets the function returning the cost of an entry bounded by WithMaxCost, it is called on every write
+func WithWeigher[V any](f func(key string, val V) int64) Option[V] {
+	return func(g *gache[V]) error {
+		if f != nil {
+			g.weigher = f
+		}
+		return nil
+	}
+}
+
+// WithMaxMemory bounds the estimated memory of keys and values to bytes, entries chosen by the eviction policy are evicted when it is exceeded.
+// Values implementing Sizer report their own size, others are measured by reflection on every write, WithWeigher replaces the estimation.
+func WithMaxMemory[V any](bytes int64) Option[V] {
+	return func(g *gache[V]) error {
+		if bytes > 0 {
+			g.bounded().maxCost = bytes
+			if g.weigher == nil {
+				g.weigher = entrySize[V]
+				g.evict.unit = entrySize("", *new(V))
+			}
+		}
+		return nil
+	}
+}
+
+// bounded returns the evictor of g creating it when g was unbounded
+func (g *gache[V]) bounded() *evictor[V] {
+	if g.evict == nil {
+		g.evict = new(evictor[V])
+	}
+	return g.evict
+}
+
+// WithEvictionPolicy sets the policy choosing entries evicted by WithMaxEntries and WithMaxCost, LRU is used by default.
+// Bounds above 2048 are split between policies tracking groups of shards, victims are then the least recent or frequent of their group.
+func WithEvictionPolicy[V any](p EvictionPolicy) Option[V] {
+	return func(g *gache[V]) error {
+		g.evictPolicy = p
+		return nil
+	}
+}
+
+// WithTinyLFU enables a TinyLFU admission filter in front of WithMaxEntries and WithMaxCost,
+// a new key is only admitted when its estimated frequency is higher than the one of the entry it would evict.
+// Refused keys are counted as Stats.Rejections and do not call the evicted hook.
+func WithTinyLFU[V any]() Option[V] {
+	return func(g *gache[V]) error {
+		g.tinyLFU = true
+		return nil
+	}
+}
+
+// WithEventHistory keeps the last n events of the cache returned by Events
+func WithEventHistory[V any](n int) Option[V] {
+	return func(g *gache[V]) error {
+		if n > 0 {
+			g.history = &history[V]{
+				events: make([]Event[V], n),
+			}
+		}
+		return nil
+	}
+}
+
+// WithLoader sets the function loading missing keys for GetOrLoad, it returns the value & its expiration where zero uses default expiration
+func WithLoader[V any](f func(ctx context.Context, key string) (V, time.Duration, error)) Option[V] {
+	return func(g *gache[V]) error {
+		g.loader = f
+		return nil
+	}
+}
+
+// WithBatchLoader sets the function loading all missing keys of GetMultiLoad at once, it returns the found values & their expiration where zero uses default expiration
+func WithBatchLoader[V any](f func(ctx context.Context, keys []string) (map[string]V, time.Duration, error)) Option[V] {
+	return func(g *gache[V]) error {
+		g.batchLoader = f
+		return nil
+	}
+}
+
+// WithRefreshAhead reloads entries read within window before their expiration in background using the loader set by WithLoader
+func WithRefreshAhead[V any](window time.Duration) Option[V] {
+	return func(g *gache[V]) error {
+		if window > 0 {
+			g.refreshWindow = window.Nanoseconds()
+		}
+		return nil
+	}
+}
+
+// WithStaleTTL serves entries expired for less than d from Get while the loader set by WithLoader refreshes them in background,
+// DeleteExpired keeps such entries until d has passed
+func WithStaleTTL[V any](d time.Duration) Option[V] {
+	return func(g *gache[V]) error {
+		if d > 0 {
+			g.staleTTL = d.Nanoseconds()
+		}
+		return nil
+	}
+}
+
+// WithStaleIfError keeps entries for grace after their expiration and returns them from GetOrLoad and GetMultiLoad
+// instead of the error when the loader set by WithLoader fails
+func WithStaleIfError[V any](grace time.Duration) Option[V] {
+	return func(g *gache[V]) error {
+		if grace > 0 {
+			g.staleIfError = grace.Nanoseconds()
+		}
+		return nil
+	}
+}
+
+// WithLoaderRetry retries failed loader calls up to retries times waiting backoff doubled after every attempt up to maxBackoff
+// with jitter,
+// the wait is canceled with the context of GetMultiLoad while the shared loads of GetOrLoad always complete
+func WithLoaderRetry[V any](retries int, backoff, maxBackoff time.Duration) Option[V] {
+	return func(g *gache[V]) error {
+		if retries > 0 {
+			g.retry = &retry{
+				attempts: retries,
+				backoff:  backoff,
+				max:      max(backoff, maxBackoff),
+			}
+		}
+		return nil
+	}
+}
+
+// WithCircuitBreaker fails loads with ErrCircuitOpen after failures consecutive failed loads until cooldown has passed,
+// then a single load probes the backend and closes the circuit on success, WithStaleIfError values are returned instead of the error
+func WithCircuitBreaker[V any](failures int, cooldown time.Duration) Option[V] {
+	return func(g *gache[V]) error {
+		if failures > 0 {
+			g.breaker = &breaker{
+				threshold: failures,
+				cooldown:  cooldown.Nanoseconds(),
+			}
+		}
+		return nil
+	}
+}
+
+// WithNegativeTTL caches keys the loaders report missing with ErrNotFound, or the batch loader leaves out, for ttl
+func WithNegativeTTL[V any](ttl time.Duration) Option[V] {
+	return func(g *gache[V]) error {
+		if ttl > 0 {
+			g.negativeTTL = ttl.Nanoseconds()
+		}
+		return nil
+	}
+}
+
+// WithEqual sets the function comparing values in CompareAndSwap and CompareAndDelete, it is required when V is not comparable
+func WithEqual[V any](f func(a, b V) bool) Option[V] {
+	return func(g *gache[V]) error {
+		if f != nil {
+			g.equal = f
+		}
+		return nil
+	}
+}
@@ -0,0 +1,94 @@
+package otel
+
+import (
+	"context"
+	"time"
+
+	"github.com/ntsd/gache/v2"
+	otelglobal "go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const (
+	opAttr = attribute.Key("gache.operation")
+
+	opGet                   = "Get"
+	opGetWithExpire         = "GetWithExpire"
+	opSet                   = "Set"
+	opSetWithExpire         = "SetWithExpire"
+	opDelete                = "Delete"
+	opGetOrComputeWithRetry = "GetOrComputeWithRetry"
+)
+
+// instruments holds the metric instruments of Cache
+type instruments struct {
+	duration     metric.Float64Histogram
+	hits         metric.Int64Counter
+	misses       metric.Int64Counter
+	registration metric.Registration
+}
+
+// newInstruments creates the instruments of meter, errors are reported to the global error handler
+func newInstruments[V any](meter metric.Meter, g gache.Gache[V]) *instruments {
+	var (
+		m   instruments
+		err error
+	)
+	if m.duration, err = meter.Float64Histogram("gache.operation.duration",
+		metric.WithUnit("s"),
+		metric.WithDescription("Duration of cache operations.")); err != nil {
+		otelglobal.Handle(err)
+	}
+	if m.hits, err = meter.Int64Counter("gache.hits",
+		metric.WithDescription("Number of lookups finding a live entry.")); err != nil {
+		otelglobal.Handle(err)
+	}
+	if m.misses, err = meter.Int64Counter("gache.misses",
+		metric.WithDescription("Number of lookups finding no live entry.")); err != nil {
+		otelglobal.Handle(err)
+	}
+	entries, err := meter.Int64ObservableGauge("gache.entries",
+		metric.WithDescription("Number of entries stored in the cache."))
+	if err != nil {
+		otelglobal.Handle(err)
+		return &m
+	}
+	if m.registration, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		o.ObserveInt64(entries, int64(g.Len()))
+		return nil
+	}, entries); err != nil {
+		otelglobal.Handle(err)
+	}
+	return &m
+}
+
+// Close unregisters the entries gauge callback, the Cache keeps working without it
+func (c *Cache[V]) Close() error {
+	if c.metrics == nil || c.metrics.registration == nil {
+		return nil
+	}
+	return c.metrics.registration.Unregister()
+}
+
+// measure records the duration of op started at start
+func (c *Cache[V]) measure(ctx context.Context, op string, start time.Time) {
+	if c.metrics == nil || c.metrics.duration == nil {
+		return
+	}
+	c.metrics.duration.Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(opAttr.String(op)))
+}
+
+// lookup counts the hit or miss of op
+func (c *Cache[V]) lookup(ctx context.Context, op string, hit bool) {
+	if c.metrics == nil {
+		return
+	}
+	counter := c.metrics.misses
+	if hit {
+		counter = c.metrics.hits
+	}
+	if counter != nil {
+		counter.Add(ctx, 1, metric.WithAttributes(opAttr.String(op)))
+	}
+}
@@ -0,0 +1,61 @@
+package otel
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ntsd/gache/v2"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestCacheMetrics(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	c := New(gache.New[int](), WithMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))))
+	defer c.Close()
+	ctx := context.Background()
+	c.Set(ctx, "key", 1)
+	c.Get(ctx, "key")
+	c.Get(ctx, "key")
+	c.Get(ctx, "missing")
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(ctx, &rm); err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]metricdata.Aggregation{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			got[m.Name] = m.Data
+		}
+	}
+	sum := func(name string) int64 {
+		data, ok := got[name].(metricdata.Sum[int64])
+		if !ok {
+			t.Fatalf("%s is not recorded", name)
+		}
+		var n int64
+		for _, dp := range data.DataPoints {
+			n += dp.Value
+		}
+		return n
+	}
+	if hits, misses := sum("gache.hits"), sum("gache.misses"); hits != 2 || misses != 1 {
+		t.Fatalf("hits = %d, misses = %d", hits, misses)
+	}
+	entries, ok := got["gache.entries"].(metricdata.Gauge[int64])
+	if !ok || len(entries.DataPoints) != 1 || entries.DataPoints[0].Value != 1 {
+		t.Fatalf("entries = %+v", got["gache.entries"])
+	}
+	duration, ok := got["gache.operation.duration"].(metricdata.Histogram[float64])
+	if !ok {
+		t.Fatal("gache.operation.duration is not recorded")
+	}
+	var ops uint64
+	for _, dp := range duration.DataPoints {
+		ops += dp.Count
+	}
+	if ops != 4 {
+		t.Fatalf("recorded %d operation durations", ops)
+	}
+}
@@ -0,0 +1,261 @@
+// Package otel provides OpenTelemetry integration for gache.
+// It lives in its own module so the core gache package stays free of the OpenTelemetry dependency.
+package otel
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/ntsd/gache/v2"
+	"github.com/zeebo/xxh3"
+	otelglobal "go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// ScopeName is the instrumentation scope name used for the default tracer
+	ScopeName = "github.com/ntsd/gache/v2/otel"
+
+	keyAttr     = attribute.Key("gache.key")
+	keyHashAttr = attribute.Key("gache.key_hash")
+	hitAttr     = attribute.Key("gache.hit")
+	attemptAttr = attribute.Key("gache.attempt")
+	errorAttr   = attribute.Key("gache.error")
+)
+
+type (
+	// Cache wraps Gache with context-aware operations recording spans when the context carries one
+	Cache[V any] struct {
+		g       gache.Gache[V]
+		tracer  trace.Tracer
+		hashKey bool
+		events  bool
+		metrics *instruments
+	}
+
+	// Option configures Cache
+	Option func(*config)
+
+	config struct {
+		tracer  trace.Tracer
+		hashKey bool
+		events  bool
+		meter   metric.Meter
+	}
+
+	// eventSpan records an operation as an event of the span carried by the context instead of a child span
+	eventSpan struct {
+		trace.Span
+		name  string
+		attrs []attribute.KeyValue
+	}
+)
+
+// WithTracer sets the tracer used to record spans, the global tracer provider is used by default
+func WithTracer(tracer trace.Tracer) Option {
+	return func(c *config) {
+		if tracer != nil {
+			c.tracer = tracer
+		}
+	}
+}
+
+// WithMeterProvider records operation durations, hits, misses and entries as instruments of a meter from mp
+func WithMeterProvider(mp metric.MeterProvider) Option {
+	return func(c *config) {
+		if mp != nil {
+			c.meter = mp.Meter(ScopeName)
+		}
+	}
+}
+
+// WithTracerProvider sets the provider of the tracer used to record spans
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(c *config) {
+		if tp != nil {
+			c.tracer = tp.Tracer(ScopeName)
+		}
+	}
+}
+
+// WithSpanEvents records operations as events on the span carried by the context instead of child spans,
+// compute attempts of GetOrComputeWithRetry are still recorded as child spans
+func WithSpanEvents() Option {
+	return func(c *config) {
+		c.events = true
+	}
+}
+
+// WithHashedKeys records xxh3 hashes of keys instead of the raw keys
+func WithHashedKeys() Option {
+	return func(c *config) {
+		c.hashKey = true
+	}
+}
+
+// New returns Cache tracing operations of g and recording metrics when WithMeterProvider is set
+func New[V any](g gache.Gache[V], opts ...Option) *Cache[V] {
+	c := new(config)
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.tracer == nil {
+		c.tracer = otelglobal.Tracer(ScopeName)
+	}
+	cache := &Cache[V]{
+		g:       g,
+		tracer:  c.tracer,
+		hashKey: c.hashKey,
+		events:  c.events,
+	}
+	if c.meter != nil {
+		cache.metrics = newInstruments(c.meter, g)
+	}
+	return cache
+}
+
+// Unwrap returns the wrapped Gache
+func (c *Cache[V]) Unwrap() gache.Gache[V] {
+	return c.g
+}
+
+// Get returns value & exists from key
+func (c *Cache[V]) Get(ctx context.Context, key string) (v V, ok bool) {
+	span, traced := c.start(ctx, "gache.Get", key)
+	defer c.measure(ctx, opGet, time.Now())
+	v, ok = c.g.Get(key)
+	c.lookup(ctx, opGet, ok)
+	if traced {
+		span.SetAttributes(hitAttr.Bool(ok))
+		span.End()
+	}
+	return v, ok
+}
+
+// GetWithExpire returns value & expire & exists from key
+func (c *Cache[V]) GetWithExpire(ctx context.Context, key string) (v V, expire int64, ok bool) {
+	span, traced := c.start(ctx, "gache.GetWithExpire", key)
+	defer c.measure(ctx, opGetWithExpire, time.Now())
+	v, expire, ok = c.g.GetWithExpire(key)
+	c.lookup(ctx, opGetWithExpire, ok)
+	if traced {
+		span.SetAttributes(hitAttr.Bool(ok))
+		span.End()
+	}
+	return v, expire, ok
+}
+
+// Set sets key-value to Gache using default expiration
+func (c *Cache[V]) Set(ctx context.Context, key string, val V) {
+	span, traced := c.start(ctx, "gache.Set", key)
+	defer c.measure(ctx, opSet, time.Now())
+	c.g.Set(key, val)
+	if traced {
+		span.End()
+	}
+}
+
+// SetWithExpire sets key-value & expiration to Gache
+func (c *Cache[V]) SetWithExpire(ctx context.Context, key string, val V, expire time.Duration) {
+	span, traced := c.start(ctx, "gache.SetWithExpire", key)
+	defer c.measure(ctx, opSetWithExpire, time.Now())
+	c.g.SetWithExpire(key, val, expire)
+	if traced {
+		span.End()
+	}
+}
+
+// Delete deletes value from Gache using key
+func (c *Cache[V]) Delete(ctx context.Context, key string) (v V, loaded bool) {
+	span, traced := c.start(ctx, "gache.Delete", key)
+	defer c.measure(ctx, opDelete, time.Now())
+	v, loaded = c.g.Delete(key)
+	if traced {
+		span.SetAttributes(hitAttr.Bool(loaded))
+		span.End()
+	}
+	return v, loaded
+}
+
+// GetOrComputeWithRetry returns value of key or computes it using fn, every fn attempt is recorded as a child span
+func (c *Cache[V]) GetOrComputeWithRetry(ctx context.Context, key string, fn func(context.Context) (V, error), retries int, backoff time.Duration) (v V, err error) {
+	span, traced := c.start(ctx, "gache.GetOrComputeWithRetry", key)
+	defer c.measure(ctx, opGetOrComputeWithRetry, time.Now())
+	if !traced {
+		hit := true
+		v, err = c.g.GetOrComputeWithRetry(key, func() (V, error) {
+			hit = false
+			return fn(ctx)
+		}, retries, backoff)
+		c.lookup(ctx, opGetOrComputeWithRetry, hit)
+		return v, err
+	}
+	defer span.End()
+
+	hit := true
+	attempt := 0
+	sctx := trace.ContextWithSpan(ctx, span)
+	v, err = c.g.GetOrComputeWithRetry(key, func() (V, error) {
+		hit = false
+		attempt++
+		cctx, cspan := c.tracer.Start(sctx, "gache.compute", trace.WithAttributes(attemptAttr.Int(attempt)))
+		defer cspan.End()
+		v, err := fn(cctx)
+		if err != nil {
+			cspan.RecordError(err)
+			cspan.SetStatus(codes.Error, err.Error())
+		}
+		return v, err
+	}, retries, backoff)
+	c.lookup(ctx, opGetOrComputeWithRetry, hit)
+	span.SetAttributes(hitAttr.Bool(hit))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return v, err
+}
+
+// start starts a span for op only when ctx already carries a span
+func (c *Cache[V]) start(ctx context.Context, op, key string) (span trace.Span, traced bool) {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return nil, false
+	}
+	if c.events {
+		return &eventSpan{
+			Span:  trace.SpanFromContext(ctx),
+			name:  op,
+			attrs: []attribute.KeyValue{c.keyAttribute(key)},
+		}, true
+	}
+	_, span = c.tracer.Start(ctx, op, trace.WithAttributes(c.keyAttribute(key)))
+	return span, true
+}
+
+// SetAttributes sets attributes of the event
+func (s *eventSpan) SetAttributes(kv ...attribute.KeyValue) {
+	s.attrs = append(s.attrs, kv...)
+}
+
+// SetStatus records an error status as an attribute of the event, leaving the status of the carrying span untouched
+func (s *eventSpan) SetStatus(code codes.Code, description string) {
+	if code == codes.Error {
+		s.attrs = append(s.attrs, errorAttr.String(description))
+	}
+}
+
+// End adds the event to the carrying span
+func (s *eventSpan) End(...trace.SpanEndOption) {
+	s.Span.AddEvent(s.name, trace.WithAttributes(s.attrs...))
+}
+
+func (c *Cache[V]) keyAttribute(key string) attribute.KeyValue {
+	if c.hashKey {
+		return keyHashAttr.String(strconv.FormatUint(xxh3.HashString(key), 16))
+	}
+	return keyAttr.String(key)
+}
@@ -0,0 +1,129 @@
+package otel
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ntsd/gache/v2"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func newTraced(opts ...Option) (*Cache[int], *tracetest.SpanRecorder, context.Context) {
+	sr := tracetest.NewSpanRecorder()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)).Tracer("test")
+	ctx, _ := tracer.Start(context.Background(), "request")
+	return New(gache.New[int](), append(opts, WithTracer(tracer))...), sr, ctx
+}
+
+func attr(s sdktrace.ReadOnlySpan, key string) (string, bool) {
+	for _, kv := range s.Attributes() {
+		if string(kv.Key) == key {
+			return kv.Value.Emit(), true
+		}
+	}
+	return "", false
+}
+
+func TestCacheSpans(t *testing.T) {
+	c, sr, ctx := newTraced()
+	c.Set(ctx, "key", 1)
+	c.Get(ctx, "key")
+	c.Get(ctx, "missing")
+	c.Get(context.Background(), "untraced")
+
+	spans := sr.Ended()
+	if len(spans) != 3 {
+		t.Fatalf("recorded %d spans", len(spans))
+	}
+	for i, want := range []struct{ name, key, hit string }{
+		{"gache.Set", "key", ""},
+		{"gache.Get", "key", "true"},
+		{"gache.Get", "missing", "false"},
+	} {
+		if spans[i].Name() != want.name {
+			t.Errorf("span %d name = %s, want %s", i, spans[i].Name(), want.name)
+		}
+		if k, _ := attr(spans[i], "gache.key"); k != want.key {
+			t.Errorf("span %d key = %s, want %s", i, k, want.key)
+		}
+		if h, _ := attr(spans[i], "gache.hit"); h != want.hit {
+			t.Errorf("span %d hit = %s, want %s", i, h, want.hit)
+		}
+	}
+}
+
+func TestCacheHashedKeys(t *testing.T) {
+	c, sr, ctx := newTraced(WithHashedKeys())
+	c.Set(ctx, "secret", 1)
+	s := sr.Ended()[0]
+	if _, ok := attr(s, "gache.key"); ok {
+		t.Fatal("raw key was recorded")
+	}
+	if h, ok := attr(s, "gache.key_hash"); !ok || h == "" {
+		t.Fatal("key hash was not recorded")
+	}
+}
+
+func TestCacheComputeSpans(t *testing.T) {
+	c, sr, ctx := newTraced()
+	calls := 0
+	v, err := c.GetOrComputeWithRetry(ctx, "key", func(context.Context) (int, error) {
+		calls++
+		if calls == 1 {
+			return 0, errors.New("failed")
+		}
+		return 42, nil
+	}, 1, 0)
+	if err != nil || v != 42 {
+		t.Fatalf("GetOrComputeWithRetry = %d, %v", v, err)
+	}
+	spans := sr.Ended()
+	if len(spans) != 3 {
+		t.Fatalf("recorded %d spans", len(spans))
+	}
+	parent := spans[2]
+	if parent.Name() != "gache.GetOrComputeWithRetry" {
+		t.Fatalf("parent span = %s", parent.Name())
+	}
+	if h, _ := attr(parent, "gache.hit"); h != "false" {
+		t.Fatalf("parent hit = %s", h)
+	}
+	for _, s := range spans[:2] {
+		if s.Name() != "gache.compute" || s.Parent().SpanID() != parent.SpanContext().SpanID() {
+			t.Fatalf("compute span %s is not a child of the operation span", s.Name())
+		}
+	}
+}
+
+func TestCacheSpanEvents(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+	ctx, span := tp.Tracer("test").Start(context.Background(), "request")
+	c := New(gache.New[int](), WithTracerProvider(tp), WithSpanEvents(), WithHashedKeys())
+	c.Set(ctx, "key", 1)
+	c.Get(ctx, "key")
+	span.End()
+
+	spans := sr.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("recorded %d spans", len(spans))
+	}
+	events := spans[0].Events()
+	if len(events) != 2 || events[0].Name != "gache.Set" || events[1].Name != "gache.Get" {
+		t.Fatalf("events = %+v", events)
+	}
+	var hashed, hit bool
+	for _, kv := range events[1].Attributes {
+		switch kv.Key {
+		case keyHashAttr:
+			hashed = kv.Value.AsString() != ""
+		case hitAttr:
+			hit = kv.Value.AsBool()
+		}
+	}
+	if !hashed || !hit {
+		t.Fatalf("Get event attributes = %v", events[1].Attributes)
+	}
+}
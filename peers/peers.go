@@ -0,0 +1,210 @@
+// Package peers distributes the loads of a gache across a fleet of processes like groupcache. Every key is owned
+// by one peer picked on a consistent hash Ring, a miss for a key owned by another peer fetches it from that peer
+// which loads it from origin, so concurrent misses across the fleet share a single origin load.
+//
+//	pool := peers.New[V]("http://10.0.0.1:8080/_gache")
+//	g := gache.New(gache.WithLoader(pool.Loader(origin)))
+//	http.Handle("/_gache/", http.StripPrefix("/_gache", pool.Handler(g)))
+//	pool.Set("http://10.0.0.1:8080/_gache", "http://10.0.0.2:8080/_gache")
+//
+// Values fetched from a peer are stored locally with the remaining lifetime of the owner's copy.
+package peers
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ntsd/gache/v2"
+)
+
+// HeaderTTL carries the remaining lifetime of a fetched value, it is absent for values without expiration
+const HeaderTTL = "X-Gache-TTL"
+
+type (
+	// Option configures New
+	Option func(*config)
+
+	config struct {
+		client   *http.Client
+		codec    gache.Codec
+		replicas int
+	}
+
+	// Pool picks the peer owning a key and fetches keys from peers over HTTP
+	Pool[V any] struct {
+		self string
+		ring *Ring
+		config
+	}
+
+	// gobCodec is the default Codec
+	gobCodec struct{}
+
+	// forwarded marks the context of a load requested by a peer, it is loaded from origin whoever the ring picks
+	forwarded struct{}
+)
+
+// WithHTTPClient sets the client fetching from peers, http.DefaultClient by default
+func WithHTTPClient(c *http.Client) Option {
+	return func(o *config) {
+		if c != nil {
+			o.client = c
+		}
+	}
+}
+
+// WithCodec sets the codec encoding values on the wire, all peers must use the same one, gob by default
+func WithCodec(c gache.Codec) Option {
+	return func(o *config) {
+		if c != nil {
+			o.codec = c
+		}
+	}
+}
+
+// WithReplicas sets the number of virtual nodes of each peer on the ring, DefaultReplicas by default
+func WithReplicas(n int) Option {
+	return func(o *config) {
+		o.replicas = n
+	}
+}
+
+// New returns a Pool for the process reachable by peers at the base URL self, add the fleet with Set
+func New[V any](self string, opts ...Option) *Pool[V] {
+	p := &Pool[V]{self: strings.TrimSuffix(self, "/"), config: config{client: http.DefaultClient, codec: gobCodec{}}}
+	for _, opt := range opts {
+		opt(&p.config)
+	}
+	p.ring = NewRing(p.replicas)
+	p.ring.Add(p.self)
+	return p
+}
+
+// Set replaces the peers with the base URLs of peers, they should include self and be the same on every peer
+func (p *Pool[V]) Set(peers ...string) {
+	nodes := make([]string, len(peers))
+	for i, peer := range peers {
+		nodes[i] = strings.TrimSuffix(peer, "/")
+	}
+	p.ring.Set(nodes...)
+}
+
+// Peers returns the base URLs of the peers
+func (p *Pool[V]) Peers() []string {
+	return p.ring.Nodes()
+}
+
+// Owner returns the base URL of the peer owning key and whether it is this process
+func (p *Pool[V]) Owner(key string) (peer string, self bool) {
+	peer, ok := p.ring.Get(key)
+	if !ok {
+		return p.self, true
+	}
+	return peer, peer == p.self
+}
+
+// Loader returns the loader for WithLoader, keys owned by this process or requested by a peer are loaded by origin
+// and the others are fetched from their owner. An unreachable owner falls back to origin so peers failing only
+// cost the deduplication.
+func (p *Pool[V]) Loader(origin func(ctx context.Context, key string) (V, time.Duration, error)) func(context.Context, string) (V, time.Duration, error) {
+	return func(ctx context.Context, key string) (V, time.Duration, error) {
+		peer, self := p.Owner(key)
+		if self || ctx.Value(forwarded{}) != nil {
+			return origin(ctx, key)
+		}
+		v, ttl, err := p.fetch(ctx, peer, key)
+		var unreachable *url.Error
+		if errors.As(err, &unreachable) && ctx.Err() == nil {
+			return origin(ctx, key)
+		}
+		return v, ttl, err
+	}
+}
+
+// Handler returns the handler serving the keys of g to peers with GetOrLoad, mount it at the base URL of self
+func (p *Pool[V]) Handler(g gache.Gache[V]) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{key...}", func(w http.ResponseWriter, r *http.Request) {
+		key := r.PathValue("key")
+		v, err := g.GetOrLoad(context.WithValue(r.Context(), forwarded{}, true), key)
+		if errors.Is(err, gache.ErrNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		b, err := p.codec.Marshal(v)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if ttl, ok := g.TTL(key); ok && ttl != gache.NoTTL {
+			w.Header().Set(HeaderTTL, ttl.String())
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write(b)
+	})
+	return mux
+}
+
+// fetch gets key from peer, the returned ttl is NoTTL for values without expiration
+func (p *Pool[V]) fetch(ctx context.Context, peer, key string) (v V, ttl time.Duration, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, peer+"/"+url.PathEscape(key), nil)
+	if err != nil {
+		return v, 0, err
+	}
+	res, err := p.client.Do(req)
+	if err != nil {
+		return v, 0, err
+	}
+	defer res.Body.Close()
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		return v, 0, err
+	}
+	switch res.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return v, 0, gache.ErrNotFound
+	default:
+		return v, 0, fmt.Errorf("peers: %s: %s: %s", peer, res.Status, bytes.TrimSpace(b))
+	}
+	if err := p.codec.Unmarshal(b, &v); err != nil {
+		return v, 0, err
+	}
+	ttl = gache.NoTTL
+	if h := res.Header.Get(HeaderTTL); h != "" {
+		if ttl, err = time.ParseDuration(h); err != nil {
+			return v, 0, err
+		}
+		// an owner copy about to expire must not be stored without expiration by a zero ttl
+		ttl = max(ttl, time.Nanosecond)
+	}
+	return v, ttl, nil
+}
+
+func (gobCodec) Name() string {
+	return "gob"
+}
+
+func (gobCodec) Marshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gobCodec) Unmarshal(data []byte, v any) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
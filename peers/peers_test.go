@@ -0,0 +1,118 @@
+package peers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ntsd/gache/v2"
+)
+
+type fleet struct {
+	pools  []*Pool[string]
+	caches []gache.Gache[string]
+	urls   []string
+	loads  atomic.Int64
+}
+
+func newFleet(t *testing.T, n int) *fleet {
+	t.Helper()
+	f := &fleet{}
+	origin := func(_ context.Context, key string) (string, time.Duration, error) {
+		f.loads.Add(1)
+		if strings.HasPrefix(key, "missing") {
+			return "", 0, gache.ErrNotFound
+		}
+		return "v" + key, time.Hour, nil
+	}
+	for range n {
+		var h http.Handler
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h.ServeHTTP(w, r)
+		}))
+		t.Cleanup(srv.Close)
+		p := New[string](srv.URL + "/_gache/")
+		g := gache.New(gache.WithLoader(p.Loader(origin)))
+		mux := http.NewServeMux()
+		mux.Handle("/_gache/", http.StripPrefix("/_gache", p.Handler(g)))
+		h = mux
+		f.pools = append(f.pools, p)
+		f.caches = append(f.caches, g)
+		f.urls = append(f.urls, srv.URL+"/_gache")
+	}
+	for _, p := range f.pools {
+		p.Set(f.urls...)
+	}
+	return f
+}
+
+func TestPool(t *testing.T) {
+	f := newFleet(t, 3)
+	ctx := context.Background()
+
+	// every process misses every key concurrently, each key is loaded from origin once fleet wide
+	const keys = 30
+	var wg sync.WaitGroup
+	for _, g := range f.caches {
+		for i := range keys {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				key := "key/" + strconv.Itoa(i)
+				if v, err := g.GetOrLoad(ctx, key); err != nil || v != "v"+key {
+					t.Errorf("GetOrLoad(%s) = %q, %v", key, v, err)
+				}
+			}()
+		}
+	}
+	wg.Wait()
+	if n := f.loads.Load(); n != keys {
+		t.Fatalf("origin loaded %d times, want %d", n, keys)
+	}
+
+	for i, p := range f.pools {
+		owner, self := p.Owner("key/1")
+		if self != (owner == f.urls[i]) {
+			t.Fatalf("Owner of pool %d = %s, %v", i, owner, self)
+		}
+		if _, ttl, ok := f.caches[i].GetWithTTL("key/1"); !ok || ttl <= 59*time.Minute || ttl > 61*time.Minute {
+			t.Fatalf("cache %d TTL of fetched key = %v, %v", i, ttl, ok)
+		}
+	}
+
+	for _, g := range f.caches {
+		if _, err := g.GetOrLoad(ctx, "missing"); !errors.Is(err, gache.ErrNotFound) {
+			t.Fatalf("GetOrLoad(missing) = %v, want ErrNotFound", err)
+		}
+	}
+}
+
+func TestPoolUnreachablePeer(t *testing.T) {
+	f := newFleet(t, 2)
+	// a peer listed on the ring that is not running is skipped for origin
+	dead := httptest.NewServer(http.NotFoundHandler())
+	dead.Close()
+	p := f.pools[0]
+	p.Set(f.urls[0], dead.URL)
+
+	var key string
+	for i := 0; ; i++ {
+		key = strconv.Itoa(i)
+		if owner, _ := p.Owner(key); owner == dead.URL {
+			break
+		}
+	}
+	if v, err := f.caches[0].GetOrLoad(context.Background(), key); err != nil || v != "v"+key {
+		t.Fatalf("GetOrLoad of key owned by dead peer = %q, %v", v, err)
+	}
+	if n := f.loads.Load(); n != 1 {
+		t.Fatalf("origin loaded %d times, want 1", n)
+	}
+}
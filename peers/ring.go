@@ -0,0 +1,139 @@
+package peers
+
+import (
+	"cmp"
+	"slices"
+	"strconv"
+	"sync"
+
+	"github.com/zeebo/xxh3"
+)
+
+// DefaultReplicas is the number of virtual nodes of a node on a Ring created with zero replicas
+const DefaultReplicas = 64
+
+type (
+	// Ring is a consistent hash ring mapping keys to nodes, each node owns replicas points so adding
+	// or removing a node only moves the keys of its points. It is safe for concurrent use.
+	Ring struct {
+		mu       sync.RWMutex
+		replicas int
+		points   []point
+		nodes    map[string]struct{}
+	}
+
+	point struct {
+		hash uint64
+		node string
+	}
+)
+
+// NewRing returns an empty Ring placing replicas virtual nodes per node, DefaultReplicas when replicas is not positive
+func NewRing(replicas int) *Ring {
+	if replicas <= 0 {
+		replicas = DefaultReplicas
+	}
+	return &Ring{replicas: replicas, nodes: make(map[string]struct{})}
+}
+
+// Add adds nodes to the ring, nodes already on it are ignored
+func (r *Ring) Add(nodes ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, node := range nodes {
+		if _, ok := r.nodes[node]; ok {
+			continue
+		}
+		r.nodes[node] = struct{}{}
+		for i := range r.replicas {
+			r.points = append(r.points, point{hash: xxh3.HashString(strconv.Itoa(i) + node), node: node})
+		}
+	}
+	r.sort()
+}
+
+// Remove removes nodes from the ring
+func (r *Ring) Remove(nodes ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, node := range nodes {
+		delete(r.nodes, node)
+	}
+	r.points = slices.DeleteFunc(r.points, func(p point) bool {
+		_, ok := r.nodes[p.node]
+		return !ok
+	})
+}
+
+// Set replaces the nodes of the ring with nodes
+func (r *Ring) Set(nodes ...string) {
+	r.mu.Lock()
+	r.points, r.nodes = r.points[:0], make(map[string]struct{}, len(nodes))
+	r.mu.Unlock()
+	r.Add(nodes...)
+}
+
+// Nodes returns the nodes of the ring sorted
+func (r *Ring) Nodes() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	nodes := make([]string, 0, len(r.nodes))
+	for node := range r.nodes {
+		nodes = append(nodes, node)
+	}
+	slices.Sort(nodes)
+	return nodes
+}
+
+// Len returns the number of nodes of the ring
+func (r *Ring) Len() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.nodes)
+}
+
+// Get returns the node owning key, the first point clockwise of its hash, and false when the ring is empty
+func (r *Ring) Get(key string) (string, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if len(r.points) == 0 {
+		return "", false
+	}
+	return r.points[r.search(xxh3.HashString(key))].node, true
+}
+
+// GetN returns up to n distinct nodes for key in ring order, the owner first, for replicating key on n nodes
+func (r *Ring) GetN(key string, n int) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	n = min(n, len(r.nodes))
+	if n <= 0 {
+		return nil
+	}
+	nodes := make([]string, 0, n)
+	for i, start := 0, r.search(xxh3.HashString(key)); len(nodes) < n; i++ {
+		node := r.points[(start+i)%len(r.points)].node
+		if !slices.Contains(nodes, node) {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
+
+// search returns the index of the first point at or after hash wrapping around the ring
+func (r *Ring) search(hash uint64) int {
+	i, _ := slices.BinarySearchFunc(r.points, hash, func(p point, hash uint64) int {
+		return cmp.Compare(p.hash, hash)
+	})
+	if i == len(r.points) {
+		return 0
+	}
+	return i
+}
+
+// sort orders the points by hash, ties between nodes are broken by name so every process builds the same ring
+func (r *Ring) sort() {
+	slices.SortFunc(r.points, func(a, b point) int {
+		return cmp.Or(cmp.Compare(a.hash, b.hash), cmp.Compare(a.node, b.node))
+	})
+}
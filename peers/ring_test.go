@@ -0,0 +1,64 @@
+package peers
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestRing(t *testing.T) {
+	r := NewRing(0)
+	if _, ok := r.Get("a"); ok {
+		t.Fatal("Get on empty ring succeeded")
+	}
+	r.Add("a", "b", "c", "a")
+	if r.Len() != 3 {
+		t.Fatalf("Len = %d, want 3", r.Len())
+	}
+
+	owners := make(map[string]string)
+	counts := make(map[string]int)
+	for i := range 10000 {
+		key := strconv.Itoa(i)
+		owner, _ := r.Get(key)
+		owners[key] = owner
+		counts[owner]++
+	}
+	for node, n := range counts {
+		if n < 2000 || n > 4700 {
+			t.Fatalf("node %s owns %d of 10000 keys", node, n)
+		}
+	}
+
+	// only the keys of a removed node move, and they come back to it once added again
+	r.Remove("b")
+	for key, owner := range owners {
+		got, _ := r.Get(key)
+		if owner != "b" && got != owner {
+			t.Fatalf("key %s moved from %s to %s", key, owner, got)
+		}
+		if got == "b" {
+			t.Fatalf("key %s owned by removed node", key)
+		}
+	}
+	r.Add("b")
+	for key, owner := range owners {
+		if got, _ := r.Get(key); got != owner {
+			t.Fatalf("key %s owned by %s after re-adding, want %s", key, got, owner)
+		}
+	}
+
+	for key, owner := range owners {
+		nodes := r.GetN(key, 5)
+		if len(nodes) != 3 || nodes[0] != owner || nodes[1] == nodes[2] || nodes[1] == owner || nodes[2] == owner {
+			t.Fatalf("GetN(%s) = %v, owner %s", key, nodes, owner)
+		}
+	}
+
+	r.Set("x")
+	if nodes := r.Nodes(); len(nodes) != 1 || nodes[0] != "x" {
+		t.Fatalf("Nodes after Set = %v", nodes)
+	}
+	if got, _ := r.Get("a"); got != "x" {
+		t.Fatalf("Get after Set = %s", got)
+	}
+}
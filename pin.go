@@ -0,0 +1,65 @@
+package gache
+
+import "sync/atomic"
+
+// Pin exempts key from eviction and expiration until Unpin, the key may be pinned before it is set.
+// Pinned entries stay readable after their expiration, are not counted toward WithMaxCost and can still be deleted explicitly.
+func (g *gache[V]) Pin(key string) {
+	if _, loaded := g.pins.LoadOrStore(key, true); !loaded {
+		atomic.AddInt64(&g.pinned, 1)
+	}
+	shard := g.shard(key)
+	for {
+		val, ok := shard.Load(key)
+		if !ok {
+			return
+		}
+		if val.meta != nil {
+			val.meta.pinned.Store(true)
+			g.forget(key, val)
+			return
+		}
+		pinned := *val
+		pinned.meta = new(entryMeta)
+		pinned.meta.pinned.Store(true)
+		if shard.CompareAndSwap(key, val, &pinned) {
+			g.forget(key, val)
+			return
+		}
+	}
+}
+
+// Unpin makes key evictable and expirable again, the eviction policy tracks it as just written
+func (g *gache[V]) Unpin(key string) {
+	if _, loaded := g.pins.LoadAndDelete(key); !loaded {
+		return
+	}
+	atomic.AddInt64(&g.pinned, -1)
+	val, ok := g.shard(key).Load(key)
+	if !ok || val.meta == nil {
+		return
+	}
+	val.meta.pinned.Store(false)
+	if g.valid(val) {
+		g.admit(key, val, val)
+	}
+}
+
+// pin marks val pinned when key is pinned
+func (g *gache[V]) pin(key string, val *value[V]) {
+	if atomic.LoadInt64(&g.pinned) == 0 {
+		return
+	}
+	if _, ok := g.pins.Load(key); !ok {
+		return
+	}
+	if val.meta == nil {
+		val.meta = new(entryMeta)
+	}
+	val.meta.pinned.Store(true)
+}
+
+// isPinned reports whether val is exempt from eviction and expiration
+func (v *value[V]) isPinned() bool {
+	return v.meta != nil && v.meta.pinned.Load()
+}
@@ -0,0 +1,198 @@
+package rdb
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/ntsd/gache/v2"
+)
+
+// DefaultPipeline is the number of commands ExportRedis sends before reading their replies unless WithPipeline is set
+const DefaultPipeline = 1000
+
+type (
+	// ExportOption configures ExportRedis
+	ExportOption func(*exporter)
+
+	exporter struct {
+		dial     func(ctx context.Context, network, addr string) (net.Conn, error)
+		username string
+		password string
+		db       int
+		pipeline int
+	}
+)
+
+// WithAuth authenticates with AUTH, username may be empty for the default user
+func WithAuth(username, password string) ExportOption {
+	return func(e *exporter) {
+		e.username, e.password = username, password
+	}
+}
+
+// WithSelect writes the entries to database db instead of 0
+func WithSelect(db int) ExportOption {
+	return func(e *exporter) {
+		e.db = db
+	}
+}
+
+// WithPipeline sets the number of commands sent before their replies are read
+func WithPipeline(n int) ExportOption {
+	return func(e *exporter) {
+		if n > 0 {
+			e.pipeline = n
+		}
+	}
+}
+
+// WithDialer sets the function connecting to Redis, for example a tls.Dialer
+func WithDialer(dial func(ctx context.Context, network, addr string) (net.Conn, error)) ExportOption {
+	return func(e *exporter) {
+		if dial != nil {
+			e.dial = dial
+		}
+	}
+}
+
+// ExportRedis writes the live entries of g to the Redis at addr with pipelined SET commands, entries with an expiration
+// are written with PX and their remaining TTL. It returns the number of written entries and stops at the first error reply.
+func ExportRedis[V ~string | ~[]byte](ctx context.Context, g gache.Gache[V], addr string, opts ...ExportOption) (n int, err error) {
+	e := &exporter{
+		dial:     (&net.Dialer{}).DialContext,
+		pipeline: DefaultPipeline,
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	conn, err := e.dial(ctx, "tcp", addr)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	// unblocks reads and writes once ctx is done
+	stop := context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Now())
+	})
+	defer stop()
+
+	w, r := bufio.NewWriter(conn), bufio.NewReader(conn)
+	var setup [][]string
+	if e.password != "" {
+		if e.username != "" {
+			setup = append(setup, []string{"AUTH", e.username, e.password})
+		} else {
+			setup = append(setup, []string{"AUTH", e.password})
+		}
+	}
+	if e.db != 0 {
+		setup = append(setup, []string{"SELECT", strconv.Itoa(e.db)})
+	}
+	for _, cmd := range setup {
+		if err := command(w, cmd...); err != nil {
+			return 0, err
+		}
+		if err := w.Flush(); err != nil {
+			return 0, err
+		}
+		if err := reply(r); err != nil {
+			return 0, fmt.Errorf("rdb: %s: %w", cmd[0], err)
+		}
+	}
+
+	pending := 0
+	flush := func() error {
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		for ; pending > 0; pending-- {
+			if err := reply(r); err != nil {
+				return err
+			}
+			n++
+		}
+		return nil
+	}
+	for ent := range g.Stream(ctx) {
+		args := []string{"SET", ent.Key, string(ent.Value)}
+		if ent.Expire > 0 {
+			ttl := time.Until(time.Unix(0, ent.Expire)).Milliseconds()
+			if ttl <= 0 {
+				continue
+			}
+			args = append(args, "PX", strconv.FormatInt(ttl, 10))
+		}
+		if err := command(w, args...); err != nil {
+			return n, err
+		}
+		if pending++; pending >= e.pipeline {
+			if err := flush(); err != nil {
+				return n, err
+			}
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return n, err
+	}
+	return n, flush()
+}
+
+// command writes args as a RESP array of bulk strings
+func command(w *bufio.Writer, args ...string) error {
+	w.WriteString("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, arg := range args {
+		w.WriteString("$" + strconv.Itoa(len(arg)) + "\r\n")
+		w.WriteString(arg)
+		if _, err := w.WriteString("\r\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reply reads a RESP reply and returns error replies as errors
+func reply(r *bufio.Reader) error {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return errors.New("rdb: malformed reply")
+	}
+	line = line[:len(line)-2]
+	switch line[0] {
+	case '+', ':':
+		return nil
+	case '-':
+		return errors.New("redis: " + line[1:])
+	case '$':
+		l, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return errors.New("rdb: malformed bulk reply")
+		}
+		if l >= 0 {
+			_, err = io.CopyN(io.Discard, r, int64(l)+2)
+		}
+		return err
+	case '*':
+		l, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return errors.New("rdb: malformed array reply")
+		}
+		for range max(l, 0) {
+			if err := reply(r); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("rdb: unexpected reply %q", line)
+}
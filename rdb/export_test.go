@@ -0,0 +1,112 @@
+package rdb
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ntsd/gache/v2"
+)
+
+// fakeRedis records the commands it receives and rejects AUTH with any password but "secret"
+type fakeRedis struct {
+	mu       sync.Mutex
+	commands [][]string
+}
+
+func (f *fakeRedis) serve(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go f.handle(conn)
+		}
+	}()
+	return l.Addr().String()
+}
+
+func (f *fakeRedis) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+		args := make([]string, n)
+		for i := range args {
+			line, _ = r.ReadString('\n')
+			l, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+			b := make([]byte, l+2)
+			io.ReadFull(r, b)
+			args[i] = string(b[:l])
+		}
+		f.mu.Lock()
+		f.commands = append(f.commands, args)
+		f.mu.Unlock()
+		if args[0] == "AUTH" && args[len(args)-1] != "secret" {
+			io.WriteString(conn, "-WRONGPASS invalid username-password pair\r\n")
+			continue
+		}
+		io.WriteString(conn, "+OK\r\n")
+	}
+}
+
+func TestExportRedis(t *testing.T) {
+	f := new(fakeRedis)
+	addr := f.serve(t)
+	g := gache.New[string]()
+	g.SetWithExpire("persistent", "p", gache.NoTTL)
+	g.SetWithExpire("ttl", "t", time.Minute)
+	for i := range 10 {
+		g.SetWithExpire("k"+strconv.Itoa(i), strconv.Itoa(i), gache.NoTTL)
+	}
+	n, err := ExportRedis(context.Background(), g, addr, WithAuth("", "secret"), WithSelect(2), WithPipeline(3))
+	if err != nil || n != 12 {
+		t.Fatalf("ExportRedis = %d, %v", n, err)
+	}
+	f.mu.Lock()
+	commands := f.commands
+	f.commands = nil
+	f.mu.Unlock()
+	if len(commands) != 14 || strings.Join(commands[0], " ") != "AUTH secret" || strings.Join(commands[1], " ") != "SELECT 2" {
+		t.Fatalf("commands = %v", commands)
+	}
+	for _, cmd := range commands[2:] {
+		switch cmd[1] {
+		case "ttl":
+			ttl, err := strconv.Atoi(cmd[len(cmd)-1])
+			if len(cmd) != 5 || cmd[3] != "PX" || err != nil || ttl <= 0 || ttl > 60000 {
+				t.Fatalf("SET of key with TTL = %v", cmd)
+			}
+		case "persistent":
+			if strings.Join(cmd, " ") != "SET persistent p" {
+				t.Fatalf("SET of key without TTL = %v", cmd)
+			}
+		}
+	}
+
+	if _, err := ExportRedis(context.Background(), gache.New[[]byte](), addr, WithAuth("user", "wrong")); err == nil || !strings.Contains(err.Error(), "WRONGPASS") {
+		t.Fatalf("ExportRedis with wrong password = %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := ExportRedis(ctx, g, addr); err == nil {
+		t.Fatal("ExportRedis with canceled context succeeded")
+	}
+}
@@ -0,0 +1,474 @@
+// Package rdb moves entries between Redis and gache, it imports RDB snapshots and exports caches to a live Redis.
+package rdb
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/ntsd/gache/v2"
+)
+
+// ErrUnsupportedType is returned for values Import can neither read nor skip, like streams and module types
+var ErrUnsupportedType = errors.New("rdb: unsupported value type")
+
+const (
+	opSlotInfo      = 0xF4
+	opFunction2     = 0xF5
+	opFunctionPreGA = 0xF6
+	opModuleAux     = 0xF7
+	opIdle          = 0xF8
+	opFreq          = 0xF9
+	opAux           = 0xFA
+	opResizeDB      = 0xFB
+	opExpireTimeMS  = 0xFC
+	opExpireTime    = 0xFD
+	opSelectDB      = 0xFE
+	opEOF           = 0xFF
+
+	typeString         = 0
+	typeList           = 1
+	typeSet            = 2
+	typeZSet           = 3
+	typeHash           = 4
+	typeZSet2          = 5
+	typeHashZipmap     = 9
+	typeListZiplist    = 10
+	typeSetIntset      = 11
+	typeZSetZiplist    = 12
+	typeHashZiplist    = 13
+	typeListQuicklist  = 14
+	typeHashListpack   = 16
+	typeZSetListpack   = 17
+	typeListQuicklist2 = 18
+	typeSetListpack    = 20
+
+	encInt8  = 0
+	encInt16 = 1
+	encInt32 = 2
+	encLZF   = 3
+
+	// maxStringLength is the largest string Import reads, the default proto-max-bulk-len of Redis
+	maxStringLength = 512 << 20
+
+	// readChunk is the buffer growth of a string read, a corrupt length fails at the end of the input before
+	// allocating its size
+	readChunk = 64 << 10
+)
+
+type (
+	// Option configures Import
+	Option func(*importer)
+
+	importer struct {
+		r       *bufio.Reader
+		crc     uint64
+		db      int
+		dbs     map[int]bool
+		version int
+	}
+)
+
+// WithDB imports the keys of the given databases only, all databases are imported by default
+func WithDB(dbs ...int) Option {
+	return func(im *importer) {
+		if im.dbs == nil {
+			im.dbs = make(map[int]bool)
+		}
+		for _, db := range dbs {
+			im.dbs[db] = true
+		}
+	}
+}
+
+// Import reads the string keys of the Redis RDB snapshot r into g with their expirations and returns the number of imported keys.
+// Keys without expiration are stored without one, expired keys and values of other types are skipped, and the checksum is verified.
+func Import[V ~string | ~[]byte](r io.Reader, g gache.Gache[V], opts ...Option) (n int, err error) {
+	im := &importer{r: bufio.NewReader(r)}
+	for _, opt := range opts {
+		opt(im)
+	}
+	head := make([]byte, 9)
+	if err := im.read(head); err != nil {
+		return 0, err
+	}
+	if string(head[:5]) != "REDIS" {
+		return 0, errors.New("rdb: not a Redis RDB file")
+	}
+	if im.version, err = strconv.Atoi(string(head[5:])); err != nil {
+		return 0, fmt.Errorf("rdb: invalid version %q", head[5:])
+	}
+
+	var expire int64
+	for {
+		op, err := im.byte()
+		if err != nil {
+			return n, err
+		}
+		switch op {
+		case opEOF:
+			return n, im.checksum()
+		case opSelectDB:
+			db, err := im.length()
+			if err != nil {
+				return n, err
+			}
+			im.db = int(db)
+		case opResizeDB:
+			if _, err := im.length(); err != nil {
+				return n, err
+			}
+			if _, err := im.length(); err != nil {
+				return n, err
+			}
+		case opAux:
+			if err := im.skipStrings(2); err != nil {
+				return n, err
+			}
+		case opExpireTimeMS:
+			b := make([]byte, 8)
+			if err := im.read(b); err != nil {
+				return n, err
+			}
+			expire = int64(binary.LittleEndian.Uint64(b))
+		case opExpireTime:
+			b := make([]byte, 4)
+			if err := im.read(b); err != nil {
+				return n, err
+			}
+			expire = int64(binary.LittleEndian.Uint32(b)) * 1000
+		case opIdle:
+			if _, err := im.length(); err != nil {
+				return n, err
+			}
+		case opFreq:
+			if _, err := im.byte(); err != nil {
+				return n, err
+			}
+		case opSlotInfo:
+			for range 3 {
+				if _, err := im.length(); err != nil {
+					return n, err
+				}
+			}
+		case opFunction2:
+			if err := im.skipStrings(1); err != nil {
+				return n, err
+			}
+		case opFunctionPreGA, opModuleAux:
+			return n, fmt.Errorf("%w: opcode %#x", ErrUnsupportedType, op)
+		default:
+			key, err := im.string()
+			if err != nil {
+				return n, err
+			}
+			if op != typeString {
+				if err := im.skipValue(op); err != nil {
+					return n, fmt.Errorf("rdb: key %q: %w", key, err)
+				}
+				expire = 0
+				continue
+			}
+			val, err := im.string()
+			if err != nil {
+				return n, fmt.Errorf("rdb: key %q: %w", key, err)
+			}
+			if im.dbs == nil || im.dbs[im.db] {
+				switch {
+				case expire == 0:
+					g.SetWithExpireAt(string(key), V(val), time.Time{})
+					n++
+				case time.UnixMilli(expire).After(time.Now()):
+					g.SetWithExpireAt(string(key), V(val), time.UnixMilli(expire))
+					n++
+				}
+			}
+			expire = 0
+		}
+	}
+}
+
+// skipValue reads past a value of type t
+func (im *importer) skipValue(t byte) error {
+	switch t {
+	case typeList, typeSet, typeListQuicklist:
+		l, err := im.length()
+		if err != nil {
+			return err
+		}
+		return im.skipStrings(l)
+	case typeHash:
+		l, err := im.length()
+		if err != nil {
+			return err
+		}
+		return im.skipStrings(2 * l)
+	case typeZSet, typeZSet2:
+		l, err := im.length()
+		if err != nil {
+			return err
+		}
+		for range l {
+			if err := im.skipStrings(1); err != nil {
+				return err
+			}
+			if t == typeZSet2 {
+				if err := im.read(make([]byte, 8)); err != nil {
+					return err
+				}
+				continue
+			}
+			// scores of version 1 sorted sets are strings with a single byte length, 253 to 255 encode NaN and infinities
+			sl, err := im.byte()
+			if err != nil {
+				return err
+			}
+			if sl < 253 {
+				if err := im.read(make([]byte, sl)); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	case typeListQuicklist2:
+		l, err := im.length()
+		if err != nil {
+			return err
+		}
+		for range l {
+			if _, err := im.length(); err != nil {
+				return err
+			}
+			if err := im.skipStrings(1); err != nil {
+				return err
+			}
+		}
+		return nil
+	case typeHashZipmap, typeListZiplist, typeSetIntset, typeZSetZiplist, typeHashZiplist,
+		typeHashListpack, typeZSetListpack, typeSetListpack:
+		return im.skipStrings(1)
+	}
+	return fmt.Errorf("%w %d", ErrUnsupportedType, t)
+}
+
+func (im *importer) skipStrings(n uint64) error {
+	for range n {
+		if _, err := im.string(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// string reads a length prefixed, integer or LZF encoded string
+func (im *importer) string() ([]byte, error) {
+	l, special, err := im.lengthOrEncoding()
+	if err != nil {
+		return nil, err
+	}
+	if !special {
+		return im.bytes(l)
+	}
+	switch l {
+	case encInt8, encInt16, encInt32:
+		b := make([]byte, 1<<l)
+		if err := im.read(b); err != nil {
+			return nil, err
+		}
+		var v int64
+		switch l {
+		case encInt8:
+			v = int64(int8(b[0]))
+		case encInt16:
+			v = int64(int16(binary.LittleEndian.Uint16(b)))
+		case encInt32:
+			v = int64(int32(binary.LittleEndian.Uint32(b)))
+		}
+		return strconv.AppendInt(nil, v, 10), nil
+	case encLZF:
+		clen, err := im.length()
+		if err != nil {
+			return nil, err
+		}
+		ulen, err := im.length()
+		if err != nil {
+			return nil, err
+		}
+		if ulen > maxStringLength {
+			return nil, fmt.Errorf("rdb: LZF string of %d bytes exceeds %d", ulen, maxStringLength)
+		}
+		b, err := im.bytes(clen)
+		if err != nil {
+			return nil, err
+		}
+		return lzf(b, int(ulen))
+	}
+	return nil, fmt.Errorf("rdb: unknown string encoding %d", l)
+}
+
+// bytes reads a string of n bytes
+func (im *importer) bytes(n uint64) ([]byte, error) {
+	if n > maxStringLength {
+		return nil, fmt.Errorf("rdb: string of %d bytes exceeds %d", n, maxStringLength)
+	}
+	b := make([]byte, 0, min(n, readChunk))
+	for uint64(len(b)) < n {
+		start, chunk := len(b), int(min(n-uint64(len(b)), readChunk))
+		b = slices.Grow(b, chunk)[:start+chunk]
+		if err := im.read(b[start:]); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+func (im *importer) length() (uint64, error) {
+	l, special, err := im.lengthOrEncoding()
+	if err == nil && special {
+		err = errors.New("rdb: encoded string where a length was expected")
+	}
+	return l, err
+}
+
+// lengthOrEncoding reads a length, special reports an encoded string whose encoding is returned instead
+func (im *importer) lengthOrEncoding() (l uint64, special bool, err error) {
+	b, err := im.byte()
+	if err != nil {
+		return 0, false, err
+	}
+	switch b >> 6 {
+	case 0:
+		return uint64(b & 0x3F), false, nil
+	case 1:
+		next, err := im.byte()
+		return uint64(b&0x3F)<<8 | uint64(next), false, err
+	case 2:
+		switch b {
+		case 0x80:
+			buf := make([]byte, 4)
+			err := im.read(buf)
+			return uint64(binary.BigEndian.Uint32(buf)), false, err
+		case 0x81:
+			buf := make([]byte, 8)
+			err := im.read(buf)
+			return binary.BigEndian.Uint64(buf), false, err
+		}
+		return 0, false, fmt.Errorf("rdb: invalid length encoding %#x", b)
+	}
+	return uint64(b & 0x3F), true, nil
+}
+
+// checksum verifies the CRC-64 following the EOF opcode, files written with rdbchecksum disabled store zero
+func (im *importer) checksum() error {
+	if im.version < 5 {
+		return nil
+	}
+	want := im.crc
+	b := make([]byte, 8)
+	if _, err := io.ReadFull(im.r, b); err != nil {
+		return unexpected(err)
+	}
+	if sum := binary.LittleEndian.Uint64(b); sum != 0 && sum != want {
+		return fmt.Errorf("rdb: checksum mismatch %#x, computed %#x", sum, want)
+	}
+	return nil
+}
+
+func (im *importer) byte() (byte, error) {
+	b, err := im.r.ReadByte()
+	if err != nil {
+		return 0, unexpected(err)
+	}
+	im.crc = crcTable[byte(im.crc)^b] ^ im.crc>>8
+	return b, nil
+}
+
+func (im *importer) read(b []byte) error {
+	if _, err := io.ReadFull(im.r, b); err != nil {
+		return unexpected(err)
+	}
+	im.crc = crc64(im.crc, b)
+	return nil
+}
+
+// unexpected converts io.EOF as a file ends with the EOF opcode
+func unexpected(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// lzf decompresses the LZF data in to n bytes
+func lzf(in []byte, n int) ([]byte, error) {
+	// the output grows with the decoded data so a corrupt length does not allocate it upfront
+	out := make([]byte, 0, min(n, 4*len(in)))
+	for i := 0; i < len(in); {
+		ctrl := int(in[i])
+		i++
+		if ctrl < 1<<5 {
+			ctrl++
+			if i+ctrl > len(in) || len(out)+ctrl > n {
+				return nil, errors.New("rdb: corrupt LZF literal")
+			}
+			out = append(out, in[i:i+ctrl]...)
+			i += ctrl
+			continue
+		}
+		l := ctrl >> 5
+		if l == 7 {
+			if i >= len(in) {
+				return nil, errors.New("rdb: corrupt LZF back reference")
+			}
+			l += int(in[i])
+			i++
+		}
+		if i >= len(in) {
+			return nil, errors.New("rdb: corrupt LZF back reference")
+		}
+		ref := len(out) - (ctrl&0x1F)<<8 - int(in[i]) - 1
+		i++
+		l += 2
+		if ref < 0 || len(out)+l > n {
+			return nil, errors.New("rdb: corrupt LZF back reference")
+		}
+		// references may overlap the output being written
+		for j := range l {
+			out = append(out, out[ref+j])
+		}
+	}
+	if len(out) != n {
+		return nil, fmt.Errorf("rdb: LZF data decompressed to %d bytes, want %d", len(out), n)
+	}
+	return out, nil
+}
+
+// crcTable is the reflected table of the Jones polynomial used by Redis
+var crcTable = func() (t [256]uint64) {
+	const poly = 0x95AC9329AC4BC9B5
+	for i := range t {
+		crc := uint64(i)
+		for range 8 {
+			if crc&1 == 1 {
+				crc = crc>>1 ^ poly
+			} else {
+				crc >>= 1
+			}
+		}
+		t[i] = crc
+	}
+	return t
+}()
+
+// crc64 updates the Redis CRC-64 of crc with b
+func crc64(crc uint64, b []byte) uint64 {
+	for _, c := range b {
+		crc = crcTable[byte(crc)^c] ^ crc>>8
+	}
+	return crc
+}
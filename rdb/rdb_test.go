@@ -0,0 +1,121 @@
+package rdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/ntsd/gache/v2"
+)
+
+type rdbWriter struct{ bytes.Buffer }
+
+func (w *rdbWriter) str(s string) *rdbWriter {
+	w.WriteByte(byte(len(s)))
+	w.WriteString(s)
+	return w
+}
+
+func (w *rdbWriter) expireMS(t time.Time) *rdbWriter {
+	w.WriteByte(opExpireTimeMS)
+	w.Write(binary.LittleEndian.AppendUint64(nil, uint64(t.UnixMilli())))
+	return w
+}
+
+func (w *rdbWriter) end() []byte {
+	w.WriteByte(opEOF)
+	w.Write(binary.LittleEndian.AppendUint64(nil, crc64(0, w.Bytes())))
+	return w.Bytes()
+}
+
+func snapshot() []byte {
+	w := new(rdbWriter)
+	w.WriteString("REDIS0011")
+	w.WriteByte(opAux)
+	w.str("redis-ver").str("7.2.0")
+	w.Write([]byte{opSelectDB, 0, opResizeDB, 5, 2})
+	w.WriteByte(typeString)
+	w.str("plain").str("value")
+	w.expireMS(time.Now().Add(time.Hour))
+	w.WriteByte(typeString)
+	w.str("ttl").Write([]byte{0xC0, 42})
+	w.expireMS(time.Now().Add(-time.Hour))
+	w.WriteByte(typeString)
+	w.str("old").str("x")
+	w.WriteByte(typeList)
+	w.str("list").Write([]byte{2})
+	w.str("a").str("b")
+	w.Write([]byte{opFreq, 3})
+	w.WriteByte(typeString)
+	w.str("lzf").Write([]byte{0xC3, 5, 10, 0, 'a', 0xE0, 0, 0})
+	w.WriteByte(typeString)
+	w.str("big").Write([]byte{0xC2})
+	w.Write(binary.LittleEndian.AppendUint32(nil, uint32(100000)))
+	w.Write([]byte{opSelectDB, 1, opExpireTime})
+	w.Write(binary.LittleEndian.AppendUint32(nil, uint32(time.Now().Add(time.Hour).Unix())))
+	w.WriteByte(typeString)
+	w.str("db1").str("one")
+	return w.end()
+}
+
+func TestCRC64(t *testing.T) {
+	if sum := crc64(0, []byte("123456789")); sum != 0xe9c6d914c4b8d9ca {
+		t.Fatalf("crc64 = %#x", sum)
+	}
+}
+
+func TestImport(t *testing.T) {
+	g := gache.New[string]()
+	n, err := Import(bytes.NewReader(snapshot()), g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"plain": "value", "ttl": "42", "lzf": "aaaaaaaaaa", "big": "100000", "db1": "one"}
+	if n != len(want) || g.Len() != len(want) {
+		t.Fatalf("Import = %d, Len %d, want %d", n, g.Len(), len(want))
+	}
+	for k, v := range want {
+		if got, ok := g.Get(k); !ok || got != v {
+			t.Fatalf("Get(%s) = %q, %v, want %q", k, got, ok, v)
+		}
+	}
+	if ttl, ok := g.TTL("plain"); !ok || ttl != gache.NoTTL {
+		t.Fatalf("TTL of key without expiration = %v, %v", ttl, ok)
+	}
+	for _, k := range []string{"ttl", "db1"} {
+		if ttl, ok := g.TTL(k); !ok || ttl <= 58*time.Minute || ttl > 61*time.Minute {
+			t.Fatalf("TTL(%s) = %v, %v", k, ttl, ok)
+		}
+	}
+
+	b := gache.New[[]byte]()
+	if n, err := Import(bytes.NewReader(snapshot()), b, WithDB(1)); err != nil || n != 1 {
+		t.Fatalf("Import of database 1 = %d, %v", n, err)
+	}
+	if v, ok := b.Get("db1"); !ok || string(v) != "one" {
+		t.Fatalf("Get(db1) = %q, %v", v, ok)
+	}
+
+	corrupt := snapshot()
+	corrupt[len(corrupt)-1] ^= 0xFF
+	if _, err := Import(bytes.NewReader(corrupt), gache.New[string]()); err == nil {
+		t.Fatal("Import with wrong checksum succeeded")
+	}
+	if _, err := Import(bytes.NewReader(snapshot()[:40]), gache.New[string]()); err == nil {
+		t.Fatal("Import of truncated file succeeded")
+	}
+
+	// lengths read from the file are bounded before allocating
+	huge := []byte{0x81, 0x7F, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}
+	for name, b := range map[string][]byte{
+		"aux":       append([]byte("REDIS0009\xFA"), huge...),
+		"large":     append([]byte("REDIS0009\x00\x01k\x80"), binary.BigEndian.AppendUint32(nil, 1<<28)...),
+		"lzf":       append([]byte("REDIS0009\x00\x01k\xC3\x01"), huge...),
+		"lzf input": append([]byte("REDIS0009\x00\x01k\xC3"), huge...),
+	} {
+		if _, err := Import(bytes.NewReader(b), gache.New[string]()); err == nil {
+			t.Errorf("Import of %s length succeeded", name)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package gache
+
+import "context"
+
+// Reason tells why an entry was removed from the cache
+type Reason int
+
+const (
+	// Expired entries outlived their expiration
+	Expired Reason = iota
+	// Deleted entries were removed explicitly
+	Deleted
+	// Replaced entries were overwritten by a new value
+	Replaced
+	// Evicted entries were removed to keep the cache within its bounds
+	Evicted
+	// Cleared entries were removed by Clear, LazyClear or ClearWithHooks
+	Cleared
+)
+
+// String returns the name of the reason
+func (r Reason) String() string {
+	switch r {
+	case Expired:
+		return "Expired"
+	case Deleted:
+		return "Deleted"
+	case Replaced:
+		return "Replaced"
+	case Evicted:
+		return "Evicted"
+	case Cleared:
+		return "Cleared"
+	}
+	return "Unknown"
+}
+
+// SetEvictedHook sets the function called with every value removed from the cache and the reason of the removal.
+// It is called synchronously by the goroutine removing the value, changing only the expiration of a value does not call it.
+func (g *gache[V]) SetEvictedHook(f func(ctx context.Context, key string, val V, reason Reason)) Gache[V] {
+	g.evictFunc = f
+	return g
+}
+
+// notifyEvicted calls the evicted hook and emits expirations, evictions and clears to watchers
+func (g *gache[V]) notifyEvicted(key string, val V, reason Reason) {
+	switch reason {
+	case Expired:
+		g.emit(EventExpired, key, val)
+	case Evicted, Cleared:
+		g.emit(EventDeleted, key, val)
+	}
+	if g.evictFunc != nil {
+		g.evictFunc(context.Background(), key, val, reason)
+	}
+}
+
+// reason returns the reason reported for removing v, expired and cleared values override reason
+func (g *gache[V]) reason(v *value[V], reason Reason) Reason {
+	switch {
+	case g.cleared(v):
+		return Cleared
+	case !v.isValid() && !v.isPinned():
+		return Expired
+	}
+	return reason
+}
@@ -0,0 +1,319 @@
+package memcache
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"time"
+)
+
+// relativeLimit is the largest exptime memcached reads as seconds from now, larger ones are unix times
+const relativeLimit = 60 * 60 * 24 * 30
+
+var errBadFormat = errors.New("CLIENT_ERROR bad command line format")
+
+// exec runs a command, the returned error closes the connection
+func (s *Server) exec(c *conn, args []string) error {
+	c.noreply = false
+	if len(args) == 0 {
+		c.reply("ERROR")
+		return nil
+	}
+	switch args[0] {
+	case "get", "gets":
+		return s.get(c, args[0] == "gets", args[1:])
+	case "set", "cas":
+		return s.store(c, args[0] == "cas", args[1:])
+	case "delete":
+		return s.delete(c, args[1:])
+	case "touch":
+		return s.touch(c, args[1:])
+	case "flush_all":
+		return s.flush(c, args[1:])
+	case "stats":
+		if len(args) > 1 {
+			c.reply("ERROR")
+			return nil
+		}
+		s.writeStats(c)
+	case "version":
+		c.reply("VERSION gache")
+	case "verbosity":
+		c.noreply = args[len(args)-1] == "noreply"
+		c.reply("OK")
+	case "quit":
+		c.quit = true
+	default:
+		c.reply("ERROR")
+	}
+	return nil
+}
+
+// get runs get and gets, gets adds the version of each item as its cas unique
+func (s *Server) get(c *conn, cas bool, keys []string) error {
+	if len(keys) == 0 {
+		c.reply("ERROR")
+		return nil
+	}
+	for _, key := range keys {
+		if !validKey(key) {
+			c.reply(errBadFormat.Error())
+			return nil
+		}
+	}
+	for _, key := range keys {
+		s.stats.gets.Add(1)
+		v, version, ok := s.cache.GetWithVersion(key)
+		if !ok {
+			s.stats.getMisses.Add(1)
+			continue
+		}
+		s.stats.getHits.Add(1)
+		var flags uint32
+		if s.flags && len(v) >= 4 {
+			flags, v = binary.BigEndian.Uint32(v), v[4:]
+		}
+		c.w.WriteString("VALUE " + key + " " + strconv.FormatUint(uint64(flags), 10) + " " + strconv.Itoa(len(v)))
+		if cas {
+			c.w.WriteString(" " + strconv.FormatUint(version, 10))
+		}
+		c.w.WriteString("\r\n")
+		c.w.Write(v)
+		c.w.WriteString("\r\n")
+	}
+	c.reply("END")
+	return nil
+}
+
+// store runs set <key> <flags> <exptime> <bytes> [noreply] and cas <key> <flags> <exptime> <bytes> <cas unique> [noreply]
+func (s *Server) store(c *conn, cas bool, args []string) error {
+	n := 4
+	if cas {
+		n = 5
+	}
+	if len(args) == n+1 && args[n] == "noreply" {
+		c.noreply = true
+		args = args[:n]
+	}
+	if len(args) != n || !validKey(args[0]) {
+		c.reply("ERROR")
+		return nil
+	}
+	key := args[0]
+	flags, err1 := strconv.ParseUint(args[1], 10, 32)
+	exptime, err2 := strconv.ParseInt(args[2], 10, 64)
+	size, err3 := strconv.Atoi(args[3])
+	var unique uint64
+	var err4 error
+	if cas {
+		unique, err4 = strconv.ParseUint(args[4], 10, 64)
+	}
+	if err := errors.Join(err1, err2, err3, err4); err != nil || size < 0 {
+		c.reply(errBadFormat.Error())
+		return nil
+	}
+	if size > s.maxItem {
+		// the data block is swallowed so the next command is read from its start
+		if _, err := io.CopyN(io.Discard, c.r, int64(size)+2); err != nil {
+			return err
+		}
+		c.reply("SERVER_ERROR object too large for cache")
+		return nil
+	}
+	off := 0
+	if s.flags {
+		off = 4
+	}
+	b := make([]byte, off+size+2)
+	if _, err := io.ReadFull(c.r, b[off:]); err != nil {
+		return err
+	}
+	s.stats.bytesRead.Add(uint64(size + 2))
+	if string(b[off+size:]) != "\r\n" {
+		c.reply("CLIENT_ERROR bad data chunk")
+		return nil
+	}
+	v := b[: off+size : off+size]
+	if s.flags {
+		binary.BigEndian.PutUint32(v, uint32(flags))
+	}
+	s.stats.sets.Add(1)
+	at, expired := expiry(exptime)
+	if !cas {
+		if expired {
+			s.cache.Delete(key)
+		} else {
+			s.cache.SetWithExpireAt(key, v, at)
+		}
+		c.reply("STORED")
+		return nil
+	}
+
+	if _, _, ok := s.cache.GetWithVersion(key); !ok {
+		s.stats.casMisses.Add(1)
+		c.reply("NOT_FOUND")
+		return nil
+	}
+	if expired {
+		// stored already expired so the version check and the removal stay one write
+		at = time.Unix(0, 1)
+	}
+	if !s.cache.SetIfVersionWithExpireAt(key, v, unique, at) {
+		s.stats.casBad.Add(1)
+		c.reply("EXISTS")
+		return nil
+	}
+	s.stats.casHits.Add(1)
+	c.reply("STORED")
+	return nil
+}
+
+// delete runs delete <key> [0] [noreply], the zero time is accepted for old clients
+func (s *Server) delete(c *conn, args []string) error {
+	if len(args) > 1 && args[len(args)-1] == "noreply" {
+		c.noreply = true
+		args = args[:len(args)-1]
+	}
+	if len(args) == 2 && args[1] == "0" {
+		args = args[:1]
+	}
+	if len(args) != 1 || !validKey(args[0]) {
+		c.reply(errBadFormat.Error())
+		return nil
+	}
+	if _, ok := s.cache.Delete(args[0]); ok {
+		s.stats.deleteHits.Add(1)
+		c.reply("DELETED")
+	} else {
+		s.stats.deleteMisses.Add(1)
+		c.reply("NOT_FOUND")
+	}
+	return nil
+}
+
+// touch runs touch <key> <exptime> [noreply]
+func (s *Server) touch(c *conn, args []string) error {
+	if len(args) == 3 && args[2] == "noreply" {
+		c.noreply = true
+		args = args[:2]
+	}
+	if len(args) != 2 || !validKey(args[0]) {
+		c.reply("ERROR")
+		return nil
+	}
+	exptime, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		c.reply("CLIENT_ERROR invalid exptime argument")
+		return nil
+	}
+	s.stats.touches.Add(1)
+	var ok bool
+	if at, expired := expiry(exptime); expired {
+		_, ok = s.cache.Delete(args[0])
+	} else {
+		ok = s.cache.ExpireAt(args[0], at)
+	}
+	if ok {
+		s.stats.touchHits.Add(1)
+		c.reply("TOUCHED")
+	} else {
+		s.stats.touchMisses.Add(1)
+		c.reply("NOT_FOUND")
+	}
+	return nil
+}
+
+// flush runs flush_all [delay] [noreply], a delay clears the cache once it has passed
+func (s *Server) flush(c *conn, args []string) error {
+	if len(args) > 0 && args[len(args)-1] == "noreply" {
+		c.noreply = true
+		args = args[:len(args)-1]
+	}
+	var delay int64
+	if len(args) > 1 {
+		c.reply("ERROR")
+		return nil
+	}
+	if len(args) == 1 {
+		var err error
+		if delay, err = strconv.ParseInt(args[0], 10, 64); err != nil || delay < 0 {
+			c.reply(errBadFormat.Error())
+			return nil
+		}
+	}
+	s.stats.flushes.Add(1)
+	if at, _ := expiry(delay); delay > 0 {
+		time.AfterFunc(time.Until(at), s.cache.Clear)
+	} else {
+		s.cache.Clear()
+	}
+	c.reply("OK")
+	return nil
+}
+
+func (s *Server) writeStats(c *conn) {
+	now := time.Now()
+	stat := func(name string, v uint64) {
+		c.w.WriteString("STAT " + name + " " + strconv.FormatUint(v, 10) + "\r\n")
+	}
+	stat("pid", uint64(os.Getpid()))
+	stat("uptime", uint64(now.Sub(s.started)/time.Second))
+	stat("time", uint64(now.Unix()))
+	c.w.WriteString("STAT version gache\r\n")
+	stat("curr_connections", uint64(s.stats.conns.Load()))
+	stat("total_connections", uint64(s.stats.totalConns.Load()))
+	stat("cmd_get", s.stats.gets.Load())
+	stat("cmd_set", s.stats.sets.Load())
+	stat("cmd_flush", s.stats.flushes.Load())
+	stat("cmd_touch", s.stats.touches.Load())
+	stat("get_hits", s.stats.getHits.Load())
+	stat("get_misses", s.stats.getMisses.Load())
+	stat("delete_hits", s.stats.deleteHits.Load())
+	stat("delete_misses", s.stats.deleteMisses.Load())
+	stat("cas_hits", s.stats.casHits.Load())
+	stat("cas_misses", s.stats.casMisses.Load())
+	stat("cas_badval", s.stats.casBad.Load())
+	stat("touch_hits", s.stats.touchHits.Load())
+	stat("touch_misses", s.stats.touchMisses.Load())
+	stat("bytes_read", s.stats.bytesRead.Load())
+	stat("bytes_written", s.stats.bytesWritten.Load())
+	stat("curr_items", uint64(s.cache.Len()))
+	stat("evictions", s.cache.Stats().Evictions)
+	c.reply("END")
+}
+
+// reply writes line unless the command was sent with noreply
+func (c *conn) reply(line string) {
+	if !c.noreply {
+		c.w.WriteString(line + "\r\n")
+	}
+}
+
+// expiry converts a memcached exptime, zero never expires and negative or past times are already expired
+func expiry(exptime int64) (at time.Time, expired bool) {
+	switch {
+	case exptime == 0:
+		return time.Time{}, false
+	case exptime < 0:
+		return time.Time{}, true
+	case exptime <= relativeLimit:
+		return time.Now().Add(time.Duration(exptime) * time.Second), false
+	}
+	at = time.Unix(exptime, 0)
+	return at, !at.After(time.Now())
+}
+
+// validKey reports whether key is a memcached key of at most 250 bytes without control characters
+func validKey(key string) bool {
+	if len(key) == 0 || len(key) > maxKey {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] <= ' ' || key[i] == 0x7f {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,188 @@
+// Package memcache serves a gache over the memcached text protocol so memcached clients can use a sidecar gache
+// without code changes, it supports get, gets, set, cas, delete, touch, flush_all, stats, version and quit.
+package memcache
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ntsd/gache/v2"
+)
+
+const (
+	// DefaultMaxItemSize is the largest value accepted by set unless WithMaxItemSize is set, it matches memcached
+	DefaultMaxItemSize = 1 << 20
+
+	// maxKey is the longest key memcached accepts
+	maxKey = 250
+)
+
+// ErrServerClosed is returned by Serve after Close
+var ErrServerClosed = errors.New("memcache: server closed")
+
+type (
+	// Option configures New
+	Option func(*Server)
+
+	// Server serves a gache over the memcached text protocol. Expiration times follow memcached, zero never expires,
+	// up to 30 days are seconds from now and larger ones are unix times, the cas unique of an item is its gache version.
+	Server struct {
+		cache   gache.Gache[[]byte]
+		flags   bool
+		maxItem int
+		started time.Time
+		stats   counters
+
+		mu        sync.Mutex
+		closed    bool
+		listeners map[net.Listener]struct{}
+		conns     map[net.Conn]struct{}
+	}
+
+	// counters are the statistics reported by the stats command
+	counters struct {
+		conns, totalConns            atomic.Int64
+		gets, sets, touches, flushes atomic.Uint64
+		getHits, getMisses           atomic.Uint64
+		casHits, casMisses, casBad   atomic.Uint64
+		deleteHits, deleteMisses     atomic.Uint64
+		touchHits, touchMisses       atomic.Uint64
+		bytesRead, bytesWritten      atomic.Uint64
+	}
+
+	// conn is the state of a client connection, noreply suppresses the reply of the current command
+	conn struct {
+		r       *bufio.Reader
+		w       *bufio.Writer
+		noreply bool
+		quit    bool
+	}
+)
+
+// WithFlags stores the client flags of each item as a 4 byte big endian prefix of its cached value, without it
+// flags are not stored and items are returned with flags 0
+func WithFlags() Option {
+	return func(s *Server) {
+		s.flags = true
+	}
+}
+
+// WithMaxItemSize sets the largest value in bytes accepted by set
+func WithMaxItemSize(n int) Option {
+	return func(s *Server) {
+		if n > 0 {
+			s.maxItem = n
+		}
+	}
+}
+
+// New returns a Server for g
+func New(g gache.Gache[[]byte], opts ...Option) *Server {
+	s := &Server{
+		cache:     g,
+		maxItem:   DefaultMaxItemSize,
+		started:   time.Now(),
+		listeners: make(map[net.Listener]struct{}),
+		conns:     make(map[net.Conn]struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Serve accepts connections on l and serves each in its own goroutine until Close, it then returns ErrServerClosed
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		l.Close()
+		return ErrServerClosed
+	}
+	s.listeners[l] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.listeners, l)
+		s.mu.Unlock()
+	}()
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return ErrServerClosed
+			}
+			return err
+		}
+		go s.ServeConn(c)
+	}
+}
+
+// ServeConn serves the commands of c until the client quits or disconnects, c is closed on return
+func (s *Server) ServeConn(c net.Conn) {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		c.Close()
+		return
+	}
+	s.conns[c] = struct{}{}
+	s.mu.Unlock()
+	s.stats.conns.Add(1)
+	s.stats.totalConns.Add(1)
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, c)
+		s.mu.Unlock()
+		s.stats.conns.Add(-1)
+		c.Close()
+	}()
+
+	cn := &conn{r: bufio.NewReader(c), w: bufio.NewWriter(c)}
+	for !cn.quit {
+		line, err := cn.r.ReadSlice('\n')
+		if errors.Is(err, bufio.ErrBufferFull) {
+			cn.w.WriteString("CLIENT_ERROR line too long\r\n")
+			cn.w.Flush()
+			return
+		}
+		if err != nil {
+			return
+		}
+		s.stats.bytesRead.Add(uint64(len(line)))
+		if err := s.exec(cn, strings.Fields(string(line))); err != nil {
+			cn.w.Flush()
+			return
+		}
+		// pipelined commands are replied to in one write
+		if cn.r.Buffered() == 0 || cn.quit {
+			s.stats.bytesWritten.Add(uint64(cn.w.Buffered()))
+			if err := cn.w.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// Close stops the listeners of Serve and closes all connections
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	var err error
+	for l := range s.listeners {
+		err = errors.Join(err, l.Close())
+	}
+	for c := range s.conns {
+		c.Close()
+	}
+	return err
+}
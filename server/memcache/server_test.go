@@ -0,0 +1,188 @@
+package memcache
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ntsd/gache/v2"
+)
+
+type client struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func serve(t *testing.T, g gache.Gache[[]byte], opts ...Option) *client {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := New(g, opts...)
+	done := make(chan error, 1)
+	go func() { done <- s.Serve(l) }()
+	t.Cleanup(func() {
+		s.Close()
+		if err := <-done; !errors.Is(err, ErrServerClosed) {
+			t.Errorf("Serve after Close = %v, want %v", err, ErrServerClosed)
+		}
+	})
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	return &client{t: t, conn: conn, r: bufio.NewReader(conn)}
+}
+
+// do sends req and returns the reply lines up to the one starting with one of the final prefixes
+func (c *client) do(req string, final ...string) []string {
+	c.t.Helper()
+	if _, err := c.conn.Write([]byte(req)); err != nil {
+		c.t.Fatal(err)
+	}
+	var lines []string
+	for {
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			c.t.Fatalf("reply to %q: %v after %q", req, err, lines)
+		}
+		line = strings.TrimSuffix(line, "\r\n")
+		lines = append(lines, line)
+		if len(final) == 0 {
+			return lines
+		}
+		for _, f := range final {
+			if strings.HasPrefix(line, f) {
+				return lines
+			}
+		}
+	}
+}
+
+func TestServer(t *testing.T) {
+	g := gache.New[[]byte]()
+	c := serve(t, g)
+
+	for _, tc := range []struct {
+		req  string
+		want string
+	}{
+		{"get a\r\n", "END"},
+		{"set a 0 0 5\r\nhello\r\n", "STORED"},
+		{"get a b\r\n", "VALUE a 0 5|hello|END"},
+		{"set b 0 100 2\r\nhi\r\n", "STORED"},
+		{"get a b\r\n", "VALUE a 0 5|hello|VALUE b 0 2|hi|END"},
+		{"touch a 60\r\n", "TOUCHED"},
+		{"touch missing 60\r\n", "NOT_FOUND"},
+		{"delete b\r\n", "DELETED"},
+		{"delete b\r\n", "NOT_FOUND"},
+		{"set b 0 -1 2\r\nhi\r\n", "STORED"},
+		{"get b\r\n", "END"},
+		{"set c 0 0 2 noreply\r\nhi\r\nget c\r\n", "VALUE c 0 2|hi|END"},
+		{"set c 0 0 2\r\nhello\r\n", "CLIENT_ERROR bad data chunk|ERROR"},
+		{"set c x 0 2\r\n", "CLIENT_ERROR bad command line format"},
+		{"bogus\r\n", "ERROR"},
+		{"version\r\n", "VERSION gache"},
+	} {
+		want := strings.Split(tc.want, "|")
+		if got := c.do(tc.req, want[len(want)-1]); strings.Join(got, "|") != tc.want {
+			t.Errorf("%q = %q, want %q", tc.req, strings.Join(got, "|"), tc.want)
+		}
+	}
+	if ttl, ok := g.TTL("a"); !ok || ttl <= 59*time.Second || ttl > 61*time.Second {
+		t.Fatalf("TTL after touch = %v, %v", ttl, ok)
+	}
+
+	// cas succeeds only with the unique returned by gets
+	lines := c.do("gets a\r\n", "END")
+	fields := strings.Fields(lines[0])
+	if len(fields) != 5 {
+		t.Fatalf("gets reply = %q", lines)
+	}
+	unique, _ := strconv.ParseUint(fields[4], 10, 64)
+	stale := strconv.FormatUint(unique+1, 10)
+	if got := c.do("cas a 0 0 3 " + stale + "\r\nbad\r\n"); got[0] != "EXISTS" {
+		t.Fatalf("cas with stale unique = %q", got)
+	}
+	if got := c.do("cas a 0 0 3 " + fields[4] + "\r\nnew\r\n"); got[0] != "STORED" {
+		t.Fatalf("cas = %q", got)
+	}
+	if got := c.do("cas missing 0 0 3 1\r\nnew\r\n"); got[0] != "NOT_FOUND" {
+		t.Fatalf("cas of missing key = %q", got)
+	}
+	if v, ok := g.Get("a"); !ok || string(v) != "new" {
+		t.Fatalf("Get(a) after cas = %q, %v", v, ok)
+	}
+	if ttl, _ := g.TTL("a"); ttl != gache.NoTTL {
+		t.Fatalf("TTL after cas with exptime 0 = %v", ttl)
+	}
+	// a cas bumps the unique once and a touch keeps it
+	for _, req := range []string{"", "touch a 60\r\n"} {
+		if req != "" {
+			c.do(req)
+		}
+		fields := strings.Fields(c.do("gets a\r\n", "END")[0])
+		if got := fields[len(fields)-1]; got != strconv.FormatUint(unique+1, 10) {
+			t.Fatalf("unique after cas and %q = %s, want %d", req, got, unique+1)
+		}
+	}
+
+	stats := c.do("stats\r\n", "END")
+	for _, want := range []string{"STAT cas_hits 1", "STAT cas_badval 1", "STAT cas_misses 1", "STAT delete_hits 1", "STAT curr_connections 1"} {
+		if !strings.Contains(strings.Join(stats, "\n"), want) {
+			t.Errorf("stats missing %q in %q", want, stats)
+		}
+	}
+
+	if got := c.do("flush_all\r\n"); got[0] != "OK" {
+		t.Fatalf("flush_all = %q", got)
+	}
+	if keys := g.Keys(context.Background()); len(keys) != 0 {
+		t.Fatalf("keys after flush_all = %v", keys)
+	}
+	c.conn.Write([]byte("quit\r\n"))
+	if _, err := c.r.ReadByte(); err == nil {
+		t.Fatal("connection open after quit")
+	}
+}
+
+func TestServerFlags(t *testing.T) {
+	g := gache.New[[]byte]()
+	c := serve(t, g, WithFlags(), WithMaxItemSize(8))
+	if got := c.do("set a 42 0 5\r\nhello\r\nget a\r\n", "END"); strings.Join(got, "|") != "STORED|VALUE a 42 5|hello|END" {
+		t.Fatalf("set and get with flags = %q", got)
+	}
+	if v, _ := g.Get("a"); string(v) != "\x00\x00\x00\x2ahello" {
+		t.Fatalf("stored value = %q, want flags prefix", v)
+	}
+	if got := c.do("set b 0 0 9\r\ntoo large\r\nget a\r\n", "END"); got[0] != "SERVER_ERROR object too large for cache" || got[1] != "VALUE a 42 5" {
+		t.Fatalf("set of a large item = %q", got)
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	if at, expired := expiry(0); !at.IsZero() || expired {
+		t.Fatalf("expiry(0) = %v, %v", at, expired)
+	}
+	if _, expired := expiry(-1); !expired {
+		t.Fatal("negative exptime not expired")
+	}
+	if at, expired := expiry(60); expired || time.Until(at) <= 59*time.Second {
+		t.Fatalf("expiry(60) = %v, %v", at, expired)
+	}
+	abs := time.Now().Add(time.Hour).Unix()
+	if at, expired := expiry(abs); expired || at.Unix() != abs {
+		t.Fatalf("expiry of unix time = %v, %v", at, expired)
+	}
+	if _, expired := expiry(relativeLimit + 1); !expired {
+		t.Fatal("unix time in the past not expired")
+	}
+}
@@ -0,0 +1,389 @@
+package resp
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ntsd/gache/v2"
+	"github.com/zeebo/xxh3"
+)
+
+// defaultScanCount is the number of keys SCAN visits per call without COUNT
+const defaultScanCount = 10
+
+// scanPositionBits is the number of hash bits of a SCAN position, the shard index takes the bits above them
+const scanPositionBits = 48
+
+// arity is the number of arguments of each command including its name, negative for a minimum
+var arity = map[string]int{
+	"PING":    -1,
+	"ECHO":    2,
+	"AUTH":    -2,
+	"QUIT":    1,
+	"GET":     2,
+	"SET":     -3,
+	"DEL":     -2,
+	"EXISTS":  -2,
+	"EXPIRE":  3,
+	"PEXPIRE": 3,
+	"PERSIST": 2,
+	"TTL":     2,
+	"PTTL":    2,
+	"SCAN":    -2,
+}
+
+func (s *Server[V]) exec(c *conn, args []string) {
+	name := strings.ToUpper(args[0])
+	n, ok := arity[name]
+	if !ok {
+		c.error("ERR unknown command '" + args[0] + "'")
+		return
+	}
+	if n >= 0 && len(args) != n || n < 0 && len(args) < -n {
+		c.error("ERR wrong number of arguments for '" + strings.ToLower(name) + "' command")
+		return
+	}
+	if !c.authed && name != "AUTH" && name != "QUIT" {
+		c.error("NOAUTH Authentication required.")
+		return
+	}
+	switch name {
+	case "PING":
+		switch len(args) {
+		case 1:
+			c.simple("PONG")
+		case 2:
+			c.bulk(args[1])
+		default:
+			c.error("ERR wrong number of arguments for 'ping' command")
+		}
+	case "ECHO":
+		c.bulk(args[1])
+	case "AUTH":
+		s.auth(c, args[1:])
+	case "QUIT":
+		c.simple("OK")
+		c.quit = true
+	case "GET":
+		if v, ok := s.cache.Get(args[1]); ok {
+			c.bulk(string(v))
+		} else {
+			c.null()
+		}
+	case "SET":
+		s.set(c, args[1:])
+	case "DEL":
+		var n int64
+		for _, key := range args[1:] {
+			if _, ok := s.cache.Delete(key); ok {
+				n++
+			}
+		}
+		c.integer(n)
+	case "EXISTS":
+		var n int64
+		for _, key := range args[1:] {
+			if _, ok := s.cache.TTL(key); ok {
+				n++
+			}
+		}
+		c.integer(n)
+	case "EXPIRE", "PEXPIRE":
+		unit := time.Second
+		if name == "PEXPIRE" {
+			unit = time.Millisecond
+		}
+		s.expire(c, name, args[1], args[2], unit)
+	case "PERSIST":
+		// keys without expiration are left as is and reply 0 in Redis
+		if ttl, ok := s.cache.TTL(args[1]); ok && ttl != gache.NoTTL && s.cache.Persist(args[1]) {
+			c.integer(1)
+		} else {
+			c.integer(0)
+		}
+	case "TTL", "PTTL":
+		ttl, ok := s.cache.TTL(args[1])
+		switch {
+		case !ok:
+			c.integer(-2)
+		case ttl == gache.NoTTL:
+			c.integer(-1)
+		case name == "TTL":
+			c.integer(int64((ttl + time.Second/2) / time.Second))
+		default:
+			c.integer(ttl.Milliseconds())
+		}
+	case "SCAN":
+		s.scan(c, args[1:])
+	}
+}
+
+// auth accepts AUTH password and AUTH username password
+func (s *Server[V]) auth(c *conn, args []string) {
+	if len(args) > 2 {
+		c.error("ERR syntax error")
+		return
+	}
+	if s.password == "" {
+		c.error("ERR AUTH called without any password configured")
+		return
+	}
+	if args[len(args)-1] != s.password {
+		c.error("WRONGPASS invalid username-password pair or user is disabled.")
+		return
+	}
+	c.authed = true
+	c.simple("OK")
+}
+
+// set runs SET key value [NX | XX] [EX seconds | PX milliseconds | KEEPTTL], without expiration arguments the default
+// expiration of the cache is used rather than none
+func (s *Server[V]) set(c *conn, args []string) {
+	key, val := args[0], V(args[1])
+	var (
+		nx, xx, keepTTL bool
+		ttl             time.Duration
+	)
+	for i := 2; i < len(args); i++ {
+		switch opt := strings.ToUpper(args[i]); {
+		case opt == "NX" && !xx:
+			nx = true
+		case opt == "XX" && !nx:
+			xx = true
+		case opt == "KEEPTTL" && ttl == 0:
+			keepTTL = true
+		case (opt == "EX" || opt == "PX") && ttl == 0 && !keepTTL && i+1 < len(args):
+			i++
+			n, err := strconv.ParseInt(args[i], 10, 64)
+			if err != nil {
+				c.error("ERR value is not an integer or out of range")
+				return
+			}
+			unit := time.Second
+			if opt == "PX" {
+				unit = time.Millisecond
+			}
+			if n <= 0 || n > math.MaxInt64/int64(unit) {
+				c.error("ERR invalid expire time in 'set' command")
+				return
+			}
+			ttl = time.Duration(n) * unit
+		default:
+			c.error("ERR syntax error")
+			return
+		}
+	}
+	ok := true
+	switch {
+	case nx && ttl > 0:
+		ok = s.cache.SetWithExpireIfNotExists(key, val, ttl)
+	case nx:
+		ok = s.cache.SetIfNotExists(key, val)
+	case xx || keepTTL:
+		// Update keeps the expiration of live keys, new keys get the default one
+		_, ok = s.cache.Update(key, func(_ V, exists bool) (V, bool) {
+			return val, exists || !xx
+		})
+		if ok && ttl > 0 {
+			s.cache.ExpireAt(key, time.Now().Add(ttl))
+		}
+	case ttl > 0:
+		s.cache.SetWithExpire(key, val, ttl)
+	default:
+		s.cache.Set(key, val)
+	}
+	if ok {
+		c.simple("OK")
+	} else {
+		c.null()
+	}
+}
+
+// expire sets the TTL of a live key, a TTL of zero or less deletes it like Redis does
+func (s *Server[V]) expire(c *conn, name, key, arg string, unit time.Duration) {
+	n, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil {
+		c.error("ERR value is not an integer or out of range")
+		return
+	}
+	if n > math.MaxInt64/int64(unit) {
+		c.error("ERR invalid expire time in '" + strings.ToLower(name) + "' command")
+		return
+	}
+	var ok bool
+	if n <= 0 {
+		_, ok = s.cache.Delete(key)
+	} else {
+		ok = s.cache.ExpireAt(key, time.Now().Add(time.Duration(n)*unit))
+	}
+	if ok {
+		c.integer(1)
+	} else {
+		c.integer(0)
+	}
+}
+
+// scan runs SCAN cursor [MATCH pattern] [COUNT count] [TYPE type]. Shards are visited in turn and the keys of a shard
+// in the order of their hash, the cursor holds the shard and hash of the next key so keys live during the whole
+// iteration are returned at least once
+func (s *Server[V]) scan(c *conn, args []string) {
+	cursor, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		c.error("ERR invalid cursor")
+		return
+	}
+	var (
+		pattern = "*"
+		count   = defaultScanCount
+		typ     = "string"
+	)
+	for i := 1; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			c.error("ERR syntax error")
+			return
+		}
+		switch strings.ToUpper(args[i]) {
+		case "MATCH":
+			pattern = args[i+1]
+		case "COUNT":
+			if count, err = strconv.Atoi(args[i+1]); err != nil || count < 1 {
+				c.error("ERR value is not an integer or out of range")
+				return
+			}
+		case "TYPE":
+			typ = strings.ToLower(args[i+1])
+		default:
+			c.error("ERR syntax error")
+			return
+		}
+	}
+
+	type entry struct {
+		pos uint64
+		key string
+	}
+	var (
+		keys   []entry
+		next   uint64
+		shards = len(s.cache.ShardLens())
+	)
+	for shard := int(cursor >> scanPositionBits); shard < shards; shard++ {
+		from := len(keys)
+		for _, key := range s.cache.ShardKeys(shard) {
+			if p := position(shard, key); p >= cursor {
+				keys = append(keys, entry{p, key})
+			}
+		}
+		slices.SortFunc(keys[from:], func(a, b entry) int {
+			return cmp.Compare(a.pos, b.pos)
+		})
+		n := from
+		// keys sharing a position are returned together as the cursor could not resume between them
+		for n < len(keys) && (n < count || keys[n].pos == keys[n-1].pos) {
+			n++
+		}
+		if n < len(keys) {
+			next, keys = keys[n].pos, keys[:n]
+			break
+		}
+		if len(keys) >= count && shard+1 < shards {
+			next = uint64(shard+1) << scanPositionBits
+			break
+		}
+	}
+	var matched []string
+	if typ == "string" {
+		for _, e := range keys {
+			if match(pattern, e.key) {
+				matched = append(matched, e.key)
+			}
+		}
+	}
+	c.array(2)
+	c.bulk(strconv.FormatUint(next, 10))
+	c.array(len(matched))
+	for _, key := range matched {
+		c.bulk(key)
+	}
+}
+
+// position returns the SCAN position of key in shard, the shard index above the top bits of the hash of key
+func position(shard int, key string) uint64 {
+	return uint64(shard)<<scanPositionBits | xxh3.HashString(key)>>(64-scanPositionBits)
+}
+
+// match reports whether s matches the Redis glob pattern supporting *, ?, [abc], [^a-z] and \ escapes
+func match(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 1 && pattern[1] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 1 {
+				return true
+			}
+			for i := 0; i <= len(s); i++ {
+				if match(pattern[1:], s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+			s = s[1:]
+			pattern = pattern[1:]
+		case '[':
+			if len(s) == 0 {
+				return false
+			}
+			end := strings.IndexByte(pattern[1:], ']')
+			if end < 0 {
+				// an unterminated class matches its characters like Redis does
+				end = len(pattern) - 1
+			}
+			class := pattern[1 : end+1]
+			negate := strings.HasPrefix(class, "^")
+			if negate {
+				class = class[1:]
+			}
+			found := false
+			for i := 0; i < len(class); i++ {
+				switch {
+				case class[i] == '\\' && i+1 < len(class):
+					i++
+					found = found || class[i] == s[0]
+				case i+2 < len(class) && class[i+1] == '-':
+					lo, hi := min(class[i], class[i+2]), max(class[i], class[i+2])
+					found = found || lo <= s[0] && s[0] <= hi
+					i += 2
+				default:
+					found = found || class[i] == s[0]
+				}
+			}
+			if found == negate {
+				return false
+			}
+			s = s[1:]
+			pattern = pattern[min(end+2, len(pattern)):]
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if len(s) == 0 || s[0] != pattern[0] {
+				return false
+			}
+			s = s[1:]
+			pattern = pattern[1:]
+		}
+	}
+	return len(s) == 0
+}
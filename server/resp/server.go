@@ -0,0 +1,241 @@
+// Package resp serves a gache over the Redis protocol so redis-cli and Redis client libraries can inspect and manipulate
+// an in-process cache, it is meant for debug sockets rather than as a Redis replacement.
+package resp
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ntsd/gache/v2"
+)
+
+const (
+	// maxArgs and maxBulk are the limits Redis applies to the number and size of command arguments
+	maxArgs = 1024 * 1024
+	maxBulk = 512 << 20
+)
+
+// ErrServerClosed is returned by Serve after Close
+var ErrServerClosed = errors.New("resp: server closed")
+
+type (
+	// Option configures New
+	Option func(*options)
+
+	options struct {
+		password string
+	}
+
+	// Server serves a gache over the Redis protocol, it supports PING, ECHO, AUTH, QUIT, GET, SET, DEL, EXISTS,
+	// EXPIRE, PEXPIRE, PERSIST, TTL, PTTL and SCAN
+	Server[V ~string | ~[]byte] struct {
+		cache gache.Gache[V]
+		options
+
+		mu        sync.Mutex
+		closed    bool
+		listeners map[net.Listener]struct{}
+		conns     map[net.Conn]struct{}
+	}
+
+	// conn is the state of a client connection
+	conn struct {
+		r      *bufio.Reader
+		w      *bufio.Writer
+		authed bool
+		quit   bool
+	}
+
+	// protocolError is a malformed request, it is replied to before the connection is closed like Redis does
+	protocolError string
+)
+
+func (e protocolError) Error() string {
+	return "ERR Protocol error: " + string(e)
+}
+
+// WithPassword requires clients to AUTH with password before any other command, the username is ignored
+func WithPassword(password string) Option {
+	return func(o *options) {
+		o.password = password
+	}
+}
+
+// New returns a Server for g
+func New[V ~string | ~[]byte](g gache.Gache[V], opts ...Option) *Server[V] {
+	s := &Server[V]{
+		cache:     g,
+		listeners: make(map[net.Listener]struct{}),
+		conns:     make(map[net.Conn]struct{}),
+	}
+	for _, opt := range opts {
+		opt(&s.options)
+	}
+	return s
+}
+
+// Serve accepts connections on l and serves each in its own goroutine until Close, it then returns ErrServerClosed
+func (s *Server[V]) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		l.Close()
+		return ErrServerClosed
+	}
+	s.listeners[l] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.listeners, l)
+		s.mu.Unlock()
+	}()
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return ErrServerClosed
+			}
+			return err
+		}
+		go s.ServeConn(c)
+	}
+}
+
+// ServeConn serves the commands of c until the client quits or disconnects, c is closed on return
+func (s *Server[V]) ServeConn(c net.Conn) {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		c.Close()
+		return
+	}
+	s.conns[c] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, c)
+		s.mu.Unlock()
+		c.Close()
+	}()
+
+	cn := &conn{r: bufio.NewReader(c), w: bufio.NewWriter(c), authed: s.password == ""}
+	for !cn.quit {
+		args, err := cn.read()
+		if err != nil {
+			var perr protocolError
+			if errors.As(err, &perr) {
+				cn.error(perr.Error())
+				cn.w.Flush()
+			}
+			return
+		}
+		if len(args) > 0 {
+			s.exec(cn, args)
+		}
+		// pipelined commands are replied to in one write
+		if cn.r.Buffered() == 0 || cn.quit {
+			if err := cn.w.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// Close stops the listeners of Serve and closes all connections
+func (s *Server[V]) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	var err error
+	for l := range s.listeners {
+		err = errors.Join(err, l.Close())
+	}
+	for c := range s.conns {
+		c.Close()
+	}
+	return err
+}
+
+// read reads a command sent as an array of bulk strings or as an inline command
+func (c *conn) read() ([]string, error) {
+	line, err := c.line()
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 || line[0] != '*' {
+		return strings.Fields(line), nil
+	}
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n > maxArgs {
+		return nil, protocolError("invalid multibulk length")
+	}
+	args := make([]string, 0, max(n, 0))
+	for range n {
+		line, err := c.line()
+		if err != nil {
+			return nil, err
+		}
+		if len(line) == 0 || line[0] != '$' {
+			return nil, protocolError("expected '$', got '" + line + "'")
+		}
+		l, err := strconv.Atoi(line[1:])
+		if err != nil || l < 0 || l > maxBulk {
+			return nil, protocolError("invalid bulk length")
+		}
+		b := make([]byte, l+2)
+		if _, err := io.ReadFull(c.r, b); err != nil {
+			return nil, err
+		}
+		if string(b[l:]) != "\r\n" {
+			return nil, protocolError("bulk string not terminated by CRLF")
+		}
+		args = append(args, string(b[:l]))
+	}
+	return args, nil
+}
+
+// line reads a line without its line ending, inline commands may end with a bare LF
+func (c *conn) line() (string, error) {
+	b, err := c.r.ReadSlice('\n')
+	if errors.Is(err, bufio.ErrBufferFull) {
+		return "", protocolError("too big request line")
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(string(b[:len(b)-1]), "\r"), nil
+}
+
+func (c *conn) simple(s string) {
+	c.w.WriteString("+" + s + "\r\n")
+}
+
+func (c *conn) error(s string) {
+	c.w.WriteString("-" + s + "\r\n")
+}
+
+func (c *conn) integer(n int64) {
+	c.w.WriteString(":" + strconv.FormatInt(n, 10) + "\r\n")
+}
+
+func (c *conn) bulk(s string) {
+	c.w.WriteString("$" + strconv.Itoa(len(s)) + "\r\n")
+	c.w.WriteString(s)
+	c.w.WriteString("\r\n")
+}
+
+func (c *conn) null() {
+	c.w.WriteString("$-1\r\n")
+}
+
+func (c *conn) array(n int) {
+	c.w.WriteString("*" + strconv.Itoa(n) + "\r\n")
+}
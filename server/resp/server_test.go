@@ -0,0 +1,260 @@
+package resp
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ntsd/gache/v2"
+)
+
+// client sends commands as RESP arrays and returns the replies in their wire form without line endings
+type client struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func serve(t *testing.T, g gache.Gache[string], opts ...Option) (*Server[string], *client) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := New(g, opts...)
+	done := make(chan error, 1)
+	go func() { done <- s.Serve(l) }()
+	t.Cleanup(func() {
+		s.Close()
+		if err := <-done; !errors.Is(err, ErrServerClosed) {
+			t.Errorf("Serve after Close = %v, want %v", err, ErrServerClosed)
+		}
+	})
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	return s, &client{t: t, conn: conn, r: bufio.NewReader(conn)}
+}
+
+func (c *client) send(args ...string) {
+	c.t.Helper()
+	var b strings.Builder
+	b.WriteString("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, arg := range args {
+		b.WriteString("$" + strconv.Itoa(len(arg)) + "\r\n" + arg + "\r\n")
+	}
+	if _, err := c.conn.Write([]byte(b.String())); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func (c *client) reply() string {
+	c.t.Helper()
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	switch line[0] {
+	case '$':
+		l, _ := strconv.Atoi(line[1:])
+		if l < 0 {
+			return line
+		}
+		b := make([]byte, l+2)
+		if _, err := io.ReadFull(c.r, b); err != nil {
+			c.t.Fatal(err)
+		}
+		return string(b[:l])
+	case '*':
+		l, _ := strconv.Atoi(line[1:])
+		items := make([]string, l)
+		for i := range items {
+			items[i] = c.reply()
+		}
+		return "[" + strings.Join(items, " ") + "]"
+	}
+	return line
+}
+
+func (c *client) do(args ...string) string {
+	c.t.Helper()
+	c.send(args...)
+	return c.reply()
+}
+
+func TestServer(t *testing.T) {
+	g := gache.New[string]()
+	g.SetDefaultExpire(gache.NoTTL)
+	_, c := serve(t, g)
+
+	for _, tc := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"PING"}, "+PONG"},
+		{[]string{"ping", "hi"}, "hi"},
+		{[]string{"ECHO", "hello"}, "hello"},
+		{[]string{"GET", "a"}, "$-1"},
+		{[]string{"SET", "a", "1"}, "+OK"},
+		{[]string{"GET", "a"}, "1"},
+		{[]string{"TTL", "a"}, ":-1"},
+		{[]string{"SET", "a", "2", "NX"}, "$-1"},
+		{[]string{"SET", "b", "2", "XX"}, "$-1"},
+		{[]string{"SET", "a", "2", "XX", "EX", "100"}, "+OK"},
+		{[]string{"GET", "a"}, "2"},
+		{[]string{"TTL", "a"}, ":100"},
+		{[]string{"SET", "a", "3", "KEEPTTL"}, "+OK"},
+		{[]string{"TTL", "a"}, ":100"},
+		{[]string{"SET", "b", "1", "PX", "5000", "NX"}, "+OK"},
+		{[]string{"PTTL", "b"}, ":5000"},
+		{[]string{"PERSIST", "b"}, ":1"},
+		{[]string{"PERSIST", "b"}, ":0"},
+		{[]string{"TTL", "missing"}, ":-2"},
+		{[]string{"EXPIRE", "b", "60"}, ":1"},
+		{[]string{"TTL", "b"}, ":60"},
+		{[]string{"EXPIRE", "missing", "60"}, ":0"},
+		{[]string{"PEXPIRE", "b", "0"}, ":1"},
+		{[]string{"EXISTS", "a", "b", "a"}, ":2"},
+		{[]string{"SET", "c", "1"}, "+OK"},
+		{[]string{"DEL", "a", "c", "missing"}, ":2"},
+		{[]string{"EXISTS", "a"}, ":0"},
+		{[]string{"SET", "a", "1", "EX", "0"}, "-ERR invalid expire time in 'set' command"},
+		{[]string{"SET", "a", "1", "EX", "x"}, "-ERR value is not an integer or out of range"},
+		{[]string{"SET", "a", "1", "NX", "XX"}, "-ERR syntax error"},
+		{[]string{"SET", "a", "1", "EX", "1", "KEEPTTL"}, "-ERR syntax error"},
+		{[]string{"GET"}, "-ERR wrong number of arguments for 'get' command"},
+		{[]string{"FLUSHALL"}, "-ERR unknown command 'FLUSHALL'"},
+		{[]string{"AUTH", "secret"}, "-ERR AUTH called without any password configured"},
+	} {
+		// PTTL may lose a millisecond between the commands
+		if got := c.do(tc.args...); got != tc.want && !(tc.args[0] == "PTTL" && got == ":4999") {
+			t.Errorf("%v = %q, want %q", tc.args, got, tc.want)
+		}
+	}
+
+	// pipelined and inline commands
+	c.conn.Write([]byte("*3\r\n$3\r\nSET\r\n$1\r\nx\r\n$5\r\nhello\r\nGET x\r\nEXISTS  x\n"))
+	for _, want := range []string{"+OK", "hello", ":1"} {
+		if got := c.reply(); got != want {
+			t.Errorf("pipelined reply = %q, want %q", got, want)
+		}
+	}
+	if v, ok := g.Get("x"); !ok || v != "hello" {
+		t.Fatalf("Get(x) = %q, %v", v, ok)
+	}
+
+	if got := c.do("QUIT"); got != "+OK" {
+		t.Fatalf("QUIT = %q", got)
+	}
+	if _, err := c.r.ReadByte(); err == nil {
+		t.Fatal("connection open after QUIT")
+	}
+}
+
+func TestServerAuth(t *testing.T) {
+	_, c := serve(t, gache.New[string](), WithPassword("secret"))
+	if got := c.do("GET", "a"); got != "-NOAUTH Authentication required." {
+		t.Fatalf("GET before AUTH = %q", got)
+	}
+	if got := c.do("AUTH", "wrong"); !strings.HasPrefix(got, "-WRONGPASS") {
+		t.Fatalf("AUTH with wrong password = %q", got)
+	}
+	if got := c.do("AUTH", "default", "secret"); got != "+OK" {
+		t.Fatalf("AUTH = %q", got)
+	}
+	if got := c.do("GET", "a"); got != "$-1" {
+		t.Fatalf("GET after AUTH = %q", got)
+	}
+}
+
+func TestServerProtocolError(t *testing.T) {
+	_, c := serve(t, gache.New[string]())
+	c.conn.Write([]byte("*1\r\n+GET\r\n"))
+	if got := c.reply(); got != "-ERR Protocol error: expected '$', got '+GET'" {
+		t.Fatalf("reply to malformed request = %q", got)
+	}
+	if _, err := c.r.ReadByte(); err == nil {
+		t.Fatal("connection open after protocol error")
+	}
+}
+
+func TestScan(t *testing.T) {
+	g := gache.New[string]()
+	var want []string
+	for i := range 50 {
+		key := "user:" + strconv.Itoa(i)
+		g.Set(key, "v")
+		want = append(want, key)
+		g.Set("session:"+strconv.Itoa(i), "v")
+	}
+	_, c := serve(t, g)
+
+	var got []string
+	cursor, calls := "0", 0
+	for {
+		c.send("SCAN", cursor, "MATCH", "user:*", "COUNT", "7")
+		line, _ := c.r.ReadString('\n')
+		if line != "*2\r\n" {
+			t.Fatalf("SCAN reply header = %q", line)
+		}
+		cursor = c.reply()
+		keys := c.reply()
+		if keys = strings.Trim(keys, "[]"); keys != "" {
+			got = append(got, strings.Fields(keys)...)
+		}
+		if calls++; cursor == "0" || calls > 100 {
+			break
+		}
+	}
+	if calls < 100/7 {
+		t.Fatalf("SCAN returned all keys in %d calls with COUNT 7", calls)
+	}
+	slices.Sort(got)
+	slices.Sort(want)
+	if !slices.Equal(got, want) {
+		t.Fatalf("SCAN MATCH user:* = %v, want %v", got, want)
+	}
+	if got := c.do("SCAN", "0", "COUNT", "1000", "TYPE", "hash"); got != "[0 []]" {
+		t.Fatalf("SCAN TYPE hash = %q", got)
+	}
+	if got := c.do("SCAN", "x"); got != "-ERR invalid cursor" {
+		t.Fatalf("SCAN with invalid cursor = %q", got)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	for _, tc := range []struct {
+		pattern, s string
+		want       bool
+	}{
+		{"*", "", true},
+		{"*", "abc", true},
+		{"a*c", "abbbc", true},
+		{"a*c", "abbb", false},
+		{"a?c", "abc", true},
+		{"a?c", "ac", false},
+		{"h[ae]llo", "hallo", true},
+		{"h[ae]llo", "hillo", false},
+		{"h[^e]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-c]llo", "hbllo", true},
+		{"h[a-c]llo", "hdllo", false},
+		{`a\*`, "a*", true},
+		{`a\*`, "ab", false},
+		{"user:*:name", "user:1:name", true},
+		{"user:*:name", "user:1:email", false},
+	} {
+		if got := match(tc.pattern, tc.s); got != tc.want {
+			t.Errorf("match(%q, %q) = %v, want %v", tc.pattern, tc.s, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package gache
+
+import (
+	"reflect"
+	"unsafe"
+)
+
+// Sizer is implemented by values reporting their own memory usage in bytes to WithMaxMemory
+type Sizer interface {
+	Size() uintptr
+}
+
+// entrySize estimates the memory used by key & val stored in the cache
+func entrySize[V any](key string, val V) int64 {
+	size := unsafe.Sizeof(key) + uintptr(len(key)) + unsafe.Sizeof(value[V]{}) + unsafe.Sizeof(uintptr(0))*2
+	if s, ok := any(val).(Sizer); ok {
+		size += s.Size()
+	} else {
+		size += sizeOf(reflect.ValueOf(&val).Elem(), make(map[uintptr]bool)) - unsafe.Sizeof(val)
+	}
+	return int64(size)
+}
+
+// sizeOf estimates the memory used by v including the memory it references, seen breaks pointer cycles
+func sizeOf(v reflect.Value, seen map[uintptr]bool) uintptr {
+	size := v.Type().Size()
+	switch v.Kind() {
+	case reflect.String:
+		size += uintptr(v.Len())
+	case reflect.Slice:
+		if v.IsNil() || seen[v.Pointer()] {
+			break
+		}
+		seen[v.Pointer()] = true
+		size += uintptr(v.Cap()-v.Len()) * v.Type().Elem().Size()
+		for i := 0; i < v.Len(); i++ {
+			size += sizeOf(v.Index(i), seen)
+		}
+	case reflect.Array:
+		size = 0
+		for i := 0; i < v.Len(); i++ {
+			size += sizeOf(v.Index(i), seen)
+		}
+		if v.Len() == 0 {
+			size = v.Type().Size()
+		}
+	case reflect.Map:
+		if v.IsNil() || seen[v.Pointer()] {
+			break
+		}
+		seen[v.Pointer()] = true
+		for it := v.MapRange(); it.Next(); {
+			size += sizeOf(it.Key(), seen) + sizeOf(it.Value(), seen)
+		}
+	case reflect.Pointer:
+		if v.IsNil() || seen[v.Pointer()] {
+			break
+		}
+		seen[v.Pointer()] = true
+		size += sizeOf(v.Elem(), seen)
+	case reflect.Interface:
+		if !v.IsNil() {
+			size += sizeOf(v.Elem(), seen)
+		}
+	case reflect.Struct:
+		size = v.Type().Size()
+		for i := 0; i < v.NumField(); i++ {
+			size += sizeOf(v.Field(i), seen) - v.Field(i).Type().Size()
+		}
+	}
+	return size
+}
@@ -0,0 +1,653 @@
+package gache
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kpango/fastime"
+	"github.com/zeebo/xxh3"
+)
+
+const (
+	// snapshotMagic starts every snapshot written since version 2, older snapshots are a bare gob encoded map
+	snapshotMagic = "GACHE"
+
+	// snapshotVersion is the format written by Write, version 2 is a gob stream of records with absolute expirations.
+	// Version 3 follows the version with the Compression byte, the length-prefixed name of the Codec and the encryption
+	// mode, key ID and nonce, then a sequence of uvarint length-prefixed frames each holding an encoded batch of records
+	// and the big endian xxh3 checksum of the batch. An empty frame, the uvarint entry count and the big endian xxh3
+	// checksum of all the frames end the stream.
+	snapshotVersion = 3
+
+	// snapshotFrameRecords is the number of records encoded per frame
+	snapshotFrameRecords = 1024
+
+	// maxSnapshotFrame is the largest frame length accepted by Read
+	maxSnapshotFrame = 1 << 30
+)
+
+var (
+	// ErrCorruptSnapshot is returned by Read for truncated or malformed snapshots and checksum mismatches
+	ErrCorruptSnapshot = errors.New("gache: corrupt snapshot")
+
+	// ErrUnsupportedSnapshot is returned by Read for snapshot versions, compressions, encryptions or codecs it cannot decode
+	ErrUnsupportedSnapshot = errors.New("gache: unsupported snapshot")
+
+	// ErrSnapshotKey is returned by Read for encrypted snapshots without the key set by WithSnapshotEncryption or with another key
+	ErrSnapshotKey = errors.New("gache: snapshot key mismatch")
+)
+
+type (
+	// ReadOption configures how Read stores the entries of a snapshot
+	ReadOption[V any] func(*readOptions[V])
+
+	readOptions[V any] struct {
+		resolve func(key string, existing, incoming V, existingExp, incomingExp int64) (V, int64, bool)
+		filter  func(string) bool
+		ttl     func(string, time.Duration) time.Duration
+		report  *ReadStats
+	}
+
+	// ReadStats counts the entries of a snapshot read by Read with ReadReport
+	ReadStats struct {
+		// Loaded is the number of entries stored or merged into the cache
+		Loaded int
+		// Skipped is the number of entries dropped by FilterKeys
+		Skipped int
+		// Expired is the number of entries already expired in the snapshot
+		Expired int
+	}
+)
+
+// SnapshotInfo is the header of a snapshot, snapshots of version 1 have no header and report the gob codec
+type SnapshotInfo struct {
+	Version     int
+	Compression Compression
+	Codec       string
+	Encrypted   bool
+}
+
+// record is a snapshot entry, Expire is the unix nano expiration where zero or negative never expires
+type record[V any] struct {
+	Key    string `json:"key"`
+	Value  V      `json:"value"`
+	Expire int64  `json:"expire"`
+}
+
+// Write writes all cached data with their expirations to writer
+func (g *gache[V]) Write(ctx context.Context, w io.Writer) error {
+	return g.writeSnapshot(ctx, w, nil, nil)
+}
+
+// WriteTransform writes all cached data to writer mapping each value through encode, false drops the entry
+func (g *gache[V]) WriteTransform(ctx context.Context, w io.Writer, encode func(V) (V, bool)) error {
+	return g.writeSnapshot(ctx, w, nil, encode)
+}
+
+// writeSnapshot encodes the live entries read by Read, shards are encoded in parallel into frames of at most
+// snapshotFrameRecords records so memory stays bounded by the number of workers regardless of the cache size.
+// strip maps stored keys to written keys and false skips the key, encode maps values when it is set.
+func (g *gache[V]) writeSnapshot(ctx context.Context, w io.Writer, strip func(string) (string, bool), encode func(V) (V, bool)) (err error) {
+	defer func() {
+		if err != nil {
+			g.log(context.Background(), slog.LevelWarn, "gache: snapshot write failed", "error", err)
+		}
+	}()
+	codec := g.snapshotCodec()
+	if len(codec.Name()) > math.MaxUint8 {
+		return fmt.Errorf("gache: codec name %q exceeds %d bytes", codec.Name(), math.MaxUint8)
+	}
+	encryption, ew, err := g.encryptionHeader(w)
+	if err != nil {
+		return err
+	}
+	header := append([]byte(snapshotMagic), snapshotVersion, byte(g.compression), byte(len(codec.Name())))
+	header = append(append(header, codec.Name()...), encryption...)
+	if _, err = w.Write(header); err != nil {
+		return err
+	}
+	cw, err := compressor(ew, g.compression)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	shards := make(chan *Map[string, *value[V]], len(g.shards))
+	for _, shard := range g.shards {
+		shards <- shard
+	}
+	close(shards)
+	workers := min(runtime.GOMAXPROCS(0), len(g.shards))
+	frames := make(chan []byte, workers)
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		encErr error
+		n      atomic.Int64
+	)
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			batch := make([]record[V], 0, snapshotFrameRecords)
+			flush := func() bool {
+				b, err := codec.Marshal(batch)
+				if err != nil {
+					mu.Lock()
+					encErr = cmp.Or(encErr, err)
+					mu.Unlock()
+					cancel()
+					return false
+				}
+				n.Add(int64(len(batch)))
+				batch = batch[:0]
+				select {
+				case frames <- b:
+					return true
+				case <-ctx.Done():
+					return false
+				}
+			}
+			for shard := range shards {
+				for k, v := range shard.RangeIter() {
+					if ctx.Err() != nil {
+						return
+					}
+					if !g.valid(v) {
+						continue
+					}
+					if strip != nil {
+						var ok bool
+						if k, ok = strip(k); !ok {
+							continue
+						}
+					}
+					val := v.val
+					if encode != nil {
+						var ok bool
+						if val, ok = encode(val); !ok {
+							continue
+						}
+					}
+					batch = append(batch, record[V]{Key: k, Value: val, Expire: v.expire})
+					if len(batch) == snapshotFrameRecords && !flush() {
+						return
+					}
+				}
+			}
+			if len(batch) != 0 {
+				flush()
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(frames)
+	}()
+	h := xxh3.New()
+	fw := io.MultiWriter(cw, h)
+	for b := range frames {
+		if err == nil {
+			if err = writeFrame(fw, b); err != nil {
+				cancel()
+			}
+		}
+	}
+	// frames dropped by a canceled ctx are counted in n, the trailer is skipped so the snapshot fails to read
+	if err = cmp.Or(err, encErr, ctx.Err()); err != nil {
+		return err
+	}
+	trailer := binary.AppendUvarint([]byte{0}, uint64(n.Load()))
+	if _, err = cw.Write(binary.BigEndian.AppendUint64(trailer, h.Sum64())); err != nil {
+		return err
+	}
+	if err = cmp.Or(cw.Close(), ew.Close()); err != nil {
+		return err
+	}
+	g.log(context.Background(), slog.LevelDebug, "gache: snapshot written", "entries", n.Load())
+	return nil
+}
+
+// snapshotCodec returns the codec set by WithCodec or gob
+func (g *gache[V]) snapshotCodec() Codec {
+	if g.codec != nil {
+		return g.codec
+	}
+	return gobCodec{}
+}
+
+// writeFrame writes b prefixed by its uvarint length and followed by its checksum
+func writeFrame(w io.Writer, b []byte) error {
+	var prefix [binary.MaxVarintLen64]byte
+	if _, err := w.Write(prefix[:binary.PutUvarint(prefix[:], uint64(len(b)))]); err != nil {
+		return err
+	}
+	if _, err := w.Write(b); err != nil {
+		return err
+	}
+	_, err := w.Write(binary.BigEndian.AppendUint64(nil, xxh3.Hash(b)))
+	return err
+}
+
+// Read reads reader data to cache restoring their expirations, entries already expired are skipped.
+// Live keys are overwritten unless KeepExisting or MergeWith is passed, FilterKeys, RemapTTL and ReadReport select, retime and count the entries.
+func (g *gache[V]) Read(r io.Reader, opts ...ReadOption[V]) error {
+	return g.ReadContext(context.Background(), r, opts...)
+}
+
+// ReadContext is Read checking ctx between records and returning its error once done. Entries are stored frame by frame
+// once the checksum of their frame matches so memory does not grow with the snapshot, an abort or a corruption found
+// later in the snapshot keeps the entries of the frames verified so far and ReadReport counts those as loaded.
+func (g *gache[V]) ReadContext(ctx context.Context, r io.Reader, opts ...ReadOption[V]) error {
+	l := g.restorer(opts, "")
+	expired, err := g.readRecords(ctx, r, l.store)
+	return l.done(expired, err)
+}
+
+// KeepExisting makes Read skip the entries of keys live in the cache
+func KeepExisting[V any]() ReadOption[V] {
+	return func(o *readOptions[V]) {
+		o.resolve = func(_ string, existing, _ V, existingExp, _ int64) (V, int64, bool) {
+			return existing, existingExp, true
+		}
+	}
+}
+
+// Overwrite makes Read replace the values of keys live in the cache, it is the default
+func Overwrite[V any]() ReadOption[V] {
+	return func(o *readOptions[V]) {
+		o.resolve = nil
+	}
+}
+
+// CapTTL makes Read restore entries expiring later than max, or never, with max as TTL
+func CapTTL[V any](max time.Duration) ReadOption[V] {
+	return RemapTTL[V](func(_ string, ttl time.Duration) time.Duration {
+		if ttl <= 0 || ttl > max {
+			return max
+		}
+		return ttl
+	})
+}
+
+// RemapTTL makes Read restore entries with the TTL returned by f for the remaining TTL of the snapshot entry,
+// entries without expiration are passed NoTTL and a returned zero or negative TTL restores the entry without expiration
+func RemapTTL[V any](f func(key string, ttl time.Duration) time.Duration) ReadOption[V] {
+	return func(o *readOptions[V]) {
+		o.ttl = f
+	}
+}
+
+// FilterKeys makes Read skip the entries of keys for which keep returns false
+func FilterKeys[V any](keep func(key string) bool) ReadOption[V] {
+	return func(o *readOptions[V]) {
+		o.filter = keep
+	}
+}
+
+// ReadReport makes Read store the counts of the entries it loaded and skipped in s
+func ReadReport[V any](s *ReadStats) ReadOption[V] {
+	return func(o *readOptions[V]) {
+		o.report = s
+	}
+}
+
+// MergeWith makes Read store the result of merge for keys live in the cache, it expires at the later of both expirations
+func MergeWith[V any](merge func(key string, existing, incoming V) V) ReadOption[V] {
+	return func(o *readOptions[V]) {
+		o.resolve = func(key string, existing, incoming V, existingExp, incomingExp int64) (V, int64, bool) {
+			return merge(key, existing, incoming), laterExpire(existingExp, incomingExp), true
+		}
+	}
+}
+
+// restorer stores the records of a Read one at a time by the policy of its options
+type restorer[V any] struct {
+	g       *gache[V]
+	o       readOptions[V]
+	prefix  string
+	resolve func(key string, existing, incoming V, existingExp, incomingExp int64) (V, int64, bool)
+	stats   ReadStats
+}
+
+// restorer returns the restorer of opts, prefix is cut from the keys passed to the option functions
+func (g *gache[V]) restorer(opts []ReadOption[V], prefix string) *restorer[V] {
+	l := &restorer[V]{g: g, prefix: prefix}
+	for _, opt := range opts {
+		opt(&l.o)
+	}
+	if l.o.resolve != nil {
+		l.resolve = func(key string, existing, incoming V, existingExp, incomingExp int64) (V, int64, bool) {
+			return l.o.resolve(key[len(prefix):], existing, incoming, existingExp, incomingExp)
+		}
+	}
+	return l
+}
+
+// store stores rec unless FilterKeys drops it
+func (l *restorer[V]) store(rec record[V]) {
+	key := rec.Key[len(l.prefix):]
+	if l.o.filter != nil && !l.o.filter(key) {
+		l.stats.Skipped++
+		return
+	}
+	if l.o.ttl != nil {
+		now := fastime.UnixNanoNow()
+		ttl := NoTTL
+		if rec.Expire > 0 {
+			ttl = time.Duration(rec.Expire - now)
+		}
+		if ttl = l.o.ttl(key, ttl); ttl > 0 {
+			rec.Expire = now + ttl.Nanoseconds()
+		} else {
+			rec.Expire = NoTTL.Nanoseconds()
+		}
+	}
+	if l.resolve != nil {
+		l.g.merge(rec, l.resolve)
+	} else {
+		l.g.restore(rec.Key, rec.Value, rec.Expire)
+	}
+	l.stats.Loaded++
+}
+
+// done stores the counts to ReadReport and returns err
+func (l *restorer[V]) done(expired int, err error) error {
+	if l.o.report != nil {
+		l.stats.Expired = expired
+		*l.o.report = l.stats
+	}
+	return err
+}
+
+// laterExpire returns the later of two unix nano expirations where zero or negative never expires
+func laterExpire(a, b int64) int64 {
+	if a <= 0 {
+		return a
+	}
+	if b <= 0 {
+		return b
+	}
+	return max(a, b)
+}
+
+// ReadTransform reads reader data to cache mapping each value through decode, false drops the entry
+func (g *gache[V]) ReadTransform(r io.Reader, decode func(V) (V, bool)) error {
+	_, err := g.readRecords(context.Background(), r, func(rec record[V]) {
+		if v, ok := decode(rec.Value); ok {
+			g.restore(rec.Key, v, rec.Expire)
+		}
+	})
+	return err
+}
+
+// ReadWithResolver reads reader data to cache and calls resolve for keys already live in the cache.
+// resolve returns the winning value & unix nano expiration, or false to delete the key, incoming entries keep their written expiration.
+func (g *gache[V]) ReadWithResolver(r io.Reader, resolve func(key string, existing, incoming V, existingExp, incomingExp int64) (V, int64, bool)) error {
+	_, err := g.readRecords(context.Background(), r, func(rec record[V]) {
+		g.merge(rec, resolve)
+	})
+	return err
+}
+
+// restore sets key-value with unix nano expiration
+func (g *gache[V]) restore(key string, val V, expire int64) {
+	g.update(g.shard(key), key, func(*value[V]) (*value[V], bool) {
+		return &value[V]{expire: expire, val: val}, true
+	})
+}
+
+// merge sets the record and calls resolve when its key is already live in the cache
+func (g *gache[V]) merge(r record[V], resolve func(key string, existing, incoming V, existingExp, incomingExp int64) (V, int64, bool)) {
+	shard := g.shard(r.Key)
+	for {
+		drop := false
+		old, _ := g.update(shard, r.Key, func(old *value[V]) (*value[V], bool) {
+			drop = false
+			if old == nil || !g.valid(old) {
+				return &value[V]{expire: r.Expire, val: r.Value}, true
+			}
+			val, expire, ok := resolve(r.Key, old.val, r.Value, old.expire, r.Expire)
+			if !ok {
+				drop = true
+				return nil, false
+			}
+			return &value[V]{expire: expire, val: val}, true
+		})
+		if !drop || g.compareAndDelete(shard, r.Key, old) {
+			return
+		}
+	}
+}
+
+// readRecords decodes the records written by Write until ctx is done, passes the unexpired ones to store as they are
+// decoded and counts the expired ones. Snapshots without a header get the default expiration.
+func (g *gache[V]) readRecords(ctx context.Context, r io.Reader, store func(record[V])) (expired int, err error) {
+	var n int
+	defer func() {
+		if err != nil {
+			g.log(context.Background(), slog.LevelWarn, "gache: snapshot decode failed", "error", err)
+			return
+		}
+		g.log(context.Background(), slog.LevelDebug, "gache: snapshot read", "entries", n, "expired", expired)
+	}()
+	br := bufio.NewReader(r)
+	info, err := readSnapshotHeader(br)
+	if err != nil {
+		return 0, err
+	}
+	if info.Version == 1 {
+		n, err = g.readLegacy(ctx, br, store)
+		return 0, err
+	}
+	now := fastime.UnixNanoNow()
+	keep := func(rec record[V]) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if rec.Expire <= 0 || rec.Expire >= now {
+			store(rec)
+			n++
+		} else {
+			expired++
+		}
+		return nil
+	}
+	if info.Version == 2 {
+		dec := gob.NewDecoder(br)
+		for {
+			var rec record[V]
+			if err := dec.Decode(&rec); err != nil {
+				if errors.Is(err, io.EOF) {
+					return expired, ctx.Err()
+				}
+				return expired, corrupt(err)
+			}
+			if err := keep(rec); err != nil {
+				return expired, err
+			}
+		}
+	}
+	return expired, g.readFrames(ctx, br, info, keep)
+}
+
+// ReadSnapshotInfo reads the header of a snapshot written by Write without decoding its entries, r is read past the header
+func ReadSnapshotInfo(r io.Reader) (SnapshotInfo, error) {
+	br := bufio.NewReader(r)
+	info, err := readSnapshotHeader(br)
+	if err != nil || info.Version < snapshotVersion {
+		return info, err
+	}
+	mode, err := br.ReadByte()
+	if err != nil {
+		return info, readErr(err)
+	}
+	info.Encrypted = mode != encryptionNone
+	return info, nil
+}
+
+// readSnapshotHeader reads the magic, version, compression and codec name of a snapshot, it reads nothing from
+// snapshots of version 1
+func readSnapshotHeader(br *bufio.Reader) (SnapshotInfo, error) {
+	info := SnapshotInfo{Version: 1, Codec: gobCodec{}.Name()}
+	head, _ := br.Peek(len(snapshotMagic) + 1)
+	if len(head) <= len(snapshotMagic) || string(head[:len(snapshotMagic)]) != snapshotMagic {
+		return info, nil
+	}
+	br.Discard(len(head))
+	if info.Version = int(head[len(snapshotMagic)]); info.Version < 2 || info.Version > snapshotVersion {
+		return info, fmt.Errorf("%w: version %d", ErrUnsupportedSnapshot, info.Version)
+	}
+	if info.Version == 2 {
+		return info, nil
+	}
+	b, err := br.ReadByte()
+	if err != nil {
+		return info, readErr(err)
+	}
+	if info.Compression = Compression(b); info.Compression > Snappy {
+		return info, fmt.Errorf("%w: compression %s", ErrUnsupportedSnapshot, info.Compression)
+	}
+	l, err := br.ReadByte()
+	if err != nil {
+		return info, readErr(err)
+	}
+	name := make([]byte, l)
+	if _, err := io.ReadFull(br, name); err != nil {
+		return info, readErr(err)
+	}
+	info.Codec = string(name)
+	return info, nil
+}
+
+// readFrames decodes the frames of a snapshot following its header until ctx is done, keep receives every record
+func (g *gache[V]) readFrames(ctx context.Context, br *bufio.Reader, info SnapshotInfo, keep func(record[V]) error) error {
+	codec, compression := g.snapshotCodec(), info.Compression
+	if info.Codec != codec.Name() {
+		return fmt.Errorf("%w: encoded by %q codec, reading with %q codec", ErrUnsupportedSnapshot, info.Codec, codec.Name())
+	}
+	er, err := g.decryptor(br)
+	if err != nil {
+		return err
+	}
+	dr, err := decompressor(er, compression)
+	if err != nil {
+		return corrupt(err)
+	}
+	defer dr.Close()
+	fr := er
+	if compression != NoCompression {
+		fr = bufio.NewReader(dr)
+	}
+	h := xxh3.New()
+	var (
+		n      uint64
+		prefix [binary.MaxVarintLen64]byte
+	)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		l, err := binary.ReadUvarint(fr)
+		if err != nil {
+			return readErr(err)
+		}
+		if l == 0 {
+			break
+		}
+		if l > maxSnapshotFrame {
+			return fmt.Errorf("%w: frame of %d bytes exceeds limit", ErrCorruptSnapshot, l)
+		}
+		b := make([]byte, l+8)
+		if _, err := io.ReadFull(fr, b); err != nil {
+			return readErr(err)
+		}
+		h.Write(prefix[:binary.PutUvarint(prefix[:], l)])
+		h.Write(b)
+		// the records of a frame are only stored once its checksum matches
+		if xxh3.Hash(b[:l]) != binary.BigEndian.Uint64(b[l:]) {
+			return fmt.Errorf("%w: frame checksum mismatch", ErrCorruptSnapshot)
+		}
+		var batch []record[V]
+		if err := codec.Unmarshal(b[:l], &batch); err != nil {
+			return corrupt(err)
+		}
+		n += uint64(len(batch))
+		for _, rec := range batch {
+			if err := keep(rec); err != nil {
+				return err
+			}
+		}
+	}
+	count, err := binary.ReadUvarint(fr)
+	if err != nil {
+		return readErr(err)
+	}
+	var sum [8]byte
+	if _, err := io.ReadFull(fr, sum[:]); err != nil {
+		return readErr(err)
+	}
+	if count != n {
+		return fmt.Errorf("%w: %d entries decoded, header records %d", ErrCorruptSnapshot, n, count)
+	}
+	if binary.BigEndian.Uint64(sum[:]) != h.Sum64() {
+		return fmt.Errorf("%w: checksum mismatch", ErrCorruptSnapshot)
+	}
+	if er != br {
+		// decompressors may stop before the end of the encrypted stream, its final chunk must still authenticate
+		if _, err := io.Copy(io.Discard, er); err != nil {
+			return readErr(err)
+		}
+	}
+	return nil
+}
+
+// corrupt marks err as a malformed snapshot
+func corrupt(err error) error {
+	if errors.Is(err, ErrCorruptSnapshot) {
+		return err
+	}
+	if errors.Is(err, io.EOF) {
+		err = io.ErrUnexpectedEOF
+	}
+	return fmt.Errorf("%w: %w", ErrCorruptSnapshot, err)
+}
+
+// readErr marks err as a truncated snapshot when the reader ended early
+func readErr(err error) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return corrupt(err)
+	}
+	return err
+}
+
+// readLegacy decodes a snapshot of version 1 which stores values without expiration and passes its entries to store
+func (g *gache[V]) readLegacy(ctx context.Context, r io.Reader, store func(record[V])) (n int, err error) {
+	var m map[string]V
+	gob.Register(map[string]V{})
+	if err := gob.NewDecoder(r).Decode(&m); err != nil {
+		return 0, corrupt(err)
+	}
+	expire := absExpire(atomic.LoadInt64(&g.expire))
+	for k, v := range m {
+		if err := ctx.Err(); err != nil {
+			return n, err
+		}
+		store(record[V]{Key: k, Value: v, Expire: expire})
+		n++
+	}
+	return n, nil
+}
@@ -0,0 +1,110 @@
+package gache
+
+import (
+	"context"
+
+	"github.com/zeebo/xxh3"
+)
+
+// digestBuckets is the number of buckets of Digest
+const digestBuckets = 256
+
+// Digest returns the hashes of the keys and write times of the live entries in digestBuckets buckets of keys,
+// two caches holding the same writes have equal digests and a differing bucket narrows down where they diverge.
+func (g *gache[V]) Digest(ctx context.Context) []uint64 {
+	return g.digest(ctx, nil)
+}
+
+// digest implements Digest for the keys strip accepts, renamed to the key it returns
+func (g *gache[V]) digest(ctx context.Context, strip func(string) (string, bool)) []uint64 {
+	d := make([]uint64, digestBuckets)
+	for _, s := range g.shards {
+		if ctx.Err() != nil {
+			break
+		}
+		for k, v := range s.RangeIter() {
+			if strip != nil {
+				var ok bool
+				if k, ok = strip(k); !ok {
+					continue
+				}
+			}
+			if g.valid(v) {
+				d[digestBucket(k)] ^= digestHash(k, v.updated())
+			}
+		}
+	}
+	return d
+}
+
+// SyncFrom copies the live entries of other written after the local copy of their key, last write wins by UpdatedAt
+// tracked by WithWriteTimestamps on both caches. Only the buckets whose Digest differs are streamed from other, copied entries keep their write time and
+// expiration so a second sync copies nothing. Deletions are not propagated. It returns the number of copied entries.
+func (g *gache[V]) SyncFrom(ctx context.Context, other Gache[V]) (int, error) {
+	return syncFrom(ctx, g, other, func(e Entry[V]) bool {
+		return g.storeSynced(e.Key, e)
+	})
+}
+
+// syncFrom implements SyncFrom for g storing the newer entries of other with store
+func syncFrom[V any](ctx context.Context, g, other Gache[V], store func(Entry[V]) bool) (n int, err error) {
+	local, remote := g.Digest(ctx), other.Digest(ctx)
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	var diff [digestBuckets]bool
+	differ := false
+	for i := range diff {
+		diff[i] = i >= len(local) || i >= len(remote) || local[i] != remote[i]
+		differ = differ || diff[i]
+	}
+	if !differ {
+		return 0, nil
+	}
+	for e := range other.Stream(ctx) {
+		if diff[digestBucket(e.Key)] && store(e) {
+			n++
+		}
+	}
+	return n, ctx.Err()
+}
+
+// storeSynced stores e as key unless the local copy was written at the same time or later
+func (g *gache[V]) storeSynced(key string, e Entry[V]) bool {
+	var updated int64
+	if !e.UpdatedAt.IsZero() {
+		updated = e.UpdatedAt.UnixNano()
+	}
+	_, ok := g.update(g.shard(key), key, func(old *value[V]) (*value[V], bool) {
+		if old != nil && g.valid(old) && old.updated() >= updated {
+			return nil, false
+		}
+		v := &value[V]{expire: e.Expire, val: e.Value}
+		if updated != 0 {
+			v.meta = new(entryMeta)
+			v.meta.updated.Store(updated)
+		}
+		return v, true
+	})
+	return ok
+}
+
+// updated returns the write time of v tracked by WithWriteTimestamps, 0 when it is not tracked
+func (v *value[V]) updated() int64 {
+	if v.meta == nil {
+		return 0
+	}
+	return v.meta.updated.Load()
+}
+
+func digestBucket(key string) int {
+	return int(xxh3.HashString(key) >> 56)
+}
+
+// digestHash mixes the hash of key with its write time with the splitmix64 finalizer
+func digestHash(key string, updated int64) uint64 {
+	h := xxh3.HashString(key) ^ uint64(updated)
+	h = (h ^ h>>30) * 0xbf58476d1ce4e5b9
+	h = (h ^ h>>27) * 0x94d049bb133111eb
+	return h ^ h>>31
+}
@@ -0,0 +1,106 @@
+package gache
+
+import (
+	"slices"
+	"time"
+)
+
+// SetWithTags sets key-value & expiration to Gache and attaches tags used by InvalidateTag.
+// Tags are bound to the stored entry, overwriting the key without tags detaches it from its previous tags.
+func (g *gache[V]) SetWithTags(key string, val V, expire time.Duration, tags ...string) {
+	if g.frozen.Load() || g.rejected(key) {
+		return
+	}
+	tags = slices.Clone(tags)
+	var meta *entryMeta
+	if len(tags) != 0 {
+		meta = &entryMeta{tags: tags}
+	}
+	shard := g.shard(key)
+	if _, ok := g.update(shard, key, func(*value[V]) (*value[V], bool) {
+		return &value[V]{
+			expire: absExpire(expire.Nanoseconds()),
+			meta:   meta,
+			val:    val,
+		}, true
+	}); !ok {
+		return
+	}
+	// registered once stored so a concurrent removal of the previous entry cannot drop the new registration
+	for _, tag := range tags {
+		g.tagKey(tag, key)
+	}
+	// the entry may be replaced or removed before its tags are registered
+	if cur, ok := shard.Load(key); !ok || cur.meta != meta {
+		g.untag(key, &value[V]{meta: meta}, nil)
+	}
+}
+
+// tagKey registers key in the key set of tag
+func (g *gache[V]) tagKey(tag, key string) {
+	for {
+		keys, _ := g.tags.LoadOrStore(tag, new(Map[string, bool]))
+		keys.Store(key, true)
+		// retry when InvalidateTag replaced the key set concurrently
+		if cur, ok := g.tags.Load(tag); ok && cur == keys {
+			return
+		}
+	}
+}
+
+// untag drops key from the key sets of the tags of old not carried by val and deletes the key sets left empty
+func (g *gache[V]) untag(key string, old, val *value[V]) {
+	if old == nil || old.meta == nil || len(old.meta.tags) == 0 || val != nil && val.meta == old.meta {
+		return
+	}
+	for _, tag := range old.meta.tags {
+		if val != nil && val.meta != nil && slices.Contains(val.meta.tags, tag) {
+			continue
+		}
+		keys, ok := g.tags.Load(tag)
+		if !ok {
+			continue
+		}
+		keys.Delete(key)
+		// a concurrent write may have stored key with tag before the delete
+		if cur, ok := g.shard(key).Load(key); ok && cur.meta != nil && slices.Contains(cur.meta.tags, tag) {
+			g.tagKey(tag, key)
+			continue
+		}
+		empty := true
+		keys.Range(func(string, bool) bool {
+			empty = false
+			return false
+		})
+		if empty {
+			g.tags.CompareAndDelete(tag, keys)
+		}
+	}
+}
+
+// InvalidateTag deletes all entries carrying tag and returns the number of deleted live entries
+func (g *gache[V]) InvalidateTag(tag string) (rows uint64) {
+	if g.frozen.Load() {
+		return 0
+	}
+	keys, ok := g.tags.LoadAndDelete(tag)
+	if !ok {
+		return 0
+	}
+	keys.Range(func(key string, _ bool) bool {
+		shard := g.shard(key)
+		for {
+			val, ok := shard.Load(key)
+			if !ok || val.meta == nil || !slices.Contains(val.meta.tags, tag) {
+				return true
+			}
+			if g.compareAndDelete(shard, key, val) {
+				if g.valid(val) {
+					rows++
+				}
+				return true
+			}
+		}
+	})
+	return rows
+}
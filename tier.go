@@ -0,0 +1,88 @@
+package gache
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/kpango/fastime"
+)
+
+// Tier is a second level store receiving the entries evicted from memory by WithMaxEntries, WithMaxCost or WithMaxMemory,
+// values are encoded by the codec of WithCodec and expire is the unix nano expiration, zero or negative for none.
+// An implementation backed by bbolt lives in the tier/bbolt module.
+type Tier interface {
+	Get(key string) ([]byte, bool, error)
+	Set(key string, value []byte, expire int64) error
+	Delete(key string) error
+}
+
+// spill moves the evicted value v of key to the tier before it is deleted from memory
+func (g *gache[V]) spill(key string, v *value[V]) {
+	if g.tier == nil || !g.valid(v) {
+		return
+	}
+	b, err := g.snapshotCodec().Marshal(v.val)
+	if err == nil {
+		err = g.tier.Set(key, b, v.expire)
+	}
+	if err != nil {
+		g.log(context.Background(), slog.LevelWarn, "gache: tier write failed", "key", key, "error", err)
+		return
+	}
+	g.spilled.Store(key, v.expire)
+}
+
+// unspill deletes the tier copy of key, it is called for every write and deletion so memory and tier never both hold a key
+func (g *gache[V]) unspill(key string) {
+	if g.tier == nil {
+		return
+	}
+	if _, loaded := g.spilled.LoadAndDelete(key); loaded {
+		if err := g.tier.Delete(key); err != nil {
+			g.log(context.Background(), slog.LevelWarn, "gache: tier delete failed", "key", key, "error", err)
+		}
+	}
+}
+
+// promote reads key back from the tier into memory on a miss
+func (g *gache[V]) promote(shard *Map[string, *value[V]], key string) (v V, expire int64, ok bool) {
+	expire, ok = g.spilled.Load(key)
+	if !ok {
+		return v, 0, false
+	}
+	if expire > 0 && expire < fastime.UnixNanoNow() {
+		g.unspill(key)
+		return v, 0, false
+	}
+	b, ok, err := g.tier.Get(key)
+	if err == nil && ok {
+		err = g.snapshotCodec().Unmarshal(b, &v)
+	}
+	if err != nil || !ok {
+		if err != nil {
+			g.log(context.Background(), slog.LevelWarn, "gache: tier read failed", "key", key, "error", err)
+		}
+		g.unspill(key)
+		return v, 0, false
+	}
+	_, ok = g.update(shard, key, func(old *value[V]) (*value[V], bool) {
+		if old != nil && g.valid(old) {
+			return nil, false
+		}
+		return &value[V]{expire: expire, val: v}, true
+	})
+	return v, expire, ok
+}
+
+// deleteSpilled deletes the tier copies of all keys, expired only removes the expired ones
+func (g *gache[V]) deleteSpilled(expired bool) {
+	if g.tier == nil {
+		return
+	}
+	now := fastime.UnixNanoNow()
+	for key, expire := range g.spilled.RangeIter() {
+		if !expired || expire > 0 && expire < now {
+			g.unspill(key)
+		}
+	}
+}
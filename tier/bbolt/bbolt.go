@@ -0,0 +1,82 @@
+// Package bbolt provides a gache.Tier backed by a bbolt database.
+// It lives in its own module so the core gache package stays free of the bbolt dependency.
+package bbolt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var bucket = []byte("gache")
+
+// Tier stores spilled entries in a bbolt database, every value is prefixed by its 8 byte unix nano expiration
+type Tier struct {
+	db *bolt.DB
+}
+
+// Open opens the database at path for Tier and drops the entries of a previous process,
+// the tier extends the memory of a running cache and is not a persistence layer
+func Open(path string) (*Tier, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second, NoSync: true})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket(bucket) != nil {
+			if err := tx.DeleteBucket(bucket); err != nil {
+				return err
+			}
+		}
+		_, err := tx.CreateBucket(bucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Tier{db: db}, nil
+}
+
+// Get implements gache.Tier
+func (t *Tier) Get(key string) (value []byte, ok bool, err error) {
+	err = t.db.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket(bucket).Get([]byte(key)); len(b) >= 8 {
+			value, ok = bytes.Clone(b[8:]), true
+		}
+		return nil
+	})
+	return value, ok, err
+}
+
+// Set implements gache.Tier
+func (t *Tier) Set(key string, value []byte, expire int64) error {
+	b := binary.BigEndian.AppendUint64(make([]byte, 0, 8+len(value)), uint64(expire))
+	b = append(b, value...)
+	return t.db.Batch(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucket).Put([]byte(key), b)
+	})
+}
+
+// Delete implements gache.Tier
+func (t *Tier) Delete(key string) error {
+	return t.db.Batch(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucket).Delete([]byte(key))
+	})
+}
+
+// Len returns the number of stored entries
+func (t *Tier) Len() (n int) {
+	t.db.View(func(tx *bolt.Tx) error {
+		n = tx.Bucket(bucket).Stats().KeyN
+		return nil
+	})
+	return n
+}
+
+// Close closes the database
+func (t *Tier) Close() error {
+	return t.db.Close()
+}
@@ -0,0 +1,45 @@
+package bbolt
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/ntsd/gache/v2"
+)
+
+func TestTier(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tier.db")
+	tier, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := gache.New(gache.WithMaxEntries[string](10), gache.WithTier[string](tier))
+	for i := range 100 {
+		g.Set(string(rune('a'+i%26))+string(rune('0'+i/26)), "value")
+	}
+	if n := tier.Len(); n != 90 {
+		t.Fatalf("tier holds %d entries, want 90", n)
+	}
+	if v, ok := g.Get("a0"); !ok || v != "value" {
+		t.Fatalf("Get of spilled key = %q, %v", v, ok)
+	}
+	if _, ok, err := tier.Get("a0"); ok || err != nil {
+		t.Fatalf("promoted key still in tier, %v", err)
+	}
+	g.Delete("b0")
+	if _, ok := g.Get("b0"); ok {
+		t.Fatal("deleted spilled key readable")
+	}
+	if err := tier.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	tier, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tier.Close()
+	if n := tier.Len(); n != 0 {
+		t.Fatalf("reopened tier holds %d entries", n)
+	}
+}
@@ -0,0 +1,19 @@
+module github.com/ntsd/gache/v2/tier/bbolt
+
+go 1.23.3
+
+require (
+	github.com/ntsd/gache/v2 v2.0.0
+	go.etcd.io/bbolt v1.3.11
+)
+
+require (
+	github.com/klauspost/compress v1.17.11 // indirect
+	github.com/klauspost/cpuid/v2 v2.0.9 // indirect
+	github.com/kpango/fastime v1.1.9 // indirect
+	github.com/zeebo/xxh3 v1.0.2 // indirect
+	golang.org/x/sync v0.10.0 // indirect
+	golang.org/x/sys v0.4.0 // indirect
+)
+
+replace github.com/ntsd/gache/v2 => ../../
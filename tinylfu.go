@@ -0,0 +1,130 @@
+package gache
+
+import (
+	"math/bits"
+
+	"github.com/zeebo/xxh3"
+)
+
+const (
+	// sketchDepth is the number of count-min sketch rows
+	sketchDepth = 4
+	// sketchMax is the saturation value of sketch counters
+	sketchMax = 15
+	// sketchSampleFactor sets the number of increments between agings relative to the cache bound
+	sketchSampleFactor = 10
+	// sketchMaxEntries caps the number of entries a sketch is sized for, 8 MiB of counters
+	sketchMaxEntries = 1 << 20
+)
+
+// tinyLFU estimates key frequencies with a count-min sketch behind a doorkeeper bloom filter,
+// counters are halved and the doorkeeper cleared every sample increments to age old frequencies
+type tinyLFU struct {
+	rows       [sketchDepth][]uint8
+	doorkeeper []uint64
+	mask       uint64
+	additions  uint64
+	sample     uint64
+	hash       func(string) uint64
+}
+
+// newTinyLFU returns a sketch sized for max keys hashing them with hash, xxh3 when it is nil
+func newTinyLFU(max uint64, hash func(string) uint64) *tinyLFU {
+	if hash == nil {
+		hash = xxh3.HashString
+	}
+	width := uint64(1) << bits.Len64(max)
+	if width < 64 {
+		width = 64
+	}
+	t := &tinyLFU{
+		doorkeeper: make([]uint64, width/64),
+		mask:       width - 1,
+		sample:     max * sketchSampleFactor,
+		hash:       hash,
+	}
+	for i := range t.rows {
+		t.rows[i] = make([]uint8, width)
+	}
+	return t
+}
+
+// increment records an occurrence of key
+func (t *tinyLFU) increment(key string) {
+	h := t.hash(key)
+	if !t.admitted(h) {
+		return
+	}
+	for i := range t.rows {
+		if c := &t.rows[i][t.index(h, i)]; *c < sketchMax {
+			*c++
+		}
+	}
+	t.additions++
+	if t.additions >= t.sample {
+		t.age()
+	}
+}
+
+// estimate returns the estimated frequency of key
+func (t *tinyLFU) estimate(key string) uint64 {
+	h := t.hash(key)
+	n := uint8(sketchMax)
+	for i := range t.rows {
+		n = min(n, t.rows[i][t.index(h, i)])
+	}
+	est := uint64(n)
+	if t.contains(h) {
+		est++
+	}
+	return est
+}
+
+// admitted adds h to the doorkeeper and reports whether it was already there
+func (t *tinyLFU) admitted(h uint64) bool {
+	if t.contains(h) {
+		return true
+	}
+	for _, b := range t.bits(h) {
+		t.doorkeeper[b/64] |= 1 << (b % 64)
+	}
+	return false
+}
+
+func (t *tinyLFU) contains(h uint64) bool {
+	for _, b := range t.bits(h) {
+		if t.doorkeeper[b/64]&(1<<(b%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// bits returns the doorkeeper bit positions of h
+func (t *tinyLFU) bits(h uint64) [2]uint64 {
+	return [2]uint64{h & t.mask, (h >> 32) & t.mask}
+}
+
+// index returns the counter position of h in row i
+func (t *tinyLFU) index(h uint64, i int) uint64 {
+	return bits.RotateLeft64(h, i*16) * 0x9E3779B97F4A7C15 >> 32 & t.mask
+}
+
+// age halves all counters and clears the doorkeeper
+func (t *tinyLFU) age() {
+	for i := range t.rows {
+		for j := range t.rows[i] {
+			t.rows[i][j] >>= 1
+		}
+	}
+	clear(t.doorkeeper)
+	t.additions = 0
+}
+
+func (t *tinyLFU) reset() {
+	for i := range t.rows {
+		clear(t.rows[i])
+	}
+	clear(t.doorkeeper)
+	t.additions = 0
+}
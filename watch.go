@@ -0,0 +1,163 @@
+package gache
+
+import (
+	"cmp"
+	"context"
+	"log/slog"
+	"regexp"
+	"slices"
+	"sync"
+	"sync/atomic"
+)
+
+// EventType is the kind of change reported by an Event
+type EventType int
+
+const (
+	// EventCreated is emitted when an absent key is set
+	EventCreated EventType = iota
+	// EventUpdated is emitted when a live key is overwritten
+	EventUpdated
+	// EventExpired is emitted when an expired key is removed
+	EventExpired
+	// EventDeleted is emitted when a live key is deleted, evicted or cleared
+	EventDeleted
+)
+
+type (
+	// Event is a change of a key delivered by Watch and Events, Value is the new value or the removed one.
+	// Seq increases by one for every event emitted while the cache is watched or keeps a history.
+	Event[V any] struct {
+		Seq   uint64
+		Type  EventType
+		Key   string
+		Value V
+	}
+
+	// history is the ring buffer of the last events enabled by WithEventHistory
+	history[V any] struct {
+		mu     sync.Mutex
+		events []Event[V]
+		next   int
+		full   bool
+	}
+
+	// watchers holds the Watch subscriptions
+	watchers[V any] struct {
+		mu   sync.RWMutex
+		subs map[*watcher[V]]bool
+		n    atomic.Int64
+		seq  atomic.Uint64
+	}
+
+	watcher[V any] struct {
+		re *regexp.Regexp
+		ch chan Event[V]
+	}
+)
+
+// String returns the name of the event type
+func (t EventType) String() string {
+	switch t {
+	case EventCreated:
+		return "Created"
+	case EventUpdated:
+		return "Updated"
+	case EventExpired:
+		return "Expired"
+	case EventDeleted:
+		return "Deleted"
+	}
+	return "Unknown"
+}
+
+// Watch delivers events of keys matching the glob pattern to the returned channel until ctx is canceled.
+// Events are dropped when the subscriber falls more than streamBufferSize events behind, so writers never block on it.
+func (g *gache[V]) Watch(ctx context.Context, pattern string) <-chan Event[V] {
+	return g.watch(ctx, globRegexp(pattern))
+}
+
+// watch subscribes to events of keys matching re
+func (g *gache[V]) watch(ctx context.Context, re *regexp.Regexp) chan Event[V] {
+	w := &watcher[V]{
+		re: re,
+		ch: make(chan Event[V], streamBufferSize),
+	}
+	g.watchers.mu.Lock()
+	if g.watchers.subs == nil {
+		g.watchers.subs = make(map[*watcher[V]]bool)
+	}
+	g.watchers.subs[w] = true
+	g.watchers.n.Add(1)
+	g.watchers.mu.Unlock()
+	go func() {
+		<-ctx.Done()
+		g.watchers.mu.Lock()
+		delete(g.watchers.subs, w)
+		g.watchers.n.Add(-1)
+		g.watchers.mu.Unlock()
+		close(w.ch)
+	}()
+	return w.ch
+}
+
+// emit records the event to the history and delivers it to matching watchers
+func (g *gache[V]) emit(typ EventType, key string, val V) {
+	if !g.emitting() {
+		return
+	}
+	e := Event[V]{Type: typ, Key: key, Value: val}
+	if h := g.history; h != nil {
+		// the sequence is taken under the history lock to keep the ring ordered
+		h.mu.Lock()
+		e.Seq = g.watchers.seq.Add(1)
+		h.events[h.next] = e
+		h.next = (h.next + 1) % len(h.events)
+		h.full = h.full || h.next == 0
+		h.mu.Unlock()
+	} else {
+		e.Seq = g.watchers.seq.Add(1)
+	}
+	g.watchers.mu.RLock()
+	defer g.watchers.mu.RUnlock()
+	for w := range g.watchers.subs {
+		if !w.re.MatchString(key) {
+			continue
+		}
+		select {
+		case w.ch <- e:
+		default:
+			g.log(context.Background(), slog.LevelWarn, "gache: watch event dropped", "key", key, "type", typ)
+		}
+	}
+}
+
+// Events returns the retained events with Seq greater than since in order, it requires WithEventHistory.
+// A first event with Seq greater than since+1 means older events were overwritten.
+func (g *gache[V]) Events(since uint64) []Event[V] {
+	h := g.history
+	if h == nil {
+		return nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var events []Event[V]
+	if h.full {
+		events = append(events, h.events[h.next:]...)
+	}
+	events = append(events, h.events[:h.next]...)
+	i, _ := slices.BinarySearchFunc(events, since+1, func(e Event[V], seq uint64) int {
+		return cmp.Compare(e.Seq, seq)
+	})
+	return slices.Clip(events[i:])
+}
+
+// emitting reports whether events are watched or kept in a history
+func (g *gache[V]) emitting() bool {
+	return g.watchers.n.Load() != 0 || g.history != nil
+}
+
+// observed reports whether removed values must be reported one by one
+func (g *gache[V]) observed() bool {
+	return g.evictFunc != nil || g.emitting()
+}